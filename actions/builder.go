@@ -0,0 +1,146 @@
+// Package actions builds the JSON-LD semantic action payloads accepted by
+// POST /v1/api/semantic/action, for clients and tests of the service.
+//
+//	body, err := actions.NewStoreAction().
+//		WithWorkflowID("wf-1").
+//		WithIdentifier("step-1").
+//		WithText(`{"result": 42}`).
+//		WithFormat("application/json").
+//		JSON()
+package actions
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"eve.evalgo.org/semantic"
+)
+
+// Context is the JSON-LD context of every built action
+const Context = "https://schema.org"
+
+// documentType is the @type of the object an action stores or refers to
+const documentType = "DigitalDocument"
+
+// Builder assembles a semantic action. The With methods return the builder
+// so calls can be chained; Build returns a fresh payload on every call.
+type Builder struct {
+	actionType string
+	properties map[string]interface{}
+	object     map[string]interface{}
+}
+
+// New starts an action of the given @type, e.g. "ChecksumAction"
+func New(actionType string) *Builder {
+	return &Builder{
+		actionType: actionType,
+		properties: make(map[string]interface{}),
+	}
+}
+
+// NewStoreAction starts a CreateAction that stores a workflow result
+func NewStoreAction() *Builder {
+	return New("CreateAction")
+}
+
+// NewRetrieveAction starts a RetrieveAction that reads a stored result
+func NewRetrieveAction() *Builder {
+	return New("RetrieveAction")
+}
+
+// NewDeleteAction starts a DeleteAction that removes a stored result
+func NewDeleteAction() *Builder {
+	return New("DeleteAction")
+}
+
+// NewListAction starts a ListAction over a workflow's results
+func NewListAction() *Builder {
+	return New("ListAction")
+}
+
+// WithIdentifier sets the action identifier, which names the result within
+// its workflow. Retrieve and describe actions fall back to it when the
+// object has no identifier of its own.
+func (b *Builder) WithIdentifier(identifier string) *Builder {
+	return b.WithProperty("identifier", identifier)
+}
+
+// WithWorkflowID sets the workflow the result belongs to. Without it the
+// service uses the X-Workflow-ID header or "default".
+func (b *Builder) WithWorkflowID(workflowID string) *Builder {
+	return b.WithProperty("workflowId", workflowID)
+}
+
+// WithText sets the object text, the data a store action persists
+func (b *Builder) WithText(text string) *Builder {
+	return b.withObject("text", text)
+}
+
+// WithContentBase64 sets binary data for a store action, e.g. a tar archive
+func (b *Builder) WithContentBase64(data []byte) *Builder {
+	return b.WithProperty("contentBase64", base64.StdEncoding.EncodeToString(data))
+}
+
+// WithFormat sets the object encodingFormat (content type)
+func (b *Builder) WithFormat(format string) *Builder {
+	return b.withObject("encodingFormat", format)
+}
+
+// WithContentURL refers to a stored result by its s3:// location
+func (b *Builder) WithContentURL(contentURL string) *Builder {
+	return b.withObject("contentUrl", contentURL)
+}
+
+// WithObjectIdentifier sets the identifier of the object the action refers to
+func (b *Builder) WithObjectIdentifier(identifier string) *Builder {
+	return b.withObject("identifier", identifier)
+}
+
+// WithProperty sets an additional top-level property, such as
+// "skipIfUnchanged" or "returnMode"
+func (b *Builder) WithProperty(name string, value interface{}) *Builder {
+	b.properties[name] = value
+	return b
+}
+
+// withObject sets a field of the action object, creating the object on first use
+func (b *Builder) withObject(name string, value interface{}) *Builder {
+	if b.object == nil {
+		b.object = map[string]interface{}{"@type": documentType}
+	}
+	b.object[name] = value
+	return b
+}
+
+// Build returns the action as a JSON-LD map
+func (b *Builder) Build() map[string]interface{} {
+	action := make(map[string]interface{}, len(b.properties)+3)
+	for name, value := range b.properties {
+		action[name] = value
+	}
+	action["@context"] = Context
+	action["@type"] = b.actionType
+	if b.object != nil {
+		object := make(map[string]interface{}, len(b.object))
+		for name, value := range b.object {
+			object[name] = value
+		}
+		action["object"] = object
+	}
+	return action
+}
+
+// JSON returns the action as a request body
+func (b *Builder) JSON() ([]byte, error) {
+	return json.Marshal(b.Build())
+}
+
+// Action returns the action parsed the way the service parses request
+// bodies, for calling handlers directly
+func (b *Builder) Action() (*semantic.SemanticAction, error) {
+	body, err := b.JSON()
+	if err != nil {
+		return nil, err
+	}
+	return semantic.ParseSemanticAction(body)
+}
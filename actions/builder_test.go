@@ -0,0 +1,91 @@
+package actions
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestBuilder_Build(t *testing.T) {
+	got := NewStoreAction().
+		WithWorkflowID("wf-1").
+		WithIdentifier("step-1").
+		WithText(`{"result": 42}`).
+		WithFormat("application/json").
+		WithProperty("skipIfUnchanged", true).
+		Build()
+
+	want := map[string]interface{}{
+		"@context":        "https://schema.org",
+		"@type":           "CreateAction",
+		"identifier":      "step-1",
+		"workflowId":      "wf-1",
+		"skipIfUnchanged": true,
+		"object": map[string]interface{}{
+			"@type":          "DigitalDocument",
+			"text":           `{"result": 42}`,
+			"encodingFormat": "application/json",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Build() = %v, want %v", got, want)
+	}
+}
+
+func TestBuilder_NoObjectUnlessSet(t *testing.T) {
+	got := NewListAction().WithWorkflowID("wf-1").Build()
+	if _, ok := got["object"]; ok {
+		t.Errorf("Build() = %v, should have no object", got)
+	}
+	if got["@type"] != "ListAction" {
+		t.Errorf("@type = %v, want ListAction", got["@type"])
+	}
+}
+
+func TestBuilder_BuildReturnsCopies(t *testing.T) {
+	b := NewRetrieveAction().WithContentURL("s3://bucket/workflow-results/wf-1/a.json")
+	first := b.Build()
+	first["object"].(map[string]interface{})["contentUrl"] = "changed"
+	first["@type"] = "changed"
+
+	second := b.Build()
+	if second["@type"] != "RetrieveAction" || second["object"].(map[string]interface{})["contentUrl"] != "s3://bucket/workflow-results/wf-1/a.json" {
+		t.Errorf("Build() shares state between calls: %v", second)
+	}
+}
+
+func TestBuilder_JSONAndAction(t *testing.T) {
+	b := NewStoreAction().
+		WithIdentifier("archive").
+		WithContentBase64([]byte("binary\x00data")).
+		WithFormat("application/x-tar")
+
+	body, err := b.JSON()
+	if err != nil {
+		t.Fatalf("JSON() error = %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("JSON() is not valid JSON: %v", err)
+	}
+	if decoded["contentBase64"] != "YmluYXJ5AGRhdGE=" {
+		t.Errorf("contentBase64 = %v", decoded["contentBase64"])
+	}
+
+	action, err := b.Action()
+	if err != nil {
+		t.Fatalf("Action() error = %v", err)
+	}
+	if action.Type != "CreateAction" || action.Identifier != "archive" || action.Object == nil || action.Object.EncodingFormat != "application/x-tar" {
+		t.Errorf("Action() = %+v", action)
+	}
+	if action.Properties["contentBase64"] != "YmluYXJ5AGRhdGE=" {
+		t.Errorf("Action() properties = %v", action.Properties)
+	}
+}
+
+func TestBuilder_JSONRejectsUnencodableProperty(t *testing.T) {
+	if _, err := New("CreateAction").WithProperty("bad", make(chan int)).JSON(); err == nil {
+		t.Error("JSON() should fail for a property that cannot be encoded")
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// accessStatsPrefix holds the access sidecars, outside the result prefix
+	// so listings never include them
+	accessStatsPrefix = "access-stats"
+	// defaultAccessFlushInterval is used when WORKFLOW_STORAGE_ACCESS_FLUSH_INTERVAL is unset
+	defaultAccessFlushInterval = 30 * time.Second
+)
+
+// accessStats is the persisted access record of one object
+type accessStats struct {
+	AccessCount    int64     `json:"accessCount"`
+	LastAccessed   time.Time `json:"lastAccessed"`
+	LastAccessedBy string    `json:"lastAccessedBy"`
+}
+
+// accessTracker counts retrieves per object when WORKFLOW_STORAGE_ACCESS_TRACKING
+// is enabled. Reads only update an in-memory delta; the deltas are merged
+// into a JSON sidecar per object ({accessStatsPrefix}/{key}.json in the same
+// bucket) every WORKFLOW_STORAGE_ACCESS_FLUSH_INTERVAL, so a burst of reads
+// costs one sidecar write. Object metadata is not used because rewriting it
+// would change the object's Last-Modified. Deltas not yet flushed are lost
+// when the process is killed.
+type accessTracker struct {
+	mu      sync.Mutex
+	pending map[string]*pendingAccess
+}
+
+// pendingAccess is the unflushed access delta of one object
+type pendingAccess struct {
+	bucket string
+	key    string
+	stats  accessStats
+}
+
+// accessLog is the service-wide access tracker
+var accessLog = &accessTracker{pending: make(map[string]*pendingAccess)}
+
+// accessTrackingEnabled reports whether WORKFLOW_STORAGE_ACCESS_TRACKING is on
+func accessTrackingEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("WORKFLOW_STORAGE_ACCESS_TRACKING"))
+	return enabled
+}
+
+// accessFlushInterval returns the configured flush interval
+func accessFlushInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("WORKFLOW_STORAGE_ACCESS_FLUSH_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return defaultAccessFlushInterval
+	}
+	return interval
+}
+
+// accessStatsKey returns the sidecar key of an object
+func accessStatsKey(key string) string {
+	return accessStatsPrefix + "/" + key + ".json"
+}
+
+// apiKeyFingerprint identifies the caller without storing the API key: the
+// first 12 hex characters of its SHA-256, or "anonymous" without a key
+func apiKeyFingerprint(c echo.Context) string {
+	apiKey := c.Request().Header.Get("X-API-Key")
+	if apiKey == "" {
+		return "anonymous"
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// record counts one successful retrieve of bucket/key by the calling API key
+func (a *accessTracker) record(c echo.Context, bucket, key string) {
+	if !accessTrackingEnabled() {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id := bucket + "/" + key
+	entry, ok := a.pending[id]
+	if !ok {
+		entry = &pendingAccess{bucket: bucket, key: key}
+		a.pending[id] = entry
+	}
+	entry.stats.AccessCount++
+	entry.stats.LastAccessed = time.Now().UTC()
+	entry.stats.LastAccessedBy = apiKeyFingerprint(c)
+}
+
+// forget drops the unflushed delta of bucket/key, e.g. after a delete
+func (a *accessTracker) forget(bucket, key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.pending, bucket+"/"+key)
+}
+
+// unflushed returns the pending delta of bucket/key
+func (a *accessTracker) unflushed(bucket, key string) (accessStats, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry, ok := a.pending[bucket+"/"+key]
+	if !ok {
+		return accessStats{}, false
+	}
+	return entry.stats, true
+}
+
+// stats returns the persisted access record of bucket/key merged with the
+// delta that has not been flushed yet
+func (a *accessTracker) stats(ctx context.Context, store Storage, bucket, key string) (accessStats, error) {
+	stats, err := readAccessStats(ctx, store, bucket, key)
+	if err != nil {
+		return accessStats{}, err
+	}
+	if delta, ok := a.unflushed(bucket, key); ok {
+		stats = mergeAccessStats(stats, delta)
+	}
+	return stats, nil
+}
+
+// flush merges every pending delta into its sidecar. Deltas that fail to
+// persist are kept for the next flush.
+func (a *accessTracker) flush(ctx context.Context, store Storage) {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = make(map[string]*pendingAccess)
+	a.mu.Unlock()
+
+	for id, entry := range pending {
+		if err := persistAccess(ctx, store, entry.bucket, entry.key, entry.stats); err != nil {
+			log.Printf("Failed to persist access stats for %s: %v", id, err)
+			a.requeue(entry)
+		}
+	}
+}
+
+// requeue merges a delta that failed to persist back into the pending set
+func (a *accessTracker) requeue(entry *pendingAccess) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id := entry.bucket + "/" + entry.key
+	if current, ok := a.pending[id]; ok {
+		current.stats = mergeAccessStats(entry.stats, current.stats)
+		return
+	}
+	a.pending[id] = entry
+}
+
+// run flushes pending deltas every interval until ctx is done, then flushes
+// once more
+func (a *accessTracker) run(ctx context.Context, store Storage, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.flush(ctx, store)
+		case <-ctx.Done():
+			a.flush(context.Background(), store)
+			return
+		}
+	}
+}
+
+// persistAccess adds delta to the sidecar of bucket/key
+func persistAccess(ctx context.Context, store Storage, bucket, key string, delta accessStats) error {
+	sidecar := accessStatsKey(key)
+	unlock := objectLocks.Lock(bucket, sidecar)
+	defer unlock()
+
+	stats, err := readAccessStats(ctx, store, bucket, key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(mergeAccessStats(stats, delta))
+	if err != nil {
+		return err
+	}
+	_, err = store.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(sidecar),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// readAccessStats loads the sidecar of bucket/key; a missing sidecar is an
+// object that has never been read
+func readAccessStats(ctx context.Context, store Storage, bucket, key string) (accessStats, error) {
+	var stats accessStats
+	result, err := store.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(accessStatsKey(key)),
+	})
+	if err != nil {
+		if isNotFoundError(err) {
+			return stats, nil
+		}
+		return stats, err
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return stats, err
+	}
+	err = json.Unmarshal(data, &stats)
+	return stats, err
+}
+
+// deleteAccessStats removes the sidecar of a deleted object
+func deleteAccessStats(ctx context.Context, store Storage, bucket, key string) error {
+	accessLog.forget(bucket, key)
+	_, err := store.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(accessStatsKey(key)),
+	})
+	if err != nil && !isNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
+// mergeAccessStats adds the counts of delta to stats and keeps the most
+// recent access
+func mergeAccessStats(stats, delta accessStats) accessStats {
+	stats.AccessCount += delta.AccessCount
+	if delta.LastAccessed.After(stats.LastAccessed) {
+		stats.LastAccessed = delta.LastAccessed
+		stats.LastAccessedBy = delta.LastAccessedBy
+	}
+	return stats
+}
+
+// setAccessHeaders adds the access record of bucket/key to a HEAD response
+func setAccessHeaders(c echo.Context, store Storage, bucket, key string) {
+	if !accessTrackingEnabled() || strings.HasPrefix(key, accessStatsPrefix+"/") {
+		return
+	}
+	stats, err := accessLog.stats(c.Request().Context(), store, bucket, key)
+	if err != nil {
+		logf(c, "Failed to read access stats for %s: %v", key, err)
+		return
+	}
+
+	header := c.Response().Header()
+	header.Set("X-Access-Count", strconv.FormatInt(stats.AccessCount, 10))
+	if !stats.LastAccessed.IsZero() {
+		header.Set("X-Last-Accessed", stats.LastAccessed.Format(time.RFC3339))
+		header.Set("X-Last-Accessed-By", stats.LastAccessedBy)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestAccessTracker_BatchesReads(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_ACCESS_TRACKING", "true")
+
+	e := echo.New()
+	store := newFakeStorage()
+	tracker := &accessTracker{pending: make(map[string]*pendingAccess)}
+
+	read := func(apiKey string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		tracker.record(e.NewContext(req, httptest.NewRecorder()), "bucket", "results/a.json")
+	}
+
+	read("")
+	read("secret")
+	if len(store.objects) != 0 {
+		t.Fatalf("Reads wrote %d objects before a flush", len(store.objects))
+	}
+
+	ctx := context.Background()
+	stats, err := tracker.stats(ctx, store, "bucket", "results/a.json")
+	if err != nil {
+		t.Fatalf("stats() error = %v", err)
+	}
+	if stats.AccessCount != 2 {
+		t.Errorf("Unflushed AccessCount = %d, want 2", stats.AccessCount)
+	}
+
+	tracker.flush(ctx, store)
+	if _, ok := store.objects["bucket/"+accessStatsKey("results/a.json")]; !ok {
+		t.Fatal("flush() did not write the sidecar")
+	}
+
+	read("secret")
+	tracker.flush(ctx, store)
+
+	stats, err = tracker.stats(ctx, store, "bucket", "results/a.json")
+	if err != nil {
+		t.Fatalf("stats() error = %v", err)
+	}
+	if stats.AccessCount != 3 {
+		t.Errorf("AccessCount = %d, want 3", stats.AccessCount)
+	}
+	if stats.LastAccessedBy == "" || stats.LastAccessedBy == "secret" || len(stats.LastAccessedBy) != 12 {
+		t.Errorf("LastAccessedBy = %q, want a 12 character fingerprint", stats.LastAccessedBy)
+	}
+	if time.Since(stats.LastAccessed) > time.Minute {
+		t.Errorf("LastAccessed = %v, want a recent time", stats.LastAccessed)
+	}
+}
+
+func TestAccessTracker_Disabled(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_ACCESS_TRACKING", "")
+
+	tracker := &accessTracker{pending: make(map[string]*pendingAccess)}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	tracker.record(echo.New().NewContext(req, httptest.NewRecorder()), "bucket", "key")
+
+	if len(tracker.pending) != 0 {
+		t.Errorf("Disabled tracker recorded %d entries", len(tracker.pending))
+	}
+}
+
+func TestFetchHead_AccessHeaders(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_ACCESS_TRACKING", "true")
+
+	e := echo.New()
+	store := newFakeStorage()
+	bucket := defaultBucket()
+	store.objects[bucket+"/report.json"] = fakeObject{data: []byte(`{}`), contentType: "application/json", modified: time.Now()}
+	defer accessLog.forget(bucket, "report.json")
+
+	reader := httptest.NewRequest(http.MethodGet, "/v1/api/fetch/report.json", nil)
+	reader.Header.Set("X-API-Key", "secret")
+	readerCtx := e.NewContext(reader, httptest.NewRecorder())
+	accessLog.record(readerCtx, bucket, "report.json")
+
+	req := httptest.NewRequest(http.MethodHead, "/v1/api/fetch/report.json", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("key")
+	c.SetParamValues("report.json")
+	c.Set(storageContextKey, store)
+
+	if err := handleFetchHead(c); err != nil {
+		t.Fatalf("handleFetchHead() error = %v", err)
+	}
+	if got := rec.Header().Get("X-Access-Count"); got != "1" {
+		t.Errorf("X-Access-Count = %q, want 1", got)
+	}
+	if rec.Header().Get("X-Last-Accessed-By") != apiKeyFingerprint(readerCtx) {
+		t.Errorf("X-Last-Accessed-By = %q, want the fingerprint of the reading key", rec.Header().Get("X-Last-Accessed-By"))
+	}
+}
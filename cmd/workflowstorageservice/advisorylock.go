@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// lockKeyPrefix holds the lock markers, outside the result prefix so
+	// listings never include them
+	lockKeyPrefix = "lock"
+
+	// metadataLockOwner and metadataLockExpiresAt record who holds a lock
+	// marker and until when (RFC 3339)
+	metadataLockOwner     = "lock-owner"
+	metadataLockExpiresAt = "lock-expires-at"
+
+	// defaultLockTTL is used when LockAction has no ttlSeconds
+	defaultLockTTL = 5 * time.Minute
+	// maxLockTTL bounds ttlSeconds so a crashed owner cannot block writers
+	// for long
+	maxLockTTL = 24 * time.Hour
+)
+
+// errLocked is returned when a write targets an object locked by another owner
+var errLocked = errors.New("object is locked")
+
+// lockError describes the active lock that rejected a write. It matches
+// errLocked.
+type lockError struct {
+	owner     string
+	expiresAt time.Time
+}
+
+func (e *lockError) Error() string {
+	return fmt.Sprintf("object is locked by %s until %s", e.owner, e.expiresAt.Format(time.RFC3339))
+}
+
+func (e *lockError) Is(target error) bool {
+	return target == errLocked
+}
+
+// lockedResponse is the 423 response for writes to locked objects; err is the
+// error returned by checkLock
+func lockedResponse(key string, err error) error {
+	return echo.NewHTTPError(http.StatusLocked, err.Error()+": "+key)
+}
+
+// lockKey returns the key of the lock marker of an object
+func lockKey(key string) string {
+	return lockKeyPrefix + "/" + key
+}
+
+// activeLock returns the unexpired lock on bucket/key, if any. Expired
+// markers are ignored until they are replaced or removed.
+func activeLock(ctx context.Context, store Storage, bucket, key string) (*lockError, error) {
+	head, err := store.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(lockKey(key)),
+	})
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	expiresAt, err := time.Parse(time.RFC3339, head.Metadata[metadataLockExpiresAt])
+	if err != nil || !time.Now().Before(expiresAt) {
+		return nil, nil
+	}
+	return &lockError{owner: head.Metadata[metadataLockOwner], expiresAt: expiresAt}, nil
+}
+
+// checkLock returns a lockError if bucket/key has an active lock held by
+// someone other than owner, unless the request carries an admin override.
+// Writers pass the lockOwner property of their action; an empty owner never
+// holds a lock.
+func checkLock(ctx context.Context, c echo.Context, store Storage, bucket, key, owner string) error {
+	if hasAdminOverride(c) {
+		return nil
+	}
+	lock, err := activeLock(ctx, store, bucket, key)
+	if err != nil {
+		return err
+	}
+	if lock != nil && lock.owner != owner {
+		return lock
+	}
+	return nil
+}
+
+// lockTarget resolves the object a LockAction or UnlockAction refers to
+func lockTarget(c echo.Context, action *semantic.SemanticAction) (string, string, error) {
+	if action.Object == nil || action.Object.ContentUrl == "" {
+		return "", "", returnActionError(c, action, "object.contentUrl is required (resource s3:// location)", nil)
+	}
+	bucket, key, err := parseContentURL(action.Object.ContentUrl)
+	if err != nil {
+		return "", "", returnActionError(c, action, err.Error(), nil)
+	}
+	if err := checkTenantScope(c, key); err != nil {
+		return "", "", err
+	}
+	return bucket, key, nil
+}
+
+// handleSemanticLockImpl acquires or renews an advisory lock on an object by
+// writing a marker ({lockKeyPrefix}/{key}) with the lockOwner and an expiry
+// ttlSeconds from now. Stores, updates, copies and deletes by other owners
+// are rejected with 423 Locked until the lock is released or expires. The
+// object itself need not exist yet.
+//
+// Locks are only serialized within this instance; two instances acquiring
+// the same free lock at the same moment can both succeed.
+func handleSemanticLockImpl(c echo.Context, action *semantic.SemanticAction) error {
+	bucket, key, err := lockTarget(c, action)
+	if err != nil {
+		return err
+	}
+
+	owner := strings.TrimSpace(stringProperty(action, "lockOwner"))
+	if owner == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "lockOwner is required")
+	}
+	ttl := defaultLockTTL
+	if seconds, ok := int64Property(action, "ttlSeconds"); ok {
+		ttl = time.Duration(seconds) * time.Second
+		if ttl <= 0 || ttl > maxLockTTL {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("ttlSeconds must be between 1 and %d", int64(maxLockTTL.Seconds())))
+		}
+	}
+
+	store := storageFor(c)
+	ctx := c.Request().Context()
+
+	unlock := objectLocks.Lock(bucket, key)
+	defer unlock()
+
+	if err := checkLock(ctx, c, store, bucket, key, owner); err != nil {
+		if errors.Is(err, errLocked) {
+			return lockedResponse(key, err)
+		}
+		return returnActionError(c, action, "Failed to check lock", err)
+	}
+
+	expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	if _, err := store.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(lockKey(key)),
+		Body:        strings.NewReader(""),
+		ContentType: aws.String("application/octet-stream"),
+		Metadata: map[string]string{
+			metadataLockOwner:     owner,
+			metadataLockExpiresAt: expiresAt.Format(time.RFC3339),
+		},
+	}); err != nil {
+		return returnActionError(c, action, "Failed to write lock", err)
+	}
+
+	logf(c, "Locked %s for %s until %s", key, owner, expiresAt.Format(time.RFC3339))
+
+	action.Result = &semantic.SemanticResult{
+		Type: "DigitalDocument",
+		Value: map[string]interface{}{
+			"contentUrl": action.Object.ContentUrl,
+			"lockOwner":  owner,
+			"expiresAt":  expiresAt.Format(time.RFC3339),
+		},
+	}
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// handleSemanticLock wraps the implementation to match ActionHandler signature
+func handleSemanticLock(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticLockImpl(c, action)
+}
+
+// handleSemanticUnlockImpl releases an advisory lock. Only its owner (or an
+// admin override) may release an active lock; releasing a lock that is not
+// held succeeds and reports unlocked: false.
+func handleSemanticUnlockImpl(c echo.Context, action *semantic.SemanticAction) error {
+	bucket, key, err := lockTarget(c, action)
+	if err != nil {
+		return err
+	}
+	owner := strings.TrimSpace(stringProperty(action, "lockOwner"))
+
+	store := storageFor(c)
+	ctx := c.Request().Context()
+
+	unlock := objectLocks.Lock(bucket, key)
+	defer unlock()
+
+	lock, err := activeLock(ctx, store, bucket, key)
+	if err != nil {
+		return returnActionError(c, action, "Failed to check lock", err)
+	}
+	if lock != nil && lock.owner != owner && !hasAdminOverride(c) {
+		return lockedResponse(key, lock)
+	}
+
+	// Expired markers are removed too
+	if _, err := store.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(lockKey(key)),
+	}); err != nil && !isNotFoundError(err) {
+		return returnActionError(c, action, "Failed to remove lock", err)
+	}
+	if lock != nil {
+		logf(c, "Unlocked %s held by %s", key, lock.owner)
+	}
+
+	action.Result = &semantic.SemanticResult{
+		Type: "DigitalDocument",
+		Value: map[string]interface{}{
+			"contentUrl": action.Object.ContentUrl,
+			"unlocked":   lock != nil,
+		},
+	}
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// handleSemanticUnlock wraps the implementation to match ActionHandler signature
+func handleSemanticUnlock(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticUnlockImpl(c, action)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+	"workflowstorageservice.evalgo.org/actions"
+)
+
+func TestAdvisoryLocks(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_ADMIN_KEY", "admin-secret")
+
+	e := echo.New()
+	store := newFakeStorage()
+	contentURL := "s3://" + defaultBucket() + "/workflow-results/wf-1/shared.json"
+	run := func(b *actions.Builder, handler func(echo.Context, *semantic.SemanticAction) error, adminKey string) (*semantic.SemanticAction, error) {
+		t.Helper()
+		action, err := b.Action()
+		if err != nil {
+			t.Fatalf("Action() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		if adminKey != "" {
+			req.Header.Set(adminOverrideHeader, adminKey)
+		}
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return action, handler(c, action)
+	}
+	lock := func(owner string) *actions.Builder {
+		return actions.New("LockAction").WithContentURL(contentURL).WithProperty("lockOwner", owner)
+	}
+	unlock := func(owner string) *actions.Builder {
+		return actions.New("UnlockAction").WithContentURL(contentURL).WithProperty("lockOwner", owner)
+	}
+	write := func(owner string) *actions.Builder {
+		return actions.NewStoreAction().WithWorkflowID("wf-1").WithIdentifier("shared").WithText(`{"by": "`+owner+`"}`).WithProperty("lockOwner", owner)
+	}
+	assertLocked := func(name string, err error) {
+		t.Helper()
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != http.StatusLocked {
+			t.Errorf("%s: error = %v, want 423", name, err)
+		}
+	}
+
+	action, err := run(lock("writer-a").WithProperty("ttlSeconds", 60), handleSemanticLockImpl, "")
+	if err != nil {
+		t.Fatalf("Lock error = %v", err)
+	}
+	value := action.Result.Value.(map[string]interface{})
+	marker, ok := store.objects[defaultBucket()+"/lock/workflow-results/wf-1/shared.json"]
+	if value["lockOwner"] != "writer-a" || !ok || marker.metadata[metadataLockOwner] != "writer-a" {
+		t.Fatalf("Lock result = %v, marker %v", value, marker.metadata)
+	}
+
+	// Only the owner writes while the lock is held
+	_, err = run(write("writer-b"), handleSemanticStoreImpl, "")
+	assertLocked("Store by another owner", err)
+	if _, err := run(write("writer-a"), handleSemanticStoreImpl, ""); err != nil {
+		t.Errorf("Store by the owner error = %v", err)
+	}
+	_, err = run(actions.NewDeleteAction().WithContentURL(contentURL).WithProperty("lockOwner", "writer-b"), handleSemanticDeleteImpl, "")
+	assertLocked("Delete by another owner", err)
+	_, err = run(lock("writer-b"), handleSemanticLockImpl, "")
+	assertLocked("Lock by another owner", err)
+	_, err = run(unlock("writer-b"), handleSemanticUnlockImpl, "")
+	assertLocked("Unlock by another owner", err)
+
+	// An admin override bypasses the lock
+	if _, err := run(write("writer-b"), handleSemanticStoreImpl, "admin-secret"); err != nil {
+		t.Errorf("Store with admin override error = %v", err)
+	}
+
+	action, err = run(unlock("writer-a"), handleSemanticUnlockImpl, "")
+	if err != nil || action.Result.Value.(map[string]interface{})["unlocked"] != true {
+		t.Fatalf("Unlock by the owner = %v", err)
+	}
+	if _, err := run(write("writer-b"), handleSemanticStoreImpl, ""); err != nil {
+		t.Errorf("Store after unlock error = %v", err)
+	}
+
+	// Expired locks are ignored
+	store.objects[defaultBucket()+"/lock/workflow-results/wf-1/shared.json"] = fakeObject{metadata: map[string]string{
+		metadataLockOwner:     "writer-a",
+		metadataLockExpiresAt: time.Now().Add(-time.Minute).Format(time.RFC3339),
+	}}
+	if _, err := run(write("writer-b"), handleSemanticStoreImpl, ""); err != nil {
+		t.Errorf("Store under an expired lock error = %v", err)
+	}
+	if _, err := run(lock("writer-b"), handleSemanticLockImpl, ""); err != nil {
+		t.Errorf("Lock over an expired lock error = %v", err)
+	}
+
+	var httpErr *echo.HTTPError
+	for name, b := range map[string]*actions.Builder{
+		"missing owner": lock(""),
+		"ttl too long":  lock("writer-b").WithProperty("ttlSeconds", 90000),
+		"negative ttl":  lock("writer-b").WithProperty("ttlSeconds", -1),
+	} {
+		if _, err := run(b, handleSemanticLockImpl, ""); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+			t.Errorf("%s: error = %v, want 400", name, err)
+		}
+	}
+}
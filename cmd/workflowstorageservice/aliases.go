@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// parseActionAliases parses WORKFLOW_STORAGE_ACTION_ALIASES, a
+// comma-separated list of alias=ActionType entries, e.g.
+// "SaveAction=CreateAction,GetAction=RetrieveAction". Malformed entries are
+// returned separately so they can be reported once at startup.
+func parseActionAliases(spec string) (map[string]string, []string) {
+	aliases := make(map[string]string)
+	var malformed []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		alias, target, ok := strings.Cut(entry, "=")
+		alias, target = strings.TrimSpace(alias), strings.TrimSpace(target)
+		if !ok || alias == "" || target == "" || strings.ContainsAny(alias, " \t") {
+			malformed = append(malformed, entry)
+			continue
+		}
+		aliases[alias] = target
+	}
+	return aliases, malformed
+}
+
+// actionAliases returns the configured alias to action type mapping
+func actionAliases() map[string]string {
+	aliases, _ := parseActionAliases(os.Getenv("WORKFLOW_STORAGE_ACTION_ALIASES"))
+	return aliases
+}
+
+// registerActionAliases registers every configured alias with the handler of
+// its target action type, so deployments can accept their ecosystem's
+// vocabulary. An alias of a mutating action is mutating too (see
+// checkWritable). Aliases that shadow a registered type or name an unknown
+// target are skipped with a log line rather than stopping the service.
+func registerActionAliases() {
+	aliases := actionAliases()
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+
+	for _, alias := range names {
+		target := aliases[alias]
+		if err := registerActionAlias(alias, target); err != nil {
+			log.Printf("Ignoring WORKFLOW_STORAGE_ACTION_ALIASES entry %s=%s: %v", alias, target, err)
+			continue
+		}
+		log.Printf("Registered action alias %s for %s", alias, target)
+	}
+}
+
+// registerActionAlias makes alias dispatch to the handler of target
+func registerActionAlias(alias, target string) error {
+	handler, ok := serviceActions.lookup(target)
+	if !ok {
+		return fmt.Errorf("unknown action type %s", target)
+	}
+	if err := serviceActions.register(alias, handler); err != nil {
+		return err
+	}
+	supportedActionTypes = append(supportedActionTypes, alias)
+	if mutatingActionTypes[target] {
+		mutatingActionTypes[alias] = true
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseActionAliases(t *testing.T) {
+	aliases, malformed := parseActionAliases(" SaveAction=CreateAction, GetAction = RetrieveAction,broken,=CreateAction,Bad Name=DeleteAction")
+	want := map[string]string{"SaveAction": "CreateAction", "GetAction": "RetrieveAction"}
+	if !reflect.DeepEqual(aliases, want) {
+		t.Errorf("parseActionAliases() = %v, want %v", aliases, want)
+	}
+	if !reflect.DeepEqual(malformed, []string{"broken", "=CreateAction", "Bad Name=DeleteAction"}) {
+		t.Errorf("malformed = %v", malformed)
+	}
+}
+
+func TestActionAlias_DispatchesToTarget(t *testing.T) {
+	resetStorageEnv(t)
+	registerActions()
+
+	if err := registerActionAlias("SaveAction", "CreateAction"); err != nil {
+		t.Fatalf("registerActionAlias() error = %v", err)
+	}
+	t.Cleanup(func() {
+		// The registry is process-wide; drop the alias for other tests
+		serviceActions.mu.Lock()
+		delete(serviceActions.handlers, "SaveAction")
+		serviceActions.mu.Unlock()
+		supportedActionTypes = supportedActionTypes[:len(supportedActionTypes)-1]
+		delete(mutatingActionTypes, "SaveAction")
+	})
+
+	if err := registerActionAlias("SaveAction", "RetrieveAction"); err == nil {
+		t.Error("Registering an alias twice should fail")
+	}
+	if err := registerActionAlias("FrobAction", "NoSuchAction"); err == nil {
+		t.Error("An alias of an unknown action type should fail")
+	}
+
+	e := echo.New()
+	store := newFakeStorage()
+	save := func() (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", strings.NewReader(`{"@type": "SaveAction", "identifier": "aliased",
+			"object": {"@type": "DigitalDocument", "text": "{\"saved\": true}"}}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		return rec, handleSemanticAction(c)
+	}
+
+	if rec, err := save(); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("SaveAction = %v (status %d): %s", err, rec.Code, rec.Body.String())
+	}
+	if _, ok := store.objects[defaultBucket()+"/workflow-results/default/aliased.json"]; !ok {
+		t.Errorf("SaveAction did not store through CreateAction, have %v", keysOf(store.objects))
+	}
+
+	// An alias of a mutating action is rejected in read-only mode
+	t.Setenv("WORKFLOW_STORAGE_READ_ONLY", "true")
+	rec, err := save()
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusForbidden {
+		t.Errorf("SaveAction in read-only mode = %v (status %d), want 403", err, rec.Code)
+	}
+}
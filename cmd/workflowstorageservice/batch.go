@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path"
+	"strings"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// maxBatchRetrieveItems caps the number of objects fetched by one BatchRetrieveAction
+const maxBatchRetrieveItems = 100
+
+// handleSemanticBatchRetrieveImpl fetches several objects listed in
+// action.Properties["contentUrls"] and/or ["identifiers"] (resolved like an
+// identifier-based retrieve). By default the objects are returned as a JSON
+// array on the action result; clients sending Accept: multipart/mixed get a
+// streamed multipart response with one part per object, Accept:
+// application/zip a single streamed ZIP archive and Accept: application/x-tar
+// an uncompressed tar archive.
+func handleSemanticBatchRetrieveImpl(c echo.Context, action *semantic.SemanticAction) error {
+	contentURLs := stringListProperty(action, "contentUrls")
+	for _, identifier := range stringListProperty(action, "identifiers") {
+		route, err := routeAction(c, action, identifier, "")
+		if err != nil {
+			return returnActionError(c, action, "Failed to resolve storage location", err)
+		}
+		contentURLs = append(contentURLs, fmt.Sprintf("s3://%s/%s", route.Bucket, route.Key))
+	}
+	if len(contentURLs) == 0 {
+		return returnActionError(c, action, "contentUrls or identifiers is required (list of s3:// locations or result identifiers)", nil)
+	}
+	if len(contentURLs) > maxBatchRetrieveItems {
+		return returnActionError(c, action, fmt.Sprintf("too many contentUrls (max %d)", maxBatchRetrieveItems), nil)
+	}
+
+	// Validate every URL up front so a streamed response never starts for a bad request
+	objects := make([]Route, len(contentURLs))
+	for i, contentURL := range contentURLs {
+		bucket, key, err := parseContentURL(contentURL)
+		if err != nil {
+			return returnActionError(c, action, fmt.Sprintf("%s: %v", contentURL, err), nil)
+		}
+		if err := checkTenantScope(c, key); err != nil {
+			return err
+		}
+		objects[i] = Route{Bucket: bucket, Key: key}
+	}
+
+	if acceptsZip(c.Request()) {
+		filename := stringProperty(action, "filename")
+		if filename == "" {
+			filename = "export.zip"
+		} else if err := validateFilename(filename); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		compression, err := parseZipCompression(c.QueryParam("compression"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return streamBatchZip(c, filename, compression, contentURLs, objects)
+	}
+	if acceptsTar(c.Request()) {
+		filename := stringProperty(action, "filename")
+		if filename == "" {
+			filename = "export.tar"
+		} else if err := validateFilename(filename); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return streamTar(c, filename, contentURLs, objects, nil)
+	}
+	if acceptsMultipart(c.Request()) {
+		return streamBatchMultipart(c, contentURLs, objects)
+	}
+
+	items := make([]map[string]interface{}, 0, len(objects))
+	for i, object := range objects {
+		item := map[string]interface{}{"contentUrl": contentURLs[i]}
+
+		obj, err := fetchObject(c.Request().Context(), storageFor(c), object.Bucket, object.Key)
+		if err != nil {
+			logf(c, "Failed to fetch %s in batch: %v", object.Key, err)
+			item["error"] = fetchErrorMessage(err)
+			items = append(items, item)
+			continue
+		}
+		data, contentType := obj.data, obj.contentType
+
+		item["encodingFormat"] = contentType
+		item["contentSize"] = int64(len(data))
+		if limit := maxRetrieveInline(); limit > 0 && int64(len(data)) > limit {
+			// Above the server ceiling only a marked preview is inlined
+			data = previewBytes(data, limit)
+			item["truncated"] = true
+			item["previewSize"] = int64(len(data))
+		}
+		if isTextualContentType(contentType) {
+			item["text"] = string(data)
+		} else {
+			item["contentBase64"] = base64.StdEncoding.EncodeToString(data)
+		}
+		items = append(items, item)
+	}
+
+	logf(c, "Fetched %d workflow results via batch retrieve", len(items))
+
+	action.Result = &semantic.SemanticResult{
+		Type: "ItemList",
+		Value: map[string]interface{}{
+			"numberOfItems":   len(items),
+			"itemListElement": items,
+		},
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// streamBatchMultipart writes each object as its own multipart/mixed part.
+// Unencrypted objects are copied straight from S3 without buffering. Objects
+// that cannot be fetched are reported as an application/json error part so
+// the remaining parts are still delivered.
+func streamBatchMultipart(c echo.Context, contentURLs []string, objects []Route) error {
+	mw := multipart.NewWriter(c.Response())
+
+	c.Response().Header().Set(echo.HeaderContentType, "multipart/mixed; boundary="+mw.Boundary())
+	c.Response().WriteHeader(http.StatusOK)
+
+	for i, object := range objects {
+		if err := writeBatchPart(c.Request().Context(), storageFor(c), mw, object.Bucket, contentURLs[i], object.Key); err != nil {
+			// Headers are already sent; the truncated body signals the failure
+			logf(c, "Failed to stream batch part %s: %v", object.Key, err)
+			return nil
+		}
+		c.Response().Flush()
+	}
+
+	if err := mw.Close(); err != nil {
+		logf(c, "Failed to close multipart response: %v", err)
+	}
+
+	logf(c, "Streamed %d workflow results via batch retrieve", len(objects))
+	return nil
+}
+
+// writeBatchPart appends a single object to the multipart response
+func writeBatchPart(ctx context.Context, store Storage, mw *multipart.Writer, bucket, contentURL, key string) error {
+	result, err := store.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		log.Printf("Failed to fetch %s in batch: %v", key, err)
+		return writeBatchErrorPart(mw, contentURL, "data not found")
+	}
+	defer func() {
+		if err := result.Body.Close(); err != nil {
+			log.Printf("Failed to close S3 response body: %v", err)
+		}
+	}()
+
+	contentType := "application/json"
+	if result.ContentType != nil {
+		contentType = *result.ContentType
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", contentType)
+	filename := filenameFromMetadata(result.Metadata)
+	if filename == "" {
+		filename = path.Base(key)
+	}
+	header.Set("Content-Disposition", contentDisposition(filename))
+	header.Set("Content-Location", contentURL)
+
+	var body io.Reader = result.Body
+	if isEncoded(result.Metadata) {
+		// AES-GCM must authenticate the whole ciphertext before releasing plaintext
+		data, err := io.ReadAll(result.Body)
+		if err != nil {
+			return err
+		}
+		plaintext, err := decodePayload(data, result.Metadata)
+		if err != nil {
+			log.Printf("Failed to decrypt %s in batch: %v", key, err)
+			return writeBatchErrorPart(mw, contentURL, "failed to decrypt data")
+		}
+		body = bytes.NewReader(plaintext)
+	}
+
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(part, body)
+	return err
+}
+
+// writeBatchErrorPart reports a per-object failure inside the multipart stream
+func writeBatchErrorPart(mw *multipart.Writer, contentURL, message string) error {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-Location", contentURL)
+
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(part, `{"error":%q,"contentUrl":%q}`, message, contentURL)
+	return err
+}
+
+// acceptsMultipart reports whether the client asked for a multipart/mixed response
+func acceptsMultipart(r *http.Request) bool {
+	return strings.Contains(r.Header.Get(echo.HeaderAccept), "multipart/mixed")
+}
+
+// isTextualContentType reports whether content of this type can be embedded
+// in JSON as a string without base64 encoding
+func isTextualContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" ||
+		mediaType == "application/xml" ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestIsTextualContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/json", true},
+		{"application/ld+json; charset=utf-8", true},
+		{"text/csv", true},
+		{"application/xml", true},
+		{"application/octet-stream", false},
+		{"image/png", false},
+	}
+
+	for _, tt := range tests {
+		if got := isTextualContentType(tt.contentType); got != tt.want {
+			t.Errorf("isTextualContentType(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestPreviewBytes_KeepsRuneBoundary(t *testing.T) {
+	data := []byte("aé") // 'é' is two bytes
+
+	if got := string(previewBytes(data, 2)); got != "a" {
+		t.Errorf("Expected preview %q, got %q", "a", got)
+	}
+	if got := string(previewBytes(data, 10)); got != "aé" {
+		t.Errorf("Expected full data for large limit, got %q", got)
+	}
+}
+
+func TestBatchRetrieve_Multipart(t *testing.T) {
+	resetStorageEnv(t)
+	setTestEncryptionKey(t)
+
+	ciphertext, encryptionMetadata, err := encryptPayload([]byte("top secret"))
+	if err != nil {
+		t.Fatalf("encryptPayload() error = %v", err)
+	}
+	store := newFakeStorage()
+	store.objects[defaultBucket()+"/workflow-results/wf-1/step-1.json"] = fakeObject{data: []byte(`{"step": 1}`), contentType: "application/json"}
+	store.objects[defaultBucket()+"/workflow-results/wf-1/report.json"] = fakeObject{
+		data:        []byte("a,b\n"),
+		contentType: "text/csv",
+		metadata:    withFilename(nil, "Q3 report.csv"),
+	}
+	store.objects[defaultBucket()+"/workflow-results/wf-1/secret.json"] = fakeObject{data: ciphertext, contentType: "text/plain", metadata: encryptionMetadata}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "BatchRetrieveAction", "workflowId": "wf-1",
+		"identifiers": ["step-1", "report", "missing", "secret"]}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	req.Header.Set(echo.HeaderAccept, "multipart/mixed")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set(storageContextKey, store)
+	if err := handleSemanticBatchRetrieveImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticBatchRetrieveImpl() error = %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get(echo.HeaderContentType))
+	if err != nil || mediaType != "multipart/mixed" || params["boundary"] == "" {
+		t.Fatalf("Content-Type = %q, want multipart/mixed with a boundary", rec.Header().Get(echo.HeaderContentType))
+	}
+
+	type part struct {
+		contentType, disposition, location, body string
+	}
+	var parts []part
+	mr := multipart.NewReader(rec.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Invalid multipart response: %v", err)
+		}
+		body, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatalf("Read part: %v", err)
+		}
+		parts = append(parts, part{p.Header.Get("Content-Type"), p.Header.Get("Content-Disposition"), p.Header.Get("Content-Location"), string(body)})
+	}
+	if len(parts) != 4 {
+		t.Fatalf("Got %d parts, want 4: %+v", len(parts), parts)
+	}
+
+	url := func(id string) string {
+		return "s3://" + defaultBucket() + "/workflow-results/wf-1/" + id + ".json"
+	}
+	if p := parts[0]; p.contentType != "application/json" || p.body != `{"step": 1}` || p.location != url("step-1") || !strings.Contains(p.disposition, "step-1.json") {
+		t.Errorf("Part 0 = %+v", p)
+	}
+	if p := parts[1]; p.contentType != "text/csv" || p.body != "a,b\n" || !strings.Contains(p.disposition, "Q3 report.csv") {
+		t.Errorf("Part 1 = %+v, want the CSV under its original filename", p)
+	}
+
+	// The missing object becomes an error part and the stream goes on
+	var failure map[string]string
+	if p := parts[2]; p.contentType != "application/json" || p.location != url("missing") || json.Unmarshal([]byte(p.body), &failure) != nil {
+		t.Errorf("Part 2 = %+v, want a JSON error part", p)
+	} else if failure["error"] != "data not found" || failure["contentUrl"] != url("missing") {
+		t.Errorf("Error part = %v", failure)
+	}
+
+	if p := parts[3]; p.body != "top secret" || p.contentType != "text/plain" {
+		t.Errorf("Part 3 = %+v, want the decrypted content", p)
+	}
+}
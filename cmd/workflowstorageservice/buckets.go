@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"eve.evalgo.org/semantic"
+)
+
+// serviceCapabilities are the capabilities advertised to the registry. Each
+// can be routed to its own bucket with WORKFLOW_STORAGE_BUCKET_MAP.
+var serviceCapabilities = []string{"document-storage", "workflow-storage", "data-storage"}
+
+// storageTarget is the bucket and optional key prefix an action operates on
+type storageTarget struct {
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// objectKey places key under the target's prefix
+func (t storageTarget) objectKey(key string) string {
+	if t.Prefix == "" {
+		return key
+	}
+	return t.Prefix + "/" + key
+}
+
+// parseBucketMap parses WORKFLOW_STORAGE_BUCKET_MAP, a comma-separated list
+// of capability=bucket or capability=bucket/prefix entries, e.g.
+// "data-storage=large-blobs,document-storage=docs/definitions". Capabilities
+// may be given without the -storage suffix. Malformed entries are returned
+// separately so they can be reported once at startup.
+func parseBucketMap(spec string) (map[string]storageTarget, []string) {
+	targets := make(map[string]storageTarget)
+	var malformed []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		capability, location, ok := strings.Cut(entry, "=")
+		bucket, prefix, _ := strings.Cut(strings.TrimSpace(location), "/")
+		if !ok || strings.TrimSpace(capability) == "" || bucket == "" {
+			malformed = append(malformed, entry)
+			continue
+		}
+		targets[capabilityName(capability)] = storageTarget{
+			Bucket: bucket,
+			Prefix: strings.Trim(prefix, "/"),
+		}
+	}
+	return targets, malformed
+}
+
+// bucketMap returns the configured capability to bucket mapping
+func bucketMap() map[string]storageTarget {
+	targets, _ := parseBucketMap(os.Getenv("WORKFLOW_STORAGE_BUCKET_MAP"))
+	return targets
+}
+
+// capabilityName normalizes a type such as "data" or "Data-Storage" to the
+// advertised capability name
+func capabilityName(typ string) string {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	if typ != "" && !strings.HasSuffix(typ, "-storage") {
+		typ += "-storage"
+	}
+	return typ
+}
+
+// storageTargetFor resolves where an action's objects live from its "type"
+// property. Unmapped or missing types use the default bucket without prefix.
+func storageTargetFor(action *semantic.SemanticAction) storageTarget {
+	var typ string
+	if action != nil && action.Properties != nil {
+		typ, _ = action.Properties["type"].(string)
+	}
+	return storageTargetForType(typ)
+}
+
+// storageTargetForType resolves the target of a capability type name
+func storageTargetForType(typ string) storageTarget {
+	if typ != "" {
+		if target, ok := bucketMap()[capabilityName(typ)]; ok {
+			return target
+		}
+	}
+	return storageTarget{Bucket: defaultBucket()}
+}
+
+// configuredBuckets returns every distinct bucket the service may write to
+func configuredBuckets() []string {
+	seen := map[string]bool{defaultBucket(): true}
+	buckets := []string{defaultBucket()}
+	var mapped []string
+	for _, target := range bucketMap() {
+		if !seen[target.Bucket] {
+			seen[target.Bucket] = true
+			mapped = append(mapped, target.Bucket)
+		}
+	}
+	sort.Strings(mapped)
+	return append(buckets, mapped...)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseBucketMap(t *testing.T) {
+	targets, malformed := parseBucketMap("data=large-blobs, document-storage=docs/definitions/ ,broken,=x,workflow-storage=")
+	want := map[string]storageTarget{
+		"data-storage":     {Bucket: "large-blobs"},
+		"document-storage": {Bucket: "docs", Prefix: "definitions"},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("parseBucketMap() = %v, want %v", targets, want)
+	}
+	if len(malformed) != 3 {
+		t.Errorf("Expected 3 malformed entries, got %q", malformed)
+	}
+}
+
+func TestSemanticStoreAndRetrieve_BucketMap(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_BUCKET_MAP", "data-storage=large-blobs/raw")
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(body string, handler func(echo.Context, *semantic.SemanticAction) error) *httptest.ResponseRecorder {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		if err := handler(c, action); err != nil {
+			t.Fatalf("handler error = %v", err)
+		}
+		return rec
+	}
+
+	run(`{"@type": "CreateAction", "identifier": "blob", "type": "data",
+		"object": {"@type": "DigitalDocument", "text": "{\"big\": true}"}}`, handleSemanticStoreImpl)
+	run(`{"@type": "CreateAction", "identifier": "definition",
+		"object": {"@type": "DigitalDocument", "text": "{\"small\": true}"}}`, handleSemanticStoreImpl)
+
+	if _, ok := store.objects["large-blobs/raw/workflow-results/wf-1/blob.json"]; !ok {
+		t.Errorf("Expected data-storage result in the mapped bucket, got %v", keysOf(store.objects))
+	}
+	if _, ok := store.objects["px-semantic/workflow-results/wf-1/definition.json"]; !ok {
+		t.Errorf("Expected untyped result in the default bucket, got %v", keysOf(store.objects))
+	}
+
+	rec := run(`{"@type": "RetrieveAction", "type": "data-storage",
+		"object": {"@type": "DigitalDocument", "identifier": "blob"}}`, handleSemanticRetrieveImpl)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected mapped retrieve to succeed, got %d", rec.Code)
+	}
+}
+
+func TestSemanticActions_ContentURLBucket(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_BUCKET_MAP", "data-storage=large-blobs")
+
+	e := echo.New()
+	store := newFakeStorage()
+	store.objects["large-blobs/workflow-results/wf-1/blob.json"] = fakeObject{data: []byte(`{"big": true}`), contentType: "application/json"}
+	store.objects["private/workflow-results/wf-1/blob.json"] = fakeObject{data: []byte(`{"secret": true}`), contentType: "application/json"}
+
+	run := func(body string, handler func(echo.Context, *semantic.SemanticAction) error) *httptest.ResponseRecorder {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), rec)
+		c.Set(storageContextKey, store)
+		if err := handler(c, action); err != nil {
+			t.Fatalf("handler error = %v", err)
+		}
+		return rec
+	}
+
+	// The bucket comes from the contentUrl, not from the action's type
+	rec := run(`{"@type": "RetrieveAction",
+		"object": {"@type": "DigitalDocument", "contentUrl": "s3://large-blobs/workflow-results/wf-1/blob.json"}}`, handleSemanticRetrieveImpl)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "big") {
+		t.Errorf("Retrieve from a mapped bucket = %d %s", rec.Code, rec.Body.String())
+	}
+	run(`{"@type": "DeleteAction",
+		"object": {"@type": "DigitalDocument", "contentUrl": "s3://large-blobs/workflow-results/wf-1/blob.json"}}`, handleSemanticDeleteImpl)
+	if _, ok := store.objects["large-blobs/workflow-results/wf-1/blob.json"]; ok {
+		t.Error("Delete did not remove the object from the contentUrl's bucket")
+	}
+
+	// Buckets the service does not manage are rejected
+	rec = run(`{"@type": "RetrieveAction",
+		"object": {"@type": "DigitalDocument", "contentUrl": "s3://private/workflow-results/wf-1/blob.json"}}`, handleSemanticRetrieveImpl)
+	if rec.Code == http.StatusOK || strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("Retrieve from an unmanaged bucket = %d %s", rec.Code, rec.Body.String())
+	}
+	run(`{"@type": "DeleteAction",
+		"object": {"@type": "DigitalDocument", "contentUrl": "s3://private/workflow-results/wf-1/blob.json"}}`, handleSemanticDeleteImpl)
+	if _, ok := store.objects["private/workflow-results/wf-1/blob.json"]; !ok {
+		t.Error("Delete removed an object from an unmanaged bucket")
+	}
+}
+
+func keysOf(objects map[string]fakeObject) []string {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// bundlesKeyPrefix is the top-level prefix of multi-part bundles. It is
+	// separate from resultsKeyPrefix so ListAction does not return parts.
+	bundlesKeyPrefix = "workflow-bundles"
+	// bundleManifestName is the object listing a bundle's parts
+	bundleManifestName = "manifest.json"
+	// maxBundleParts caps the parts stored by one BundleStoreAction
+	maxBundleParts = 100
+)
+
+// bundleManifest is the stored manifest of a bundle
+type bundleManifest struct {
+	Type        string                 `json:"@type"`
+	Identifier  string                 `json:"identifier"`
+	WorkflowID  string                 `json:"workflowId"`
+	DateCreated time.Time              `json:"dateCreated"`
+	About       map[string]interface{} `json:"about,omitempty"`
+	HasPart     []bundlePartEntry      `json:"hasPart"`
+}
+
+// bundlePartEntry describes one stored part in the manifest
+type bundlePartEntry struct {
+	Identifier     string `json:"identifier"`
+	ContentURL     string `json:"contentUrl"`
+	EncodingFormat string `json:"encodingFormat"`
+	ContentSize    int64  `json:"contentSize"`
+	SHA256         string `json:"sha256"`
+}
+
+// bundlePart is one part of a BundleStoreAction before it is stored
+type bundlePart struct {
+	identifier string
+	format     string
+	data       []byte
+}
+
+// bundleBase returns the key prefix of a bundle:
+// workflow-bundles/{workflowId}/{bundleId}, sharded like results when
+// WORKFLOW_STORAGE_SHARD_KEYS is enabled
+func bundleBase(workflowID, bundleID string) string {
+	base := fmt.Sprintf("%s/%s/%s", bundlesKeyPrefix, workflowID, bundleID)
+	if shardKeysEnabled() {
+		return keyShard(workflowID, bundleID) + "/" + base
+	}
+	return base
+}
+
+// validBundleName reports whether name can be used as a bundle or part
+// identifier without escaping its prefix
+func validBundleName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
+
+// parseBundleParts reads the "parts" property: objects with identifier,
+// optional encodingFormat (default application/json) and either text or
+// contentBase64
+func parseBundleParts(c echo.Context, action *semantic.SemanticAction) ([]bundlePart, error) {
+	raw, _ := action.Properties["parts"].([]interface{})
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("parts is required (list of objects with identifier and text or contentBase64)")
+	}
+	if len(raw) > maxBundleParts {
+		return nil, fmt.Errorf("too many parts (max %d)", maxBundleParts)
+	}
+
+	parts := make([]bundlePart, 0, len(raw))
+	seen := make(map[string]bool, len(raw))
+	for i, item := range raw {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("part %d is not an object", i)
+		}
+
+		identifier, _ := entry["identifier"].(string)
+		if !validBundleName(identifier) {
+			return nil, fmt.Errorf("part %d: identifier is required and must not contain slashes", i)
+		}
+		if seen[identifier] {
+			return nil, fmt.Errorf("part %d: duplicate identifier %q", i, identifier)
+		}
+		seen[identifier] = true
+
+		format, _ := entry["encodingFormat"].(string)
+		if format == "" {
+			format = "application/json"
+		}
+		if err := validateEncodingFormat(c, format); err != nil {
+			return nil, fmt.Errorf("part %s: %v", identifier, err)
+		}
+
+		var data []byte
+		if text, ok := entry["text"].(string); ok {
+			data = []byte(text)
+		} else if encoded, ok := entry["contentBase64"].(string); ok {
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("part %s: invalid contentBase64: %v", identifier, err)
+			}
+			data = decoded
+		} else {
+			return nil, fmt.Errorf("part %s: text or contentBase64 is required", identifier)
+		}
+
+		parts = append(parts, bundlePart{identifier: identifier, format: format, data: data})
+	}
+	return parts, nil
+}
+
+// handleSemanticBundleStoreImpl stores a bundle: every part under
+// {bundle}/parts/{revision}/{identifier}, then a manifest listing them. Each
+// store writes its parts under a new revision and the manifest last, so a
+// rewrite never touches the parts the current manifest lists, and a readable
+// manifest always describes a complete bundle. The parts of the previous
+// revision are removed once the new manifest is in place.
+func handleSemanticBundleStoreImpl(c echo.Context, action *semantic.SemanticAction) error {
+	if !validBundleName(action.Identifier) {
+		return returnActionError(c, action, "identifier is required (bundle name without slashes)", nil)
+	}
+
+	parts, err := parseBundleParts(c, action)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	workflowID := workflowIDFor(c, action)
+	target := storageTargetFor(action)
+	bucket := target.Bucket
+	base := scopeToTenant(c, scopeToEnvironment(target.objectKey(bundleBase(workflowID, action.Identifier))))
+	manifestKey := base + "/" + bundleManifestName
+
+	store := storageFor(c)
+	ctx := c.Request().Context()
+
+	// The manifest lock serializes writers of the whole bundle
+	unlock := objectLocks.Lock(bucket, manifestKey)
+	defer unlock()
+
+	if status, err := evaluatePreconditions(ctx, c.Request(), store, bucket, manifestKey); err != nil {
+		return returnActionError(c, action, "Failed to check existing bundle", err)
+	} else if status != 0 {
+		return preconditionError(http.StatusPreconditionFailed, manifestKey)
+	}
+
+	previous, err := readBundleManifest(ctx, store, bucket, manifestKey)
+	if err != nil && fetchErrorStatus(err) != http.StatusNotFound {
+		return returnActionError(c, action, "Failed to read existing bundle", err)
+	}
+
+	// The revision is the creation time, moved past the previous one so two
+	// stores within a millisecond do not share their parts
+	created := time.Now().UTC().Truncate(time.Millisecond)
+	if previous != nil && !created.After(previous.DateCreated.Truncate(time.Millisecond)) {
+		created = previous.DateCreated.Truncate(time.Millisecond).Add(time.Millisecond)
+	}
+	revision := created.Format(versionLayout)
+
+	manifest := bundleManifest{
+		Type:        "Collection",
+		Identifier:  action.Identifier,
+		WorkflowID:  workflowID,
+		DateCreated: created,
+		HasPart:     make([]bundlePartEntry, 0, len(parts)),
+	}
+	if about, ok := action.Properties["manifest"].(map[string]interface{}); ok {
+		manifest.About = about
+	}
+
+	var total int64
+	for _, part := range parts {
+		key := base + "/parts/" + revision + "/" + part.identifier
+		sum := sha256.Sum256(part.data)
+		if _, err := store.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(part.data),
+			ContentType: aws.String(part.format),
+			Metadata:    withChecksum(nil, part.data),
+		}); err != nil {
+			logf(c, "Failed to store bundle part %s: %v", key, err)
+			return returnActionError(c, action, fmt.Sprintf("Failed to store part %s", part.identifier), err)
+		}
+		missingObjects.forget(bucket, key)
+		resultCache.forget(bucket, key)
+
+		manifest.HasPart = append(manifest.HasPart, bundlePartEntry{
+			Identifier:     part.identifier,
+			ContentURL:     fmt.Sprintf("s3://%s/%s", bucket, key),
+			EncodingFormat: part.format,
+			ContentSize:    int64(len(part.data)),
+			SHA256:         hex.EncodeToString(sum[:]),
+		})
+		total += int64(len(part.data))
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return returnActionError(c, action, "Failed to encode manifest", err)
+	}
+	if _, err := store.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(manifestKey),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+		Metadata:    withChecksum(nil, data),
+	}); err != nil {
+		logf(c, "Failed to store bundle manifest %s: %v", manifestKey, err)
+		return returnActionError(c, action, "Failed to store manifest", err)
+	}
+	missingObjects.forget(bucket, manifestKey)
+	resultCache.forget(bucket, manifestKey)
+
+	if previous != nil {
+		removeStaleBundleParts(c, store, bucket, previous, manifest)
+	}
+
+	contentURL := fmt.Sprintf("s3://%s/%s", bucket, manifestKey)
+	logf(c, "Stored bundle %s with %d parts (%d bytes)", manifestKey, len(parts), total)
+
+	action.Result = &semantic.SemanticResult{
+		Type:   "Collection",
+		Format: "application/json",
+		Value: map[string]interface{}{
+			"contentUrl":    contentURL,
+			"identifier":    action.Identifier,
+			"numberOfParts": len(parts),
+			"contentSize":   total,
+			"hasPart":       manifest.HasPart,
+		},
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// removeStaleBundleParts deletes parts of the previous manifest that the new
+// one no longer lists. Failures only leave orphaned objects behind.
+func removeStaleBundleParts(c echo.Context, store Storage, bucket string, previous *bundleManifest, current bundleManifest) {
+	kept := make(map[string]bool, len(current.HasPart))
+	for _, part := range current.HasPart {
+		kept[part.ContentURL] = true
+	}
+	for _, part := range previous.HasPart {
+		if kept[part.ContentURL] {
+			continue
+		}
+		partBucket, key, err := parseContentURL(part.ContentURL)
+		if err != nil || partBucket != bucket || checkTenantScope(c, key) != nil {
+			continue
+		}
+		if _, err := store.DeleteObject(c.Request().Context(), &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		}); err != nil {
+			logf(c, "Failed to remove stale bundle part %s: %v", key, err)
+			continue
+		}
+		resultCache.forget(bucket, key)
+	}
+}
+
+// readBundleManifest loads and decodes a stored manifest
+func readBundleManifest(ctx context.Context, store Storage, bucket, key string) (*bundleManifest, error) {
+	obj, err := fetchObject(ctx, store, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	var manifest bundleManifest
+	if err := json.Unmarshal(obj.data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// handleSemanticBundleRetrieveImpl returns a bundle's manifest with links to
+// its parts. The bundle is addressed by the manifest's contentUrl or by
+// identifier within the workflow. Part contents are fetched separately with
+// RetrieveAction or BatchRetrieveAction on the listed contentUrls.
+func handleSemanticBundleRetrieveImpl(c echo.Context, action *semantic.SemanticAction) error {
+	target := storageTargetFor(action)
+	bucket := target.Bucket
+
+	var manifestKey string
+	if action.Object != nil && action.Object.ContentUrl != "" {
+		manifestBucket, key, err := parseContentURL(action.Object.ContentUrl)
+		if err != nil {
+			return returnActionError(c, action, err.Error(), nil)
+		}
+		if err := checkTenantScope(c, key); err != nil {
+			return err
+		}
+		bucket, manifestKey = manifestBucket, key
+	} else {
+		identifier := action.Identifier
+		if action.Object != nil && action.Object.Identifier != "" {
+			identifier = action.Object.Identifier
+		}
+		if !validBundleName(identifier) {
+			return returnActionError(c, action, "object.contentUrl or identifier is required", nil)
+		}
+		manifestKey = scopeToTenant(c, scopeToEnvironment(target.objectKey(bundleBase(workflowIDFor(c, action), identifier)))) + "/" + bundleManifestName
+	}
+
+	manifest, err := readBundleManifest(c.Request().Context(), storageFor(c), bucket, manifestKey)
+	if err != nil {
+		logf(c, "Failed to fetch bundle %s: %v", manifestKey, err)
+		return returnActionError(c, action, fetchErrorMessage(err), err)
+	}
+
+	logf(c, "Fetched bundle %s (%d parts)", manifestKey, len(manifest.HasPart))
+
+	value := map[string]interface{}{
+		"contentUrl":    fmt.Sprintf("s3://%s/%s", bucket, manifestKey),
+		"identifier":    manifest.Identifier,
+		"workflowId":    manifest.WorkflowID,
+		"dateCreated":   manifest.DateCreated,
+		"numberOfParts": len(manifest.HasPart),
+		"hasPart":       manifest.HasPart,
+	}
+	if manifest.About != nil {
+		value["manifest"] = manifest.About
+	}
+
+	action.Result = &semantic.SemanticResult{
+		Type:   "Collection",
+		Format: "application/json",
+		Value:  value,
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// handleSemanticBundleStore wraps the implementation to match ActionHandler signature
+func handleSemanticBundleStore(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticBundleStoreImpl(c, action)
+}
+
+// handleSemanticBundleRetrieve wraps the implementation to match ActionHandler signature
+func handleSemanticBundleRetrieve(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticBundleRetrieveImpl(c, action)
+}
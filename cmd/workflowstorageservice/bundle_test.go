@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSemanticBundle_StoreAndRetrieve(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(body string, handler func(echo.Context, *semantic.SemanticAction) error) (*httptest.ResponseRecorder, error) {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		return rec, handler(c, action)
+	}
+
+	_, err := run(`{"@type": "BundleStoreAction", "identifier": "release",
+		"manifest": {"name": "Release pipeline"},
+		"parts": [
+			{"identifier": "definition", "text": "{\"steps\": []}"},
+			{"identifier": "logo.png", "encodingFormat": "image/png", "contentBase64": "iVBORw0K"},
+			{"identifier": "notes", "encodingFormat": "text/plain", "text": "v1"}
+		]}`, handleSemanticBundleStoreImpl)
+	if err != nil {
+		t.Fatalf("handleSemanticBundleStoreImpl() error = %v", err)
+	}
+
+	base := defaultBucket() + "/" + bundleBase("wf-1", "release")
+	parts := func() map[string]fakeObject {
+		found := make(map[string]fakeObject)
+		for id, obj := range store.objects {
+			if strings.HasPrefix(id, base+"/parts/") {
+				found[path.Base(id)] = obj
+			}
+		}
+		return found
+	}
+	if _, ok := store.objects[base+"/manifest.json"]; !ok {
+		t.Errorf("Missing manifest %s", base+"/manifest.json")
+	}
+	first := parts()
+	if len(first) != 3 || first["logo.png"].contentType != "image/png" {
+		t.Errorf("Parts = %v, want definition, logo.png and notes", keysOf(store.objects))
+	}
+
+	// A new version writes its parts under a new revision and removes the
+	// parts of the previous one
+	if _, err := run(`{"@type": "BundleStoreAction", "identifier": "release",
+		"parts": [{"identifier": "definition", "text": "{\"steps\": [1]}"}]}`, handleSemanticBundleStoreImpl); err != nil {
+		t.Fatalf("Second store failed: %v", err)
+	}
+	if second := parts(); len(second) != 1 || string(second["definition"].data) != `{"steps": [1]}` {
+		t.Errorf("Parts after the second store = %v", keysOf(store.objects))
+	}
+
+	rec, err := run(`{"@type": "BundleRetrieveAction", "identifier": "release"}`, handleSemanticBundleRetrieveImpl)
+	if err != nil {
+		t.Fatalf("handleSemanticBundleRetrieveImpl() error = %v", err)
+	}
+	var response struct {
+		Result struct {
+			Value struct {
+				NumberOfParts int               `json:"numberOfParts"`
+				HasPart       []bundlePartEntry `json:"hasPart"`
+			} `json:"value"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Result.Value.NumberOfParts != 1 || len(response.Result.Value.HasPart) != 1 {
+		t.Fatalf("Retrieved %+v, want one part", response.Result.Value)
+	}
+	if part := response.Result.Value.HasPart[0]; !strings.Contains(part.ContentURL, "/parts/") || !strings.HasSuffix(part.ContentURL, "/definition") || part.SHA256 == "" {
+		t.Errorf("Part entry = %+v", part)
+	}
+}
+
+func TestSemanticBundle_InvalidParts(t *testing.T) {
+	e := echo.New()
+
+	tests := []string{
+		`{"@type": "BundleStoreAction", "identifier": "b"}`,
+		`{"@type": "BundleStoreAction", "identifier": "b", "parts": [{"identifier": "../x", "text": "a"}]}`,
+		`{"@type": "BundleStoreAction", "identifier": "b", "parts": [{"identifier": "a", "text": "1"}, {"identifier": "a", "text": "2"}]}`,
+		`{"@type": "BundleStoreAction", "identifier": "b", "parts": [{"identifier": "a"}]}`,
+		`{"@type": "BundleStoreAction", "identifier": "b", "parts": [{"identifier": "a", "contentBase64": "%%%"}]}`,
+	}
+	for _, body := range tests {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, newFakeStorage())
+
+		err = handleSemanticBundleStoreImpl(c, action)
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", body, err)
+		}
+	}
+}
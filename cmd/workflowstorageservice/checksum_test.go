@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestWithChecksum(t *testing.T) {
+	metadata := withChecksum(nil, []byte("hello"))
+
+	want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if got := metadata[metadataChecksumSHA256]; got != want {
+		t.Errorf("Expected digest %q, got %q", want, got)
+	}
+
+	encrypted := withChecksum(map[string]string{metadataEncryptionAlgorithm: encryptionAlgorithm}, []byte("hello"))
+	if encrypted[metadataEncryptionAlgorithm] != encryptionAlgorithm {
+		t.Error("withChecksum() must keep existing metadata")
+	}
+	if digest, ok := encrypted[metadataChecksumSHA256]; ok {
+		t.Errorf("withChecksum() recorded plaintext digest %q on encrypted metadata", digest)
+	}
+}
+
+func TestSemanticChecksum_EncryptedComputedOnRead(t *testing.T) {
+	resetStorageEnv(t)
+	setTestEncryptionKey(t)
+
+	store := newFakeStorage()
+	run := func(body string, handler func(echo.Context, *semantic.SemanticAction) error) *semantic.SemanticAction {
+		t.Helper()
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		if err := handler(c, action); err != nil {
+			t.Fatalf("Handler error = %v", err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		return action
+	}
+
+	run(`{"@type": "CreateAction", "identifier": "secret", "encrypt": true,
+		"object": {"@type": "DigitalDocument", "text": "hello", "encodingFormat": "text/plain"}}`, handleSemanticStoreImpl)
+	obj, ok := store.objects[defaultBucket()+"/workflow-results/default/secret.json"]
+	if !ok {
+		t.Fatalf("Encrypted result not stored, have %v", keysOf(store.objects))
+	}
+	if digest, ok := obj.metadata[metadataChecksumSHA256]; ok {
+		t.Errorf("Encrypted object carries plaintext digest %q", digest)
+	}
+
+	action := run(`{"@type": "ChecksumAction", "object": {"@type": "DigitalDocument",
+		"contentUrl": "s3://`+defaultBucket()+`/workflow-results/default/secret.json"}}`, handleSemanticChecksumImpl)
+	value, _ := json.Marshal(action.Result.Value)
+	var result map[string]interface{}
+	if err := json.Unmarshal(value, &result); err != nil {
+		t.Fatalf("Invalid result value: %v", err)
+	}
+	want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if result["digest"] != want || result["source"] != "computed" {
+		t.Errorf("Checksum of encrypted object = %v, want the plaintext digest computed on read", result)
+	}
+}
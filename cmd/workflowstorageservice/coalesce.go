@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultCoalesceMaxBytes bounds the objects whose buffered content is shared
+// between concurrent retrieves
+const defaultCoalesceMaxBytes = 8 << 20
+
+// errNotCoalesced tells the callers of a coalesced fetch that the object was
+// too large to share and must be fetched individually
+var errNotCoalesced = errors.New("object too large to coalesce")
+
+// objectFetches coalesces concurrent fetches of the same object, so a burst of
+// retrieves for a hot key (e.g. many pollers right after a store) issues a
+// single GetObject
+var objectFetches singleflight.Group
+
+// coalesceMaxBytes returns WORKFLOW_STORAGE_COALESCE_MAX_BYTES or the
+// default. 0 disables coalescing.
+func coalesceMaxBytes() int64 {
+	limit, err := strconv.ParseInt(os.Getenv("WORKFLOW_STORAGE_COALESCE_MAX_BYTES"), 10, 64)
+	if err != nil || limit < 0 {
+		return defaultCoalesceMaxBytes
+	}
+	return limit
+}
+
+// coalescedGet runs get once for all concurrent callers with the same bucket,
+// key and cached ETag, and hands each of them the same result. Objects above
+// coalesceMaxBytes are not shared: the caller that fetched one keeps it, and
+// the others fetch their own copy rather than pinning a large buffer for the
+// whole group. The shared fetch is not cancelled with the first caller's
+// request; every caller still stops waiting when its own context ends.
+func coalescedGet(ctx context.Context, bucket, key string, cached *storedObject, get func(context.Context, int64) (*storedObject, error)) (*storedObject, error) {
+	limit := coalesceMaxBytes()
+	if limit == 0 {
+		return get(ctx, 0)
+	}
+
+	id := bucket + "/" + key
+	if cached != nil {
+		id += "\x00" + cached.etag
+	}
+
+	var own *storedObject
+	results := objectFetches.DoChan(id, func() (interface{}, error) {
+		obj, err := get(context.WithoutCancel(ctx), limit)
+		if errors.Is(err, errNotCoalesced) {
+			own = obj
+		}
+		return obj, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		if errors.Is(result.Err, errNotCoalesced) {
+			if own != nil {
+				return own, nil
+			}
+			return get(ctx, 0)
+		}
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*storedObject), nil
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingGet returns a get function for coalescedGet that counts its calls
+// and blocks the first one until release is closed
+func countingGet(data string, calls *atomic.Int32, started, release chan struct{}) func(context.Context, int64) (*storedObject, error) {
+	return func(ctx context.Context, limit int64) (*storedObject, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		obj := &storedObject{data: []byte(data), contentType: "application/json"}
+		if limit > 0 && int64(len(data)) > limit {
+			return obj, errNotCoalesced
+		}
+		return obj, nil
+	}
+}
+
+// fetchConcurrently runs n coalescedGet calls for the same key while the
+// first fetch is held, and returns the objects they received
+func fetchConcurrently(t *testing.T, n int, data string, calls *atomic.Int32) []*storedObject {
+	started, release := make(chan struct{}), make(chan struct{})
+	get := countingGet(data, calls, started, release)
+
+	results := make([]*storedObject, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			obj, err := coalescedGet(context.Background(), "bucket", "hot.json", nil, get)
+			if err != nil {
+				t.Errorf("coalescedGet() error = %v", err)
+			}
+			results[i] = obj
+		}(i)
+		if i == 0 {
+			<-started
+		}
+	}
+
+	// Give the other callers time to join the in-flight fetch
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	return results
+}
+
+func TestCoalescedGet_SharesOneFetch(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_COALESCE_MAX_BYTES", "")
+
+	var calls atomic.Int32
+	results := fetchConcurrently(t, 10, `{"hot": true}`, &calls)
+	if got := calls.Load(); got != 1 {
+		t.Errorf("GetObject calls = %d, want 1", got)
+	}
+	for _, obj := range results {
+		if obj == nil || string(obj.data) != `{"hot": true}` {
+			t.Errorf("Coalesced caller received %v", obj)
+		}
+	}
+}
+
+func TestCoalescedGet_LargeObjectsNotShared(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_COALESCE_MAX_BYTES", "4")
+
+	var calls atomic.Int32
+	data := strings.Repeat("x", 64)
+	results := fetchConcurrently(t, 5, data, &calls)
+	if got := calls.Load(); got != 5 {
+		t.Errorf("GetObject calls = %d, want one per caller", got)
+	}
+	seen := make(map[*storedObject]bool)
+	for _, obj := range results {
+		if obj == nil || string(obj.data) != data {
+			t.Fatalf("Caller received %v", obj)
+		}
+		if seen[obj] {
+			t.Error("A large object was shared between callers")
+		}
+		seen[obj] = true
+	}
+}
+
+func TestCoalescedGet_Disabled(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_COALESCE_MAX_BYTES", "0")
+
+	var calls atomic.Int32
+	fetchConcurrently(t, 3, `{}`, &calls)
+	if got := calls.Load(); got != 3 {
+		t.Errorf("GetObject calls = %d, want 3 with coalescing disabled", got)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"eve.evalgo.org/semantic"
+	"github.com/klauspost/compress/zstd"
+)
+
+// metadataCompression records the algorithm a stored object was compressed
+// with, so reads can undo it
+const metadataCompression = "compression"
+
+// compressionCodec compresses and decompresses whole payloads
+type compressionCodec struct {
+	compress   func(data []byte) ([]byte, error)
+	decompress func(data []byte) ([]byte, error)
+}
+
+// zstdCodec holds the shared zstd encoder and decoder; both are safe for
+// concurrent EncodeAll and DecodeAll calls
+var zstdCodec = sync.OnceValues(func() (*zstd.Encoder, *zstd.Decoder) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic(err)
+	}
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		panic(err)
+	}
+	return enc, dec
+})
+
+// compressionCodecs are the algorithms the compress store property selects.
+// gzip is the widely readable default; zstd compresses better and faster but
+// needs a zstd-aware reader for objects fetched around the service.
+var compressionCodecs = map[string]compressionCodec{
+	"gzip": {
+		compress: func(data []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			if _, err := zw.Write(data); err != nil {
+				return nil, err
+			}
+			if err := zw.Close(); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		},
+		decompress: func(data []byte) ([]byte, error) {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(zr)
+		},
+	},
+	"zstd": {
+		compress: func(data []byte) ([]byte, error) {
+			enc, _ := zstdCodec()
+			return enc.EncodeAll(data, nil), nil
+		},
+		decompress: func(data []byte) ([]byte, error) {
+			_, dec := zstdCodec()
+			return dec.DecodeAll(data, nil)
+		},
+	},
+}
+
+// compressionAlgorithms lists the supported algorithms for messages
+func compressionAlgorithms() string {
+	names := make([]string, 0, len(compressionCodecs))
+	for name := range compressionCodecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// requestedCompression reads the compress store property: an algorithm name
+// or true for gzip. An unknown algorithm is reported as unsupported and the
+// result is stored uncompressed rather than failing the store.
+func requestedCompression(action *semantic.SemanticAction) (algorithm string, unsupported string) {
+	if action == nil || action.Properties == nil {
+		return "", ""
+	}
+	switch value := action.Properties["compress"].(type) {
+	case bool:
+		if value {
+			return "gzip", ""
+		}
+	case string:
+		name := strings.ToLower(strings.TrimSpace(value))
+		if name == "" || name == "none" {
+			return "", ""
+		}
+		if _, ok := compressionCodecs[name]; ok {
+			return name, ""
+		}
+		return "", value
+	}
+	return "", ""
+}
+
+// compressPayload compresses data with algorithm. Data that does not shrink
+// is returned unchanged with an empty algorithm, so incompressible results
+// are not penalized on every read.
+func compressPayload(algorithm string, data []byte) ([]byte, string, error) {
+	codec, ok := compressionCodecs[algorithm]
+	if !ok || len(data) == 0 {
+		return data, "", nil
+	}
+	compressed, err := codec.compress(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(compressed) >= len(data) {
+		return data, "", nil
+	}
+	return compressed, algorithm, nil
+}
+
+// isCompressed reports whether the object metadata carries a compression marker
+func isCompressed(metadata map[string]string) bool {
+	return metadata[metadataCompression] != ""
+}
+
+// isEncoded reports whether a stored body differs from the result it holds,
+// i.e. it must be read whole and decoded with decodePayload
+func isEncoded(metadata map[string]string) bool {
+	return isEncrypted(metadata) || isCompressed(metadata)
+}
+
+// decodePayload turns a stored body back into the result: it decrypts
+// (see decryptPayload) and then decompresses. Plain objects are returned
+// unchanged.
+func decodePayload(data []byte, metadata map[string]string) ([]byte, error) {
+	data, err := decryptPayload(data, metadata)
+	if err != nil || !isCompressed(metadata) {
+		return data, err
+	}
+	algorithm := metadata[metadataCompression]
+	codec, ok := compressionCodecs[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported compression algorithm: %s", algorithm)
+	}
+	data, err = codec.decompress(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s data: %w", algorithm, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestCompressOnStore_RoundTrip(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+	run := func(body string, handler func(echo.Context, *semantic.SemanticAction) error) (*semantic.SemanticAction, error) {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return action, handler(c, action)
+	}
+
+	text := "[" + strings.Repeat(`{"status": "ok", "value": 42}, `, 200) + "{}]"
+	for _, tt := range []struct {
+		compress string
+		want     string
+	}{
+		{`"gzip"`, "gzip"},
+		{`"zstd"`, "zstd"},
+		{`true`, "gzip"},
+		{`"brotli"`, ""},
+	} {
+		identifier := "result-" + strings.Trim(tt.compress, `"`)
+		action, err := run(`{"@type": "CreateAction", "identifier": "`+identifier+`", "compress": `+tt.compress+`,
+			"object": {"@type": "DigitalDocument", "text": "`+strings.ReplaceAll(text, `"`, `\"`)+`"}}`, handleSemanticStoreImpl)
+		if err != nil {
+			t.Fatalf("compress %s: store error = %v", tt.compress, err)
+		}
+
+		stored := store.objects[defaultBucket()+"/workflow-results/wf-1/"+identifier+".json"]
+		value := action.Result.Value.(map[string]interface{})
+		if got := stored.metadata[metadataCompression]; got != tt.want {
+			t.Errorf("compress %s: stored compression = %q, want %q", tt.compress, got, tt.want)
+		}
+		if tt.want != "" && (value["compression"] != tt.want || value["storedSize"] != int64(len(stored.data)) || len(stored.data) >= len(text)/2) {
+			t.Errorf("compress %s: result = %v, stored %d bytes", tt.compress, value, len(stored.data))
+		}
+
+		action, err = run(`{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "identifier": "`+identifier+`"}}`, handleSemanticRetrieveImpl)
+		if err != nil || action.Result.Output != text {
+			t.Errorf("compress %s: retrieve error = %v, output differs from the stored text", tt.compress, err)
+		}
+	}
+}
+
+func TestCompressPayload(t *testing.T) {
+	data := []byte(strings.Repeat("workflow result ", 100))
+	for _, algorithm := range []string{"gzip", "zstd"} {
+		compressed, used, err := compressPayload(algorithm, data)
+		if err != nil || used != algorithm || len(compressed) >= len(data) {
+			t.Fatalf("compressPayload(%s) = %d bytes, %q, %v", algorithm, len(compressed), used, err)
+		}
+		plain, err := decodePayload(compressed, map[string]string{metadataCompression: used})
+		if err != nil || !bytes.Equal(plain, data) {
+			t.Errorf("decodePayload(%s) = %v", algorithm, err)
+		}
+	}
+
+	// Data that does not shrink is stored as is
+	if out, used, err := compressPayload("zstd", []byte("{}")); err != nil || used != "" || string(out) != "{}" {
+		t.Errorf("compressPayload of tiny data = %q, %q, %v", out, used, err)
+	}
+	if _, err := decodePayload([]byte("x"), map[string]string{metadataCompression: "lz4"}); err == nil {
+		t.Error("decodePayload should reject an unknown algorithm")
+	}
+}
+
+// BenchmarkCompression compares ratio and speed of the compress algorithms on
+// a JSON workflow result: go test -bench Compression -benchmem
+func BenchmarkCompression(b *testing.B) {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&buf, `{"step": %d, "status": "completed", "durationMs": %d, "output": {"rows": %d, "checksum": "%x"}},`, i, i*37%1000, i*13, i*7919)
+	}
+	buf.WriteString("{}]")
+	data := buf.Bytes()
+
+	for _, algorithm := range []string{"gzip", "zstd"} {
+		codec := compressionCodecs[algorithm]
+		compressed, err := codec.compress(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(algorithm+"/compress", func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportMetric(float64(len(data))/float64(len(compressed)), "ratio")
+			for i := 0; i < b.N; i++ {
+				if _, err := codec.compress(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(algorithm+"/decompress", func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := codec.decompress(compressed); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
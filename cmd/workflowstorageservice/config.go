@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// storageValidationTimeout bounds the startup reachability check
+const storageValidationTimeout = 10 * time.Second
+
+// ConfigResponse describes the effective service configuration with secrets redacted
+type ConfigResponse struct {
+	Backend           string                   `json:"backend"`
+	Bucket            string                   `json:"bucket"`
+	BucketMap         map[string]storageTarget `json:"bucketMap"`
+	FallbackBuckets   []string                 `json:"fallbackBuckets,omitempty"`
+	Endpoint          string                   `json:"endpoint"`
+	Region            string                   `json:"region"`
+	KeyPrefix         string                   `json:"keyPrefix"`
+	Router            string                   `json:"router"`
+	Environment       string                   `json:"environment,omitempty"`
+	KeyTemplate       string                   `json:"keyTemplate,omitempty"`
+	UsePathStyle      bool                     `json:"usePathStyle"`
+	TLSMinVersion     string                   `json:"tlsMinVersion"`
+	RequireHTTPS      bool                     `json:"requireHttps"`
+	CredentialSource  string                   `json:"credentialSource,omitempty"`
+	ShardKeys         bool                     `json:"shardKeys"`
+	FlatKeys          bool                     `json:"flatKeys"`
+	KeySeparator      string                   `json:"keySeparator,omitempty"`
+	AccessKey         string                   `json:"accessKey"`
+	APIKeyConfigured  bool                     `json:"apiKeyConfigured"`
+	EncryptionEnabled bool                     `json:"encryptionEnabled"`
+	Deduplication     bool                     `json:"deduplication"`
+	Tenants           []string                 `json:"tenants,omitempty"`
+	ActionAliases     map[string]string        `json:"actionAliases,omitempty"`
+	AllowedEndpoints  map[string]string        `json:"allowedEndpoints,omitempty"`
+	KeyNormalization  []string                 `json:"keyNormalization,omitempty"`
+	ReadOnly          bool                     `json:"readOnly"`
+	Versioning        bool                     `json:"versioning"`
+	KeepVersions      int64                    `json:"keepVersions,omitempty"`
+	Limits            map[string]int64         `json:"limits"`
+	TypeSizeLimits    map[string]int64         `json:"typeSizeLimits,omitempty"`
+}
+
+// validateStorageConfig checks that the S3 endpoint is reachable and every
+// configured bucket (the default and those in WORKFLOW_STORAGE_BUCKET_MAP)
+// exists. Problems are logged with a hint for operators but do not stop the
+// service, so it can still come up while S3 recovers.
+func validateStorageConfig(ctx context.Context, store Storage) error {
+	ctx, cancel := context.WithTimeout(ctx, storageValidationTimeout)
+	defer cancel()
+
+	if _, malformed := parseBucketMap(os.Getenv("WORKFLOW_STORAGE_BUCKET_MAP")); len(malformed) > 0 {
+		log.Printf("Ignoring malformed WORKFLOW_STORAGE_BUCKET_MAP entries: %s", strings.Join(malformed, ", "))
+	}
+	if _, malformed := parseTenantKeys(os.Getenv("WORKFLOW_STORAGE_TENANT_KEYS")); len(malformed) > 0 {
+		log.Printf("Ignoring malformed WORKFLOW_STORAGE_TENANT_KEYS entries: %s", strings.Join(malformed, ", "))
+	}
+	_, invalidPaths := parseRedactPaths(os.Getenv("WORKFLOW_STORAGE_REDACT_PATHS"))
+	for _, err := range invalidPaths {
+		log.Printf("Ignoring WORKFLOW_STORAGE_REDACT_PATHS entry: %v", err)
+	}
+	if _, malformed := parseTypeSizeLimits(os.Getenv("WORKFLOW_STORAGE_TYPE_SIZE_LIMITS")); len(malformed) > 0 {
+		log.Printf("Ignoring malformed WORKFLOW_STORAGE_TYPE_SIZE_LIMITS entries: %s", strings.Join(malformed, ", "))
+	}
+	if above := typeLimitsAboveBodyLimit(); len(above) > 0 {
+		log.Printf("WORKFLOW_STORAGE_TYPE_SIZE_LIMITS entries above WORKFLOW_STORAGE_MAX_ACTION_BYTES (%d) have no effect, the request body limit applies: %s", maxActionBytes(), strings.Join(above, ", "))
+	}
+	if _, malformed := parseActionAliases(os.Getenv("WORKFLOW_STORAGE_ACTION_ALIASES")); len(malformed) > 0 {
+		log.Printf("Ignoring malformed WORKFLOW_STORAGE_ACTION_ALIASES entries: %s", strings.Join(malformed, ", "))
+	}
+	if _, malformed := parseAllowedEndpoints(os.Getenv("WORKFLOW_STORAGE_ALLOWED_ENDPOINTS")); len(malformed) > 0 {
+		log.Printf("Ignoring malformed WORKFLOW_STORAGE_ALLOWED_ENDPOINTS entries: %s", strings.Join(malformed, ", "))
+	}
+	if _, unknown := parseKeyNormalization(os.Getenv("WORKFLOW_STORAGE_KEY_NORMALIZATION")); len(unknown) > 0 {
+		log.Printf("Ignoring unknown WORKFLOW_STORAGE_KEY_NORMALIZATION entries: %s (supported: nfc, lower)", strings.Join(unknown, ", "))
+	}
+
+	var firstErr error
+	if _, err := currentRouter(); err != nil {
+		log.Printf("Storage validation failed: %v", err)
+		firstErr = err
+	}
+	if _, err := environmentName(); err != nil {
+		log.Printf("Storage validation failed: %v", err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, bucket := range configuredBuckets() {
+		_, err := store.HeadBucket(ctx, &s3.HeadBucketInput{
+			Bucket: aws.String(bucket),
+		})
+		if err != nil {
+			log.Printf("Storage validation failed: bucket %q at %s is not accessible: %v", bucket, s3Endpoint, err)
+			if storageBackend == "fs" {
+				log.Printf("Check WORKFLOW_STORAGE_FS_DIR, HETZNER_S3_BUCKET and WORKFLOW_STORAGE_BUCKET_MAP")
+			} else {
+				log.Printf("Check HETZNER_S3_URL, HETZNER_S3_BUCKET, WORKFLOW_STORAGE_BUCKET_MAP and the S3 credentials")
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		log.Printf("Storage validation passed: bucket %q at %s", bucket, s3Endpoint)
+	}
+	return firstErr
+}
+
+// currentConfig returns the effective configuration with secrets redacted
+func currentConfig() ConfigResponse {
+	_, encryptionErr := loadEncryptionKey()
+	environment, _ := environmentName()
+	separator := ""
+	if flatKeysEnabled() {
+		separator = keySeparator()
+	}
+
+	return ConfigResponse{
+		Backend:           storageBackend,
+		Bucket:            defaultBucket(),
+		BucketMap:         bucketMap(),
+		FallbackBuckets:   fallbackBuckets(),
+		Endpoint:          s3Endpoint,
+		Region:            storageRegion,
+		KeyPrefix:         resultsKeyPrefix,
+		Router:            routerName(),
+		Environment:       environment,
+		KeyTemplate:       keyTemplate(),
+		UsePathStyle:      usePathStyle,
+		TLSMinVersion:     tlsMinVersionName(),
+		RequireHTTPS:      requireHTTPS(),
+		CredentialSource:  s3CredentialSource,
+		ShardKeys:         shardKeysEnabled(),
+		FlatKeys:          flatKeysEnabled(),
+		KeySeparator:      separator,
+		AccessKey:         redactSecret(s3AccessKey),
+		APIKeyConfigured:  os.Getenv("WORKFLOW_STORAGE_API_KEY") != "",
+		EncryptionEnabled: encryptionErr == nil,
+		Deduplication:     contentStoreEnabled(),
+		Tenants:           tenantNames(),
+		ActionAliases:     actionAliases(),
+		AllowedEndpoints:  allowedEndpoints(),
+		KeyNormalization:  currentKeyNormalization().names(),
+		ReadOnly:          readOnlyMode(),
+		Versioning:        versioningEnabled(),
+		KeepVersions:      keepVersionsDefault(),
+		Limits: map[string]int64{
+			"maxBatchRetrieveItems": maxBatchRetrieveItems,
+			"maxInlineBytes":        maxInlineBytes(nil),
+			"maxRetrieveInline":     maxRetrieveInline(),
+			"listPageSize":          listPageSize(),
+			"maxListKeys":           maxListKeys(),
+			"notFoundTTLSeconds":    int64(notFoundTTL().Seconds()),
+			"resultCacheBytes":      resultCacheCapacity(),
+			"requestTimeoutMs":      requestTimeout().Milliseconds(),
+		},
+		TypeSizeLimits: typeSizeLimits(),
+	}
+}
+
+// handleConfig handles GET /v1/api/config
+func handleConfig(c echo.Context) error {
+	return respondJSON(c, http.StatusOK, currentConfig())
+}
+
+// redactSecret keeps only the first characters of a secret so operators can
+// tell which credential is in use without exposing it
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 4 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", len(secret)-4)
+}
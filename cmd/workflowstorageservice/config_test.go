@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestRedactSecret(t *testing.T) {
+	tests := []struct {
+		secret string
+		want   string
+	}{
+		{"", ""},
+		{"abc", "***"},
+		{"AKIAEXAMPLE", "AKIA*******"},
+	}
+
+	for _, tt := range tests {
+		if got := redactSecret(tt.secret); got != tt.want {
+			t.Errorf("redactSecret(%q) = %q, want %q", tt.secret, got, tt.want)
+		}
+	}
+}
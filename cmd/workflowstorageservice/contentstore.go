@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// casKeyPrefix holds deduplicated content, one object per SHA-256
+	casKeyPrefix = "cas"
+
+	// casRefsKeyPrefix holds one marker per key referencing a content
+	// object: cas-refs/{sha256}/{sha256 of the referencing key}
+	casRefsKeyPrefix = "cas-refs"
+
+	// metadataContentRef is the SHA-256 of the content a reference object
+	// points to
+	metadataContentRef = "content-ref"
+
+	// metadataContentSize is the size of the referenced content, reported
+	// as the reference's Content-Length
+	metadataContentSize = "content-size"
+
+	// minDedupBytes is the smallest object stored through the content store;
+	// below it a reference would save nothing
+	minDedupBytes = 1024
+)
+
+// contentStoreEnabled reports whether WORKFLOW_STORAGE_DEDUPLICATE is set
+func contentStoreEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("WORKFLOW_STORAGE_DEDUPLICATE"))
+	return enabled
+}
+
+// casKey returns the key of the content object with SHA-256 sum
+func casKey(sum string) string {
+	return casKeyPrefix + "/" + sum
+}
+
+// casRefKey returns the marker recording that key references sum
+func casRefKey(sum, key string) string {
+	return casRefsKeyPrefix + "/" + sum + "/" + sha256Hex([]byte(key))
+}
+
+// contentStore deduplicates stored objects. Content of at least
+// minDedupBytes is written once to cas/{sha256} in the same bucket, and the
+// object's own key holds a small JSON reference to it carrying the object's
+// metadata. Reads follow references transparently, so every handler sees the
+// original content. Each referencing key has a marker below
+// cas-refs/{sha256}/; overwriting or deleting the last reference deletes the
+// content. Encrypted and in-progress objects are stored as is.
+type contentStore struct {
+	Storage
+}
+
+// contentReference is the body of a reference object
+type contentReference struct {
+	ContentRef  string `json:"contentRef"`
+	SHA256      string `json:"sha256"`
+	ContentSize int    `json:"contentSize"`
+}
+
+// internalKey reports whether key belongs to the content store itself
+func internalKey(key string) bool {
+	return strings.HasPrefix(key, casKeyPrefix+"/") || strings.HasPrefix(key, casRefsKeyPrefix+"/")
+}
+
+// referenceOf returns the content SHA-256 bucket/key references, or "" when
+// it is a plain object or does not exist
+func (s contentStore) referenceOf(ctx context.Context, bucket, key string) (string, error) {
+	head, err := s.Storage.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFoundError(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return head.Metadata[metadataContentRef], nil
+}
+
+func (s contentStore) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	bucket, key := aws.ToString(params.Bucket), aws.ToString(params.Key)
+	if internalKey(key) || params.Body == nil {
+		return s.Storage.PutObject(ctx, params, optFns...)
+	}
+
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.referenceOf(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	input := *params
+	input.Body = bytes.NewReader(data)
+	current := ""
+	if len(data) >= minDedupBytes && !isEncrypted(params.Metadata) && params.Metadata[metadataInProgress] == "" {
+		current = sha256Hex(data)
+		stored := false
+		if err := s.addReference(ctx, bucket, key, current, func() error {
+			stored = true
+			_, err := s.Storage.PutObject(ctx, &s3.PutObjectInput{
+				Bucket:      params.Bucket,
+				Key:         aws.String(casKey(current)),
+				Body:        bytes.NewReader(data),
+				ContentType: params.ContentType,
+				Metadata:    withChecksum(nil, data),
+			}, optFns...)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		if stored {
+			dedupMetrics.recordMiss()
+		} else {
+			dedupMetrics.recordHit(int64(len(data)))
+		}
+
+		reference, _ := json.Marshal(contentReference{ContentRef: casKey(current), SHA256: current, ContentSize: len(data)})
+		input.Body = bytes.NewReader(reference)
+		input.Metadata = make(map[string]string, len(params.Metadata)+2)
+		for k, v := range params.Metadata {
+			input.Metadata[k] = v
+		}
+		input.Metadata[metadataContentRef] = current
+		input.Metadata[metadataContentSize] = strconv.Itoa(len(data))
+	}
+
+	out, err := s.Storage.PutObject(ctx, &input, optFns...)
+	if err != nil {
+		if current != "" && current != previous {
+			s.dropReference(ctx, bucket, key, current)
+		}
+		return nil, err
+	}
+	if previous != "" && previous != current {
+		s.dropReference(ctx, bucket, key, previous)
+	}
+	return out, nil
+}
+
+// GetObject follows references to the shared content
+func (s contentStore) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	out, err := s.Storage.GetObject(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	sum := out.Metadata[metadataContentRef]
+	if sum == "" {
+		return out, nil
+	}
+	out.Body.Close()
+
+	content, err := s.Storage.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: params.Bucket,
+		Key:    aws.String(casKey(sum)),
+	}, optFns...)
+	if err != nil {
+		return nil, fmt.Errorf("content %s of %s: %w", sum, aws.ToString(params.Key), err)
+	}
+	out.Body = content.Body
+	out.ContentLength = content.ContentLength
+	return out, nil
+}
+
+func (s contentStore) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	out, err := s.Storage.HeadObject(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	if size, err := strconv.ParseInt(out.Metadata[metadataContentSize], 10, 64); err == nil && out.Metadata[metadataContentRef] != "" {
+		out.ContentLength = aws.Int64(size)
+	}
+	return out, nil
+}
+
+// ListObjectsV2 reports the content size of references, like HeadObject.
+// Listings carry no metadata, so only objects whose size is that of a
+// reference body are checked with HeadObject.
+func (s contentStore) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	out, err := s.Storage.ListObjectsV2(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	for i, obj := range out.Contents {
+		key := aws.ToString(obj.Key)
+		if internalKey(key) || !mayBeReference(aws.ToInt64(obj.Size)) {
+			continue
+		}
+		head, err := s.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: params.Bucket,
+			Key:    obj.Key,
+		}, optFns...)
+		if isNotFoundError(err) {
+			// Deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out.Contents[i].Size = head.ContentLength
+	}
+	return out, nil
+}
+
+// mayBeReference reports whether an object of size bytes can be a reference
+// object: reference bodies differ only in the digits of contentSize, which is
+// at least minDedupBytes
+func mayBeReference(size int64) bool {
+	return size >= referenceSize(minDedupBytes) && size <= referenceSize(math.MaxInt)
+}
+
+// referenceSize returns the body size of a reference to content of
+// contentSize bytes
+func referenceSize(contentSize int) int64 {
+	sum := strings.Repeat("0", 64)
+	reference, _ := json.Marshal(contentReference{ContentRef: casKey(sum), SHA256: sum, ContentSize: contentSize})
+	return int64(len(reference))
+}
+
+// CopyObject copies references as references. The destination gets its own
+// marker, and the content is copied along when the destination is another
+// bucket.
+func (s contentStore) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	bucket, key := aws.ToString(params.Bucket), aws.ToString(params.Key)
+	if internalKey(key) {
+		return s.Storage.CopyObject(ctx, params, optFns...)
+	}
+	previous, err := s.referenceOf(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := s.Storage.CopyObject(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.referenceOf(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if current != "" && current != previous {
+		sourceBucket := copySourceBucket(aws.ToString(params.CopySource))
+		if err := s.addReference(ctx, bucket, key, current, func() error {
+			_, err := s.Storage.CopyObject(ctx, &s3.CopyObjectInput{
+				Bucket:     params.Bucket,
+				Key:        aws.String(casKey(current)),
+				CopySource: aws.String(copySource(sourceBucket, casKey(current))),
+			}, optFns...)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if previous != "" && previous != current {
+		s.dropReference(ctx, bucket, key, previous)
+	}
+	return out, nil
+}
+
+func (s contentStore) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	bucket, key := aws.ToString(params.Bucket), aws.ToString(params.Key)
+	if internalKey(key) {
+		return s.Storage.DeleteObject(ctx, params, optFns...)
+	}
+	previous, err := s.referenceOf(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := s.Storage.DeleteObject(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	if previous != "" {
+		s.dropReference(ctx, bucket, key, previous)
+	}
+	return out, nil
+}
+
+// addReference records that bucket/key references content sum, calling
+// store first when the content is not in the bucket's content store yet
+func (s contentStore) addReference(ctx context.Context, bucket, key, sum string, store func() error) error {
+	unlock := objectLocks.Lock(bucket, casKey(sum))
+	defer unlock()
+
+	_, err := s.Storage.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(casKey(sum)),
+	})
+	if isNotFoundError(err) {
+		err = store()
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Storage.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(casRefKey(sum, key)),
+		Body:        strings.NewReader(key),
+		ContentType: aws.String("text/plain"),
+	})
+	return err
+}
+
+// dropReference removes the marker of bucket/key on content sum and deletes
+// the content when no other key references it. Failures only leave unused
+// content behind, so they are logged rather than returned.
+func (s contentStore) dropReference(ctx context.Context, bucket, key, sum string) {
+	unlock := objectLocks.Lock(bucket, casKey(sum))
+	defer unlock()
+
+	if _, err := s.Storage.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(casRefKey(sum, key)),
+	}); err != nil {
+		log.Printf("Failed to drop content reference of %s on %s: %v", key, sum, err)
+		return
+	}
+
+	remaining, err := s.Storage.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(casRefsKeyPrefix + "/" + sum + "/"),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		log.Printf("Failed to count content references of %s: %v", sum, err)
+		return
+	}
+	if len(remaining.Contents) > 0 {
+		return
+	}
+	if _, err := s.Storage.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(casKey(sum)),
+	}); err != nil {
+		log.Printf("Failed to delete unreferenced content %s: %v", sum, err)
+	}
+}
+
+// copySourceBucket returns the bucket of a CopySource written by copySource
+func copySourceBucket(source string) string {
+	if unescaped, err := url.PathUnescape(source); err == nil {
+		source = unescaped
+	}
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	return bucket
+}
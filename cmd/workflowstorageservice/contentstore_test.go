@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+func TestContentStore_DeduplicatesAcrossWorkflows(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_DEDUPLICATE", "true")
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(workflowID, body string, handler func(echo.Context, *semantic.SemanticAction) error) (*httptest.ResponseRecorder, error) {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", workflowID)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		return rec, handler(c, action)
+	}
+	create := func(workflowID, text string) {
+		t.Helper()
+		if _, err := run(workflowID, `{"@type": "CreateAction", "identifier": "input",
+			"object": {"@type": "DigitalDocument", "text": "`+text+`"}}`, handleSemanticStoreImpl); err != nil {
+			t.Fatalf("Store in %s failed: %v", workflowID, err)
+		}
+	}
+	remove := func(workflowID string) {
+		t.Helper()
+		if _, err := run(workflowID, `{"@type": "DeleteAction", "object": {"@type": "DigitalDocument",
+			"contentUrl": "s3://px-semantic/workflow-results/`+workflowID+`/input.json"}}`, handleSemanticDeleteImpl); err != nil {
+			t.Fatalf("Delete in %s failed: %v", workflowID, err)
+		}
+	}
+	count := func(prefix string) int {
+		n := 0
+		for id := range store.objects {
+			if strings.HasPrefix(id, defaultBucket()+"/"+prefix) {
+				n++
+			}
+		}
+		return n
+	}
+
+	before := dedupMetrics.snapshot()
+	shared := `{\"rows\": \"` + strings.Repeat("x", 2*minDedupBytes) + `\"}`
+	create("wf-1", shared)
+	create("wf-2", shared)
+
+	// The first store writes the content, the second only references it
+	after := dedupMetrics.snapshot()
+	if hits, misses := after.Hits-before.Hits, after.Misses-before.Misses; hits != 1 || misses != 1 {
+		t.Errorf("Dedup metrics: %d hits, %d misses, want 1 each", hits, misses)
+	}
+	if saved := after.BytesSaved - before.BytesSaved; saved != int64(len(`{"rows": "`)+2*minDedupBytes+len(`"}`)) {
+		t.Errorf("Dedup metrics: %d bytes saved", saved)
+	}
+
+	// Listings report the content size, not the reference size
+	listed, err := contentStore{store}.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket: aws.String(defaultBucket()),
+		Prefix: aws.String("workflow-results/"),
+	})
+	if err != nil {
+		t.Fatalf("ListObjectsV2() error = %v", err)
+	}
+	for _, obj := range listed.Contents {
+		if size := aws.ToInt64(obj.Size); size != int64(len(`{"rows": "`)+2*minDedupBytes+len(`"}`)) {
+			t.Errorf("Listed size of %s = %d, want the content size", aws.ToString(obj.Key), size)
+		}
+	}
+
+	if count(casKeyPrefix+"/") != 1 || count(casRefsKeyPrefix+"/") != 2 {
+		t.Fatalf("Expected one content object and two references, have %v", keysOf(store.objects))
+	}
+	if ref := store.objects[defaultBucket()+"/workflow-results/wf-2/input.json"]; len(ref.data) >= minDedupBytes || ref.metadata[metadataContentRef] == "" {
+		t.Errorf("Result key should hold a small reference, got %d bytes", len(ref.data))
+	}
+
+	for _, workflowID := range []string{"wf-1", "wf-2"} {
+		rec, err := run(workflowID, `{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "identifier": "input"}}`, handleSemanticRetrieveImpl)
+		if err != nil || !strings.Contains(rec.Body.String(), strings.Repeat("x", 2*minDedupBytes)) {
+			t.Errorf("Retrieve in %s = %v, want the original content", workflowID, err)
+		}
+	}
+
+	// The content survives as long as one reference remains
+	remove("wf-1")
+	if count(casKeyPrefix+"/") != 1 || count(casRefsKeyPrefix+"/") != 1 {
+		t.Errorf("After the first delete have %v", keysOf(store.objects))
+	}
+
+	// Overwriting with other content releases the old content
+	create("wf-2", `{\"rows\": \"`+strings.Repeat("y", 2*minDedupBytes)+`\"}`)
+	if count(casKeyPrefix+"/") != 1 || count(casRefsKeyPrefix+"/") != 1 {
+		t.Errorf("After the overwrite have %v", keysOf(store.objects))
+	}
+
+	remove("wf-2")
+	if count(casKeyPrefix+"/") != 0 || count(casRefsKeyPrefix+"/") != 0 {
+		t.Errorf("Unreferenced content was not purged, have %v", keysOf(store.objects))
+	}
+}
+
+func TestContentStore_SmallObjectsStoredAsIs(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_DEDUPLICATE", "true")
+
+	store := newFakeStorage()
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "CreateAction", "identifier": "small",
+		"object": {"@type": "DigitalDocument", "text": "{\"v\": 1}"}}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	req.Header.Set("X-Workflow-ID", "wf-1")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.Set(storageContextKey, store)
+	if err := handleSemanticStoreImpl(c, action); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	if len(store.objects) != 1 {
+		t.Errorf("Small object should bypass the content store, have %v", keysOf(store.objects))
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// maxConvertRows bounds the number of rows converted between CSV and JSON
+const maxConvertRows = 10000
+
+// conversionTarget returns the media type a stored object should be converted
+// to for the given Accept header, or "" when no conversion applies. Only
+// CSV -> JSON and JSON -> CSV are supported.
+func conversionTarget(accept, contentType string) string {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	accept = strings.ToLower(accept)
+
+	switch {
+	case mediaType == "text/csv" && strings.Contains(accept, "application/json"):
+		return "application/json"
+	case mediaType == "application/json" && strings.Contains(accept, "text/csv"):
+		return "text/csv"
+	}
+	return ""
+}
+
+// convertData converts data to the target media type
+func convertData(data []byte, target string) ([]byte, error) {
+	switch target {
+	case "application/json":
+		return csvToJSON(data)
+	case "text/csv":
+		return jsonToCSV(data)
+	}
+	return nil, fmt.Errorf("unsupported conversion target: %s", target)
+}
+
+// csvToJSON turns CSV with a header row into a JSON array of objects
+func csvToJSON(data []byte) ([]byte, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	rows := make([]map[string]string, 0)
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		if len(rows) >= maxConvertRows {
+			return nil, fmt.Errorf("too many rows to convert (max %d)", maxConvertRows)
+		}
+
+		row := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(record) {
+				row[column] = record[i]
+			} else {
+				row[column] = ""
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return json.Marshal(rows)
+}
+
+// jsonToCSV flattens a JSON array of objects into CSV. Columns are the sorted
+// union of all keys; nested values are written as JSON.
+func jsonToCSV(data []byte) ([]byte, error) {
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("only JSON arrays of objects can be converted to CSV: %w", err)
+	}
+	if len(rows) > maxConvertRows {
+		return nil, fmt.Errorf("too many rows to convert (max %d)", maxConvertRows)
+	}
+
+	columnSet := make(map[string]struct{})
+	for _, row := range rows {
+		for column := range row {
+			columnSet[column] = struct{}{}
+		}
+	}
+	columns := make([]string, 0, len(columnSet))
+	for column := range columnSet {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(columns); err != nil {
+		return nil, err
+	}
+
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, column := range columns {
+			record[i] = csvCell(row[column])
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// csvCell renders a JSON value as a CSV cell
+func csvCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(encoded)
+	default:
+		return fmt.Sprint(v)
+	}
+}
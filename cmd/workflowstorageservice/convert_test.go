@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestCSVToJSON(t *testing.T) {
+	got, err := csvToJSON([]byte("name,count\nalpha,1\nbeta,2\n"))
+	if err != nil {
+		t.Fatalf("csvToJSON() error = %v", err)
+	}
+
+	want := `[{"count":"1","name":"alpha"},{"count":"2","name":"beta"}]`
+	if string(got) != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestJSONToCSV(t *testing.T) {
+	got, err := jsonToCSV([]byte(`[{"name": "alpha", "count": 1}, {"name": "beta", "tags": ["x"]}]`))
+	if err != nil {
+		t.Fatalf("jsonToCSV() error = %v", err)
+	}
+
+	want := "count,name,tags\n1,alpha,\n,beta,\"[\"\"x\"\"]\"\n"
+	if string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	if _, err := jsonToCSV([]byte(`{"not": "an array"}`)); err == nil {
+		t.Error("jsonToCSV() should reject non-array JSON")
+	}
+}
+
+func TestConversionTarget(t *testing.T) {
+	if got := conversionTarget("application/json", "text/csv"); got != "application/json" {
+		t.Errorf("Expected CSV to convert to JSON, got %q", got)
+	}
+	if got := conversionTarget("text/csv", "application/json"); got != "text/csv" {
+		t.Errorf("Expected JSON to convert to CSV, got %q", got)
+	}
+	if got := conversionTarget("application/json", "application/json"); got != "" {
+		t.Errorf("Expected no conversion, got %q", got)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/labstack/echo/v4"
+)
+
+// handleSemanticCopyImpl copies a stored result to another workflow. Without
+// transforms the body is copied server-side. With a "transforms" list (e.g.
+// ["json-minify", "gzip"]) the source is streamed through the chain into a
+// temporary file and uploaded from there, so memory use stays bounded for
+// large objects.
+//
+// The destination is "targetUrl" (s3://) or built from "targetWorkflowId" and
+// "targetIdentifier", which defaults to the source file name.
+func handleSemanticCopyImpl(c echo.Context, action *semantic.SemanticAction) error {
+	if action.Object == nil || action.Object.ContentUrl == "" {
+		return returnActionError(c, action, "object.contentUrl is required (source s3:// location)", nil)
+	}
+	sourceBucket, sourceKey, err := parseContentURL(action.Object.ContentUrl)
+	if err != nil {
+		return returnActionError(c, action, err.Error(), nil)
+	}
+	if err := checkTenantScope(c, sourceKey); err != nil {
+		return err
+	}
+
+	names := stringListProperty(action, "transforms")
+	chain, err := transformChain(names)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	store := storageFor(c)
+	ctx := c.Request().Context()
+
+	head, err := store.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(sourceBucket),
+		Key:    aws.String(sourceKey),
+	})
+	if err != nil {
+		logf(c, "Failed to stat %s: %v", sourceKey, err)
+		return returnActionError(c, action, "data not found", err)
+	}
+
+	// The destination key depends on the transformed content type when type folders are enabled
+	contentType := aws.ToString(head.ContentType)
+	for _, transform := range chain {
+		contentType = transform.contentType(contentType)
+	}
+	if format, ok := action.Properties["targetEncodingFormat"].(string); ok && format != "" {
+		contentType = format
+	}
+
+	target, err := copyTarget(c, action, sourceKey, contentType)
+	if err != nil {
+		return returnActionError(c, action, err.Error(), nil)
+	}
+	bucket, targetKey := target.Bucket, target.Key
+	if err := checkTenantScope(c, targetKey); err != nil {
+		return err
+	}
+	if bucket == sourceBucket && targetKey == sourceKey {
+		return returnActionError(c, action, "source and target are the same object", nil)
+	}
+
+	unlock := objectLocks.Lock(bucket, targetKey)
+	defer unlock()
+
+	if err := checkMutable(ctx, c, store, bucket, targetKey); err != nil {
+		if errors.Is(err, errImmutable) {
+			return immutableConflict(targetKey, err)
+		}
+		return returnActionError(c, action, "Failed to check target object", err)
+	}
+	if err := checkLock(ctx, c, store, bucket, targetKey, stringProperty(action, "lockOwner")); err != nil {
+		if errors.Is(err, errLocked) {
+			return lockedResponse(targetKey, err)
+		}
+		return returnActionError(c, action, "Failed to check lock", err)
+	}
+
+	var size int64
+	if len(chain) == 0 {
+		size = aws.ToInt64(head.ContentLength)
+		_, err = store.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(targetKey),
+			CopySource:        aws.String(copySource(sourceBucket, sourceKey)),
+			ContentType:       aws.String(contentType),
+			Metadata:          withoutImmutable(head.Metadata),
+			MetadataDirective: types.MetadataDirectiveReplace,
+		})
+	} else {
+		size, err = copyTransformed(ctx, store, Route{Bucket: sourceBucket, Key: sourceKey}, target, contentType, chain)
+	}
+	if err != nil {
+		logf(c, "Failed to copy %s to %s: %v", sourceKey, targetKey, err)
+		return returnActionError(c, action, "Failed to copy data", err)
+	}
+	missingObjects.forget(bucket, targetKey)
+	resultCache.forget(bucket, targetKey)
+
+	logf(c, "Copied workflow result %s to %s (transforms: %v)", sourceKey, targetKey, names)
+
+	action.Result = &semantic.SemanticResult{
+		Type:   "DigitalDocument",
+		Format: contentType,
+		Value: map[string]interface{}{
+			"contentUrl":     fmt.Sprintf("s3://%s/%s", bucket, targetKey),
+			"sourceUrl":      action.Object.ContentUrl,
+			"encodingFormat": contentType,
+			"contentSize":    size,
+			"transforms":     names,
+		},
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// copyTarget resolves the destination of a CopyAction
+func copyTarget(c echo.Context, action *semantic.SemanticAction, sourceKey, contentType string) (Route, error) {
+	if targetURL, ok := action.Properties["targetUrl"].(string); ok && targetURL != "" {
+		bucket, key, err := parseContentURL(targetURL)
+		return Route{Bucket: bucket, Key: key}, err
+	}
+
+	workflowID, _ := action.Properties["targetWorkflowId"].(string)
+	if workflowID == "" {
+		return Route{}, errors.New("targetUrl or targetWorkflowId is required")
+	}
+	identifier, _ := action.Properties["targetIdentifier"].(string)
+	if identifier == "" {
+		base := path.Base(sourceKey)
+		identifier = strings.TrimSuffix(base, path.Ext(base))
+	}
+	route, err := routeResult(RouteRequest{
+		WorkflowID: workflowID,
+		Identifier: identifier,
+		Format:     contentType,
+		Type:       stringProperty(action, "type"),
+		Properties: action.Properties,
+		Tenant:     tenantFor(c),
+	})
+	return route, err
+}
+
+// copyTransformed streams the source through chain into a temporary file and
+// uploads it to target. Encrypted sources are decrypted in memory and the
+// result is encrypted again, so a copy never leaves plaintext behind.
+func copyTransformed(ctx context.Context, store Storage, source, target Route, contentType string, chain []contentTransform) (int64, error) {
+	result, err := store.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(source.Bucket),
+		Key:    aws.String(source.Key),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer result.Body.Close()
+
+	encrypted := isEncrypted(result.Metadata)
+	var src io.Reader = result.Body
+	if isEncoded(result.Metadata) {
+		data, err := io.ReadAll(result.Body)
+		if err != nil {
+			return 0, err
+		}
+		plaintext, err := decodePayload(data, result.Metadata)
+		if err != nil {
+			return 0, err
+		}
+		src = bytes.NewReader(plaintext)
+	}
+
+	transformed, _ := applyTransforms(src, aws.ToString(result.ContentType), chain)
+	defer transformed.Close()
+
+	tmp, err := os.CreateTemp("", "workflowstorage-copy-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), transformed)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// Like withChecksum, encrypted copies get no plaintext digest
+	metadata := make(map[string]string)
+	var body io.Reader = tmp
+	if encrypted {
+		plaintext, err := io.ReadAll(tmp)
+		if err != nil {
+			return 0, err
+		}
+		ciphertext, encryptionMetadata, err := encryptPayload(plaintext)
+		if err != nil {
+			return 0, err
+		}
+		for k, v := range encryptionMetadata {
+			metadata[k] = v
+		}
+		body = bytes.NewReader(ciphertext)
+	} else {
+		metadata[metadataChecksumSHA256] = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	_, err = store.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(target.Bucket),
+		Key:         aws.String(target.Key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+		Metadata:    metadata,
+	})
+	return size, err
+}
+
+// withoutImmutable copies metadata without the immutable flag and retention
+// period; a copy starts out mutable like any freshly stored result
+func withoutImmutable(metadata map[string]string) map[string]string {
+	out := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		if k != metadataImmutable && k != metadataRetainUntil {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// handleSemanticCopy wraps the implementation to match ActionHandler signature
+func handleSemanticCopy(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticCopyImpl(c, action)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestApplyTransforms_Chain(t *testing.T) {
+	if _, err := transformChain([]string{"json-minify", "gzip", "base64-encode", "base64-decode", "gunzip"}); err == nil {
+		t.Error("Expected chains longer than maxCopyTransforms to be rejected")
+	}
+	if _, err := transformChain([]string{"rot13"}); err == nil {
+		t.Error("Expected unknown transform to be rejected")
+	}
+
+	chain, err := transformChain([]string{"json-minify", "gzip", "base64-encode"})
+	if err != nil {
+		t.Fatalf("transformChain() error = %v", err)
+	}
+	out, contentType := applyTransforms(strings.NewReader("{ \"a\" : \"b c\",\n \"d\": [1, 2] }"), "application/json", chain)
+	encoded, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if contentType != "text/plain" {
+		t.Errorf("Expected text/plain, got %q", contentType)
+	}
+
+	back, _ := transformChain([]string{"base64-decode", "gunzip"})
+	out, _ = applyTransforms(bytes.NewReader(encoded), contentType, back)
+	decoded, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if want := `{"a":"b c","d":[1,2]}`; string(decoded) != want {
+		t.Errorf("Round trip = %q, want %q", decoded, want)
+	}
+}
+
+func TestApplyTransforms_PropagatesErrors(t *testing.T) {
+	chain, _ := transformChain([]string{"gunzip", "base64-encode"})
+	out, _ := applyTransforms(strings.NewReader("not gzip"), "application/gzip", chain)
+	if _, err := io.ReadAll(out); err == nil {
+		t.Error("Expected gunzip error to reach the reader")
+	}
+}
+
+func TestSemanticCopy_WithTransforms(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+	store.objects["px-semantic/workflow-results/wf-1/report.json"] = fakeObject{
+		data:        []byte("{\n  \"ok\": true\n}"),
+		contentType: "application/json",
+		metadata:    map[string]string{metadataImmutable: "true"},
+	}
+
+	run := func(body string) error {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return handleSemanticCopyImpl(c, action)
+	}
+
+	if err := run(`{"@type": "CopyAction", "targetWorkflowId": "wf-2", "transforms": ["json-minify", "gzip"],
+		"object": {"@type": "DigitalDocument", "contentUrl": "s3://px-semantic/workflow-results/wf-1/report.json"}}`); err != nil {
+		t.Fatalf("handleSemanticCopyImpl() error = %v", err)
+	}
+
+	copied, ok := store.objects["px-semantic/workflow-results/wf-2/report.json"]
+	if !ok {
+		t.Fatal("Expected copy in the target workflow")
+	}
+	if copied.contentType != "application/gzip" {
+		t.Errorf("Expected application/gzip, got %q", copied.contentType)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(copied.data))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	plain, _ := io.ReadAll(zr)
+	if string(plain) != `{"ok":true}` {
+		t.Errorf("Unexpected copied content %q", plain)
+	}
+	if copied.metadata[metadataChecksumSHA256] != sha256Hex(copied.data) {
+		t.Error("Expected checksum of the transformed content")
+	}
+
+	// A plain copy is server-side and drops the immutable flag
+	if err := run(`{"@type": "CopyAction", "targetWorkflowId": "wf-3",
+		"object": {"@type": "DigitalDocument", "contentUrl": "s3://px-semantic/workflow-results/wf-1/report.json"}}`); err != nil {
+		t.Fatalf("handleSemanticCopyImpl() error = %v", err)
+	}
+	plainCopy := store.objects["px-semantic/workflow-results/wf-3/report.json"]
+	if string(plainCopy.data) != "{\n  \"ok\": true\n}" || plainCopy.metadata[metadataImmutable] != "" {
+		t.Errorf("Unexpected plain copy %+v", plainCopy)
+	}
+}
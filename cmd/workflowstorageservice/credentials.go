@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+	"github.com/labstack/echo/v4"
+)
+
+// credentialReloadInterval limits how often failing requests reload credentials
+const credentialReloadInterval = 10 * time.Second
+
+// credentialErrorMessage is returned to clients while S3 rejects the credentials
+const credentialErrorMessage = "storage credentials expired or invalid; the service is reloading them, retry shortly"
+
+// credentialErrorCodes are the S3 error codes of expired or revoked credentials
+var credentialErrorCodes = map[string]bool{
+	"ExpiredToken":          true,
+	"ExpiredTokenException": true,
+	"InvalidAccessKeyId":    true,
+	"InvalidToken":          true,
+	"TokenRefreshRequired":  true,
+}
+
+// s3Credentials caches the S3 credentials; invalidating it makes the next
+// request read them again from HETZNER_S3_CREDENTIALS_FILE, the environment
+// or the AWS default credential chain
+var s3Credentials *aws.CredentialsCache
+
+// s3CredentialSource names where the S3 credentials come from, for /v1/api/config
+var s3CredentialSource string
+
+var (
+	credentialReloadMu   sync.Mutex
+	lastCredentialReload time.Time
+)
+
+// s3CredentialsFile is the JSON document of HETZNER_S3_CREDENTIALS_FILE,
+// e.g. a mounted secret that is rotated in place
+type s3CredentialsFile struct {
+	AccessKeyID     string `json:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+}
+
+// loadS3Credentials reads the current credentials. HETZNER_S3_CREDENTIALS_FILE
+// takes precedence over HETZNER_S3_ACCESS_KEY, HETZNER_S3_SECRET_KEY and
+// HETZNER_S3_SESSION_TOKEN.
+func loadS3Credentials(ctx context.Context) (aws.Credentials, error) {
+	if path := os.Getenv("HETZNER_S3_CREDENTIALS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return aws.Credentials{}, fmt.Errorf("failed to read credentials file: %w", err)
+		}
+		var file s3CredentialsFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return aws.Credentials{}, fmt.Errorf("invalid credentials file %s: %w", path, err)
+		}
+		if file.AccessKeyID == "" || file.SecretAccessKey == "" {
+			return aws.Credentials{}, fmt.Errorf("credentials file %s lacks accessKeyId or secretAccessKey", path)
+		}
+		return aws.Credentials{
+			AccessKeyID:     file.AccessKeyID,
+			SecretAccessKey: file.SecretAccessKey,
+			SessionToken:    file.SessionToken,
+			Source:          "HETZNER_S3_CREDENTIALS_FILE",
+		}, nil
+	}
+
+	return aws.Credentials{
+		AccessKeyID:     os.Getenv("HETZNER_S3_ACCESS_KEY"),
+		SecretAccessKey: os.Getenv("HETZNER_S3_SECRET_KEY"),
+		SessionToken:    os.Getenv("HETZNER_S3_SESSION_TOKEN"),
+		Source:          "environment",
+	}, nil
+}
+
+// explicitS3Credentials reports whether credentials are configured for the
+// service itself (HETZNER_S3_CREDENTIALS_FILE or the HETZNER_S3_* keys)
+// rather than left to the AWS default credential chain
+func explicitS3Credentials() bool {
+	return os.Getenv("HETZNER_S3_CREDENTIALS_FILE") != "" ||
+		os.Getenv("HETZNER_S3_ACCESS_KEY") != "" ||
+		os.Getenv("HETZNER_S3_SECRET_KEY") != ""
+}
+
+// isCredentialError reports whether S3 rejected a request because its
+// credentials expired or are no longer valid
+func isCredentialError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && credentialErrorCodes[apiErr.ErrorCode()]
+}
+
+// reloadCredentials drops the cached S3 credentials so the next request
+// loads them again. Calls are rate limited so a burst of failing requests
+// reloads once.
+func reloadCredentials() {
+	if s3Credentials == nil {
+		return
+	}
+
+	credentialReloadMu.Lock()
+	defer credentialReloadMu.Unlock()
+	if time.Since(lastCredentialReload) < credentialReloadInterval {
+		return
+	}
+	lastCredentialReload = time.Now()
+
+	s3Credentials.Invalidate()
+	log.Printf("S3 rejected the storage credentials; reloading them")
+}
+
+// credentialUnavailable turns a credential error into 503 Service Unavailable
+// with Retry-After and schedules a reload
+func credentialUnavailable(c echo.Context) error {
+	reloadCredentials()
+	c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", int(credentialReloadInterval.Seconds())))
+	return echo.NewHTTPError(http.StatusServiceUnavailable, credentialErrorMessage)
+}
+
+// storageErrorStatus maps a storage error to the status of legacy responses
+func storageErrorStatus(err error) int {
+	if isCredentialError(err) {
+		reloadCredentials()
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
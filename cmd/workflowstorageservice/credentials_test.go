@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/labstack/echo/v4"
+)
+
+// expiredStorage fails every read with an expired-token error
+type expiredStorage struct {
+	*fakeStorage
+}
+
+func (expiredStorage) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return nil, &smithy.GenericAPIError{Code: "ExpiredToken", Message: "The provided token has expired."}
+}
+
+func TestIsCredentialError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&smithy.GenericAPIError{Code: "ExpiredToken"}, true},
+		{&smithy.GenericAPIError{Code: "InvalidAccessKeyId"}, true},
+		{fmt.Errorf("wrapped: %w", &smithy.GenericAPIError{Code: "ExpiredTokenException"}), true},
+		{&smithy.GenericAPIError{Code: "NoSuchKey"}, false},
+		{errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := isCredentialError(tt.err); got != tt.want {
+			t.Errorf("isCredentialError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSemanticRetrieve_ExpiredCredentials(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "RetrieveAction",
+		"object": {"@type": "DigitalDocument", "contentUrl": "s3://px-semantic/workflow-results/default/expired.json"}}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), rec)
+	c.Set(storageContextKey, expiredStorage{newFakeStorage()})
+
+	err = handleSemanticRetrieveImpl(c, action)
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %v", err)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+	if missingObjects.isMissing("px-semantic", "workflow-results/default/expired.json") {
+		t.Error("Credential failures must not be cached as missing objects")
+	}
+}
+
+func TestFetchErrorStatus_ExpiredCredentials(t *testing.T) {
+	_, err := fetchObject(context.Background(), expiredStorage{newFakeStorage()}, "bucket", "key")
+	if got := fetchErrorStatus(err); got != http.StatusServiceUnavailable {
+		t.Errorf("fetchErrorStatus() = %d, want 503", got)
+	}
+	if got := fetchErrorMessage(err); got != credentialErrorMessage {
+		t.Errorf("fetchErrorMessage() = %q", got)
+	}
+}
+
+func TestLoadS3Credentials(t *testing.T) {
+	t.Setenv("HETZNER_S3_ACCESS_KEY", "env-key")
+	t.Setenv("HETZNER_S3_SECRET_KEY", "env-secret")
+	t.Setenv("HETZNER_S3_CREDENTIALS_FILE", "")
+
+	creds, err := loadS3Credentials(context.Background())
+	if err != nil || creds.AccessKeyID != "env-key" {
+		t.Fatalf("loadS3Credentials() = %+v, %v", creds, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, []byte(`{"accessKeyId": "rotated", "secretAccessKey": "s", "sessionToken": "t"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HETZNER_S3_CREDENTIALS_FILE", path)
+
+	creds, err = loadS3Credentials(context.Background())
+	if err != nil {
+		t.Fatalf("loadS3Credentials() error = %v", err)
+	}
+	if creds.AccessKeyID != "rotated" || creds.SessionToken != "t" {
+		t.Errorf("loadS3Credentials() = %+v, want the file credentials", creds)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"accessKeyId": "only"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadS3Credentials(context.Background()); err == nil {
+		t.Error("Expected an error for incomplete credentials")
+	}
+}
+
+func TestExplicitS3Credentials(t *testing.T) {
+	tests := []struct {
+		accessKey, secretKey, file string
+		want                       bool
+	}{
+		{"", "", "", false},
+		{"key", "secret", "", true},
+		{"key", "", "", true},
+		{"", "", "/run/secrets/s3.json", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("HETZNER_S3_ACCESS_KEY", tt.accessKey)
+		t.Setenv("HETZNER_S3_SECRET_KEY", tt.secretKey)
+		t.Setenv("HETZNER_S3_CREDENTIALS_FILE", tt.file)
+		if got := explicitS3Credentials(); got != tt.want {
+			t.Errorf("explicitS3Credentials() with %q/%q/%q = %v, want %v", tt.accessKey, tt.secretKey, tt.file, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// requestDeadlineHeader lets a caller bound how long a request may take. The
+// effective deadline is echoed back in the same header.
+const requestDeadlineHeader = "X-Request-Deadline"
+
+// requestTimeout returns WORKFLOW_STORAGE_REQUEST_TIMEOUT, the longest a
+// request may spend on storage operations; 0 means unbounded
+func requestTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("WORKFLOW_STORAGE_REQUEST_TIMEOUT"))
+	if err != nil || timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+// parseRequestDeadline parses an X-Request-Deadline value, either an RFC3339
+// timestamp or a duration relative to now ("1500ms", "2s")
+func parseRequestDeadline(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if deadline, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return deadline, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return time.Time{}, errors.New("invalid " + requestDeadlineHeader + ": use an RFC3339 timestamp or a positive duration such as 2s")
+	}
+	return now.Add(timeout), nil
+}
+
+// deadlineExceeded answers a request that ran out of time with 504
+func deadlineExceeded() error {
+	return echo.NewHTTPError(http.StatusGatewayTimeout, "request deadline exceeded")
+}
+
+// applyRequestDeadline bounds the request context by WORKFLOW_STORAGE_REQUEST_TIMEOUT
+// and X-Request-Deadline, whichever ends first, so S3 calls made with the
+// request context are cancelled in time. The header can only shorten the
+// configured timeout. A request that runs out of time is answered with 504
+// Gateway Timeout unless a response was already sent.
+func applyRequestDeadline(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		now := time.Now()
+		var deadline time.Time
+		if timeout := requestTimeout(); timeout > 0 {
+			deadline = now.Add(timeout)
+		}
+		if value := c.Request().Header.Get(requestDeadlineHeader); value != "" {
+			requested, err := parseRequestDeadline(value, now)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			if deadline.IsZero() || requested.Before(deadline) {
+				deadline = requested
+			}
+		}
+		if deadline.IsZero() {
+			return next(c)
+		}
+
+		c.Response().Header().Set(requestDeadlineHeader, deadline.UTC().Format(time.RFC3339Nano))
+		if !deadline.After(now) {
+			return deadlineExceeded()
+		}
+
+		ctx, cancel := context.WithDeadline(c.Request().Context(), deadline)
+		defer cancel()
+		c.SetRequest(c.Request().WithContext(ctx))
+
+		err := next(c)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Response().Committed {
+			logf(c, "Request deadline exceeded: %v", err)
+			return deadlineExceeded()
+		}
+		return err
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// deadlineStorage fails uploads whose context has ended, like the SDK does
+type deadlineStorage struct {
+	*fakeStorage
+}
+
+func (s deadlineStorage) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.fakeStorage.PutObject(ctx, params, optFns...)
+}
+
+func TestParseRequestDeadline(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, tt := range []struct {
+		value string
+		want  time.Time
+	}{
+		{"2026-01-02T03:04:10Z", now.Add(5 * time.Second)},
+		{"1500ms", now.Add(1500 * time.Millisecond)},
+		{" 2s ", now.Add(2 * time.Second)},
+	} {
+		got, err := parseRequestDeadline(tt.value, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseRequestDeadline(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"soon", "-1s", "0s", "2026-01-02"} {
+		if _, err := parseRequestDeadline(value, now); err == nil {
+			t.Errorf("parseRequestDeadline(%q) should fail", value)
+		}
+	}
+}
+
+func TestApplyRequestDeadline(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_REQUEST_TIMEOUT", "50ms")
+
+	// waitForStorage stands in for an S3 call that outlasts any deadline
+	var remaining time.Duration
+	waitForStorage := func(c echo.Context) error {
+		deadline, ok := c.Request().Context().Deadline()
+		if !ok {
+			return c.NoContent(http.StatusOK)
+		}
+		remaining = time.Until(deadline)
+		<-c.Request().Context().Done()
+		return c.Request().Context().Err()
+	}
+
+	run := func(deadline string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/api/workflows/wf-1", nil)
+		if deadline != "" {
+			req.Header.Set(requestDeadlineHeader, deadline)
+		}
+		rec := httptest.NewRecorder()
+		return rec, applyRequestDeadline(waitForStorage)(echo.New().NewContext(req, rec))
+	}
+
+	var httpErr *echo.HTTPError
+	rec, err := run("")
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("configured timeout: error = %v, want 504", err)
+	}
+	if rec.Header().Get(requestDeadlineHeader) == "" {
+		t.Errorf("%s was not echoed", requestDeadlineHeader)
+	}
+
+	// The header shortens the configured timeout but cannot extend it
+	if _, err := run("10ms"); !errors.As(err, &httpErr) || httpErr.Code != http.StatusGatewayTimeout || remaining > 10*time.Millisecond {
+		t.Errorf("shorter deadline: error = %v, remaining %v, want 504 within 10ms", err, remaining)
+	}
+	if _, err := run("1h"); !errors.As(err, &httpErr) || httpErr.Code != http.StatusGatewayTimeout || remaining > 50*time.Millisecond {
+		t.Errorf("longer deadline: error = %v, remaining %v, want the 50ms timeout", err, remaining)
+	}
+
+	if _, err := run(time.Now().Add(-time.Second).UTC().Format(time.RFC3339)); !errors.As(err, &httpErr) || httpErr.Code != http.StatusGatewayTimeout {
+		t.Errorf("past deadline: error = %v, want 504", err)
+	}
+	if _, err := run("whenever"); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("malformed deadline: error = %v, want 400", err)
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_REQUEST_TIMEOUT", "")
+	if rec, err := run(""); err != nil || rec.Code != http.StatusOK || rec.Header().Get(requestDeadlineHeader) != "" {
+		t.Errorf("no deadline: status %d, error = %v, want an unbounded request", rec.Code, err)
+	}
+}
+
+func TestStore_ExpiredDeadline(t *testing.T) {
+	resetStorageEnv(t)
+
+	store := deadlineStorage{newFakeStorage()}
+	newContext := func(body string) (echo.Context, *httptest.ResponseRecorder) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		t.Cleanup(cancel)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)).WithContext(ctx)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		return c, rec
+	}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "CreateAction", "identifier": "late",
+		"object": {"@type": "DigitalDocument", "text": "{}"}}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	c, _ := newContext("")
+	var httpErr *echo.HTTPError
+	if err := handleSemanticStoreImpl(c, action); !errors.As(err, &httpErr) || httpErr.Code != http.StatusGatewayTimeout {
+		t.Errorf("Semantic store: error = %v, want 504", err)
+	}
+
+	c, rec := newContext(`{"workflowId": "wf-1", "actionId": "late", "data": "{}"}`)
+	if err := handleStore(c); err != nil || rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Legacy store: status %d, error = %v, want 504", rec.Code, err)
+	}
+
+	if len(store.objects) != 0 {
+		t.Errorf("Stores past the deadline wrote %v", keysOf(store.objects))
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// handleSemanticDeleteImpl removes a stored result. Immutable objects are
+// rejected with 409 Conflict unless an admin override is present.
+func handleSemanticDeleteImpl(c echo.Context, action *semantic.SemanticAction) error {
+	if action.Object == nil || action.Object.ContentUrl == "" {
+		return returnActionError(c, action, "object.contentUrl is required (resource s3:// location)", nil)
+	}
+
+	bucket, key, err := parseContentURL(action.Object.ContentUrl)
+	if err != nil {
+		return returnActionError(c, action, err.Error(), nil)
+	}
+	if err := checkTenantScope(c, key); err != nil {
+		return err
+	}
+
+	store := storageFor(c)
+	ctx := c.Request().Context()
+
+	unlock := objectLocks.Lock(bucket, key)
+	defer unlock()
+
+	if status, err := evaluatePreconditions(ctx, c.Request(), store, bucket, key); err != nil {
+		return returnActionError(c, action, "Failed to check object", err)
+	} else if status != 0 {
+		return preconditionError(http.StatusPreconditionFailed, key)
+	}
+
+	if err := checkMutable(ctx, c, store, bucket, key); err != nil {
+		if errors.Is(err, errImmutable) {
+			return immutableConflict(key, err)
+		}
+		return returnActionError(c, action, "Failed to check object", err)
+	}
+	if err := checkLock(ctx, c, store, bucket, key, stringProperty(action, "lockOwner")); err != nil {
+		if errors.Is(err, errLocked) {
+			return lockedResponse(key, err)
+		}
+		return returnActionError(c, action, "Failed to check lock", err)
+	}
+
+	if _, err := store.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		logf(c, "Failed to delete %s: %v", key, err)
+		return returnActionError(c, action, "Failed to delete data", err)
+	}
+	resultCache.forget(bucket, key)
+	if err := deleteAccessStats(ctx, store, bucket, key); err != nil {
+		logf(c, "Failed to delete access stats for %s: %v", key, err)
+	}
+
+	logf(c, "Deleted workflow result: %s", key)
+
+	action.Result = &semantic.SemanticResult{
+		Type: "DigitalDocument",
+		Value: map[string]interface{}{
+			"contentUrl": action.Object.ContentUrl,
+			"deleted":    true,
+		},
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// handleSemanticDelete wraps the implementation to match ActionHandler signature
+func handleSemanticDelete(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticDeleteImpl(c, action)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+	"workflowstorageservice.evalgo.org/actions"
+)
+
+func TestSemanticDelete(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+	run := func(b *actions.Builder, handler func(echo.Context, *semantic.SemanticAction) error) (*semantic.SemanticAction, int, error) {
+		t.Helper()
+		action, err := b.Action()
+		if err != nil {
+			t.Fatalf("Action() error = %v", err)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), rec)
+		c.Set(storageContextKey, store)
+		err = handler(c, action)
+		return action, rec.Code, err
+	}
+
+	stored, _, err := run(actions.NewStoreAction().WithWorkflowID("wf-1").WithIdentifier("step-1").WithText(`{"ok": true}`), handleSemanticStoreImpl)
+	if err != nil {
+		t.Fatalf("Store error = %v", err)
+	}
+	contentURL := stored.Result.Value.(map[string]interface{})["contentUrl"].(string)
+
+	deleted, _, err := run(actions.NewDeleteAction().WithContentURL(contentURL), handleSemanticDeleteImpl)
+	if err != nil {
+		t.Fatalf("Delete error = %v", err)
+	}
+	if value := deleted.Result.Value.(map[string]interface{}); value["deleted"] != true || value["contentUrl"] != contentURL {
+		t.Errorf("Delete result = %v", value)
+	}
+	if len(store.objects) != 0 {
+		t.Errorf("Objects left after delete: %v", keysOf(store.objects))
+	}
+
+	// The deleted result can no longer be retrieved
+	if _, status, err := run(actions.NewRetrieveAction().WithContentURL(contentURL), handleSemanticRetrieveImpl); err == nil && status == http.StatusOK {
+		t.Error("Retrieve after delete should fail")
+	}
+
+	// Deleting requires an s3:// location
+	store.objects[defaultBucket()+"/workflow-results/wf-1/step-1.json"] = fakeObject{data: []byte(`{"ok": true}`)}
+	for name, b := range map[string]*actions.Builder{
+		"missing contentUrl": actions.NewDeleteAction().WithObjectIdentifier("step-1"),
+		"http contentUrl":    actions.NewDeleteAction().WithContentURL("https://example.com/workflow-results/wf-1/step-1.json"),
+	} {
+		if _, status, err := run(b, handleSemanticDeleteImpl); err == nil && status == http.StatusOK {
+			t.Errorf("%s: delete should fail", name)
+		}
+	}
+	if len(store.objects) != 1 {
+		t.Error("A rejected delete removed the object")
+	}
+}
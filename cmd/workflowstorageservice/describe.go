@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// handleSemanticDescribeImpl resolves where a result lives under the current
+// router configuration and reports whether it exists, without transferring
+// the body. The identifier comes from object.identifier or the action
+// identifier; workflowId, type and object.encodingFormat are applied exactly
+// as a store or retrieve would apply them.
+func handleSemanticDescribeImpl(c echo.Context, action *semantic.SemanticAction) error {
+	identifier := action.Identifier
+	format := ""
+	if action.Object != nil {
+		if action.Object.Identifier != "" {
+			identifier = action.Object.Identifier
+		}
+		format = action.Object.EncodingFormat
+	}
+	if identifier == "" {
+		return returnActionError(c, action, "object.identifier is required", nil)
+	}
+	if format == "" {
+		format = "application/json"
+	}
+
+	route, err := routeAction(c, action, identifier, format)
+	if err != nil {
+		return returnActionError(c, action, "Failed to resolve storage location", err)
+	}
+
+	value := map[string]interface{}{
+		"workflowId": workflowIDFor(c, action),
+		"identifier": identifier,
+		"router":     routerName(),
+		"bucket":     route.Bucket,
+		"key":        route.Key,
+		"contentUrl": fmt.Sprintf("s3://%s/%s", route.Bucket, route.Key),
+		"exists":     false,
+	}
+
+	head, err := storageFor(c).HeadObject(c.Request().Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(route.Bucket),
+		Key:    aws.String(route.Key),
+	})
+	switch {
+	case err == nil:
+		value["exists"] = true
+		value["contentSize"] = aws.ToInt64(head.ContentLength)
+		value["encodingFormat"] = aws.ToString(head.ContentType)
+		if head.ETag != nil {
+			value["etag"] = aws.ToString(head.ETag)
+		}
+		if head.LastModified != nil {
+			value["lastModified"] = head.LastModified.UTC().Format(time.RFC3339)
+		}
+	case !isNotFoundError(err):
+		logf(c, "Failed to stat %s: %v", route.Key, err)
+		return returnFetchError(c, action, classifyStorageError(route.Bucket, err))
+	}
+
+	action.Result = &semantic.SemanticResult{
+		Type:  "DigitalDocument",
+		Value: value,
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// handleSemanticDescribe wraps the implementation to match ActionHandler signature
+func handleSemanticDescribe(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticDescribeImpl(c, action)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSemanticDescribe(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_BUCKET_MAP", "data=large-blobs/team-a")
+	t.Setenv("WORKFLOW_STORAGE_TYPE_FOLDERS", "true")
+
+	store := newFakeStorage()
+	describe := func() map[string]interface{} {
+		action, err := semantic.ParseSemanticAction([]byte(`{"@type": "DescribeAction", "workflowId": "wf-1", "type": "data",
+			"object": {"@type": "DigitalDocument", "identifier": "step-1", "encodingFormat": "text/csv"}}`))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		if err := handleSemanticDescribeImpl(c, action); err != nil {
+			t.Fatalf("handleSemanticDescribeImpl() error = %v", err)
+		}
+		return action.Result.Value.(map[string]interface{})
+	}
+
+	const key = "team-a/workflow-results/wf-1/csv/step-1.csv"
+	value := describe()
+	if value["bucket"] != "large-blobs" || value["key"] != key || value["contentUrl"] != "s3://large-blobs/"+key {
+		t.Errorf("Describe location = %v", value)
+	}
+	if value["exists"] != false {
+		t.Errorf("Describe of a missing object exists = %v", value["exists"])
+	}
+
+	store.objects["large-blobs/"+key] = fakeObject{data: []byte("a,b\n"), contentType: "text/csv"}
+	value = describe()
+	if value["exists"] != true || value["contentSize"] != int64(4) || value["encodingFormat"] != "text/csv" {
+		t.Errorf("Describe of a stored object = %v", value)
+	}
+	if store.gets != 0 {
+		t.Errorf("Describe downloaded the body (%d GetObject calls)", store.gets)
+	}
+}
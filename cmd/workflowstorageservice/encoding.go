@@ -0,0 +1,57 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// decompressRequest replaces a gzip-encoded request body (Content-Encoding:
+// gzip) with its decompressed content, so stores save the payload rather
+// than the compressed bytes. Size limits apply to the decompressed body.
+// Other content codings are rejected with 415 Unsupported Media Type.
+func decompressRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		switch encoding := strings.ToLower(strings.TrimSpace(req.Header.Get(echo.HeaderContentEncoding))); encoding {
+		case "", "identity":
+			return next(c)
+		case "gzip", "x-gzip":
+		default:
+			return echo.NewHTTPError(http.StatusUnsupportedMediaType, "unsupported Content-Encoding: "+encoding+" (use gzip)")
+		}
+
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid gzip request body")
+		}
+		req.Body = &gzipBody{gz: gz, body: req.Body}
+		req.Header.Del(echo.HeaderContentEncoding)
+		req.Header.Del(echo.HeaderContentLength)
+		req.ContentLength = -1
+		return next(c)
+	}
+}
+
+// gzipBody decompresses a request body. Corrupt data surfaces as a 400
+// payloadLimitError, like the other request body checks.
+type gzipBody struct {
+	gz   *gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	n, err := b.gz.Read(p)
+	if err != nil && err != io.EOF {
+		err = &payloadLimitError{http.StatusBadRequest, "invalid gzip request body"}
+	}
+	return n, err
+}
+
+func (b *gzipBody) Close() error {
+	b.gz.Close()
+	return b.body.Close()
+}
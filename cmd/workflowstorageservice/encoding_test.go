@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatalf("gzip Write() error = %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressRequest_StoresDecompressedPayload(t *testing.T) {
+	resetStorageEnv(t)
+	registerActions()
+
+	e := echo.New()
+	store := newFakeStorage()
+	body := gzipped(t, `{"@type": "CreateAction", "identifier": "zipped",
+		"object": {"@type": "DigitalDocument", "text": "{\"compressed\": false}"}}`)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(storageContextKey, store)
+	if err := decompressRequest(handleSemanticAction)(c); err != nil {
+		t.Fatalf("handleSemanticAction() error = %v", err)
+	}
+
+	object, ok := store.objects[defaultBucket()+"/workflow-results/default/zipped.json"]
+	if !ok || string(object.data) != `{"compressed": false}` {
+		t.Errorf("Stored %q, want the decompressed payload (status %d: %s)", object.data, rec.Code, rec.Body.String())
+	}
+}
+
+func TestDecompressRequest_Rejections(t *testing.T) {
+	e := echo.New()
+	handler := decompressRequest(handleSemanticAction)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		want     int
+	}{
+		{"not gzip", "gzip", []byte("plain text"), http.StatusBadRequest},
+		{"corrupt stream", "gzip", append(gzipped(t, strings.Repeat(`{"a": 1}`, 100))[:30], 0xff, 0xff), http.StatusBadRequest},
+		{"unsupported coding", "br", []byte("{}"), http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", bytes.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentEncoding, tt.encoding)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set(storageContextKey, newFakeStorage())
+
+		var httpErr *echo.HTTPError
+		if err := handler(c); !errors.As(err, &httpErr) || httpErr.Code != tt.want {
+			t.Errorf("%s: error = %v, want %d", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Application-layer encryption stores the payload as an AES-GCM envelope so
+// that the storage provider only ever sees ciphertext. The nonce and an
+// algorithm marker are kept in the object's user metadata.
+const (
+	encryptionAlgorithm = "AES-GCM"
+
+	metadataEncryptionAlgorithm = "encryption-algorithm"
+	metadataEncryptionNonce     = "encryption-nonce"
+)
+
+// errEncryptionKeyMissing is returned when encryption or decryption is
+// required but WORKFLOW_STORAGE_ENCRYPTION_KEY is not configured
+var errEncryptionKeyMissing = errors.New("WORKFLOW_STORAGE_ENCRYPTION_KEY is not set")
+
+// loadEncryptionKey reads the base64-encoded AES key (16, 24 or 32 bytes)
+// from WORKFLOW_STORAGE_ENCRYPTION_KEY
+func loadEncryptionKey() ([]byte, error) {
+	encoded := os.Getenv("WORKFLOW_STORAGE_ENCRYPTION_KEY")
+	if encoded == "" {
+		return nil, errEncryptionKeyMissing
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("WORKFLOW_STORAGE_ENCRYPTION_KEY must be base64 encoded: %w", err)
+	}
+
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("WORKFLOW_STORAGE_ENCRYPTION_KEY must decode to 16, 24 or 32 bytes, got %d", len(key))
+	}
+}
+
+// newGCM builds an AES-GCM cipher from the configured key
+func newGCM() (cipher.AEAD, error) {
+	key, err := loadEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encryptPayload seals plaintext and returns the ciphertext together with the
+// object metadata needed to decrypt it again
+func encryptPayload(plaintext []byte) ([]byte, map[string]string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	metadata := map[string]string{
+		metadataEncryptionAlgorithm: encryptionAlgorithm,
+		metadataEncryptionNonce:     base64.StdEncoding.EncodeToString(nonce),
+	}
+
+	return gcm.Seal(nil, nonce, plaintext, nil), metadata, nil
+}
+
+// isEncrypted reports whether the object metadata carries an encryption marker
+func isEncrypted(metadata map[string]string) bool {
+	return metadata[metadataEncryptionAlgorithm] != ""
+}
+
+// decryptPayload opens an envelope written by encryptPayload. Objects without
+// an encryption marker are returned unchanged.
+func decryptPayload(data []byte, metadata map[string]string) ([]byte, error) {
+	if !isEncrypted(metadata) {
+		return data, nil
+	}
+
+	if algorithm := metadata[metadataEncryptionAlgorithm]; algorithm != encryptionAlgorithm {
+		return nil, fmt.Errorf("unsupported encryption algorithm: %s", algorithm)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(metadata[metadataEncryptionNonce])
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption nonce: %w", err)
+	}
+
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid encryption nonce length: %d", len(nonce))
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func setTestEncryptionKey(t *testing.T) {
+	t.Helper()
+	t.Setenv("WORKFLOW_STORAGE_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("k"), 32)))
+}
+
+func TestEncryptPayload_RoundTrip(t *testing.T) {
+	setTestEncryptionKey(t)
+
+	plaintext := []byte(`{"result": "secret"}`)
+	ciphertext, metadata, err := encryptPayload(plaintext)
+	if err != nil {
+		t.Fatalf("encryptPayload() error = %v", err)
+	}
+
+	if bytes.Equal(ciphertext, plaintext) {
+		t.Error("encryptPayload() returned plaintext")
+	}
+	if metadata[metadataEncryptionAlgorithm] != encryptionAlgorithm {
+		t.Errorf("Expected algorithm marker %q, got %q", encryptionAlgorithm, metadata[metadataEncryptionAlgorithm])
+	}
+
+	decrypted, err := decryptPayload(ciphertext, metadata)
+	if err != nil {
+		t.Fatalf("decryptPayload() error = %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Expected %q, got %q", plaintext, decrypted)
+	}
+}
+
+func TestDecryptPayload_Unencrypted(t *testing.T) {
+	data := []byte("plain")
+
+	decrypted, err := decryptPayload(data, nil)
+	if err != nil {
+		t.Fatalf("decryptPayload() error = %v", err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Errorf("Expected unencrypted data to be returned unchanged, got %q", decrypted)
+	}
+}
+
+func TestDecryptPayload_MissingKey(t *testing.T) {
+	setTestEncryptionKey(t)
+
+	ciphertext, metadata, err := encryptPayload([]byte("data"))
+	if err != nil {
+		t.Fatalf("encryptPayload() error = %v", err)
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_ENCRYPTION_KEY", "")
+	if _, err := decryptPayload(ciphertext, metadata); !errors.Is(err, errEncryptionKeyMissing) {
+		t.Errorf("Expected errEncryptionKeyMissing, got %v", err)
+	}
+}
+
+func TestDecryptPayload_Tampered(t *testing.T) {
+	setTestEncryptionKey(t)
+
+	ciphertext, metadata, err := encryptPayload([]byte("data"))
+	if err != nil {
+		t.Fatalf("encryptPayload() error = %v", err)
+	}
+
+	ciphertext[0] ^= 0xff
+	if _, err := decryptPayload(ciphertext, metadata); err == nil {
+		t.Error("decryptPayload() should fail for tampered ciphertext")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// endpointContextKey is the echo context key holding the S3 client of an
+// endpoint selected with the endpoint action property
+const endpointContextKey = "endpoint"
+
+// parseAllowedEndpoints parses WORKFLOW_STORAGE_ALLOWED_ENDPOINTS, a
+// comma-separated list of S3 endpoints reads may be routed to, each either a
+// URL or name=URL, e.g. "eu=https://fsn1.example.com,https://nbg1.example.com".
+// A bare URL is its own name. Malformed entries are returned separately.
+func parseAllowedEndpoints(spec string) (map[string]string, []string) {
+	endpoints := make(map[string]string)
+	var malformed []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, endpoint := entry, entry
+		if before, after, ok := strings.Cut(entry, "="); ok {
+			name, endpoint = strings.TrimSpace(before), strings.TrimSpace(after)
+		}
+		endpoint = strings.TrimSuffix(endpoint, "/")
+		u, err := url.Parse(endpoint)
+		if name == "" || strings.ContainsAny(name, " \t") || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			malformed = append(malformed, entry)
+			continue
+		}
+		endpoints[name] = endpoint
+	}
+	return endpoints, malformed
+}
+
+// allowedEndpoints returns the configured endpoint allowlist by name
+func allowedEndpoints() map[string]string {
+	endpoints, _ := parseAllowedEndpoints(os.Getenv("WORKFLOW_STORAGE_ALLOWED_ENDPOINTS"))
+	return endpoints
+}
+
+// resolveEndpoint returns the allowed endpoint URL a name or URL refers to
+func resolveEndpoint(endpoints map[string]string, requested string) (string, bool) {
+	if endpoint, ok := endpoints[requested]; ok {
+		return endpoint, true
+	}
+	requested = strings.TrimSuffix(requested, "/")
+	for _, endpoint := range endpoints {
+		if strings.EqualFold(endpoint, requested) {
+			return endpoint, true
+		}
+	}
+	return "", false
+}
+
+// endpointClients caches one S3 client per overridden endpoint. The clients
+// share the configuration and credentials of the default client.
+var endpointClients = struct {
+	mu      sync.Mutex
+	clients map[string]*s3.Client
+}{clients: make(map[string]*s3.Client)}
+
+// endpointClient returns the cached S3 client for endpoint
+func endpointClient(endpoint string) *s3.Client {
+	endpointClients.mu.Lock()
+	defer endpointClients.mu.Unlock()
+
+	if client, ok := endpointClients.clients[endpoint]; ok {
+		return client
+	}
+	client := s3.New(s3Client.Options(), func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+		o.UsePathStyle = pathStyleFor(endpoint)
+	})
+	endpointClients.clients[endpoint] = client
+	return client
+}
+
+// selectEndpoint applies the endpoint action property, which routes a read to
+// another S3 endpoint such as a nearer replica. The endpoint must be in
+// WORKFLOW_STORAGE_ALLOWED_ENDPOINTS; writes always go to the primary
+// endpoint so replicas never diverge from it.
+func selectEndpoint(c echo.Context, action *semantic.SemanticAction) error {
+	if action == nil || action.Properties == nil || action.Properties["endpoint"] == nil {
+		return nil
+	}
+	requested, ok := action.Properties["endpoint"].(string)
+	if !ok || requested == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "endpoint must be a non-empty string")
+	}
+
+	endpoints := allowedEndpoints()
+	if len(endpoints) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "endpoint overrides are not enabled (set WORKFLOW_STORAGE_ALLOWED_ENDPOINTS)")
+	}
+	endpoint, ok := resolveEndpoint(endpoints, requested)
+	if !ok {
+		names := make([]string, 0, len(endpoints))
+		for name := range endpoints {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("endpoint %q is not allowed (allowed: %s)", requested, strings.Join(names, ", ")))
+	}
+	if mutatingActionTypes[action.Type] {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("endpoint is only supported for read actions, not %s", action.Type))
+	}
+	if s3Client == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "endpoint requires the S3 storage backend")
+	}
+
+	c.Set(endpointContextKey, endpointClient(endpoint))
+	logf(c, "Routing %s to endpoint %s", action.Type, endpoint)
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+	"workflowstorageservice.evalgo.org/actions"
+)
+
+func TestParseAllowedEndpoints(t *testing.T) {
+	endpoints, malformed := parseAllowedEndpoints(" eu=https://fsn1.example.com/, https://nbg1.example.com,bad=ftp://x,=https://a.example.com,us=notaurl")
+	want := map[string]string{
+		"eu":                       "https://fsn1.example.com",
+		"https://nbg1.example.com": "https://nbg1.example.com",
+	}
+	if !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("parseAllowedEndpoints() = %v, want %v", endpoints, want)
+	}
+	if !reflect.DeepEqual(malformed, []string{"bad=ftp://x", "=https://a.example.com", "us=notaurl"}) {
+		t.Errorf("malformed = %v", malformed)
+	}
+}
+
+func TestSelectEndpoint(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_ALLOWED_ENDPOINTS", "eu=https://fsn1.example.com,https://nbg1.example.com")
+	t.Setenv("WORKFLOW_STORAGE_S3_ADDRESSING", "")
+	t.Setenv("WORKFLOW_STORAGE_DEDUPLICATE", "")
+
+	original := s3Client
+	t.Cleanup(func() {
+		s3Client = original
+		endpointClients.mu.Lock()
+		endpointClients.clients = make(map[string]*s3.Client)
+		endpointClients.mu.Unlock()
+	})
+	s3Client = s3.New(s3.Options{
+		Region:       s3Region,
+		BaseEndpoint: aws.String("https://primary.example.com"),
+		UsePathStyle: true,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "access", SecretAccessKey: "secret"}, nil
+		}),
+	})
+
+	e := echo.New()
+	selectFor := func(b *actions.Builder) (echo.Context, error) {
+		t.Helper()
+		action, err := b.Action()
+		if err != nil {
+			t.Fatalf("Action() error = %v", err)
+		}
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		return c, selectEndpoint(c, action)
+	}
+
+	// Without the property the default storage is used
+	c, err := selectFor(actions.NewRetrieveAction().WithIdentifier("step-1"))
+	if err != nil || c.Get(endpointContextKey) != nil {
+		t.Fatalf("selectEndpoint() without endpoint = %v, %v", c.Get(endpointContextKey), err)
+	}
+
+	c, err = selectFor(actions.NewRetrieveAction().WithIdentifier("step-1").WithProperty("endpoint", "eu"))
+	if err != nil {
+		t.Fatalf("selectEndpoint(eu) error = %v", err)
+	}
+	client, ok := storageFor(c).(*s3.Client)
+	if !ok || aws.ToString(client.Options().BaseEndpoint) != "https://fsn1.example.com" {
+		t.Fatalf("storageFor() = %T, want the eu client", storageFor(c))
+	}
+	presigned, err := presignGetURL(context.Background(), storageFor(c), "px-semantic", "workflow-results/wf-1/step-1.json")
+	if err != nil || !strings.HasPrefix(presigned, "https://fsn1.example.com/px-semantic/") {
+		t.Errorf("presignGetURL() = %q, %v, want the eu endpoint", presigned, err)
+	}
+
+	// Clients are cached per endpoint, and an allowed URL selects it too
+	c, err = selectFor(actions.NewRetrieveAction().WithProperty("endpoint", "https://fsn1.example.com/"))
+	if err != nil || storageFor(c) != Storage(client) {
+		t.Errorf("selectEndpoint(URL) = %v, want the cached eu client", err)
+	}
+
+	var httpErr *echo.HTTPError
+	for name, b := range map[string]*actions.Builder{
+		"unknown endpoint": actions.NewRetrieveAction().WithProperty("endpoint", "https://evil.example.com"),
+		"not a string":     actions.NewRetrieveAction().WithProperty("endpoint", 42),
+		"write action":     actions.NewStoreAction().WithText("{}").WithProperty("endpoint", "eu"),
+	} {
+		if _, err := selectFor(b); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+			t.Errorf("%s: error = %v, want 400", name, err)
+		}
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_ALLOWED_ENDPOINTS", "")
+	if _, err := selectFor(actions.NewRetrieveAction().WithProperty("endpoint", "eu")); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("Endpoint without an allowlist: error = %v, want 400", err)
+	}
+}
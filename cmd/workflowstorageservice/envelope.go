@@ -0,0 +1,137 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// responseVersion is the envelope shape of a JSON response
+type responseVersion int
+
+const (
+	// versionNative keeps each endpoint's shape without a version field
+	versionNative responseVersion = iota
+	// versionFlat (v1) flattens semantic actions into a single object with the
+	// action status and result fields at the top level
+	versionFlat
+	// versionJSONLD (v2) is the full JSON-LD action with a guaranteed @context
+	versionJSONLD
+)
+
+// String returns the value of the version field
+func (v responseVersion) String() string {
+	switch v {
+	case versionFlat:
+		return "v1"
+	case versionJSONLD:
+		return "v2"
+	}
+	return ""
+}
+
+// parseResponseVersion accepts "1", "v1", "2" and "v2"
+func parseResponseVersion(value string) responseVersion {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "v1":
+		return versionFlat
+	case "2", "v2":
+		return versionJSONLD
+	}
+	return versionNative
+}
+
+// responseVersionFor selects the envelope version from the version query
+// parameter, falling back to a version parameter on the Accept header
+// (application/json; version=2). Without either the native shape is kept,
+// so existing clients see no change.
+func responseVersionFor(r *http.Request) responseVersion {
+	if version := r.URL.Query().Get("version"); version != "" {
+		return parseResponseVersion(version)
+	}
+	for _, accepted := range strings.Split(r.Header.Get(echo.HeaderAccept), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && params["version"] != "" {
+			return parseResponseVersion(params["version"])
+		}
+	}
+	return versionNative
+}
+
+// applyEnvelope reshapes a decoded response document for version and records
+// the version in it. Documents that are not JSON objects are left unchanged.
+func applyEnvelope(document interface{}, version responseVersion) interface{} {
+	object, ok := document.(map[string]interface{})
+	if !ok || version == versionNative {
+		return document
+	}
+
+	switch version {
+	case versionFlat:
+		if isActionDocument(object) {
+			object = flattenAction(object)
+		}
+	case versionJSONLD:
+		if ctx, ok := object["@context"]; !ok || ctx == "" {
+			object["@context"] = jsonLDContext
+		}
+	}
+	object["version"] = version.String()
+	return object
+}
+
+// isActionDocument reports whether object is a serialized semantic action
+func isActionDocument(object map[string]interface{}) bool {
+	_, ok := object["actionStatus"]
+	return ok
+}
+
+// flattenAction builds the v1 shape of a semantic action: the action type,
+// status and identifier, followed by the result's fields and value entries.
+// JSON-LD keywords are dropped, and the result type is kept as resultType.
+func flattenAction(action map[string]interface{}) map[string]interface{} {
+	flat := map[string]interface{}{
+		"action": action["@type"],
+		"status": action["actionStatus"],
+	}
+	if identifier, ok := action["identifier"]; ok {
+		flat["identifier"] = identifier
+	}
+	if actionErr, ok := action["error"]; ok {
+		flat["error"] = actionErr
+	}
+
+	result, _ := action["result"].(map[string]interface{})
+	for key, item := range result {
+		switch key {
+		case "@type":
+			flat["resultType"] = item
+		case "value":
+			// merged below so value entries win over result fields
+		default:
+			if !strings.HasPrefix(key, "@") {
+				flat[key] = item
+			}
+		}
+	}
+	if value, ok := result["value"].(map[string]interface{}); ok {
+		for key, item := range value {
+			flat[key] = item
+		}
+	}
+	return flat
+}
+
+// storeSuccessStatus returns WORKFLOW_STORAGE_STORE_STATUS, the status of a
+// store that wrote an object: 200 (default) or 201 Created
+func storeSuccessStatus() int {
+	status, err := strconv.Atoi(os.Getenv("WORKFLOW_STORAGE_STORE_STATUS"))
+	if err != nil || status != http.StatusCreated {
+		return http.StatusOK
+	}
+	return status
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestResponseVersionFor(t *testing.T) {
+	tests := []struct {
+		target string
+		accept string
+		want   responseVersion
+	}{
+		{"/", "", versionNative},
+		{"/", "application/json; version=1", versionFlat},
+		{"/", "application/json; version=v2", versionJSONLD},
+		{"/?version=v1", "application/json; version=2", versionFlat},
+		{"/?version=9", "", versionNative},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.accept != "" {
+			req.Header.Set(echo.HeaderAccept, tt.accept)
+		}
+		if got := responseVersionFor(req); got != tt.want {
+			t.Errorf("responseVersionFor(%s, Accept %q) = %v, want %v", tt.target, tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestRespondAction_Envelopes(t *testing.T) {
+	newAction := func() *semantic.SemanticAction {
+		action := &semantic.SemanticAction{Type: "CreateAction", Identifier: "step-1"}
+		action.Result = &semantic.SemanticResult{
+			Type:   "DigitalDocument",
+			Format: "application/json",
+			Value: map[string]interface{}{
+				"contentUrl":  "s3://px-semantic/workflow-results/wf-1/step-1.json",
+				"contentSize": int64(2),
+			},
+		}
+		semantic.SetSuccessOnAction(action)
+		return action
+	}
+
+	respond := func(target string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, target, nil), rec)
+		if err := respondAction(c, newAction()); err != nil {
+			t.Fatalf("respondAction() error = %v", err)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return rec, body
+	}
+
+	_, native := respond("/v1/api/semantic/action")
+	if _, ok := native["version"]; ok {
+		t.Errorf("Native response got a version field: %v", native)
+	}
+
+	_, flat := respond("/v1/api/semantic/action?version=1")
+	if flat["version"] != "v1" || flat["action"] != "CreateAction" || flat["status"] != "CompletedActionStatus" {
+		t.Errorf("v1 envelope = %v", flat)
+	}
+	if flat["contentUrl"] == nil || flat["resultType"] != "DigitalDocument" {
+		t.Errorf("v1 envelope did not flatten the result: %v", flat)
+	}
+	if _, ok := flat["result"]; ok {
+		t.Errorf("v1 envelope kept the nested result: %v", flat)
+	}
+
+	rec, jsonld := respond("/v1/api/semantic/action?version=2")
+	if jsonld["version"] != "v2" || jsonld["@context"] != jsonLDContext || jsonld["result"] == nil {
+		t.Errorf("v2 envelope = %v", jsonld)
+	}
+	if got := rec.Header().Get(echo.HeaderContentType); got != "application/ld+json" {
+		t.Errorf("v2 Content-Type = %q, want application/ld+json", got)
+	}
+}
+
+func TestStoreSuccessStatus(t *testing.T) {
+	for value, want := range map[string]int{"": http.StatusOK, "201": http.StatusCreated, "204": http.StatusOK, "x": http.StatusOK} {
+		t.Setenv("WORKFLOW_STORAGE_STORE_STATUS", value)
+		if got := storeSuccessStatus(); got != want {
+			t.Errorf("storeSuccessStatus(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
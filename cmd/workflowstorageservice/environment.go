@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// environmentName returns WORKFLOW_STORAGE_ENV_PREFIX, the environment
+// discriminator ("dev", "staging", ...) that keeps environments sharing a
+// bucket apart. It must be a single key segment, like a tenant name.
+func environmentName() (string, error) {
+	env := strings.TrimSpace(os.Getenv("WORKFLOW_STORAGE_ENV_PREFIX"))
+	if env != "" && !validTenantName(env) {
+		return "", fmt.Errorf("invalid WORKFLOW_STORAGE_ENV_PREFIX %q: use letters, digits, '-', '_' and '.'", env)
+	}
+	return env, nil
+}
+
+// scopeToEnvironment places a key built outside the router (e.g. bundle
+// keys) below the environment discriminator, if one is configured
+func scopeToEnvironment(key string) string {
+	if env, _ := environmentName(); env != "" {
+		return env + "/" + key
+	}
+	return key
+}
+
+// environmentRouter separates environments sharing a bucket by prefixing
+// every key another router produces with {env}/. It sits inside
+// tenantRouter, so tenant keys become tenants/{tenant}/{env}/...
+type environmentRouter struct {
+	Router
+	env string
+}
+
+func (r environmentRouter) Route(req RouteRequest) (Route, error) {
+	route, err := r.Router.Route(req)
+	if err != nil {
+		return Route{}, err
+	}
+	route.Key = r.env + "/" + route.Key
+	return route, nil
+}
+
+func (r environmentRouter) ListPrefix(workflowID, typ string) (Route, error) {
+	route, err := r.Router.ListPrefix(workflowID, typ)
+	if err != nil {
+		return Route{}, err
+	}
+	route.Key = r.env + "/" + route.Key
+	return route, nil
+}
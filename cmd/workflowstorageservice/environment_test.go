@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestEnvironmentPrefix_SeparatesEnvironments(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(env, body string, handler func(echo.Context, *semantic.SemanticAction) error) (*httptest.ResponseRecorder, error) {
+		t.Setenv("WORKFLOW_STORAGE_ENV_PREFIX", env)
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		return rec, handler(c, action)
+	}
+	create := func(env, text string) {
+		t.Helper()
+		if _, err := run(env, `{"@type": "CreateAction", "identifier": "step-1",
+			"object": {"@type": "DigitalDocument", "text": "`+text+`"}}`, handleSemanticStoreImpl); err != nil {
+			t.Fatalf("Store in %s failed: %v", env, err)
+		}
+	}
+	retrieve := `{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "identifier": "step-1"}}`
+
+	create("staging", `{\"env\": \"staging\"}`)
+	if _, ok := store.objects[defaultBucket()+"/staging/workflow-results/wf-1/step-1.json"]; !ok {
+		t.Fatalf("Object not stored below the environment prefix, have %v", keysOf(store.objects))
+	}
+
+	// Another environment does not see the result
+	var httpErr *echo.HTTPError
+	if _, err := run("prod", retrieve, handleSemanticRetrieveImpl); !errors.As(err, &httpErr) || httpErr.Code != http.StatusNotFound {
+		t.Errorf("Retrieve from prod error = %v, want 404", err)
+	}
+
+	// The same identifier in prod does not overwrite staging
+	create("prod", `{\"env\": \"prod\"}`)
+	rec, err := run("staging", retrieve, handleSemanticRetrieveImpl)
+	if err != nil || !strings.Contains(rec.Body.String(), "staging") {
+		t.Errorf("Staging retrieve = %v, %s", err, rec.Body.String())
+	}
+
+	rec, err = run("prod", `{"@type": "ListAction"}`, handleSemanticListImpl)
+	if err != nil || !strings.Contains(rec.Body.String(), "prod/workflow-results/wf-1/step-1.json") || strings.Contains(rec.Body.String(), "staging/") {
+		t.Errorf("Prod list = %v, %s", err, rec.Body.String())
+	}
+}
+
+func TestRouterFor_EnvironmentPrefix(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_ENV_PREFIX", "dev")
+
+	router, err := routerFor("acme")
+	if err != nil {
+		t.Fatalf("routerFor() error = %v", err)
+	}
+	route, err := router.Route(RouteRequest{WorkflowID: "wf-1", Identifier: "step-1"})
+	if err != nil || route.Key != "tenants/acme/dev/workflow-results/wf-1/step-1.json" {
+		t.Errorf("Route() = %q, %v, want the environment inside the tenant namespace", route.Key, err)
+	}
+	if got := scopeToEnvironment("bundles/wf-1/b"); got != "dev/bundles/wf-1/b" {
+		t.Errorf("scopeToEnvironment() = %q", got)
+	}
+
+	for _, env := range []string{"..", "dev/prod", "dev prod"} {
+		t.Setenv("WORKFLOW_STORAGE_ENV_PREFIX", env)
+		if _, err := routerFor(""); err == nil {
+			t.Errorf("routerFor() with WORKFLOW_STORAGE_ENV_PREFIX=%q should fail", env)
+		}
+	}
+}
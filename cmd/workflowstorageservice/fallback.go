@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fallbackBuckets returns WORKFLOW_STORAGE_FALLBACK_BUCKETS, the buckets a
+// retrieve tries in order when the object is missing from its own bucket,
+// e.g. the old bucket during a migration
+func fallbackBuckets() []string {
+	var buckets []string
+	for _, bucket := range strings.Split(os.Getenv("WORKFLOW_STORAGE_FALLBACK_BUCKETS"), ",") {
+		if bucket = strings.TrimSpace(bucket); bucket != "" {
+			buckets = append(buckets, bucket)
+		}
+	}
+	return buckets
+}
+
+// servingBucket returns the bucket a retrieve of key is served from: bucket
+// itself when it has the object, otherwise the first fallback bucket that
+// does. It is resolved before the retrieve mode is chosen, so every mode
+// reads the same bucket. Without fallback buckets no request is made; when no
+// bucket has the object, bucket is returned so the retrieve reports its usual
+// 404. Errors other than not found are returned as they are, so an
+// unreachable fallback is not reported as 404.
+func servingBucket(ctx context.Context, store Storage, bucket, key string) (string, error) {
+	fallbacks := fallbackBuckets()
+	if len(fallbacks) == 0 {
+		return bucket, nil
+	}
+	if found, err := objectPresent(ctx, store, bucket, key); err != nil || found {
+		return bucket, err
+	}
+	for _, fallback := range fallbacks {
+		if fallback == bucket {
+			continue
+		}
+		found, err := objectPresent(ctx, store, fallback, key)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return fallback, nil
+		}
+	}
+	return bucket, nil
+}
+
+// objectPresent reports whether bucket has an object at key, answering from
+// the result and not found caches before asking S3 with HeadObject
+func objectPresent(ctx context.Context, store Storage, bucket, key string) (bool, error) {
+	if _, fresh := resultCache.get(bucket, key); fresh {
+		return true, nil
+	}
+	if missingObjects.isMissing(bucket, key) {
+		return false, nil
+	}
+	_, err := store.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	switch {
+	case err == nil:
+		return true, nil
+	case isNotFoundError(err):
+		return false, nil
+	}
+	return false, classifyStorageError(bucket, err)
+}
+
+// reportServingBucket adds the bucket a retrieve was served from to value,
+// with fallback: true when it is a fallback bucket
+func reportServingBucket(value map[string]interface{}, bucket string, fallback bool) {
+	value["bucket"] = bucket
+	if fallback {
+		value["fallback"] = true
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+	"workflowstorageservice.evalgo.org/actions"
+)
+
+func TestRetrieve_FallbackBuckets(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("HETZNER_S3_BUCKET", "new-results")
+	t.Setenv("WORKFLOW_STORAGE_NOT_FOUND_TTL", "")
+	t.Setenv("WORKFLOW_STORAGE_FALLBACK_BUCKETS", "old-results, older-results")
+
+	e := echo.New()
+	store := newFakeStorage()
+	store.objects["new-results/workflow-results/wf-1/migrated.json"] = fakeObject{data: []byte(`"new"`), contentType: "application/json"}
+	store.objects["old-results/workflow-results/wf-1/migrated.json"] = fakeObject{data: []byte(`"stale"`), contentType: "application/json"}
+	store.objects["older-results/workflow-results/wf-1/pending.json"] = fakeObject{data: []byte(`"old"`), contentType: "application/json"}
+
+	retrieve := func(identifier string) (*semantic.SemanticAction, error) {
+		t.Helper()
+		action, err := actions.NewRetrieveAction().WithWorkflowID("wf-1").WithObjectIdentifier(identifier).Action()
+		if err != nil {
+			t.Fatalf("Action() error = %v", err)
+		}
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return action, handleSemanticRetrieveImpl(c, action)
+	}
+
+	// The primary bucket wins when it has the object
+	action, err := retrieve("migrated")
+	if err != nil {
+		t.Fatalf("Retrieve error = %v", err)
+	}
+	value := action.Result.Value.(map[string]interface{})
+	if action.Result.Output != `"new"` || value["bucket"] != "new-results" || value["fallback"] != nil {
+		t.Errorf("Primary retrieve = %q, %v", action.Result.Output, value)
+	}
+
+	// A missing object is looked up in the fallback buckets in order
+	action, err = retrieve("pending")
+	if err != nil {
+		t.Fatalf("Fallback retrieve error = %v", err)
+	}
+	value = action.Result.Value.(map[string]interface{})
+	if action.Result.Output != `"old"` || value["bucket"] != "older-results" || value["fallback"] != true {
+		t.Errorf("Fallback retrieve = %q, %v", action.Result.Output, value)
+	}
+
+	// Missing everywhere is still a 404
+	var httpErr *echo.HTTPError
+	if _, err := retrieve("missing"); !errors.As(err, &httpErr) || httpErr.Code != http.StatusNotFound {
+		t.Errorf("Missing object error = %v, want 404", err)
+	}
+}
+
+func TestRetrieve_FallbackBucketsAllModes(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("HETZNER_S3_BUCKET", "new-results")
+	t.Setenv("WORKFLOW_STORAGE_NOT_FOUND_TTL", "")
+	t.Setenv("WORKFLOW_STORAGE_FALLBACK_BUCKETS", "old-results")
+
+	e := echo.New()
+	store := newFakeStorage()
+	store.objects["old-results/workflow-results/wf-1/pending.json"] = fakeObject{data: []byte(`[1, 2, 3]`), contentType: "application/json"}
+
+	tests := []struct {
+		name     string
+		property string
+		value    interface{}
+	}{
+		{"metadataOnly", "metadataOnly", true},
+		{"array page", "page", 1},
+	}
+	for _, tt := range tests {
+		action, err := actions.NewRetrieveAction().WithWorkflowID("wf-1").WithObjectIdentifier("pending").WithProperty(tt.property, tt.value).Action()
+		if err != nil {
+			t.Fatalf("Action() error = %v", err)
+		}
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		if err := handleSemanticRetrieveImpl(c, action); err != nil {
+			t.Fatalf("%s: retrieve error = %v", tt.name, err)
+		}
+		value := action.Result.Value.(map[string]interface{})
+		if value["bucket"] != "old-results" || value["fallback"] != true || value["contentUrl"] != "s3://old-results/workflow-results/wf-1/pending.json" {
+			t.Errorf("%s: fallback retrieve = %v", tt.name, value)
+		}
+	}
+}
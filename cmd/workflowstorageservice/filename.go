@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// metadataFilename records the original filename of an uploaded result,
+// percent-encoded because S3 metadata travels as ASCII HTTP headers
+const metadataFilename = "original-filename"
+
+// maxFilenameBytes is the longest filename accepted, the common filesystem limit
+const maxFilenameBytes = 255
+
+// errInvalidFilename is returned for filenames that are not a single plain name
+var errInvalidFilename = errors.New("filename must be a plain file name of at most 255 bytes without path separators or control characters")
+
+// validateFilename checks that name can be offered as a download name: no
+// directories, no "." or "..", no control characters
+func validateFilename(name string) error {
+	if name == "" || name == "." || name == ".." || len(name) > maxFilenameBytes {
+		return errInvalidFilename
+	}
+	if strings.ContainsAny(name, `/\`) || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return errInvalidFilename
+	}
+	return nil
+}
+
+// withFilename records the original filename in the object metadata
+func withFilename(metadata map[string]string, name string) map[string]string {
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata[metadataFilename] = url.PathEscape(name)
+	return metadata
+}
+
+// filenameFromMetadata returns the original filename stored with an object,
+// or "" when it was stored without one
+func filenameFromMetadata(metadata map[string]string) string {
+	name, err := url.PathUnescape(metadata[metadataFilename])
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// contentDisposition builds an attachment Content-Disposition for name.
+// Non-ASCII names are encoded as filename* (RFC 2231).
+func contentDisposition(name string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestValidateFilename(t *testing.T) {
+	for _, name := range []string{"report.pdf", "Q3 report (final).xlsx", "Übersicht.csv"} {
+		if err := validateFilename(name); err != nil {
+			t.Errorf("validateFilename(%q) error = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "dir/report.pdf", `dir\report.pdf`, "bad\nname", strings.Repeat("x", 256)} {
+		if err := validateFilename(name); err == nil {
+			t.Errorf("validateFilename(%q) should fail", name)
+		}
+	}
+}
+
+func TestFilenameMetadataRoundTrip(t *testing.T) {
+	metadata := withFilename(nil, "Übersicht 2026.csv")
+	if encoded := metadata[metadataFilename]; strings.ContainsFunc(encoded, func(r rune) bool { return r > 127 }) {
+		t.Errorf("Stored filename %q is not ASCII", encoded)
+	}
+	if got := filenameFromMetadata(metadata); got != "Übersicht 2026.csv" {
+		t.Errorf("filenameFromMetadata() = %q", got)
+	}
+
+	_, params, err := mime.ParseMediaType(contentDisposition("Übersicht 2026.csv"))
+	if err != nil || params["filename"] != "Übersicht 2026.csv" {
+		t.Errorf("contentDisposition() round trip = %v, %v", params, err)
+	}
+}
+
+func TestSemanticStoreRetrieve_Filename(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(body string, handler func(echo.Context, *semantic.SemanticAction) error) (*httptest.ResponseRecorder, error) {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), rec)
+		c.Set(storageContextKey, store)
+		return rec, handler(c, action)
+	}
+	filenameOf := func(rec *httptest.ResponseRecorder) interface{} {
+		var response struct {
+			Result struct {
+				Value map[string]interface{} `json:"value"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+		return response.Result.Value["filename"]
+	}
+
+	rec, err := run(`{"@type": "CreateAction", "identifier": "upload-1", "filename": "Q3 report.csv",
+		"object": {"@type": "DigitalDocument", "encodingFormat": "text/csv", "text": "a,b\n1,2\n"}}`, handleSemanticStoreImpl)
+	if err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if got := filenameOf(rec); got != "Q3 report.csv" {
+		t.Errorf("Store filename = %v", got)
+	}
+
+	for _, body := range []string{
+		`{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "identifier": "upload-1"}}`,
+		`{"@type": "RetrieveAction", "metadataOnly": true, "object": {"@type": "DigitalDocument", "identifier": "upload-1"}}`,
+	} {
+		rec, err := run(body, handleSemanticRetrieveImpl)
+		if err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+		if got := filenameOf(rec); got != "Q3 report.csv" {
+			t.Errorf("%s: filename = %v", body, got)
+		}
+	}
+
+	_, err = run(`{"@type": "CreateAction", "identifier": "upload-2", "filename": "../etc/passwd",
+		"object": {"@type": "DigitalDocument", "text": "{}"}}`, handleSemanticStoreImpl)
+	if httpErr, ok := err.(*echo.HTTPError); !ok || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("Store with a path as filename error = %v, want 400", err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// formatValidationWarnOnly reports whether malformed encoding formats are only
+// logged instead of rejected (WORKFLOW_STORAGE_FORMAT_VALIDATION=warn)
+func formatValidationWarnOnly() bool {
+	return strings.EqualFold(os.Getenv("WORKFLOW_STORAGE_FORMAT_VALIDATION"), "warn")
+}
+
+// parseEncodingFormat checks that format is a syntactically valid MIME type:
+// type/subtype made of RFC 2045 tokens, with optional parameters
+func parseEncodingFormat(format string) error {
+	mediaType, _, err := mime.ParseMediaType(format)
+	if err != nil {
+		return fmt.Errorf("invalid encodingFormat %q: %v", format, err)
+	}
+	typ, subtype, ok := strings.Cut(mediaType, "/")
+	if !ok || typ == "" || subtype == "" || strings.Contains(subtype, "/") {
+		return fmt.Errorf("invalid encodingFormat %q: expected type/subtype", format)
+	}
+	return nil
+}
+
+// validateEncodingFormat rejects malformed encoding formats before they are
+// stored as the S3 Content-Type. In warn-only mode the problem is logged and
+// nil is returned so existing clients keep working.
+func validateEncodingFormat(c echo.Context, format string) error {
+	err := parseEncodingFormat(format)
+	if err == nil {
+		return nil
+	}
+	if formatValidationWarnOnly() {
+		logf(c, "Warning: %v", err)
+		return nil
+	}
+	return err
+}
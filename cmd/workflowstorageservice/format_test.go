@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseEncodingFormat(t *testing.T) {
+	valid := []string{"application/json", "text/csv; charset=utf-8", "application/ld+json", "application/x-ndjson"}
+	for _, format := range valid {
+		if err := parseEncodingFormat(format); err != nil {
+			t.Errorf("parseEncodingFormat(%q) error = %v", format, err)
+		}
+	}
+
+	invalid := []string{"json", "application/", "/json", "application/json/x", "text/plain; charset", "application json"}
+	for _, format := range invalid {
+		if err := parseEncodingFormat(format); err == nil {
+			t.Errorf("Expected %q to be rejected", format)
+		}
+	}
+}
+
+func TestValidateEncodingFormat_WarnOnly(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+
+	t.Setenv("WORKFLOW_STORAGE_FORMAT_VALIDATION", "")
+	if err := validateEncodingFormat(c, "json"); err == nil {
+		t.Error("Expected malformed format to be rejected by default")
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_FORMAT_VALIDATION", "warn")
+	if err := validateEncodingFormat(c, "json"); err != nil {
+		t.Errorf("Expected warn-only mode to accept malformed format, got %v", err)
+	}
+}
+
+func TestSemanticRetrieve_ForceContentType(t *testing.T) {
+	resetStorageEnv(t)
+
+	store := newFakeStorage()
+	store.objects[defaultBucket()+"/workflow-results/wf-1/report.json"] = fakeObject{data: []byte("a,b\n1,2\n"), contentType: "application/json"}
+
+	retrieve := func(forced string) (*semantic.SemanticAction, error) {
+		action, err := semantic.ParseSemanticAction([]byte(`{"@type": "RetrieveAction", "workflowId": "wf-1", "forceContentType": "` + forced + `",
+			"object": {"@type": "DigitalDocument", "identifier": "report"}}`))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return action, handleSemanticRetrieveImpl(c, action)
+	}
+
+	action, err := retrieve("text/csv; charset=utf-8")
+	if err != nil {
+		t.Fatalf("handleSemanticRetrieveImpl() error = %v", err)
+	}
+	if action.Result.Format != "text/csv; charset=utf-8" || action.Result.Output != "a,b\n1,2\n" {
+		t.Errorf("Result = %q, %q, want the CSV relabeled", action.Result.Format, action.Result.Output)
+	}
+	if store.objects[defaultBucket()+"/workflow-results/wf-1/report.json"].contentType != "application/json" {
+		t.Error("forceContentType must not change the stored object")
+	}
+
+	gets := store.gets
+	var httpErr *echo.HTTPError
+	if _, err := retrieve("csv"); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("forceContentType csv: error = %v, want 400", err)
+	}
+	if store.gets != gets {
+		t.Error("An invalid forceContentType must be rejected before fetching")
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// fileStorage is a Storage backed by the local filesystem, selected with
+// WORKFLOW_STORAGE_BACKEND=fs. Objects live at {root}/{bucket}/{key}, so the
+// directory tree mirrors the S3 key structure. Content type, ETag and user
+// metadata are kept in JSON sidecars under {root}/.metadata, and writes go
+// through {root}/.tmp so readers never see partial files.
+//
+// GetObject ignores IfNoneMatch and always returns the full object.
+type fileStorage struct {
+	root string
+	mu   sync.RWMutex
+}
+
+// fileObjectInfo is the sidecar stored next to each object
+type fileObjectInfo struct {
+	ContentType string            `json:"contentType"`
+	ETag        string            `json:"etag"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+const (
+	fsMetadataDir = ".metadata"
+	fsTempDir     = ".tmp"
+)
+
+func newFileStorage(root string) (*fileStorage, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(root, fsTempDir), 0o755); err != nil {
+		return nil, err
+	}
+	return &fileStorage{root: root}, nil
+}
+
+// validBucketName rejects bucket names that are not a single directory or
+// that collide with the internal .metadata and .tmp directories
+func validBucketName(bucket string) bool {
+	return bucket != "" && !strings.HasPrefix(bucket, ".") && !strings.ContainsAny(bucket, `/\`)
+}
+
+// objectPath returns the data and sidecar paths for bucket/key, rejecting
+// names that would escape the bucket directory
+func (f *fileStorage) objectPath(bucket, key string) (string, string, error) {
+	if !validBucketName(bucket) {
+		return "", "", fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return "", "", fmt.Errorf("invalid object key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.Contains(segment, `\`) {
+			return "", "", fmt.Errorf("invalid object key %q", key)
+		}
+	}
+
+	rel := filepath.FromSlash(key)
+	return filepath.Join(f.root, bucket, rel), filepath.Join(f.root, fsMetadataDir, bucket, rel+".json"), nil
+}
+
+func (f *fileStorage) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	dataPath, infoPath, err := f.objectPath(aws.ToString(params.Bucket), aws.ToString(params.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if params.Body != nil {
+		if data, err = io.ReadAll(params.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	info := fileObjectInfo{
+		ContentType: aws.ToString(params.ContentType),
+		ETag:        `"` + sha256Hex(data) + `"`,
+		Metadata:    params.Metadata,
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.write(dataPath, infoPath, data, info); err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectOutput{ETag: aws.String(info.ETag)}, nil
+}
+
+func (f *fileStorage) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	dataPath, infoPath, err := f.objectPath(aws.ToString(params.Bucket), aws.ToString(params.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	data, err := os.ReadFile(dataPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, err := os.Stat(filepath.Join(f.root, aws.ToString(params.Bucket))); errors.Is(err, fs.ErrNotExist) {
+			return nil, &types.NoSuchBucket{}
+		}
+		return nil, &types.NoSuchKey{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	stat, info, err := f.stat(dataPath, infoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentType:   aws.String(info.ContentType),
+		ContentLength: aws.Int64(int64(len(data))),
+		ETag:          aws.String(info.ETag),
+		LastModified:  aws.Time(stat.ModTime().UTC()),
+		Metadata:      info.Metadata,
+	}, nil
+}
+
+func (f *fileStorage) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	dataPath, infoPath, err := f.objectPath(aws.ToString(params.Bucket), aws.ToString(params.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	stat, info, err := f.stat(dataPath, infoPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &types.NotFound{}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.HeadObjectOutput{
+		ContentType:   aws.String(info.ContentType),
+		ContentLength: aws.Int64(stat.Size()),
+		ETag:          aws.String(info.ETag),
+		LastModified:  aws.Time(stat.ModTime().UTC()),
+		Metadata:      info.Metadata,
+	}, nil
+}
+
+func (f *fileStorage) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	bucket := aws.ToString(params.Bucket)
+	if !validBucketName(bucket) {
+		return nil, fmt.Errorf("invalid bucket name %q", bucket)
+	}
+
+	stat, err := os.Stat(filepath.Join(f.root, bucket))
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && !stat.IsDir()) {
+		return nil, &types.NotFound{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (f *fileStorage) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	source := aws.ToString(params.CopySource)
+	if unescaped, err := url.PathUnescape(source); err == nil {
+		source = unescaped
+	}
+	sourceBucket, sourceKey, ok := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid copy source %q", aws.ToString(params.CopySource))
+	}
+
+	sourceData, sourceInfo, err := f.objectPath(sourceBucket, sourceKey)
+	if err != nil {
+		return nil, err
+	}
+	dataPath, infoPath, err := f.objectPath(aws.ToString(params.Bucket), aws.ToString(params.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := os.ReadFile(sourceData)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &types.NoSuchKey{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, info, err := f.stat(sourceData, sourceInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.MetadataDirective == types.MetadataDirectiveReplace {
+		info.Metadata = params.Metadata
+		if params.ContentType != nil {
+			info.ContentType = aws.ToString(params.ContentType)
+		}
+	}
+
+	if err := f.write(dataPath, infoPath, data, info); err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(dataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.CopyObjectOutput{
+		CopyObjectResult: &types.CopyObjectResult{
+			ETag:         aws.String(info.ETag),
+			LastModified: aws.Time(stat.ModTime().UTC()),
+		},
+	}, nil
+}
+
+func (f *fileStorage) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	bucket := aws.ToString(params.Bucket)
+	if !validBucketName(bucket) {
+		return nil, fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	bucketDir := filepath.Join(f.root, bucket)
+
+	prefix := aws.ToString(params.Prefix)
+	delimiter := aws.ToString(params.Delimiter)
+	after := aws.ToString(params.ContinuationToken)
+	if after == "" {
+		after = aws.ToString(params.StartAfter)
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var objects []types.Object
+	err := filepath.WalkDir(bucketDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(bucketDir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			return nil
+		}
+		if delimiter != "" && strings.HasSuffix(after, delimiter) && strings.HasPrefix(key, after) {
+			// Inside the common prefix that ended the previous page
+			return nil
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, types.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(stat.Size()),
+			LastModified: aws.Time(stat.ModTime().UTC()),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return aws.ToString(objects[i].Key) < aws.ToString(objects[j].Key)
+	})
+
+	// With a Delimiter, keys that contain it below the prefix are rolled up
+	// into common prefixes, which count against MaxKeys like objects
+	var entries []string
+	common := make(map[string]bool)
+	byKey := make(map[string]types.Object, len(objects))
+	for _, object := range objects {
+		key := aws.ToString(object.Key)
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				key = key[:len(prefix)+i+len(delimiter)]
+				if common[key] {
+					continue
+				}
+				common[key] = true
+			}
+		}
+		byKey[key] = object
+		entries = append(entries, key)
+	}
+
+	maxKeys := int(aws.ToInt32(params.MaxKeys))
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(false)}
+	if len(entries) > maxKeys {
+		entries = entries[:maxKeys]
+		output.IsTruncated = aws.Bool(true)
+		output.NextContinuationToken = aws.String(entries[len(entries)-1])
+	}
+	for _, key := range entries {
+		if common[key] {
+			output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(key)})
+		} else {
+			output.Contents = append(output.Contents, byKey[key])
+		}
+	}
+	output.KeyCount = aws.Int32(int32(len(entries)))
+	return output, nil
+}
+
+func (f *fileStorage) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	dataPath, infoPath, err := f.objectPath(aws.ToString(params.Bucket), aws.ToString(params.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Deleting a missing object succeeds, as it does on S3
+	for _, path := range []string{dataPath, infoPath} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// stat returns the file info and sidecar of an object. Objects written
+// outside the service have no sidecar and get an empty one.
+func (f *fileStorage) stat(dataPath, infoPath string) (fs.FileInfo, fileObjectInfo, error) {
+	var info fileObjectInfo
+
+	stat, err := os.Stat(dataPath)
+	if err != nil {
+		return nil, info, err
+	}
+
+	raw, err := os.ReadFile(infoPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, info, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(raw, &info); err != nil {
+			return nil, info, fmt.Errorf("corrupt metadata for %s: %w", dataPath, err)
+		}
+	}
+	if info.ContentType == "" {
+		info.ContentType = "application/octet-stream"
+	}
+	return stat, info, nil
+}
+
+// write stores the object and its sidecar, renaming temporary files into
+// place so a crash never leaves a truncated object behind
+func (f *fileStorage) write(dataPath, infoPath string, data []byte, info fileObjectInfo) error {
+	rawInfo, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range []struct {
+		path string
+		data []byte
+	}{
+		{infoPath, rawInfo},
+		{dataPath, data},
+	} {
+		if err := os.MkdirAll(filepath.Dir(file.path), 0o755); err != nil {
+			return err
+		}
+		tmp, err := os.CreateTemp(filepath.Join(f.root, fsTempDir), "object-*")
+		if err != nil {
+			return err
+		}
+		if _, err := tmp.Write(file.data); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := os.Rename(tmp.Name(), file.path); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	return nil
+}
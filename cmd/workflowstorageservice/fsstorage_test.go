@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestFileStorage_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := newFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("newFileStorage() error = %v", err)
+	}
+
+	put := func(key, data string) {
+		t.Helper()
+		_, err := store.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String("px-semantic"),
+			Key:         aws.String(key),
+			Body:        strings.NewReader(data),
+			ContentType: aws.String("application/json"),
+			Metadata:    map[string]string{"checksum-sha256": sha256Hex([]byte(data))},
+		})
+		if err != nil {
+			t.Fatalf("PutObject(%s) error = %v", key, err)
+		}
+	}
+	put("workflow-results/wf-1/a.json", `{"a": 1}`)
+	put("workflow-results/wf-1/b.json", `{"b": 2}`)
+	put("workflow-results/wf-2/c.json", `{"c": 3}`)
+
+	got, err := store.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("px-semantic"), Key: aws.String("workflow-results/wf-1/a.json")})
+	if err != nil {
+		t.Fatalf("GetObject() error = %v", err)
+	}
+	data, _ := io.ReadAll(got.Body)
+	if string(data) != `{"a": 1}` || aws.ToString(got.ContentType) != "application/json" {
+		t.Errorf("Unexpected object %q (%s)", data, aws.ToString(got.ContentType))
+	}
+	if got.Metadata["checksum-sha256"] != sha256Hex(data) {
+		t.Errorf("Expected metadata to round-trip, got %v", got.Metadata)
+	}
+
+	head, err := store.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("px-semantic"), Key: aws.String("workflow-results/wf-1/a.json")})
+	if err != nil {
+		t.Fatalf("HeadObject() error = %v", err)
+	}
+	if aws.ToInt64(head.ContentLength) != int64(len(data)) || aws.ToString(head.ETag) != aws.ToString(got.ETag) {
+		t.Errorf("HeadObject() disagrees with GetObject(): %+v", head)
+	}
+
+	list, err := store.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String("px-semantic"),
+		Prefix:  aws.String("workflow-results/wf-1/"),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		t.Fatalf("ListObjectsV2() error = %v", err)
+	}
+	if len(list.Contents) != 1 || aws.ToString(list.Contents[0].Key) != "workflow-results/wf-1/a.json" || !aws.ToBool(list.IsTruncated) {
+		t.Fatalf("Unexpected first page: %+v", list)
+	}
+	list, err = store.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:            aws.String("px-semantic"),
+		Prefix:            aws.String("workflow-results/wf-1/"),
+		ContinuationToken: list.NextContinuationToken,
+	})
+	if err != nil {
+		t.Fatalf("ListObjectsV2() error = %v", err)
+	}
+	if len(list.Contents) != 1 || aws.ToString(list.Contents[0].Key) != "workflow-results/wf-1/b.json" || aws.ToBool(list.IsTruncated) {
+		t.Fatalf("Unexpected second page: %+v", list)
+	}
+
+	_, err = store.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String("px-semantic"),
+		Key:               aws.String("workflow-results/wf-1/a.json"),
+		CopySource:        aws.String(copySource("px-semantic", "workflow-results/wf-1/a.json")),
+		Metadata:          map[string]string{"expires-at": "2030-01-01T00:00:00Z"},
+		MetadataDirective: types.MetadataDirectiveReplace,
+	})
+	if err != nil {
+		t.Fatalf("CopyObject() error = %v", err)
+	}
+	head, _ = store.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("px-semantic"), Key: aws.String("workflow-results/wf-1/a.json")})
+	if head.Metadata["expires-at"] == "" || aws.ToString(head.ContentType) != "application/json" {
+		t.Errorf("Expected replaced metadata and kept content type, got %+v", head)
+	}
+
+	if _, err := store.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String("px-semantic"), Key: aws.String("workflow-results/wf-1/a.json")}); err != nil {
+		t.Fatalf("DeleteObject() error = %v", err)
+	}
+	_, err = store.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("px-semantic"), Key: aws.String("workflow-results/wf-1/a.json")})
+	if !isNotFoundError(err) {
+		t.Errorf("Expected not-found error after delete, got %v", err)
+	}
+	_, err = store.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("px-semantic"), Key: aws.String("workflow-results/wf-1/a.json")})
+	if !isNotFoundError(err) {
+		t.Errorf("Expected not-found head after delete, got %v", err)
+	}
+}
+
+func TestFileStorage_RejectsEscapingKeys(t *testing.T) {
+	store, err := newFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("newFileStorage() error = %v", err)
+	}
+
+	for _, key := range []string{"../outside", "a/../../b", "/abs", "a//b", ""} {
+		_, err := store.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket: aws.String("px-semantic"),
+			Key:    aws.String(key),
+			Body:   strings.NewReader("x"),
+		})
+		if err == nil {
+			t.Errorf("Expected key %q to be rejected", key)
+		}
+	}
+	for _, bucket := range []string{".metadata", "../x", ""} {
+		_, err := store.HeadBucket(context.Background(), &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		if err == nil {
+			t.Errorf("Expected bucket %q to be rejected", bucket)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// readinessTimeout bounds the storage check of a readiness probe, so a hung
+// S3 endpoint fails the probe instead of outlasting the probe timeout
+const readinessTimeout = 3 * time.Second
+
+// HealthResponse is the body of the liveness and readiness probes
+type HealthResponse struct {
+	Status  string            `json:"status"`
+	Service string            `json:"service"`
+	Backend string            `json:"backend,omitempty"`
+	Buckets map[string]string `json:"buckets,omitempty"`
+}
+
+// handleLiveness handles GET /health/live. It answers 200 as long as the
+// process serves requests and never touches storage, so an S3 outage does not
+// get the pod restarted.
+func handleLiveness(c echo.Context) error {
+	return respondJSON(c, http.StatusOK, HealthResponse{
+		Status:  "alive",
+		Service: "workflowstorageservice",
+	})
+}
+
+// handleReadiness handles GET /health/ready. It checks that every configured
+// bucket is reachable and answers 503 while any of them is not, so traffic
+// is routed elsewhere until storage recovers.
+func handleReadiness(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), readinessTimeout)
+	defer cancel()
+
+	response := HealthResponse{
+		Status:  "ready",
+		Service: "workflowstorageservice",
+		Backend: storageBackend,
+		Buckets: make(map[string]string),
+	}
+	status := http.StatusOK
+	for _, bucket := range configuredBuckets() {
+		_, err := storageFor(c).HeadBucket(ctx, &s3.HeadBucketInput{
+			Bucket: aws.String(bucket),
+		})
+		if err != nil {
+			logf(c, "Readiness check failed for bucket %q: %v", bucket, err)
+			response.Buckets[bucket] = "unavailable"
+			response.Status = "not ready"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		response.Buckets[bucket] = "ok"
+	}
+	return respondJSON(c, status, response)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// unreachableStorage fails every bucket check, like S3 during an outage
+type unreachableStorage struct {
+	*fakeStorage
+}
+
+func (unreachableStorage) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return nil, errors.New("dial tcp: connection refused")
+}
+
+func TestHealthProbes(t *testing.T) {
+	resetStorageEnv(t)
+
+	probe := func(store Storage, handler echo.HandlerFunc) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/health", nil), rec)
+		c.Set(storageContextKey, store)
+		if err := handler(c); err != nil {
+			t.Fatalf("Probe error = %v", err)
+		}
+		return rec
+	}
+
+	if rec := probe(newFakeStorage(), handleReadiness); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ready"`) {
+		t.Errorf("Readiness with reachable storage = %d %s", rec.Code, rec.Body.String())
+	}
+
+	down := unreachableStorage{newFakeStorage()}
+	rec := probe(down, handleReadiness)
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "unavailable") {
+		t.Errorf("Readiness during an outage = %d %s, want 503", rec.Code, rec.Body.String())
+	}
+
+	// Liveness must not follow storage down
+	if rec := probe(down, handleLiveness); rec.Code != http.StatusOK {
+		t.Errorf("Liveness during an outage = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// metadataImmutable marks objects stored with immutable: true
+	metadataImmutable = "immutable"
+
+	// metadataRetainUntil records the RFC 3339 end of a retention period set
+	// with retainUntil; the object cannot be modified before it
+	metadataRetainUntil = "retain-until"
+
+	// adminOverrideHeader lets operators modify immutable objects when it
+	// matches WORKFLOW_STORAGE_ADMIN_KEY
+	adminOverrideHeader = "X-Admin-Override"
+)
+
+// errImmutable is returned when a write targets an immutable object
+var errImmutable = errors.New("object is immutable")
+
+// retentionError is returned when a write targets an object whose retention
+// period has not ended. It matches errImmutable, so callers treat both alike.
+type retentionError struct {
+	until time.Time
+}
+
+func (e *retentionError) Error() string {
+	return "object is retained until " + e.until.Format(time.RFC3339)
+}
+
+func (e *retentionError) Is(target error) bool {
+	return target == errImmutable
+}
+
+// parseRetainUntil parses the retainUntil store property. It must be an
+// RFC 3339 timestamp in the future.
+func parseRetainUntil(value string) (time.Time, error) {
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("retainUntil must be an RFC 3339 timestamp")
+	}
+	if !until.After(time.Now()) {
+		return time.Time{}, errors.New("retainUntil must be in the future")
+	}
+	return until.UTC(), nil
+}
+
+// retainedUntil returns the end of an object's retention period, if one was
+// recorded and has not passed yet
+func retainedUntil(metadata map[string]string) (time.Time, bool) {
+	until, err := time.Parse(time.RFC3339, metadata[metadataRetainUntil])
+	if err != nil || !time.Now().Before(until) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// hasAdminOverride reports whether the request carries a valid admin override.
+// Overrides are disabled when WORKFLOW_STORAGE_ADMIN_KEY is not set.
+func hasAdminOverride(c echo.Context) bool {
+	adminKey := os.Getenv("WORKFLOW_STORAGE_ADMIN_KEY")
+	if adminKey == "" {
+		return false
+	}
+	provided := c.Request().Header.Get(adminOverrideHeader)
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(adminKey)) == 1
+}
+
+// checkMutable returns errImmutable if bucket/key exists and was stored as
+// immutable, or a retentionError while its retention period lasts, unless the
+// request carries an admin override. Missing objects are mutable.
+func checkMutable(ctx context.Context, c echo.Context, store Storage, bucket, key string) error {
+	if hasAdminOverride(c) {
+		return nil
+	}
+
+	head, err := store.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+
+	if head.Metadata[metadataImmutable] == "true" {
+		return errImmutable
+	}
+	if until, ok := retainedUntil(head.Metadata); ok {
+		return &retentionError{until: until}
+	}
+	return nil
+}
+
+// immutableConflict is the 409 response for writes to immutable or retained
+// objects; err is the error returned by checkMutable
+func immutableConflict(key string, err error) error {
+	return echo.NewHTTPError(http.StatusConflict, err.Error()+": "+key)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestImmutableObjects_RejectUpdateAndDelete(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_ADMIN_KEY", "admin-secret")
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(body string, override string, handler func(echo.Context, *semantic.SemanticAction) error) (*httptest.ResponseRecorder, error) {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		if override != "" {
+			req.Header.Set(adminOverrideHeader, override)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		return rec, handler(c, action)
+	}
+
+	create := `{"@type": "CreateAction", "identifier": "final", "immutable": true,
+		"object": {"@type": "DigitalDocument", "text": "{\"v\": 1}"}}`
+	update := `{"@type": "UpdateAction", "identifier": "final",
+		"object": {"@type": "DigitalDocument", "text": "{\"v\": 2}"}}`
+	remove := `{"@type": "DeleteAction",
+		"object": {"@type": "DigitalDocument", "contentUrl": "s3://px-semantic/workflow-results/wf-1/final.json"}}`
+
+	if rec, err := run(create, "", handleSemanticStoreImpl); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Initial store failed: %v (status %d)", err, rec.Code)
+	}
+
+	assertConflict := func(name string, err error) {
+		t.Helper()
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != http.StatusConflict {
+			t.Errorf("%s: expected 409 Conflict, got %v", name, err)
+		}
+	}
+
+	_, err := run(update, "", handleSemanticStoreImpl)
+	assertConflict("update", err)
+
+	_, err = run(remove, "wrong-key", handleSemanticDeleteImpl)
+	assertConflict("delete with invalid override", err)
+
+	if rec, err := run(remove, "admin-secret", handleSemanticDeleteImpl); err != nil || rec.Code != http.StatusOK {
+		t.Errorf("Delete with admin override failed: %v (status %d)", err, rec.Code)
+	}
+	if len(store.objects) != 0 {
+		t.Error("Expected object to be deleted")
+	}
+}
+
+func TestRetainUntil_RejectsChangesUntilExpiry(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_ADMIN_KEY", "admin-secret")
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(body string, override string, handler func(echo.Context, *semantic.SemanticAction) error) (*semantic.SemanticAction, error) {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		if override != "" {
+			req.Header.Set(adminOverrideHeader, override)
+		}
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return action, handler(c, action)
+	}
+
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	action, err := run(`{"@type": "CreateAction", "identifier": "audit", "retainUntil": "`+until+`",
+		"object": {"@type": "DigitalDocument", "text": "{\"v\": 1}"}}`, "", handleSemanticStoreImpl)
+	if err != nil {
+		t.Fatalf("Initial store failed: %v", err)
+	}
+	if value, _ := action.Result.Value.(map[string]interface{}); value["retainUntil"] != until {
+		t.Errorf("Store response retainUntil = %v, want %s", value["retainUntil"], until)
+	}
+
+	update := `{"@type": "UpdateAction", "identifier": "audit",
+		"object": {"@type": "DigitalDocument", "text": "{\"v\": 2}"}}`
+	remove := `{"@type": "DeleteAction",
+		"object": {"@type": "DigitalDocument", "contentUrl": "s3://px-semantic/workflow-results/wf-1/audit.json"}}`
+
+	var httpErr *echo.HTTPError
+	if _, err := run(update, "", handleSemanticStoreImpl); !errors.As(err, &httpErr) || httpErr.Code != http.StatusConflict {
+		t.Errorf("Update during retention: expected 409, got %v", err)
+	} else if !strings.Contains(fmt.Sprint(httpErr.Message), until) {
+		t.Errorf("Conflict message %q should name the end of retention", httpErr.Message)
+	}
+	if _, err := run(remove, "", handleSemanticDeleteImpl); !errors.As(err, &httpErr) || httpErr.Code != http.StatusConflict {
+		t.Errorf("Delete during retention: expected 409, got %v", err)
+	}
+
+	// Once the period has passed the object is an ordinary result again
+	object := store.objects["px-semantic/workflow-results/wf-1/audit.json"]
+	object.metadata[metadataRetainUntil] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	if _, err := run(update, "", handleSemanticStoreImpl); err != nil {
+		t.Errorf("Update after retention failed: %v", err)
+	}
+
+	for _, value := range []string{"tomorrow", time.Now().Add(-time.Hour).Format(time.RFC3339)} {
+		_, err := run(`{"@type": "CreateAction", "identifier": "other", "retainUntil": "`+value+`",
+			"object": {"@type": "DigitalDocument", "text": "{}"}}`, "", handleSemanticStoreImpl)
+		if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+			t.Errorf("retainUntil %q: expected 400, got %v", value, err)
+		}
+	}
+}
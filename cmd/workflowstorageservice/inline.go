@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// defaultMaxInlineBytes is the largest result returned inline by default
+	defaultMaxInlineBytes int64 = 1 << 20
+
+	// presignedURLExpiry is how long download links for oversized results stay valid
+	presignedURLExpiry = 15 * time.Minute
+
+	// defaultMaxDataURIBytes is the largest result returned as a data: URI by default
+	defaultMaxDataURIBytes int64 = 64 << 10
+)
+
+// maxInlineBytes returns the inline size threshold for a retrieve action:
+// action.Properties["maxInlineBytes"], then WORKFLOW_STORAGE_MAX_INLINE_BYTES,
+// then defaultMaxInlineBytes, never above maxRetrieveInline
+func maxInlineBytes(action *semantic.SemanticAction) int64 {
+	limit := defaultMaxInlineBytes
+	if requested, ok := int64Property(action, "maxInlineBytes"); ok && requested > 0 {
+		limit = requested
+	} else if configured, err := strconv.ParseInt(os.Getenv("WORKFLOW_STORAGE_MAX_INLINE_BYTES"), 10, 64); err == nil && configured > 0 {
+		limit = configured
+	}
+	if ceiling := maxRetrieveInline(); ceiling > 0 && limit > ceiling {
+		return ceiling
+	}
+	return limit
+}
+
+// maxRetrieveInline returns WORKFLOW_STORAGE_MAX_RETRIEVE_INLINE, the
+// server-enforced ceiling on data returned inline by any retrieve, which
+// callers cannot raise with maxInlineBytes; 0 means no ceiling
+func maxRetrieveInline() int64 {
+	limit, err := strconv.ParseInt(os.Getenv("WORKFLOW_STORAGE_MAX_RETRIEVE_INLINE"), 10, 64)
+	if err != nil || limit <= 0 {
+		return 0
+	}
+	return limit
+}
+
+// previewBytes returns at most limit bytes of data without splitting a UTF-8 sequence
+func previewBytes(data []byte, limit int64) []byte {
+	if int64(len(data)) <= limit {
+		return data
+	}
+	n := int(limit)
+	for n > 0 && !utf8.RuneStart(data[n]) {
+		n--
+	}
+	return data[:n]
+}
+
+// presignGetURL creates a time-limited download URL for an object. Only the
+// real S3 client can sign URLs; injected storage implementations cannot.
+func presignGetURL(ctx context.Context, store Storage, bucket, key string) (string, error) {
+	if dedup, ok := store.(contentStore); ok {
+		// A deduplicated object's own key holds only the reference
+		sum, err := dedup.referenceOf(ctx, bucket, key)
+		if err != nil {
+			return "", err
+		}
+		if sum != "" {
+			key = casKey(sum)
+		}
+		store = dedup.Storage
+	}
+	if timed, ok := store.(timedStorage); ok {
+		store = timed.Storage
+	}
+	client, ok := store.(*s3.Client)
+	if !ok {
+		return "", errors.New("storage does not support presigned URLs")
+	}
+	request, err := s3.NewPresignClient(client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(presignedURLExpiry))
+	if err != nil {
+		return "", err
+	}
+	return request.URL, nil
+}
+
+// wantsDataURI reports whether a retrieve asked for returnMode "dataURI"
+func wantsDataURI(action *semantic.SemanticAction) bool {
+	return strings.EqualFold(stringProperty(action, "returnMode"), "dataURI")
+}
+
+// inlineCompression reads the inlineCompress retrieve property: "" for
+// plain inline data or a compression algorithm such as "gzip"
+func inlineCompression(action *semantic.SemanticAction) (string, error) {
+	algorithm := strings.ToLower(strings.TrimSpace(stringProperty(action, "inlineCompress")))
+	if algorithm == "" || algorithm == "none" {
+		return "", nil
+	}
+	if _, ok := compressionCodecs[algorithm]; !ok {
+		return "", fmt.Errorf("unsupported inlineCompress %q (supported: %s)", algorithm, compressionAlgorithms())
+	}
+	return algorithm, nil
+}
+
+// compressInline compresses inline data with algorithm and base64 encodes
+// it, for clients that cannot negotiate Content-Encoding. Unlike stored
+// payloads, the data is compressed even when it does not shrink, so the
+// response always has the shape the client asked for.
+func compressInline(algorithm string, data []byte) (string, int, error) {
+	compressed, err := compressionCodecs[algorithm].compress(data)
+	if err != nil {
+		return "", 0, err
+	}
+	return base64.StdEncoding.EncodeToString(compressed), len(compressed), nil
+}
+
+// maxDataURIBytes returns the largest object returned as a data: URI
+// (WORKFLOW_STORAGE_MAX_DATA_URI_BYTES, default 64 KiB). Base64 adds a third
+// on top, so the limit keeps embedded references small.
+func maxDataURIBytes() int64 {
+	limit := defaultMaxDataURIBytes
+	if configured, err := strconv.ParseInt(os.Getenv("WORKFLOW_STORAGE_MAX_DATA_URI_BYTES"), 10, 64); err == nil && configured > 0 {
+		limit = configured
+	}
+	if ceiling := maxRetrieveInline(); ceiling > 0 && limit > ceiling {
+		return ceiling
+	}
+	return limit
+}
+
+// dataURI encodes data as an RFC 2397 base64 data: URI of contentType.
+// Parameters such as charset are kept; unparseable types fall back to
+// application/octet-stream.
+func dataURI(data []byte, contentType string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "application/octet-stream", nil
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("data:")
+	b.WriteString(mediaType)
+	for _, name := range names {
+		b.WriteString(";" + name + "=" + url.PathEscape(params[name]))
+	}
+	b.WriteString(";base64,")
+	b.WriteString(base64.StdEncoding.EncodeToString(data))
+	return b.String()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestDataURI(t *testing.T) {
+	tests := []struct {
+		contentType string
+		data        string
+		want        string
+	}{
+		{"application/json", `{"a":1}`, "data:application/json;base64,eyJhIjoxfQ=="},
+		{"text/plain; charset=utf-8", "hi", "data:text/plain;charset=utf-8;base64,aGk="},
+		{"not a type", "x", "data:application/octet-stream;base64,eA=="},
+	}
+	for _, tt := range tests {
+		if got := dataURI([]byte(tt.data), tt.contentType); got != tt.want {
+			t.Errorf("dataURI(%q) = %q, want %q", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestSemanticRetrieve_DataURI(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_MAX_DATA_URI_BYTES", "16")
+
+	e := echo.New()
+	store := newFakeStorage()
+	store.objects[defaultBucket()+"/"+resultKey("default", "icon", "")] = fakeObject{data: []byte("small"), contentType: "image/svg+xml", modified: time.Now()}
+	store.objects[defaultBucket()+"/"+resultKey("default", "report", "")] = fakeObject{data: []byte(strings.Repeat("x", 17)), contentType: "text/plain", modified: time.Now()}
+
+	retrieve := func(identifier string) (*httptest.ResponseRecorder, error) {
+		action, err := semantic.ParseSemanticAction([]byte(`{"@type": "RetrieveAction", "returnMode": "dataURI",
+			"object": {"@type": "DigitalDocument", "identifier": "` + identifier + `"}}`))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), rec)
+		c.Set(storageContextKey, store)
+		return rec, handleSemanticRetrieveImpl(c, action)
+	}
+
+	rec, err := retrieve("icon")
+	if err != nil {
+		t.Fatalf("handleSemanticRetrieveImpl() error = %v", err)
+	}
+	var response struct {
+		Result struct {
+			Value map[string]interface{} `json:"value"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if got := response.Result.Value["contentUrl"]; got != "data:image/svg+xml;base64,c21hbGw=" {
+		t.Errorf("contentUrl = %v", got)
+	}
+	if got, _ := response.Result.Value["sourceUrl"].(string); !strings.HasPrefix(got, "s3://") {
+		t.Errorf("sourceUrl = %v, want the s3:// location", got)
+	}
+
+	_, err = retrieve("report")
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an object above the data: URI limit, got %v", err)
+	}
+}
+
+func TestMaxRetrieveInline_CapsInlineResponses(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_MAX_INLINE_BYTES", "")
+	t.Setenv("WORKFLOW_STORAGE_MAX_RETRIEVE_INLINE", "10")
+
+	e := echo.New()
+	store := newFakeStorage()
+	store.objects[defaultBucket()+"/"+resultKey("default", "report", "")] = fakeObject{data: []byte("0123456789abcdef"), contentType: "text/plain", modified: time.Now()}
+	store.objects[defaultBucket()+"/"+resultKey("default", "small", "")] = fakeObject{data: []byte("tiny"), contentType: "text/plain", modified: time.Now()}
+
+	run := func(body string, handler func(echo.Context, *semantic.SemanticAction) error) (string, map[string]interface{}) {
+		t.Helper()
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		if err := handler(c, action); err != nil {
+			t.Fatalf("handler error = %v", err)
+		}
+		return action.Result.Output, action.Result.Value.(map[string]interface{})
+	}
+
+	// A client cannot raise the inline threshold above the server ceiling
+	output, value := run(`{"@type": "RetrieveAction", "maxInlineBytes": 1048576,
+		"object": {"@type": "DigitalDocument", "identifier": "report"}}`, handleSemanticRetrieveImpl)
+	if value["truncated"] != true || output != "0123456789" || value["contentSize"] != int64(16) || value["maxInlineBytes"] != int64(10) {
+		t.Errorf("Capped retrieve = %q, %v", output, value)
+	}
+	output, value = run(`{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "identifier": "small"}}`, handleSemanticRetrieveImpl)
+	if value["truncated"] != nil || output != "tiny" {
+		t.Errorf("Small retrieve = %q, %v", output, value)
+	}
+
+	_, value = run(`{"@type": "BatchRetrieveAction", "identifiers": ["report", "small"]}`, handleSemanticBatchRetrieveImpl)
+	items := value["itemListElement"].([]map[string]interface{})
+	if items[0]["truncated"] != true || items[0]["text"] != "0123456789" || items[0]["contentSize"] != int64(16) {
+		t.Errorf("Capped batch item = %v", items[0])
+	}
+	if items[1]["truncated"] != nil || items[1]["text"] != "tiny" {
+		t.Errorf("Small batch item = %v", items[1])
+	}
+}
+
+func TestSemanticRetrieve_InlineCompress(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_MAX_INLINE_BYTES", "")
+	t.Setenv("WORKFLOW_STORAGE_MAX_RETRIEVE_INLINE", "")
+
+	e := echo.New()
+	store := newFakeStorage()
+	payload := `{"rows": [` + strings.Repeat(`{"status": "ok"}, `, 100) + `{}]}`
+	store.objects[defaultBucket()+"/"+resultKey("default", "rows", "")] = fakeObject{data: []byte(payload), contentType: "application/json", modified: time.Now()}
+
+	retrieve := func(compress string) (*semantic.SemanticAction, error) {
+		action, err := semantic.ParseSemanticAction([]byte(`{"@type": "RetrieveAction", "inlineCompress": "` + compress + `",
+			"object": {"@type": "DigitalDocument", "identifier": "rows"}}`))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return action, handleSemanticRetrieveImpl(c, action)
+	}
+
+	action, err := retrieve("gzip")
+	if err != nil {
+		t.Fatalf("handleSemanticRetrieveImpl() error = %v", err)
+	}
+	value := action.Result.Value.(map[string]interface{})
+	if value["outputCompression"] != "gzip" || value["outputEncoding"] != "base64" || value["contentSize"] != int64(len(payload)) {
+		t.Errorf("Value = %v", value)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(action.Result.Output)
+	if err != nil || value["compressedSize"] != int64(len(compressed)) || len(compressed) >= len(payload) {
+		t.Fatalf("Output is not base64 gzip data smaller than the payload: %v (%d bytes)", err, len(compressed))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	if restored, err := io.ReadAll(zr); err != nil || string(restored) != payload {
+		t.Errorf("Restored output = %q, %v", restored, err)
+	}
+
+	// Without inlineCompress the output is the plain data
+	if action, err := retrieve(""); err != nil || action.Result.Output != payload {
+		t.Errorf("Plain retrieve = %v", err)
+	}
+
+	var httpErr *echo.HTTPError
+	if _, err := retrieve("brotli"); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unsupported inlineCompress, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// validateJSONStream checks that r holds exactly one well-formed JSON value.
+// It walks the input token by token with a json.Decoder instead of building
+// the value, so memory stays bounded by the largest scalar rather than the
+// document, and it reports the byte offset of the first error, which
+// json.Valid does not.
+func validateJSONStream(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	// Numbers are checked for syntax only, not converted
+	dec.UseNumber()
+
+	depth, values := 0, 0
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			if depth > 0 || values == 0 {
+				return fmt.Errorf("unexpected end of JSON input at byte %d", dec.InputOffset())
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("at byte %d: %v", dec.InputOffset(), err)
+		}
+		if depth == 0 && values > 0 {
+			return fmt.Errorf("unexpected data after the JSON value at byte %d", dec.InputOffset())
+		}
+
+		if delim, ok := tok.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+		}
+		if depth == 0 {
+			values++
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"workflowstorageservice.evalgo.org/actions"
+)
+
+func TestValidateJSONStream(t *testing.T) {
+	for _, valid := range []string{`{"a": 1}`, `[1, 2, {"b": [null, true]}]`, `"text"`, " 12.5e3 \n", `{}`} {
+		if err := validateJSONStream(strings.NewReader(valid)); err != nil {
+			t.Errorf("validateJSONStream(%q) error = %v", valid, err)
+		}
+	}
+
+	for input, want := range map[string]string{
+		`{"a" 1}`:  "at byte 4",
+		`[1,]`:     "at byte 2",
+		`{"a": 1`:  "unexpected end of JSON input at byte 7",
+		``:         "unexpected end of JSON input at byte 0",
+		`{} {}`:    "unexpected data after the JSON value at byte 4",
+		`{"a":1}}`: "at byte 7",
+		`{1: 2}`:   "at byte 1",
+	} {
+		err := validateJSONStream(strings.NewReader(input))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("validateJSONStream(%q) error = %v, want %q", input, err, want)
+		}
+	}
+}
+
+func TestSemanticStore_ValidateJSON(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+	storeText := func(b *actions.Builder) *httptest.ResponseRecorder {
+		t.Helper()
+		action, err := b.Action()
+		if err != nil {
+			t.Fatalf("Action() error = %v", err)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), rec)
+		c.Set(storageContextKey, store)
+		if err := handleSemanticStoreImpl(c, action); err != nil {
+			t.Fatalf("Store error = %v", err)
+		}
+		return rec
+	}
+	result := func(text string) *actions.Builder {
+		return actions.NewStoreAction().WithWorkflowID("wf-1").WithIdentifier("checked").WithText(text)
+	}
+
+	rec := storeText(result(`{"rows": [1, 2,]}`).WithProperty("validateJson", true))
+	if rec.Code == http.StatusOK || !strings.Contains(rec.Body.String(), "invalid JSON data: at byte 14") {
+		t.Errorf("Malformed JSON: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	if len(store.objects) != 0 {
+		t.Fatalf("Malformed JSON was stored: %v", store.objects)
+	}
+
+	if rec := storeText(result(`{"rows": [1, 2]}`).WithProperty("validateJson", true)); rec.Code != http.StatusOK {
+		t.Errorf("Valid JSON: status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	rec = storeText(result("a,b").WithFormat("text/csv").WithProperty("validateJson", true))
+	if rec.Code == http.StatusOK || !strings.Contains(rec.Body.String(), "validateJson requires JSON data") {
+		t.Errorf("CSV with validateJson: status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	// Without validateJson the payload is stored as is
+	if rec := storeText(result(`{"rows": [1, 2,]}`)); rec.Code != http.StatusOK {
+		t.Errorf("Unvalidated store: status %d, body %s", rec.Code, rec.Body.String())
+	}
+}
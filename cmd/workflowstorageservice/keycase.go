@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// metadataIdentifier records the canonical identifier of a result stored
+// with key normalization enabled
+const metadataIdentifier = "identifier"
+
+// keyNormalization is the set of normalizations applied to workflow IDs and
+// identifiers before they become part of a key
+type keyNormalization struct {
+	nfc   bool
+	lower bool
+}
+
+// enabled reports whether any normalization is configured
+func (n keyNormalization) enabled() bool {
+	return n.nfc || n.lower
+}
+
+// apply returns the canonical form of a workflow ID or identifier. NFC runs
+// first so composed and decomposed spellings lowercase identically.
+func (n keyNormalization) apply(s string) string {
+	if n.nfc {
+		s = norm.NFC.String(s)
+	}
+	if n.lower {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// names returns the enabled normalizations for /v1/api/config
+func (n keyNormalization) names() []string {
+	var names []string
+	if n.nfc {
+		names = append(names, "nfc")
+	}
+	if n.lower {
+		names = append(names, "lower")
+	}
+	return names
+}
+
+// parseKeyNormalization parses WORKFLOW_STORAGE_KEY_NORMALIZATION, a
+// comma-separated list of "nfc" (Unicode NFC) and "lower" (lowercasing).
+// Unknown entries are returned separately so they can be reported at startup.
+func parseKeyNormalization(spec string) (keyNormalization, []string) {
+	var n keyNormalization
+	var unknown []string
+	for _, entry := range strings.Split(spec, ",") {
+		switch entry = strings.ToLower(strings.TrimSpace(entry)); entry {
+		case "":
+		case "nfc":
+			n.nfc = true
+		case "lower":
+			n.lower = true
+		default:
+			unknown = append(unknown, entry)
+		}
+	}
+	return n, unknown
+}
+
+// currentKeyNormalization returns the configured key normalization
+func currentKeyNormalization() keyNormalization {
+	n, _ := parseKeyNormalization(os.Getenv("WORKFLOW_STORAGE_KEY_NORMALIZATION"))
+	return n
+}
+
+// canonicalIdentifier returns identifier as it appears in keys
+func canonicalIdentifier(identifier string) string {
+	return currentKeyNormalization().apply(identifier)
+}
+
+// normalizingRouter canonicalizes workflow IDs and identifiers before the
+// wrapped router builds keys from them, so "Report-1" and "report-1" resolve
+// to the same object on case-sensitive storage
+type normalizingRouter struct {
+	Router
+	normalization keyNormalization
+}
+
+func (r normalizingRouter) Route(req RouteRequest) (Route, error) {
+	req.WorkflowID = r.normalization.apply(req.WorkflowID)
+	req.Identifier = r.normalization.apply(req.Identifier)
+	return r.Router.Route(req)
+}
+
+func (r normalizingRouter) ListPrefix(workflowID, typ string) (Route, error) {
+	return r.Router.ListPrefix(r.normalization.apply(workflowID), typ)
+}
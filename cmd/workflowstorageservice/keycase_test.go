@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseKeyNormalization(t *testing.T) {
+	n, unknown := parseKeyNormalization(" NFC , lower,upper,")
+	if !n.nfc || !n.lower {
+		t.Errorf("parseKeyNormalization() = %+v, want nfc and lower", n)
+	}
+	if len(unknown) != 1 || unknown[0] != "upper" {
+		t.Errorf("parseKeyNormalization() unknown = %v, want [upper]", unknown)
+	}
+
+	// "Café" with a combining acute accent normalizes to the composed form
+	if got := n.apply("Cafe\u0301-Report"); got != "caf\u00e9-report" {
+		t.Errorf("apply() = %q", got)
+	}
+	if off, _ := parseKeyNormalization(""); off.enabled() || off.apply("Step-1") != "Step-1" {
+		t.Error("Empty normalization should leave keys unchanged")
+	}
+}
+
+func TestKeyNormalization_StoreRetrieve(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_KEY_NORMALIZATION", "nfc,lower")
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(workflowID, body string, handler func(echo.Context, *semantic.SemanticAction) error) *httptest.ResponseRecorder {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", workflowID)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		if err := handler(c, action); err != nil {
+			t.Fatalf("%s failed: %v", body, err)
+		}
+		return rec
+	}
+
+	rec := run("WF-1", `{"@type": "CreateAction", "identifier": "Step-One",
+		"object": {"@type": "DigitalDocument", "text": "{\"marker\": true}"}}`, handleSemanticStoreImpl)
+	if !strings.Contains(rec.Body.String(), `"step-one"`) {
+		t.Errorf("Store did not return the canonical identifier: %s", rec.Body.String())
+	}
+
+	object, ok := store.objects[defaultBucket()+"/workflow-results/wf-1/step-one.json"]
+	if !ok {
+		t.Fatalf("Object not stored at the canonical key, have %v", keysOf(store.objects))
+	}
+	if object.metadata[metadataIdentifier] != "step-one" {
+		t.Errorf("metadata[%s] = %q, want step-one", metadataIdentifier, object.metadata[metadataIdentifier])
+	}
+
+	// Any spelling of the identifier resolves to the same object
+	rec = run("wf-1", `{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "identifier": "STEP-ONE"}}`, handleSemanticRetrieveImpl)
+	if !strings.Contains(rec.Body.String(), "marker") {
+		t.Errorf("Retrieve with different case returned %s", rec.Body.String())
+	}
+
+	rec = run("Wf-1", `{"@type": "ListAction", "workflowId": "Wf-1"}`, handleSemanticListImpl)
+	if !strings.Contains(rec.Body.String(), "workflow-results/wf-1/step-one.json") {
+		t.Errorf("List with different case returned %s", rec.Body.String())
+	}
+}
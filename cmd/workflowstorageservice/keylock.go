@@ -0,0 +1,62 @@
+package main
+
+import "sync"
+
+// keyLocker serializes read-modify-write operations on the same object within
+// this process. Locks are reference counted and removed once no goroutine holds
+// or waits for them, so the map only grows with the number of keys in flight.
+//
+// This only protects against concurrent requests handled by a single service
+// instance. Deployments running several instances should additionally use
+// ETag preconditions (If-Match) so S3 rejects conflicting writes.
+type keyLocker struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// objectLocks guards all mutating actions on bucket/key pairs
+var objectLocks = newKeyLocker()
+
+func newKeyLocker() *keyLocker {
+	return &keyLocker{locks: make(map[string]*keyLock)}
+}
+
+// Lock blocks until the caller holds the lock for bucket/key and returns the
+// function that releases it
+func (l *keyLocker) Lock(bucket, key string) func() {
+	id := bucket + "/" + key
+
+	l.mu.Lock()
+	lock, ok := l.locks[id]
+	if !ok {
+		lock = &keyLock{}
+		l.locks[id] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, id)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// size returns the number of keys currently locked or waited on
+func (l *keyLocker) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.locks)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestKeyLocker_SerializesSameKey(t *testing.T) {
+	locker := newKeyLocker()
+
+	counter := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locker.Lock("bucket", "workflow-results/default/a.json")
+			defer unlock()
+
+			// Unsynchronized read-modify-write; the key lock must serialize it
+			value := counter
+			value++
+			counter = value
+		}()
+	}
+	wg.Wait()
+
+	if counter != 50 {
+		t.Errorf("Expected counter 50, got %d", counter)
+	}
+	if locker.size() != 0 {
+		t.Errorf("Expected unused locks to be cleaned up, %d remain", locker.size())
+	}
+}
+
+func TestKeyLocker_IndependentKeys(t *testing.T) {
+	locker := newKeyLocker()
+
+	unlockA := locker.Lock("bucket", "a")
+	unlockB := locker.Lock("bucket", "b")
+
+	if locker.size() != 2 {
+		t.Errorf("Expected 2 active locks, got %d", locker.size())
+	}
+
+	unlockA()
+	unlockB()
+
+	if locker.size() != 0 {
+		t.Errorf("Expected no active locks, got %d", locker.size())
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// resultsKeyPrefix is the top-level prefix for all stored workflow results
+const resultsKeyPrefix = "workflow-results"
+
+// resultKey builds the S3 key for a workflow result:
+// workflow-results/{workflowId}/{actionId}.json
+//
+// With WORKFLOW_STORAGE_TYPE_FOLDERS enabled, results are grouped by a folder
+// derived from their encoding format and get a matching extension, e.g.
+// workflow-results/{workflowId}/json/{actionId}.json or
+// workflow-results/{workflowId}/binary/{actionId}.bin.
+//
+// With WORKFLOW_STORAGE_SHARD_KEYS enabled the key is prefixed with a short
+// hash of the workflow and action IDs ({hash}/workflow-results/...) to spread
+// load across storage partitions. The mapping is deterministic, so the same
+// IDs always resolve to the same key.
+//
+// With WORKFLOW_STORAGE_FLAT_KEYS enabled the workflow ID, type folder and
+// action ID are joined by keySeparator instead of "/", e.g.
+// workflow-results/{workflowId}__{actionId}.json.
+func resultKey(workflowID, actionID, format string) string {
+	sep := "/"
+	if flatKeysEnabled() {
+		sep = keySeparator()
+	}
+	key := fmt.Sprintf("%s/%s%s%s.json", resultsKeyPrefix, workflowID, sep, actionID)
+	if typeFoldersEnabled() {
+		folder, ext := typeFolder(format)
+		key = fmt.Sprintf("%s/%s%s%s%s%s%s", resultsKeyPrefix, workflowID, sep, folder, sep, actionID, ext)
+	}
+	if shardKeysEnabled() {
+		return keyShard(workflowID, actionID) + "/" + key
+	}
+	return key
+}
+
+// shardKeysEnabled reports whether WORKFLOW_STORAGE_SHARD_KEYS is set
+func shardKeysEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("WORKFLOW_STORAGE_SHARD_KEYS"))
+	return enabled
+}
+
+// defaultKeySeparator joins the parts of flat keys unless
+// WORKFLOW_STORAGE_KEY_SEPARATOR is set
+const defaultKeySeparator = "__"
+
+// flatKeysEnabled reports whether WORKFLOW_STORAGE_FLAT_KEYS is set
+func flatKeysEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("WORKFLOW_STORAGE_FLAT_KEYS"))
+	return enabled
+}
+
+// keySeparator returns WORKFLOW_STORAGE_KEY_SEPARATOR, the separator of flat
+// keys. Separators containing "/" would nest keys again and fall back to
+// defaultKeySeparator.
+func keySeparator() string {
+	sep := os.Getenv("WORKFLOW_STORAGE_KEY_SEPARATOR")
+	if sep == "" || strings.Contains(sep, "/") {
+		return defaultKeySeparator
+	}
+	return sep
+}
+
+// checkFlatWorkflowID rejects workflow IDs that make flat keys ambiguous:
+// IDs containing the separator, or ending in a way that forms the separator
+// with it (e.g. "wf_" with "__"), would share another workflow's key prefix
+func checkFlatWorkflowID(workflowID string) error {
+	sep := keySeparator()
+	if strings.Index(workflowID+sep, sep) < len(workflowID) {
+		return fmt.Errorf("workflow ID %q conflicts with the flat key separator %q", workflowID, sep)
+	}
+	return nil
+}
+
+// typeFoldersEnabled reports whether WORKFLOW_STORAGE_TYPE_FOLDERS is set
+func typeFoldersEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("WORKFLOW_STORAGE_TYPE_FOLDERS"))
+	return enabled
+}
+
+// keyShard returns the two hex character shard for a workflow result
+func keyShard(workflowID, actionID string) string {
+	sum := sha256.Sum256([]byte(workflowID + "/" + actionID))
+	return hex.EncodeToString(sum[:1])
+}
+
+// typeFolder maps an encoding format to its layout folder and file extension.
+// An empty format is treated as application/json, the service default.
+func typeFolder(format string) (string, string) {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(format, ";")[0]))
+	switch {
+	case mediaType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return "json", ".json"
+	case mediaType == "application/x-ndjson":
+		return "ndjson", ".ndjson"
+	case mediaType == "text/csv":
+		return "csv", ".csv"
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return "xml", ".xml"
+	case strings.HasPrefix(mediaType, "text/"):
+		return "text", ".txt"
+	default:
+		return "binary", ".bin"
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+func TestResultKey_TypeFolders(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_TYPE_FOLDERS", "true")
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"application/json", "workflow-results/wf-1/json/step-1.json"},
+		{"", "workflow-results/wf-1/json/step-1.json"},
+		{"text/csv", "workflow-results/wf-1/csv/step-1.csv"},
+		{"text/plain; charset=utf-8", "workflow-results/wf-1/text/step-1.txt"},
+		{"application/octet-stream", "workflow-results/wf-1/binary/step-1.bin"},
+	}
+
+	for _, tt := range tests {
+		if got := resultKey("wf-1", "step-1", tt.format); got != tt.want {
+			t.Errorf("resultKey(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestResultKey_Sharding(t *testing.T) {
+	resetStorageEnv(t)
+	if got := resultKey("wf-1", "step-1", ""); got != "workflow-results/wf-1/step-1.json" {
+		t.Errorf("Unexpected unsharded key %q", got)
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_SHARD_KEYS", "true")
+	sharded := resultKey("wf-1", "step-1", "")
+	if sharded != resultKey("wf-1", "step-1", "") {
+		t.Error("Sharded keys must be deterministic")
+	}
+
+	shard := keyShard("wf-1", "step-1")
+	if len(shard) != 2 {
+		t.Errorf("Expected two character shard, got %q", shard)
+	}
+	if sharded != shard+"/workflow-results/wf-1/step-1.json" {
+		t.Errorf("Unexpected sharded key %q", sharded)
+	}
+}
+
+func TestResultKey_FlatKeys(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_FLAT_KEYS", "true")
+
+	if got := resultKey("wf-1", "step-1", ""); got != "workflow-results/wf-1__step-1.json" {
+		t.Errorf("Flat key = %q", got)
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_TYPE_FOLDERS", "true")
+	if got := resultKey("wf-1", "step-1", "text/csv"); got != "workflow-results/wf-1__csv__step-1.csv" {
+		t.Errorf("Flat key with type folders = %q", got)
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_TYPE_FOLDERS", "")
+	t.Setenv("WORKFLOW_STORAGE_KEY_SEPARATOR", "~")
+	if got := resultKey("wf-1", "step-1", ""); got != "workflow-results/wf-1~step-1.json" {
+		t.Errorf("Flat key with separator ~ = %q", got)
+	}
+	t.Setenv("WORKFLOW_STORAGE_KEY_SEPARATOR", "/")
+	if got := keySeparator(); got != defaultKeySeparator {
+		t.Errorf("keySeparator() with / = %q, want the default", got)
+	}
+}
+
+func TestCheckFlatWorkflowID(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_KEY_SEPARATOR", "")
+	for workflowID, valid := range map[string]bool{
+		"wf-1":     true,
+		"wf_1":     true,
+		"_wf":      true,
+		"wf__1":    false,
+		"wf_":      false,
+		"wf___one": false,
+	} {
+		if err := checkFlatWorkflowID(workflowID); (err == nil) != valid {
+			t.Errorf("checkFlatWorkflowID(%q) error = %v, want valid %t", workflowID, err, valid)
+		}
+	}
+}
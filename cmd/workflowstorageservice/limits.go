@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultMaxActionBytes bounds a semantic request body. Stored data is
+	// sent inline in object.text, so the limit is generous.
+	defaultMaxActionBytes int64 = 32 << 20
+	// defaultMaxJSONDepth bounds the nesting of a semantic action; real
+	// actions stay far below it
+	defaultMaxJSONDepth = 64
+)
+
+// maxActionBytes returns WORKFLOW_STORAGE_MAX_ACTION_BYTES or the default
+func maxActionBytes() int64 {
+	if limit, err := strconv.ParseInt(os.Getenv("WORKFLOW_STORAGE_MAX_ACTION_BYTES"), 10, 64); err == nil && limit > 0 {
+		return limit
+	}
+	return defaultMaxActionBytes
+}
+
+// maxJSONDepth returns WORKFLOW_STORAGE_MAX_JSON_DEPTH or the default
+func maxJSONDepth() int {
+	if depth, err := strconv.Atoi(os.Getenv("WORKFLOW_STORAGE_MAX_JSON_DEPTH")); err == nil && depth > 0 {
+		return depth
+	}
+	return defaultMaxJSONDepth
+}
+
+// parseTypeSizeLimits parses WORKFLOW_STORAGE_TYPE_SIZE_LIMITS, a
+// comma-separated list of type=bytes entries such as
+// "application/json=1048576,image/*=8388608". A type may be a media type or
+// a top-level wildcard. Malformed entries are returned separately so they can
+// be reported once at startup.
+func parseTypeSizeLimits(spec string) (map[string]int64, []string) {
+	limits := make(map[string]int64)
+	var malformed []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		typ, value, ok := strings.Cut(entry, "=")
+		typ = strings.ToLower(strings.TrimSpace(typ))
+		limit, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if !ok || !strings.Contains(typ, "/") || err != nil || limit <= 0 {
+			malformed = append(malformed, entry)
+			continue
+		}
+		limits[typ] = limit
+	}
+	return limits, malformed
+}
+
+// typeSizeLimits returns the configured per-type object size limits
+func typeSizeLimits() map[string]int64 {
+	limits, _ := parseTypeSizeLimits(os.Getenv("WORKFLOW_STORAGE_TYPE_SIZE_LIMITS"))
+	return limits
+}
+
+// typeLimitsAboveBodyLimit returns the WORKFLOW_STORAGE_TYPE_SIZE_LIMITS
+// entries larger than maxActionBytes, sorted. Request bodies are capped at
+// maxActionBytes before the type is known, so these limits never take effect.
+func typeLimitsAboveBodyLimit() []string {
+	bodyLimit := maxActionBytes()
+	var above []string
+	for typ, limit := range typeSizeLimits() {
+		if limit > bodyLimit {
+			above = append(above, fmt.Sprintf("%s=%d", typ, limit))
+		}
+	}
+	sort.Strings(above)
+	return above
+}
+
+// maxObjectBytes returns the largest object of encoding format that may be
+// stored: the exact media type's entry in WORKFLOW_STORAGE_TYPE_SIZE_LIMITS,
+// then its type/* entry, then the global maxActionBytes
+func maxObjectBytes(format string) int64 {
+	limits := typeSizeLimits()
+	mediaType, _, err := mime.ParseMediaType(format)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(format))
+	}
+	if limit, ok := limits[mediaType]; ok {
+		return limit
+	}
+	if top, _, ok := strings.Cut(mediaType, "/"); ok {
+		if limit, ok := limits[top+"/*"]; ok {
+			return limit
+		}
+	}
+	return maxActionBytes()
+}
+
+// checkObjectSize rejects data larger than maxObjectBytes(format); the error
+// names the applicable limit and is answered with 413
+func checkObjectSize(format string, size int) error {
+	if limit := maxObjectBytes(format); int64(size) > limit {
+		return fmt.Errorf("%s object of %d bytes exceeds the limit of %d bytes", format, size, limit)
+	}
+	return nil
+}
+
+// payloadLimitError reports a request body that exceeds a limit, with the
+// HTTP status to answer
+type payloadLimitError struct {
+	status  int
+	message string
+}
+
+func (e *payloadLimitError) Error() string {
+	return e.message
+}
+
+// readLimitedBody reads the request body, failing with a 413 payloadLimitError
+// once it exceeds maxActionBytes
+func readLimitedBody(c echo.Context) ([]byte, error) {
+	limit := maxActionBytes()
+	data, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, &payloadLimitError{http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit)}
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// checkJSONDepth rejects JSON nested deeper than maxJSONDepth with a 400
+// payloadLimitError. It scans the raw bytes once, before anything is
+// unmarshaled, so a hostile payload never reaches the decoder.
+func checkJSONDepth(data []byte) error {
+	limit := maxJSONDepth()
+	if depth := jsonDepth(data, limit); depth > limit {
+		return &payloadLimitError{http.StatusBadRequest, fmt.Sprintf("JSON nesting exceeds %d levels", limit)}
+	}
+	return nil
+}
+
+// readActionBody reads a semantic request body and checks it against both
+// limits. Limit violations are returned as *echo.HTTPError.
+func readActionBody(c echo.Context) ([]byte, error) {
+	data, err := readLimitedBody(c)
+	if err == nil {
+		err = checkJSONDepth(data)
+	}
+	var limitErr *payloadLimitError
+	if errors.As(err, &limitErr) {
+		return nil, echo.NewHTTPError(limitErr.status, limitErr.message)
+	}
+	return data, err
+}
+
+// jsonDepth returns the maximum object/array nesting of data, stopping as
+// soon as it exceeds limit. Brackets inside strings are ignored; malformed
+// JSON is left to the parser.
+func jsonDepth(data []byte, limit int) int {
+	depth, maxDepth := 0, 0
+	inString, escaped := false, false
+	for _, b := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > maxDepth {
+				maxDepth = depth
+				if maxDepth > limit {
+					return maxDepth
+				}
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return maxDepth
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestJSONDepth(t *testing.T) {
+	tests := []struct {
+		data string
+		want int
+	}{
+		{`"flat"`, 0},
+		{`{"a": 1}`, 1},
+		{`{"a": [{"b": []}]}`, 4},
+		{`{"a": "[[[[{{{{"}`, 1},
+		{`{"a": "\"[["}`, 1},
+		{`[[[]], [[]]]`, 3},
+	}
+	for _, tt := range tests {
+		if got := jsonDepth([]byte(tt.data), 100); got != tt.want {
+			t.Errorf("jsonDepth(%s) = %d, want %d", tt.data, got, tt.want)
+		}
+	}
+
+	if got := jsonDepth([]byte(strings.Repeat("[", 1000)), 10); got != 11 {
+		t.Errorf("jsonDepth() did not stop at the limit, got %d", got)
+	}
+}
+
+func TestSemanticAction_PayloadLimits(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_MAX_ACTION_BYTES", "256")
+	t.Setenv("WORKFLOW_STORAGE_MAX_JSON_DEPTH", "8")
+	registerActions()
+
+	e := echo.New()
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"too large", `{"@type": "RetrieveAction", "padding": "` + strings.Repeat("x", 300) + `"}`, http.StatusRequestEntityTooLarge},
+		{"too deep", `{"@type": "RetrieveAction", "nested": ` + strings.Repeat("[", 20) + strings.Repeat("]", 20) + `}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", strings.NewReader(tt.body))
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set(storageContextKey, newFakeStorage())
+
+		err := handleSemanticAction(c)
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != tt.want {
+			t.Errorf("%s: expected %d, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// Batches are bounded by the same limits
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/batch", strings.NewReader(`[`+strings.Repeat("[", 20)+strings.Repeat("]", 20)+`]`))
+	rec := httptest.NewRecorder()
+	if err := handleSemanticBatch(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handleSemanticBatch() error = %v", err)
+	}
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "nesting") {
+		t.Errorf("Batch: status = %d, body %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSemanticAction_ChunkedBody(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_MAX_ACTION_BYTES", "512")
+	registerActions()
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	// chunked hides the body length the way a streaming client does
+	chunked := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", io.MultiReader(strings.NewReader(body)))
+		req.ContentLength = -1
+		req.TransferEncoding = []string{"chunked"}
+		return req
+	}
+
+	rec := httptest.NewRecorder()
+	c := e.NewContext(chunked(`{"@type": "CreateAction", "identifier": "streamed",
+		"object": {"@type": "DigitalDocument", "text": "{\"chunked\": true}"}}`), rec)
+	c.Set(storageContextKey, store)
+	if err := handleSemanticAction(c); err != nil {
+		t.Fatalf("handleSemanticAction() error = %v", err)
+	}
+	if object, ok := store.objects[defaultBucket()+"/workflow-results/default/streamed.json"]; !ok || string(object.data) != `{"chunked": true}` {
+		t.Errorf("Chunked store wrote %v", keysOf(store.objects))
+	}
+
+	// The size limit still applies without a Content-Length to check up front
+	c = e.NewContext(chunked(`{"@type": "CreateAction", "padding": "`+strings.Repeat("x", 600)+`"}`), httptest.NewRecorder())
+	c.Set(storageContextKey, store)
+	var httpErr *echo.HTTPError
+	if err := handleSemanticAction(c); !errors.As(err, &httpErr) || httpErr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Oversized chunked body error = %v, want 413", err)
+	}
+}
+
+func TestMaxObjectBytes(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_MAX_ACTION_BYTES", "1000")
+	t.Setenv("WORKFLOW_STORAGE_TYPE_SIZE_LIMITS", "application/json=10, image/*=500,image/png=700,bogus=1,text/csv=x")
+
+	if _, malformed := parseTypeSizeLimits(os.Getenv("WORKFLOW_STORAGE_TYPE_SIZE_LIMITS")); len(malformed) != 2 {
+		t.Errorf("parseTypeSizeLimits() malformed = %v, want 2 entries", malformed)
+	}
+	tests := map[string]int64{
+		"application/json":                10,
+		"application/json; charset=utf-8": 10,
+		"image/jpeg":                      500,
+		"image/png":                       700,
+		"text/csv":                        1000,
+	}
+	for format, want := range tests {
+		if got := maxObjectBytes(format); got != want {
+			t.Errorf("maxObjectBytes(%q) = %d, want %d", format, got, want)
+		}
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_MAX_ACTION_BYTES", "600")
+	if above := typeLimitsAboveBodyLimit(); len(above) != 1 || above[0] != "image/png=700" {
+		t.Errorf("typeLimitsAboveBodyLimit() = %v, want [image/png=700]", above)
+	}
+}
+
+func TestSemanticStore_TypeSizeLimit(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_TYPE_SIZE_LIMITS", "application/json=16")
+
+	e := echo.New()
+	store := newFakeStorage()
+	run := func(text, format string) error {
+		action, err := semantic.ParseSemanticAction([]byte(`{"@type": "CreateAction", "identifier": "sized",
+			"object": {"@type": "DigitalDocument", "encodingFormat": "` + format + `", "text": "` + text + `"}}`))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return handleSemanticStoreImpl(c, action)
+	}
+
+	var httpErr *echo.HTTPError
+	err := run(`{\"padding\": \"`+strings.Repeat("x", 32)+`\"}`, "application/json")
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusRequestEntityTooLarge || !strings.Contains(fmt.Sprint(httpErr.Message), "16 bytes") {
+		t.Errorf("Oversized JSON: error = %v, want 413 naming the limit", err)
+	}
+	// Unlisted types fall back to the global limit
+	if err := run(strings.Repeat("x", 32), "text/plain"); err != nil {
+		t.Errorf("text/plain store failed: %v", err)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultListPageSize is the page size when neither maxKeys nor
+	// WORKFLOW_STORAGE_LIST_PAGE_SIZE is given
+	defaultListPageSize = 100
+
+	// defaultMaxListKeys bounds the keys returned by one ListAction when
+	// WORKFLOW_STORAGE_LIST_MAX_KEYS is not set
+	defaultMaxListKeys = 10000
+
+	// maxListPageSize is the S3 ListObjectsV2 page limit
+	maxListPageSize = 1000
+
+	// maxCountAllKeys bounds the walk performed for countAll
+	maxCountAllKeys = 10000
+
+	// maxFilterScanKeys bounds the keys one ListAction examines when
+	// modifiedAfter or modifiedBefore filter the page
+	maxFilterScanKeys = 10000
+)
+
+// modifiedRange is the modifiedAfter/modifiedBefore filter of a ListAction.
+// A zero bound is open.
+type modifiedRange struct {
+	after, before time.Time
+}
+
+// parseModifiedRange reads the modifiedAfter and modifiedBefore properties,
+// both RFC 3339 timestamps
+func parseModifiedRange(action *semantic.SemanticAction) (modifiedRange, error) {
+	var r modifiedRange
+	for _, bound := range []struct {
+		name string
+		dst  *time.Time
+	}{{"modifiedAfter", &r.after}, {"modifiedBefore", &r.before}} {
+		value := stringProperty(action, bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return modifiedRange{}, fmt.Errorf("%s must be an RFC 3339 timestamp", bound.name)
+		}
+		*bound.dst = t
+	}
+	if !r.after.IsZero() && !r.before.IsZero() && !r.after.Before(r.before) {
+		return modifiedRange{}, errors.New("modifiedAfter must be before modifiedBefore")
+	}
+	return r, nil
+}
+
+// active reports whether the range filters anything
+func (r modifiedRange) active() bool {
+	return !r.after.IsZero() || !r.before.IsZero()
+}
+
+// contains reports whether an object modified at t passes the filter. Objects
+// without a modification time only pass an open range.
+func (r modifiedRange) contains(t *time.Time) bool {
+	if !r.active() {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	return (r.after.IsZero() || t.After(r.after)) && (r.before.IsZero() || t.Before(r.before))
+}
+
+// listPageSize returns WORKFLOW_STORAGE_LIST_PAGE_SIZE or the default, the
+// number of keys a ListAction returns without maxKeys
+func listPageSize() int64 {
+	size, err := strconv.ParseInt(os.Getenv("WORKFLOW_STORAGE_LIST_PAGE_SIZE"), 10, 64)
+	if err != nil || size <= 0 {
+		return defaultListPageSize
+	}
+	return min(size, maxListKeys())
+}
+
+// maxListKeys returns WORKFLOW_STORAGE_LIST_MAX_KEYS or the default, the
+// most keys a single ListAction returns however large maxKeys is
+func maxListKeys() int64 {
+	limit, err := strconv.ParseInt(os.Getenv("WORKFLOW_STORAGE_LIST_MAX_KEYS"), 10, 64)
+	if err != nil || limit <= 0 {
+		return defaultMaxListKeys
+	}
+	return limit
+}
+
+// handleSemanticListImpl lists stored results one page at a time. Optional
+// properties: workflowId (restricts to one workflow), maxKeys,
+// continuationToken, and countAll. A page larger than the 1000 keys S3
+// returns per ListObjectsV2 call is assembled from several calls; maxKeys is
+// capped at maxListKeys, and the response reports truncated when the cap
+// cut the page short. countAll walks the whole prefix to report totalCount,
+// which costs one extra ListObjectsV2 call per 1000 keys and is capped at
+// maxCountAllKeys (totalCountIsExact is false when the cap is hit).
+//
+// modifiedAfter and modifiedBefore keep only objects modified within the
+// range. S3 lists keys in lexical rather than time order, so the filter is
+// applied while paging and a filtered page may need many calls; after
+// maxFilterScanKeys examined keys the page is returned short with
+// scanLimitReached and a continuation token.
+//
+// Version keys (see isVersionKey) are skipped like filtered keys and not
+// counted; versionsOf lists the versions of one result instead (see
+// listVersions). With Accept: application/x-tar the selected objects are streamed as a tar
+// archive instead (see listTarExport).
+func handleSemanticListImpl(c echo.Context, action *semantic.SemanticAction) error {
+	// versionsOf lists the history of one versioned result instead
+	if identifier := stringProperty(action, "versionsOf"); identifier != "" {
+		return listVersions(c, action, identifier)
+	}
+
+	modified, err := parseModifiedRange(action)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	router, err := routerFor(tenantFor(c))
+	if err != nil {
+		return returnActionError(c, action, "Failed to resolve storage location", err)
+	}
+	listRoute, err := router.ListPrefix(stringProperty(action, "workflowId"), stringProperty(action, "type"))
+	if errors.Is(err, errWorkflowsNotListable) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return returnActionError(c, action, "Failed to resolve storage location", err)
+	}
+	bucket, prefix := listRoute.Bucket, listRoute.Key
+
+	if acceptsTar(c.Request()) {
+		return listTarExport(c, action, bucket, prefix, modified)
+	}
+
+	pageSize := listPageSize()
+	if maxKeys, ok := int64Property(action, "maxKeys"); ok && maxKeys > 0 {
+		pageSize = maxKeys
+	}
+	limit := maxListKeys()
+	capped := pageSize > limit
+	if capped {
+		pageSize = limit
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+	if token, ok := action.Properties["continuationToken"].(string); ok && token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+
+	// S3 returns at most 1000 keys per call, so larger pages take several
+	store := storageFor(c)
+	items := make([]map[string]interface{}, 0, min(pageSize, maxListPageSize))
+	hasMore, scanLimitReached := false, false
+	scanned, skippedVersions := 0, 0
+	var nextToken *string
+	for int64(len(items)) < pageSize {
+		// Never ask for more keys than the page can take, so the continuation
+		// token does not skip matches that did not fit
+		input.MaxKeys = aws.Int32(int32(min(pageSize-int64(len(items)), maxListPageSize)))
+		page, err := store.ListObjectsV2(c.Request().Context(), input)
+		if err != nil {
+			logf(c, "Failed to list %s: %v", prefix, err)
+			return returnActionError(c, action, "Failed to list objects", err)
+		}
+
+		scanned += len(page.Contents)
+		for _, obj := range page.Contents {
+			if isVersionKey(aws.ToString(obj.Key)) {
+				skippedVersions++
+				continue
+			}
+			if !modified.contains(obj.LastModified) {
+				continue
+			}
+			item := map[string]interface{}{
+				"contentUrl":  fmt.Sprintf("s3://%s/%s", bucket, aws.ToString(obj.Key)),
+				"contentSize": aws.ToInt64(obj.Size),
+			}
+			if obj.LastModified != nil {
+				item["lastModified"] = obj.LastModified.UTC().Format(time.RFC3339)
+			}
+			items = append(items, item)
+		}
+
+		hasMore = aws.ToBool(page.IsTruncated) && page.NextContinuationToken != nil
+		nextToken = page.NextContinuationToken
+		if !hasMore {
+			break
+		}
+		if (modified.active() || skippedVersions > 0) && scanned >= maxFilterScanKeys {
+			scanLimitReached = true
+			break
+		}
+		input.ContinuationToken = nextToken
+	}
+
+	value := map[string]interface{}{
+		"numberOfItems":   len(items),
+		"itemListElement": items,
+		"hasMore":         hasMore,
+	}
+	if hasMore {
+		value["nextContinuationToken"] = *nextToken
+	}
+	if capped && hasMore {
+		// The caller asked for more than one ListAction may return
+		value["truncated"] = true
+		value["maxKeys"] = limit
+	}
+	if scanLimitReached {
+		// The filter matched too few keys to fill the page within the budget
+		value["scanLimitReached"] = true
+	}
+
+	if boolProperty(action, "countAll") {
+		total, exact, err := countKeys(c.Request().Context(), store, bucket, prefix)
+		if err != nil {
+			logf(c, "Failed to count %s: %v", prefix, err)
+			return returnActionError(c, action, "Failed to count objects", err)
+		}
+		value["totalCount"] = total
+		value["totalCountIsExact"] = exact
+	}
+
+	if modified.active() {
+		logf(c, "Listed %d workflow results under %s, %d keys examined", len(items), prefix, scanned)
+	} else {
+		logf(c, "Listed %d workflow results under %s", len(items), prefix)
+	}
+
+	action.Result = &semantic.SemanticResult{
+		Type:  "ItemList",
+		Value: value,
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// listTarExport streams every object a ListAction selects, across all pages
+// and at most maxListKeys, as a tar archive. Entries are named by their key
+// below prefix, so tar -x recreates the workflow's layout, e.g. step-1.json
+// or json/step-1.json with type folders.
+func listTarExport(c echo.Context, action *semantic.SemanticAction, bucket, prefix string, modified modifiedRange) error {
+	filename := stringProperty(action, "filename")
+	if filename == "" {
+		filename = "export.tar"
+	} else if err := validateFilename(filename); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	keys, err := tarExportKeys(c.Request().Context(), storageFor(c), bucket, prefix, modified, maxListKeys())
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return err
+		}
+		logf(c, "Failed to list %s: %v", prefix, err)
+		return returnActionError(c, action, "Failed to list objects", err)
+	}
+
+	contentURLs := make([]string, len(keys))
+	objects := make([]Route, len(keys))
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		contentURLs[i] = fmt.Sprintf("s3://%s/%s", bucket, key)
+		objects[i] = Route{Bucket: bucket, Key: key}
+		names[i] = strings.TrimPrefix(key, prefix)
+		if names[i] == "" || strings.HasPrefix(names[i], "/") || hasDotSegment(names[i]) {
+			// Never let an entry escape the directory it is extracted into
+			names[i] = path.Base(key)
+		}
+	}
+	return streamTar(c, filename, contentURLs, objects, names)
+}
+
+// countKeys walks prefix and counts its objects other than versions,
+// stopping after maxCountAllKeys keys. exact is false when the walk stopped
+// early.
+func countKeys(ctx context.Context, store Storage, bucket, prefix string) (int, bool, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(maxListPageSize),
+	}
+
+	total, scanned := 0, 0
+	for {
+		page, err := store.ListObjectsV2(ctx, input)
+		if err != nil {
+			return 0, false, err
+		}
+		scanned += len(page.Contents)
+		for _, obj := range page.Contents {
+			if !isVersionKey(aws.ToString(obj.Key)) {
+				total++
+			}
+		}
+
+		if !aws.ToBool(page.IsTruncated) || page.NextContinuationToken == nil {
+			return total, true, nil
+		}
+		if scanned >= maxCountAllKeys {
+			return total, false, nil
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+}
+
+// handleSemanticList wraps the implementation to match ActionHandler signature
+func handleSemanticList(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticListImpl(c, action)
+}
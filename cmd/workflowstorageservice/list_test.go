@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSemanticList_PaginationAndCountAll(t *testing.T) {
+	resetStorageEnv(t)
+
+	store := newFakeStorage()
+	for i := 0; i < 5; i++ {
+		store.objects[fmt.Sprintf("px-semantic/workflow-results/wf-1/step-%d.json", i)] = fakeObject{data: []byte("{}")}
+	}
+	store.objects["px-semantic/workflow-results/wf-2/other.json"] = fakeObject{data: []byte("{}")}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{
+		"@context": "https://schema.org",
+		"@type": "ListAction",
+		"workflowId": "wf-1",
+		"maxKeys": 2,
+		"countAll": true
+	}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(storageContextKey, store)
+
+	if err := handleSemanticListImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticListImpl() error = %v", err)
+	}
+
+	value := action.Result.Value.(map[string]interface{})
+	if value["numberOfItems"] != 2 {
+		t.Errorf("Expected a page of 2 items, got %v", value["numberOfItems"])
+	}
+	if value["hasMore"] != true {
+		t.Error("Expected hasMore for a truncated page")
+	}
+	if value["totalCount"] != 5 || value["totalCountIsExact"] != true {
+		t.Errorf("Expected exact totalCount 5, got %v (exact: %v)", value["totalCount"], value["totalCountIsExact"])
+	}
+}
+
+func TestSemanticList_RejectsShardedKeys(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_SHARD_KEYS", "true")
+
+	store := newFakeStorage()
+	store.objects[defaultBucket()+"/"+resultKey("wf-1", "step", "application/json")] = fakeObject{data: []byte("{}")}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "ListAction", "workflowId": "wf-1"}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+	c.Set(storageContextKey, store)
+
+	var httpErr *echo.HTTPError
+	if err := handleSemanticListImpl(c, action); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("ListAction with sharded keys: error = %v, want 400", err)
+	}
+}
+
+func TestCountKeys_StopsAtBound(t *testing.T) {
+	store := newFakeStorage()
+	for i := 0; i < maxCountAllKeys+maxListPageSize+1; i++ {
+		store.objects[fmt.Sprintf("bucket/workflow-results/wf/%06d.json", i)] = fakeObject{}
+	}
+
+	total, exact, err := countKeys(context.Background(), store, "bucket", "workflow-results/")
+	if err != nil {
+		t.Fatalf("countKeys() error = %v", err)
+	}
+	if exact {
+		t.Error("Expected an approximate count when the bound is reached")
+	}
+	if total != maxCountAllKeys {
+		t.Errorf("Expected walk to stop at %d keys, got %d", maxCountAllKeys, total)
+	}
+}
+
+func TestSemanticList_PagesBeyondS3Limit(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_LIST_MAX_KEYS", "1500")
+
+	store := newFakeStorage()
+	for i := 0; i < 2500; i++ {
+		store.objects[fmt.Sprintf("px-semantic/workflow-results/wf-big/%04d.json", i)] = fakeObject{data: []byte("{}")}
+	}
+
+	list := func(body string) map[string]interface{} {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		if err := handleSemanticListImpl(c, action); err != nil {
+			t.Fatalf("handleSemanticListImpl() error = %v", err)
+		}
+		return action.Result.Value.(map[string]interface{})
+	}
+
+	// maxKeys above the configured cap is served up to the cap, across two S3 pages
+	first := list(`{"@type": "ListAction", "workflowId": "wf-big", "maxKeys": 5000}`)
+	if first["numberOfItems"] != 1500 || first["truncated"] != true || first["maxKeys"] != int64(1500) {
+		t.Errorf("First page = %v items, truncated %v, maxKeys %v", first["numberOfItems"], first["truncated"], first["maxKeys"])
+	}
+	token, _ := first["nextContinuationToken"].(string)
+	if first["hasMore"] != true || token == "" {
+		t.Fatalf("Expected a continuation token, got %v", first["nextContinuationToken"])
+	}
+
+	// The token continues where the capped page stopped
+	rest := list(`{"@type": "ListAction", "workflowId": "wf-big", "maxKeys": 5000, "continuationToken": "` + token + `"}`)
+	if rest["numberOfItems"] != 1000 || rest["hasMore"] != false || rest["truncated"] != nil {
+		t.Errorf("Second page = %v items, hasMore %v, truncated %v", rest["numberOfItems"], rest["hasMore"], rest["truncated"])
+	}
+}
+
+func TestSemanticList_ModifiedRange(t *testing.T) {
+	resetStorageEnv(t)
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := newFakeStorage()
+	for i := 0; i < 6; i++ {
+		// Lexical and modification order disagree: step-0 is the newest
+		store.objects[fmt.Sprintf("px-semantic/workflow-results/wf-1/step-%d.json", i)] = fakeObject{
+			data:     []byte("{}"),
+			modified: now.Add(-time.Duration(i) * time.Hour),
+		}
+	}
+
+	list := func(body string) (map[string]interface{}, error) {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		if err := handleSemanticListImpl(c, action); err != nil {
+			return nil, err
+		}
+		return action.Result.Value.(map[string]interface{}), nil
+	}
+
+	// Results of the last 150 minutes: step-0, step-1 and step-2
+	value, err := list(`{"@type": "ListAction", "workflowId": "wf-1", "modifiedAfter": "2026-05-01T09:30:00Z"}`)
+	if err != nil || value["numberOfItems"] != 3 || value["hasMore"] != false {
+		t.Fatalf("modifiedAfter = %v, %v", value, err)
+	}
+
+	// Pages of a filtered listing continue without skipping matches
+	value, err = list(`{"@type": "ListAction", "workflowId": "wf-1", "maxKeys": 2,
+		"modifiedAfter": "2026-05-01T07:30:00Z", "modifiedBefore": "2026-05-01T11:30:00Z"}`)
+	if err != nil || value["numberOfItems"] != 2 || value["hasMore"] != true {
+		t.Fatalf("First filtered page = %v, %v", value, err)
+	}
+	token := value["nextContinuationToken"].(string)
+	value, err = list(`{"@type": "ListAction", "workflowId": "wf-1", "maxKeys": 2, "continuationToken": "` + token + `",
+		"modifiedAfter": "2026-05-01T07:30:00Z", "modifiedBefore": "2026-05-01T11:30:00Z"}`)
+	if err != nil {
+		t.Fatalf("Second filtered page error = %v", err)
+	}
+	if items := value["itemListElement"].([]map[string]interface{}); len(items) != 2 || items[1]["contentUrl"] != "s3://px-semantic/workflow-results/wf-1/step-4.json" {
+		t.Errorf("Second filtered page = %v", items)
+	}
+
+	var httpErr *echo.HTTPError
+	for _, body := range []string{
+		`{"@type": "ListAction", "modifiedAfter": "yesterday"}`,
+		`{"@type": "ListAction", "modifiedAfter": "2026-05-01T12:00:00Z", "modifiedBefore": "2026-05-01T11:00:00Z"}`,
+	} {
+		if _, err := list(body); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+			t.Errorf("%s: error = %v, want 400", body, err)
+		}
+	}
+}
+
+func TestSemanticList_ModifiedRangeScanLimit(t *testing.T) {
+	resetStorageEnv(t)
+
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newFakeStorage()
+	for i := 0; i < maxFilterScanKeys+maxListPageSize; i++ {
+		store.objects[fmt.Sprintf("px-semantic/workflow-results/wf-1/%05d.json", i)] = fakeObject{modified: old}
+	}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "ListAction", "maxKeys": 1000, "modifiedAfter": "2026-01-01T00:00:00Z"}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+	c.Set(storageContextKey, store)
+	if err := handleSemanticListImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticListImpl() error = %v", err)
+	}
+
+	value := action.Result.Value.(map[string]interface{})
+	if value["numberOfItems"] != 0 || value["scanLimitReached"] != true || value["hasMore"] != true || value["nextContinuationToken"] == nil {
+		t.Errorf("Expected an empty page stopped by the scan budget, got %v", value)
+	}
+}
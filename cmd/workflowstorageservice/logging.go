@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"eve.evalgo.org/common"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// logger is the EVE service logger shared by main and the handlers
+var logger = common.ServiceLogger("workflowstorageservice", "1.0.0")
+
+// configureLogLevel applies WORKFLOW_STORAGE_LOG_LEVEL (debug, info, warn,
+// error). Debug output is silent unless explicitly enabled.
+func configureLogLevel() {
+	level := logrus.InfoLevel
+	if value := strings.TrimSpace(os.Getenv("WORKFLOW_STORAGE_LOG_LEVEL")); value != "" {
+		parsed, err := logrus.ParseLevel(value)
+		if err != nil {
+			logger.WithError(err).Warn("Invalid WORKFLOW_STORAGE_LOG_LEVEL, using info")
+		} else {
+			level = parsed
+		}
+	}
+	logger.Logger.SetLevel(level)
+}
+
+// debugf logs a debug message tagged with the request ID
+func debugf(c echo.Context, format string, args ...interface{}) {
+	entry := logger
+	if id := requestID(c); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	entry.Debugf(format, args...)
+}
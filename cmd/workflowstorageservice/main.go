@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -9,10 +10,8 @@ import (
 
 	"eve.evalgo.org/web"
 
-	"eve.evalgo.org/common"
 	evehttp "eve.evalgo.org/http"
 	"eve.evalgo.org/registry"
-	"eve.evalgo.org/semantic"
 	"eve.evalgo.org/statemanager"
 	"eve.evalgo.org/tracing"
 	"github.com/labstack/echo/v4"
@@ -20,25 +19,33 @@ import (
 )
 
 func main() {
-	// Initialize logger
-	logger := common.ServiceLogger("workflowstorageservice", "1.0.0")
+	// Initialize logger verbosity (WORKFLOW_STORAGE_LOG_LEVEL)
+	configureLogLevel()
+
+	// Initialize S3 client (exits if credentials are missing)
+	initStorage()
 
 	// Register action handlers with the semantic action registry
-	// This allows the service to handle semantic actions without modifying switch statements
-	semantic.MustRegister("UploadAction", handleSemanticStore)
-	semantic.MustRegister("CreateAction", handleSemanticStore)
-	semantic.MustRegister("StoreAction", handleSemanticStore)
-	semantic.MustRegister("DownloadAction", handleSemanticRetrieve)
-	semantic.MustRegister("RetrieveAction", handleSemanticRetrieve)
-	semantic.MustRegister("FetchAction", handleSemanticRetrieve)
+	registerActions()
 
 	e := echo.New()
+	// Wrong methods on workflow resources get a JSON 405 listing the allowed methods
+	e.HTTPErrorHandler = newHTTPErrorHandler(e)
 
 	// Register EVE corporate identity assets
 	web.RegisterAssets(e)
+	// Echo or generate X-Request-ID before logging so every log line carries it
+	e.Use(middleware.RequestID())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
+	// gzip-encoded request bodies are stored decompressed
+	e.Use(decompressRequest)
+	// WORKFLOW_STORAGE_REQUEST_TIMEOUT and X-Request-Deadline bound storage calls
+	e.Use(applyRequestDeadline)
+	// Workflow resources answer their own preflight requests (see handleWorkflowOptions)
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		Skipper: skipWorkflowPreflight,
+	}))
 
 	// Initialize tracing (gracefully disabled if unavailable)
 	if tracer := tracing.Init(tracing.InitConfig{
@@ -48,8 +55,12 @@ func main() {
 		e.Use(tracer.Middleware())
 	}
 
-	// EVE health check
+	// Kubernetes probes: liveness never depends on S3, readiness does. The
+	// EVE health check stays on /health as a liveness check (it does not
+	// touch storage either) for existing monitors.
 	e.GET("/health", evehttp.HealthCheckHandler("workflowstorageservice", "1.0.0"))
+	e.GET("/health/live", handleLiveness)
+	e.GET("/health/ready", handleReadiness)
 
 	// Documentation endpoint
 	e.GET("/v1/api/docs", evehttp.DocumentationHandler(evehttp.ServiceDocConfig{
@@ -59,18 +70,28 @@ func main() {
 		Version:             "v1",
 		Port:                8094,
 		IncludeDependencies: true, // Show all dependency versions for debugging
-		Capabilities:        []string{"document-storage", "workflow-storage", "data-storage"},
+		Capabilities:        serviceCapabilities,
 		Endpoints: []evehttp.EndpointDoc{
 			{
 				Method:      "POST",
 				Path:        "/v1/api/semantic/action",
 				Description: "Execute storage operations via semantic actions (primary interface)",
 			},
+			{
+				Method:      "POST",
+				Path:        "/v1/api/semantic/batch",
+				Description: "Execute an array of semantic actions in order",
+			},
 			{
 				Method:      "POST",
 				Path:        "/v1/api/workflows",
 				Description: "Store workflow (REST convenience - converts to CreateAction)",
 			},
+			{
+				Method:      "GET",
+				Path:        "/v1/api/workflows",
+				Description: "List workflows (REST convenience - converts to ListAction)",
+			},
 			{
 				Method:      "GET",
 				Path:        "/v1/api/workflows/:id",
@@ -96,10 +117,35 @@ func main() {
 				Path:        "/v1/api/fetch/:key",
 				Description: "Fetch workflow data by key (legacy)",
 			},
+			{
+				Method:      "HEAD",
+				Path:        "/v1/api/fetch/:key",
+				Description: "Object headers without body (legacy)",
+			},
+			{
+				Method:      "GET",
+				Path:        "/v1/api/config",
+				Description: "Effective service configuration with secrets redacted (admin)",
+			},
+			{
+				Method:      "GET",
+				Path:        "/v1/api/metrics",
+				Description: "Deduplication counters and in-flight operations, as JSON or Prometheus text (admin)",
+			},
 			{
 				Method:      "GET",
 				Path:        "/health",
-				Description: "Health check endpoint",
+				Description: "Health check endpoint (liveness, kept for compatibility)",
+			},
+			{
+				Method:      "GET",
+				Path:        "/health/live",
+				Description: "Liveness probe, independent of storage",
+			},
+			{
+				Method:      "GET",
+				Path:        "/health/ready",
+				Description: "Readiness probe, 503 while a configured bucket is unreachable",
 			},
 		},
 	}))
@@ -114,16 +160,45 @@ func main() {
 	apiGroup := e.Group("/v1/api")
 	sm.RegisterRoutes(apiGroup)
 
-	// Legacy API routes
-	e.POST("/v1/api/store", handleStore)
-	e.GET("/v1/api/fetch/:key", handleFetch)
-
 	// EVE API Key middleware
 	apiKey := os.Getenv("WORKFLOW_STORAGE_API_KEY")
-	apiKeyMiddleware := evehttp.APIKeyMiddleware(apiKey)
+	apiKeyMiddleware := apiKeyAuth(apiKey)
+
+	// Validate storage configuration early so misconfiguration shows up in the startup logs
+	if err := validateStorageConfig(context.Background(), defaultStorage); err != nil {
+		logger.WithError(err).Error("Storage configuration check failed")
+	}
+
+	// Per-object access counters are batched in memory and flushed periodically
+	accessCtx, stopAccessLog := context.WithCancel(context.Background())
+	accessDone := make(chan struct{})
+	if accessTrackingEnabled() {
+		go func() {
+			accessLog.run(accessCtx, defaultStorage, accessFlushInterval())
+			close(accessDone)
+		}()
+	} else {
+		close(accessDone)
+	}
+
+	// Effective configuration (secrets redacted) and deduplication counters
+	// with the in-flight gauge, for operators only
+	adminMiddleware := adminAuth(apiKey)
+	apiGroup.GET("/config", handleConfig, adminMiddleware)
+	apiGroup.GET("/metrics", handleMetrics, adminMiddleware)
+
+	// Legacy API routes, only authenticated when tenants must be isolated
+	var legacyMiddleware []echo.MiddlewareFunc
+	if len(tenantKeys()) > 0 {
+		legacyMiddleware = append(legacyMiddleware, apiKeyMiddleware)
+	}
+	e.POST("/v1/api/store", handleStore, legacyMiddleware...)
+	e.GET("/v1/api/fetch/:key", handleFetch, legacyMiddleware...)
+	e.HEAD("/v1/api/fetch/:key", handleFetchHead, legacyMiddleware...)
 
 	// Semantic action endpoint (primary interface)
 	apiGroup.POST("/semantic/action", handleSemanticAction, apiKeyMiddleware)
+	apiGroup.POST("/semantic/batch", handleSemanticBatch, apiKeyMiddleware)
 
 	// REST endpoints (convenience adapters that convert to semantic actions)
 	registerRESTEndpoints(apiGroup, apiKeyMiddleware)
@@ -150,7 +225,7 @@ func main() {
 		Directory:    "/home/opunix/workflowstorageservice",
 		Binary:       "workflowstorageservice",
 		Version:      "v1",
-		Capabilities: []string{"document-storage", "workflow-storage", "data-storage"},
+		Capabilities: serviceCapabilities,
 		APIVersions: []registry.APIVersion{
 			{
 				Version:       "v1",
@@ -159,7 +234,7 @@ func main() {
 				IsDefault:     true,
 				Status:        "stable",
 				ReleaseDate:   "2024-01-01",
-				Capabilities:  []string{"document-storage", "workflow-storage", "data-storage"},
+				Capabilities:  serviceCapabilities,
 			},
 		},
 	})
@@ -192,5 +267,9 @@ func main() {
 		logger.WithError(err).Error("Error during shutdown")
 	}
 
+	// Persist access counters that have not been flushed yet
+	stopAccessLog()
+	<-accessDone
+
 	logger.Info("Server stopped")
 }
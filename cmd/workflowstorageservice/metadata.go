@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// retrieveMetadataOnly answers a retrieve with metadataOnly set: size,
+// format, ETag, modification time and custom metadata of the object, read
+// with HeadObject so the body is never downloaded. Clients use it to decide
+// whether a result is worth fetching without a separate HEAD round trip.
+// contentSize is the stored size, i.e. the ciphertext size for encrypted
+// results.
+func retrieveMetadataOnly(c echo.Context, action *semantic.SemanticAction, bucket, key, contentURL string, fallback bool) error {
+	head, err := storageFor(c).HeadObject(c.Request().Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		logf(c, "Failed to stat %s: %v", key, err)
+		return returnFetchError(c, action, classifyStorageError(bucket, err))
+	}
+
+	format := aws.ToString(head.ContentType)
+	metadata := head.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	value := map[string]interface{}{
+		"contentUrl":     contentURL,
+		"contentSize":    aws.ToInt64(head.ContentLength),
+		"encodingFormat": format,
+		"encrypted":      isEncrypted(head.Metadata),
+		"inProgress":     isInProgress(head.Metadata),
+		"metadata":       metadata,
+	}
+	if head.ETag != nil {
+		value["etag"] = aws.ToString(head.ETag)
+	}
+	if isCompressed(head.Metadata) {
+		value["compression"] = head.Metadata[metadataCompression]
+	}
+	if head.LastModified != nil {
+		value["lastModified"] = head.LastModified.UTC().Format(time.RFC3339)
+	}
+	if filename := filenameFromMetadata(head.Metadata); filename != "" {
+		value["filename"] = filename
+	}
+	if expires := setExpiryHeaders(c, head.Metadata); expires != "" {
+		value["expires"] = expires
+	}
+	reportServingBucket(value, bucket, fallback)
+
+	action.Result = &semantic.SemanticResult{
+		Type:   "DigitalDocument",
+		Format: format,
+		Value:  value,
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSemanticRetrieve_MetadataOnly(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(body string, handler func(echo.Context, *semantic.SemanticAction) error) (*httptest.ResponseRecorder, error) {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		return rec, handler(c, action)
+	}
+
+	if _, err := run(`{"@type": "CreateAction", "identifier": "big",
+		"object": {"@type": "DigitalDocument", "text": "{\"payload\": \"large body\"}"}}`, handleSemanticStoreImpl); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	gets := store.gets
+
+	rec, err := run(`{"@type": "RetrieveAction", "metadataOnly": true,
+		"object": {"@type": "DigitalDocument", "identifier": "big"}}`, handleSemanticRetrieveImpl)
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if store.gets != gets {
+		t.Errorf("metadataOnly downloaded the body (%d GetObject calls)", store.gets-gets)
+	}
+
+	var response struct {
+		Result struct {
+			Output string                 `json:"output"`
+			Value  map[string]interface{} `json:"value"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	value := response.Result.Value
+	if response.Result.Output != "" {
+		t.Errorf("metadataOnly returned a body: %q", response.Result.Output)
+	}
+	if value["contentSize"] != float64(len(`{"payload": "large body"}`)) || value["encodingFormat"] != "application/json" {
+		t.Errorf("metadataOnly value = %v", value)
+	}
+	if value["etag"] == nil || value["lastModified"] == nil {
+		t.Errorf("metadataOnly value lacks etag or lastModified: %v", value)
+	}
+	metadata, _ := value["metadata"].(map[string]interface{})
+	if metadata[metadataChecksumSHA256] == nil {
+		t.Errorf("metadataOnly metadata = %v, want the stored checksum", metadata)
+	}
+
+	rec, err = run(`{"@type": "RetrieveAction", "metadataOnly": true,
+		"object": {"@type": "DigitalDocument", "identifier": "missing"}}`, handleSemanticRetrieveImpl)
+	if err == nil && rec.Code < http.StatusBadRequest {
+		t.Error("metadataOnly for a missing object should fail")
+	}
+}
+
+// failingHeadStorage fails every HeadObject with err
+type failingHeadStorage struct {
+	*fakeStorage
+	err error
+}
+
+func (f failingHeadStorage) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return nil, f.err
+}
+
+func TestHeadPaths_DistinguishMissingKeysFromBackendErrors(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	for name, tt := range map[string]struct {
+		store Storage
+		want  int
+	}{
+		"absent key":     {newFakeStorage(), http.StatusNotFound},
+		"backend down":   {failingHeadStorage{newFakeStorage(), errors.New("dial tcp: connection refused")}, http.StatusInternalServerError},
+		"missing bucket": {failingHeadStorage{newFakeStorage(), &types.NoSuchBucket{}}, http.StatusBadGateway},
+	} {
+		// HEAD /v1/api/fetch/:key answers with the status alone
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodHead, "/v1/api/fetch/workflow-results/wf-1/step-1.json", nil), rec)
+		c.SetParamNames("key")
+		c.SetParamValues("workflow-results/wf-1/step-1.json")
+		c.Set(storageContextKey, tt.store)
+		if err := handleFetchHead(c); err != nil || rec.Code != tt.want {
+			t.Errorf("%s: HEAD = %d (%v), want %d", name, rec.Code, err, tt.want)
+		}
+
+		// metadataOnly retrieves report the distinction with a message
+		action, err := semantic.ParseSemanticAction([]byte(`{"@type": "RetrieveAction", "metadataOnly": true,
+			"object": {"@type": "DigitalDocument", "contentUrl": "s3://px-semantic/workflow-results/wf-1/step-1.json"}}`))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		rec = httptest.NewRecorder()
+		c = e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), rec)
+		c.Set(storageContextKey, tt.store)
+		err = handleSemanticRetrieveImpl(c, action)
+		var httpErr *echo.HTTPError
+		switch {
+		case errors.As(err, &httpErr):
+			if httpErr.Code != tt.want {
+				t.Errorf("%s: metadataOnly status = %d, want %d", name, httpErr.Code, tt.want)
+			}
+		case tt.want != http.StatusInternalServerError || rec.Code == http.StatusOK || rec.Code == http.StatusNotFound:
+			t.Errorf("%s: metadataOnly = %v (status %d), want %d", name, err, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// maxMetadataUpdateKeys caps the contentUrls and identifiers of one
+	// UpdateMetadataAction
+	maxMetadataUpdateKeys = 1000
+
+	// maxObjectTags, maxTagKeyLength and maxTagValueLength are the S3 limits
+	// of an object's tag set
+	maxObjectTags     = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// metadataNamePattern matches the custom metadata names clients may set; S3
+// returns metadata names in lower case
+var metadataNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// reservedMetadataNames are the metadata entries the service itself relies
+// on. UpdateMetadataAction neither sets nor removes them.
+var reservedMetadataNames = map[string]bool{
+	metadataExpiresAt:           true,
+	metadataLockOwner:           true,
+	metadataLockExpiresAt:       true,
+	metadataIdentifier:          true,
+	metadataEncryptionAlgorithm: true,
+	metadataEncryptionNonce:     true,
+	metadataFilename:            true,
+	metadataInProgress:          true,
+	metadataContentRef:          true,
+	metadataContentSize:         true,
+	metadataTarEntries:          true,
+	metadataTarIndex:            true,
+	metadataImmutable:           true,
+	metadataRetainUntil:         true,
+	metadataCompression:         true,
+}
+
+// stringMapProperty returns the string entries of an object property and
+// whether the property is set, or an error naming the first entry that is
+// not a string
+func stringMapProperty(action *semantic.SemanticAction, name string) (map[string]string, bool, error) {
+	if action == nil || action.Properties == nil || action.Properties[name] == nil {
+		return nil, false, nil
+	}
+	raw, ok := action.Properties[name].(map[string]interface{})
+	if !ok {
+		return nil, true, fmt.Errorf("%s must be an object", name)
+	}
+	values := make(map[string]string, len(raw))
+	for k, v := range raw {
+		value, ok := v.(string)
+		if !ok {
+			return nil, true, fmt.Errorf("%s.%s must be a string", name, k)
+		}
+		values[k] = value
+	}
+	return values, true, nil
+}
+
+// metadataChanges reads the metadata, removeMetadata and tags properties of
+// an UpdateMetadataAction. tags is nil when the tag set is left unchanged.
+func metadataChanges(action *semantic.SemanticAction) (map[string]string, []string, map[string]string, error) {
+	set, _, err := stringMapProperty(action, "metadata")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	metadata := make(map[string]string, len(set))
+	for name, value := range set {
+		name = strings.ToLower(name)
+		if !metadataNamePattern.MatchString(name) {
+			return nil, nil, nil, fmt.Errorf("invalid metadata name %q", name)
+		}
+		if reservedMetadataNames[name] {
+			return nil, nil, nil, fmt.Errorf("metadata %q is reserved", name)
+		}
+		metadata[name] = value
+	}
+
+	remove := stringListProperty(action, "removeMetadata")
+	for i, name := range remove {
+		name = strings.ToLower(name)
+		if reservedMetadataNames[name] {
+			return nil, nil, nil, fmt.Errorf("metadata %q is reserved", name)
+		}
+		remove[i] = name
+	}
+
+	tags, ok, err := stringMapProperty(action, "tags")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if ok {
+		if len(tags) > maxObjectTags {
+			return nil, nil, nil, fmt.Errorf("too many tags (max %d)", maxObjectTags)
+		}
+		for k, v := range tags {
+			if k == "" || len(k) > maxTagKeyLength || len(v) > maxTagValueLength {
+				return nil, nil, nil, fmt.Errorf("invalid tag %q", k)
+			}
+		}
+	}
+
+	if len(metadata) == 0 && len(remove) == 0 && !ok {
+		return nil, nil, nil, errors.New("metadata, removeMetadata or tags is required")
+	}
+	return metadata, remove, tags, nil
+}
+
+// updateObjectMetadata rewrites the metadata and, when tags is not nil, the
+// tag set of bucket/key by copying the object onto itself, so the body is
+// never downloaded. Existing metadata is kept unless it is removed or
+// replaced; a nil tags keeps the existing tag set.
+func updateObjectMetadata(ctx context.Context, c echo.Context, action *semantic.SemanticAction, store Storage, bucket, key string, metadata map[string]string, remove []string, tags map[string]string) error {
+	unlock := objectLocks.Lock(bucket, key)
+	defer unlock()
+
+	if err := checkMutable(ctx, c, store, bucket, key); err != nil {
+		return err
+	}
+	if err := checkLock(ctx, c, store, bucket, key, stringProperty(action, "lockOwner")); err != nil {
+		return err
+	}
+
+	head, err := store.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+
+	// REPLACE drops existing metadata unless it is supplied again
+	merged := make(map[string]string, len(head.Metadata)+len(metadata))
+	for k, v := range head.Metadata {
+		merged[k] = v
+	}
+	for _, name := range remove {
+		delete(merged, name)
+	}
+	for k, v := range metadata {
+		merged[k] = v
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(copySource(bucket, key)),
+		ContentType:       head.ContentType,
+		Metadata:          merged,
+		MetadataDirective: types.MetadataDirectiveReplace,
+	}
+	if tags != nil {
+		tagging := url.Values{}
+		for k, v := range tags {
+			tagging.Set(k, v)
+		}
+		input.Tagging = aws.String(tagging.Encode())
+		input.TaggingDirective = types.TaggingDirectiveReplace
+	}
+	if _, err := store.CopyObject(ctx, input); err != nil {
+		return err
+	}
+	resultCache.forget(bucket, key)
+	return nil
+}
+
+// metadataUpdateFailure describes an object UpdateMetadataAction could not
+// update, without exposing backend errors
+func metadataUpdateFailure(bucket, key string, err error) map[string]interface{} {
+	message := "failed to update metadata"
+	switch {
+	case errors.Is(err, errImmutable):
+		message = "object is immutable"
+	case errors.Is(err, errLocked):
+		message = "object is locked"
+	case isNotFoundError(err):
+		message = "data not found"
+	}
+	return map[string]interface{}{
+		"contentUrl": fmt.Sprintf("s3://%s/%s", bucket, key),
+		"error":      message,
+	}
+}
+
+// metadataUpdateObjects resolves the contentUrls and identifiers of an
+// UpdateMetadataAction to object locations
+func metadataUpdateObjects(c echo.Context, action *semantic.SemanticAction) ([]Route, error) {
+	contentURLs := stringListProperty(action, "contentUrls")
+	for _, identifier := range stringListProperty(action, "identifiers") {
+		route, err := routeAction(c, action, identifier, "")
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s: %v", identifier, err))
+		}
+		contentURLs = append(contentURLs, fmt.Sprintf("s3://%s/%s", route.Bucket, route.Key))
+	}
+	if len(contentURLs) > maxMetadataUpdateKeys {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("too many contentUrls (max %d)", maxMetadataUpdateKeys))
+	}
+
+	objects := make([]Route, len(contentURLs))
+	for i, contentURL := range contentURLs {
+		bucket, key, err := parseContentURL(contentURL)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s: %v", contentURL, err))
+		}
+		if err := checkTenantScope(c, key); err != nil {
+			return nil, err
+		}
+		objects[i] = Route{Bucket: bucket, Key: key}
+	}
+	return objects, nil
+}
+
+// handleSemanticUpdateMetadataImpl sets or removes custom metadata
+// (x-amz-meta-*) and replaces the tag set of existing objects without
+// rewriting their bodies, e.g. to mark a batch of results as archived. The
+// objects are either listed in contentUrls and/or identifiers (resolved in
+// workflowId), or, without them, selected by workflowId and an optional
+// prefix below the workflow's results, of which
+// at most maxObjects (default 1000, capped at the list limit) are updated
+// per call. Updated objects stay where they are, so when hasMore is set the
+// caller runs the action again with the returned startAfter key.
+//
+// metadata entries are merged into the existing metadata and removeMetadata
+// names are dropped; tags, when present, replace the whole tag set.
+// Immutable and locked objects are reported in errors, like objects that
+// fail to update, without aborting the others.
+func handleSemanticUpdateMetadataImpl(c echo.Context, action *semantic.SemanticAction) error {
+	metadata, remove, tags, err := metadataChanges(action)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	objects, err := metadataUpdateObjects(c, action)
+	if err != nil {
+		return err
+	}
+	workflowID := stringProperty(action, "workflowId")
+	if len(objects) == 0 && workflowID == "" {
+		return returnActionError(c, action, "contentUrls, identifiers or workflowId is required", nil)
+	}
+	if len(objects) > 0 && stringProperty(action, "prefix") != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "contentUrls and identifiers cannot be combined with prefix")
+	}
+
+	store := storageFor(c)
+	ctx := c.Request().Context()
+
+	var updated int64
+	failures := make([]map[string]interface{}, 0)
+	update := func(bucket, key string) {
+		if err := updateObjectMetadata(ctx, c, action, store, bucket, key, metadata, remove, tags); err != nil {
+			logf(c, "Failed to update metadata of %s: %v", key, err)
+			failures = append(failures, metadataUpdateFailure(bucket, key, err))
+			return
+		}
+		updated++
+	}
+
+	value := map[string]interface{}{}
+	if len(objects) > 0 {
+		for _, object := range objects {
+			update(object.Bucket, object.Key)
+		}
+	} else {
+		prefix := stringProperty(action, "prefix")
+		if strings.HasPrefix(prefix, "/") || hasDotSegment(prefix) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid prefix %q", prefix))
+		}
+		batchSize := int64(defaultArchiveBatchSize)
+		if maxObjects, ok := int64Property(action, "maxObjects"); ok && maxObjects > 0 {
+			batchSize = maxObjects
+		}
+		batchSize = min(batchSize, maxListKeys())
+
+		router, err := routerFor(tenantFor(c))
+		if err != nil {
+			return returnActionError(c, action, "Failed to resolve storage location", err)
+		}
+		listRoute, err := router.ListPrefix(workflowID, stringProperty(action, "type"))
+		if errors.Is(err, errWorkflowsNotListable) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			return returnActionError(c, action, "Failed to resolve storage location", err)
+		}
+		input := &s3.ListObjectsV2Input{
+			Bucket:  aws.String(listRoute.Bucket),
+			Prefix:  aws.String(listRoute.Key + prefix),
+			MaxKeys: aws.Int32(maxListPageSize),
+		}
+		if startAfter := stringProperty(action, "startAfter"); startAfter != "" {
+			input.StartAfter = aws.String(startAfter)
+		}
+		hasMore := false
+		var lastKey string
+		for {
+			page, err := store.ListObjectsV2(ctx, input)
+			if err != nil {
+				logf(c, "Failed to list %s: %v", aws.ToString(input.Prefix), err)
+				return returnActionError(c, action, "Failed to list objects", err)
+			}
+			for _, obj := range page.Contents {
+				key := aws.ToString(obj.Key)
+				if internalKey(key) {
+					continue
+				}
+				if updated+int64(len(failures)) >= batchSize {
+					hasMore = true
+					break
+				}
+				update(listRoute.Bucket, key)
+				lastKey = key
+			}
+			if hasMore || !aws.ToBool(page.IsTruncated) || page.NextContinuationToken == nil {
+				break
+			}
+			input.ContinuationToken = page.NextContinuationToken
+		}
+		value["workflowId"] = workflowID
+		value["hasMore"] = hasMore
+		if hasMore {
+			value["startAfter"] = lastKey
+		}
+	}
+
+	logf(c, "Updated metadata of %d workflow results (%d failed)", updated, len(failures))
+
+	value["updated"] = updated
+	value["failed"] = len(failures)
+	value["errors"] = failures
+	action.Result = &semantic.SemanticResult{
+		Type:  "DigitalDocument",
+		Value: value,
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// handleSemanticUpdateMetadata wraps the implementation to match ActionHandler signature
+func handleSemanticUpdateMetadata(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticUpdateMetadataImpl(c, action)
+}
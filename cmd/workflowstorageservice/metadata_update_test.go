@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/labstack/echo/v4"
+	"workflowstorageservice.evalgo.org/actions"
+)
+
+// taggingStorage records the tag sets written by CopyObject
+type taggingStorage struct {
+	*fakeStorage
+	tagging map[string]string
+}
+
+func (s *taggingStorage) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	if params.TaggingDirective == types.TaggingDirectiveReplace {
+		s.tagging[aws.ToString(params.Key)] = aws.ToString(params.Tagging)
+	}
+	return s.fakeStorage.CopyObject(ctx, params, optFns...)
+}
+
+func TestSemanticUpdateMetadata(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := &taggingStorage{fakeStorage: newFakeStorage(), tagging: map[string]string{}}
+	for _, name := range []string{"a", "b", "c"} {
+		store.objects["px-semantic/workflow-results/wf-1/batch/"+name+".json"] = fakeObject{
+			data:        []byte(`{"name": "` + name + `"}`),
+			contentType: "application/json",
+			metadata:    map[string]string{"reviewer": "alice", metadataIdentifier: name},
+		}
+	}
+	store.objects["px-semantic/workflow-results/wf-1/batch/c.json"] = fakeObject{
+		data:        []byte(`{"name": "c"}`),
+		contentType: "application/json",
+		metadata:    map[string]string{metadataImmutable: "true"},
+	}
+	run := func(b *actions.Builder) (map[string]interface{}, error) {
+		t.Helper()
+		action, err := b.Action()
+		if err != nil {
+			t.Fatalf("Action() error = %v", err)
+		}
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		if err := handleSemanticUpdateMetadataImpl(c, action); err != nil {
+			return nil, err
+		}
+		return action.Result.Value.(map[string]interface{}), nil
+	}
+	update := func() *actions.Builder {
+		return actions.New("UpdateMetadataAction").
+			WithProperty("metadata", map[string]interface{}{"Status": "archived"}).
+			WithProperty("removeMetadata", []interface{}{"reviewer"})
+	}
+
+	value, err := run(update().
+		WithProperty("contentUrls", []interface{}{"s3://px-semantic/workflow-results/wf-1/batch/a.json"}).
+		WithProperty("tags", map[string]interface{}{"retention": "long term"}))
+	if err != nil || value["updated"] != int64(1) || value["failed"] != 0 {
+		t.Fatalf("Update by contentUrl = %v, %v", value, err)
+	}
+	obj := store.objects["px-semantic/workflow-results/wf-1/batch/a.json"]
+	if obj.metadata["status"] != "archived" || obj.metadata["reviewer"] != "" || obj.metadata[metadataIdentifier] != "a" {
+		t.Errorf("Metadata after update = %v", obj.metadata)
+	}
+	if string(obj.data) != `{"name": "a"}` || obj.contentType != "application/json" {
+		t.Errorf("Object after update = %q (%s)", obj.data, obj.contentType)
+	}
+	if got := store.tagging["workflow-results/wf-1/batch/a.json"]; got != "retention=long+term" {
+		t.Errorf("Tagging = %q", got)
+	}
+
+	// A prefix selection is processed in batches; immutable objects are reported
+	value, err = run(update().WithWorkflowID("wf-1").WithProperty("prefix", "batch/").WithProperty("maxObjects", 2))
+	if err != nil || value["updated"] != int64(2) || value["hasMore"] != true || value["startAfter"] != "workflow-results/wf-1/batch/b.json" {
+		t.Fatalf("First prefix batch = %v, %v", value, err)
+	}
+	if store.objects["px-semantic/workflow-results/wf-1/batch/b.json"].metadata["status"] != "archived" {
+		t.Errorf("b.json was not updated")
+	}
+	value, err = run(update().WithWorkflowID("wf-1").WithProperty("prefix", "batch/").WithProperty("maxObjects", 2).WithProperty("startAfter", value["startAfter"]))
+	if err != nil || value["updated"] != int64(0) || value["failed"] != 1 || value["hasMore"] != false {
+		t.Fatalf("Second prefix batch = %v, %v", value, err)
+	}
+	if failure := value["errors"].([]map[string]interface{})[0]; failure["error"] != "object is immutable" {
+		t.Errorf("Immutable failure = %v", failure)
+	}
+
+	var httpErr *echo.HTTPError
+	for name, b := range map[string]*actions.Builder{
+		"no changes":     actions.New("UpdateMetadataAction").WithWorkflowID("wf-1"),
+		"reserved name":  actions.New("UpdateMetadataAction").WithWorkflowID("wf-1").WithProperty("metadata", map[string]interface{}{"immutable": "false"}),
+		"reserved drop":  update().WithWorkflowID("wf-1").WithProperty("removeMetadata", []interface{}{"content-ref"}),
+		"invalid name":   actions.New("UpdateMetadataAction").WithWorkflowID("wf-1").WithProperty("metadata", map[string]interface{}{"a b": "c"}),
+		"non-string":     actions.New("UpdateMetadataAction").WithWorkflowID("wf-1").WithProperty("tags", map[string]interface{}{"n": 1}),
+		"escaping":       update().WithWorkflowID("wf-1").WithProperty("prefix", "../wf-2/"),
+		"mixed selector": update().WithProperty("contentUrls", []interface{}{"s3://px-semantic/workflow-results/wf-1/batch/a.json"}).WithProperty("prefix", "batch/"),
+	} {
+		if _, err := run(b); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+			t.Errorf("%s: error = %v, want 400", name, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// workflowRoutePrefix is the path prefix of the REST workflow resources
+const workflowRoutePrefix = "/v1/api/workflows"
+
+// preflightMaxAge is how long browsers may cache a workflow preflight response
+const preflightMaxAge = 10 * time.Minute
+
+// workflowRequestHeaders are the request headers the workflow resources
+// accept, advertised in preflight responses. Add a header here when a handler
+// starts reading it, or browsers will refuse to send it cross-origin.
+var workflowRequestHeaders = []string{
+	echo.HeaderAccept,
+	echo.HeaderContentType,
+	echo.HeaderXRequestID,
+	"X-API-Key",
+	"X-Workflow-ID",
+	adminOverrideHeader,
+	requestDeadlineHeader,
+	"Idempotency-Key",
+	"If-Match",
+	"If-None-Match",
+	"If-Modified-Since",
+	"If-Unmodified-Since",
+}
+
+// workflowResponseHeaders are the response headers browser clients may read
+var workflowResponseHeaders = []string{
+	echo.HeaderXRequestID,
+	"ETag",
+	echo.HeaderLastModified,
+	echo.HeaderAllow,
+	requestDeadlineHeader,
+}
+
+// allowedMethods returns the methods registered for a route path, sorted.
+// OPTIONS is always allowed: the workflow resources answer it with
+// handleWorkflowOptions and everything else through the CORS middleware.
+func allowedMethods(e *echo.Echo, path string) []string {
+	seen := map[string]bool{http.MethodOptions: true}
+	methods := []string{http.MethodOptions}
+	for _, route := range e.Routes() {
+		if route.Path == path && !seen[route.Method] {
+			seen[route.Method] = true
+			methods = append(methods, route.Method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// newHTTPErrorHandler answers 405 Method Not Allowed on the workflow
+// resources with a JSON error that lists the allowed methods, derived from
+// the registered routes, and sets the Allow header to match. Everything else
+// goes to echo's default handler.
+func newHTTPErrorHandler(e *echo.Echo) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		var httpErr *echo.HTTPError
+		if c.Response().Committed || !errors.As(err, &httpErr) || httpErr.Code != http.StatusMethodNotAllowed ||
+			!strings.HasPrefix(c.Path(), workflowRoutePrefix) {
+			e.DefaultHTTPErrorHandler(err, c)
+			return
+		}
+
+		methods := allowedMethods(e, c.Path())
+		c.Response().Header().Set(echo.HeaderAllow, strings.Join(methods, ", "))
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(http.StatusMethodNotAllowed)
+		} else {
+			err = c.JSON(http.StatusMethodNotAllowed, map[string]interface{}{
+				"error":          fmt.Sprintf("method %s is not allowed on %s", c.Request().Method, c.Path()),
+				"allowedMethods": methods,
+			})
+		}
+		if err != nil {
+			logf(c, "Failed to send 405 response: %v", err)
+		}
+	}
+}
+
+// handleWorkflowOptions answers OPTIONS on the workflow resources with the
+// methods registered for the path and, for CORS preflight requests, the
+// accepted request headers (workflowRequestHeaders). The CORS middleware
+// skips these requests (see skipWorkflowPreflight) so the answer always
+// reflects the routes and headers the service actually supports.
+func handleWorkflowOptions(c echo.Context) error {
+	methods := strings.Join(allowedMethods(c.Echo(), c.Path()), ", ")
+	header := c.Response().Header()
+	header.Set(echo.HeaderAllow, methods)
+
+	if c.Request().Header.Get(echo.HeaderOrigin) != "" {
+		header.Add(echo.HeaderVary, echo.HeaderOrigin)
+		header.Set(echo.HeaderAccessControlAllowOrigin, "*")
+		header.Set(echo.HeaderAccessControlAllowMethods, methods)
+		header.Set(echo.HeaderAccessControlAllowHeaders, strings.Join(workflowRequestHeaders, ", "))
+		header.Set(echo.HeaderAccessControlExposeHeaders, strings.Join(workflowResponseHeaders, ", "))
+		header.Set(echo.HeaderAccessControlMaxAge, strconv.Itoa(int(preflightMaxAge.Seconds())))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// skipWorkflowPreflight is the CORS middleware skipper that leaves OPTIONS on
+// the workflow resources to handleWorkflowOptions
+func skipWorkflowPreflight(c echo.Context) bool {
+	return c.Request().Method == http.MethodOptions && strings.HasPrefix(c.Path(), workflowRoutePrefix)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestHTTPErrorHandler_MethodNotAllowed(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = newHTTPErrorHandler(e)
+	noAuth := func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	registerRESTEndpoints(e.Group("/v1/api"), noAuth)
+	e.GET("/v1/api/config", handleConfig)
+
+	tests := []struct {
+		method string
+		path   string
+		want   []string
+	}{
+		{http.MethodPatch, "/v1/api/workflows/my-workflow", []string{"DELETE", "GET", "OPTIONS", "PUT"}},
+		{http.MethodDelete, "/v1/api/workflows", []string{"GET", "OPTIONS", "POST"}},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("%s %s: status = %d, want 405", tt.method, tt.path, rec.Code)
+		}
+		var body struct {
+			Error          string   `json:"error"`
+			AllowedMethods []string `json:"allowedMethods"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if !reflect.DeepEqual(body.AllowedMethods, tt.want) || body.Error == "" {
+			t.Errorf("%s %s: body = %+v, want allowedMethods %v", tt.method, tt.path, body, tt.want)
+		}
+		if got := rec.Header().Get(echo.HeaderAllow); got == "" {
+			t.Errorf("%s %s: missing Allow header", tt.method, tt.path)
+		}
+	}
+
+	// Other paths keep echo's default error format
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/api/config", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST /v1/api/config: status = %d, want 405", rec.Code)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if _, ok := body["allowedMethods"]; ok {
+		t.Errorf("Non-workflow path got the workflow 405 body: %v", body)
+	}
+}
+
+func TestHandleWorkflowOptions_Preflight(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{Skipper: skipWorkflowPreflight}))
+	noAuth := func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	registerRESTEndpoints(e.Group("/v1/api"), noAuth)
+
+	req := httptest.NewRequest(http.MethodOptions, "/v1/api/workflows/my-workflow", nil)
+	req.Header.Set(echo.HeaderOrigin, "https://app.example.com")
+	req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPut)
+	req.Header.Set(echo.HeaderAccessControlRequestHeaders, "if-match, x-api-key")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", rec.Code)
+	}
+	if got := rec.Header().Get(echo.HeaderAccessControlAllowMethods); got != "DELETE, GET, OPTIONS, PUT" {
+		t.Errorf("Access-Control-Allow-Methods = %q", got)
+	}
+	allowHeaders := rec.Header().Get(echo.HeaderAccessControlAllowHeaders)
+	for _, header := range []string{"X-Workflow-ID", "X-API-Key", "Idempotency-Key", "If-Match"} {
+		if !strings.Contains(allowHeaders, header) {
+			t.Errorf("Access-Control-Allow-Headers = %q, missing %s", allowHeaders, header)
+		}
+	}
+	if got := rec.Header().Get(echo.HeaderAccessControlAllowOrigin); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+
+	// Plain OPTIONS without Origin only reports the allowed methods
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/v1/api/workflows", nil))
+	if got := rec.Header().Get(echo.HeaderAllow); got != "GET, OPTIONS, POST" {
+		t.Errorf("Allow = %q", got)
+	}
+	if got := rec.Header().Get(echo.HeaderAccessControlAllowHeaders); got != "" {
+		t.Errorf("Non-CORS OPTIONS got Access-Control-Allow-Headers %q", got)
+	}
+}
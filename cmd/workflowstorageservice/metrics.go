@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+)
+
+// dedupCounters counts how often deduplication spared a write. A hit is a
+// skipIfUnchanged store whose content matched the existing object, or a
+// content store write whose content was already stored; a miss is one that
+// had to be written. bytesSaved sums the payload sizes of the spared writes.
+type dedupCounters struct {
+	hits       atomic.Int64
+	misses     atomic.Int64
+	bytesSaved atomic.Int64
+}
+
+// dedupMetrics is the service-wide deduplication counter set
+var dedupMetrics = &dedupCounters{}
+
+// recordHit counts a skipped write of size bytes
+func (d *dedupCounters) recordHit(size int64) {
+	d.hits.Add(1)
+	d.bytesSaved.Add(size)
+}
+
+// recordMiss counts a write that deduplication could not avoid
+func (d *dedupCounters) recordMiss() {
+	d.misses.Add(1)
+}
+
+// inflightOperations counts the storage operations (semantic actions and
+// legacy store and fetch requests) currently being handled
+var inflightOperations atomic.Int64
+
+// trackInflight counts an operation as in flight until the returned function
+// is called; handlers call it on entry and defer the result
+func trackInflight() func() {
+	inflightOperations.Add(1)
+	return func() {
+		inflightOperations.Add(-1)
+	}
+}
+
+// DedupMetrics is the deduplication section of the metrics response
+type DedupMetrics struct {
+	Hits       int64 `json:"hits"`
+	Misses     int64 `json:"misses"`
+	BytesSaved int64 `json:"bytesSaved"`
+}
+
+// MetricsResponse describes the service counters exposed to operators
+type MetricsResponse struct {
+	Dedup    DedupMetrics `json:"dedup"`
+	Inflight int64        `json:"inflight"`
+}
+
+// snapshot returns the current counter values
+func (d *dedupCounters) snapshot() DedupMetrics {
+	return DedupMetrics{
+		Hits:       d.hits.Load(),
+		Misses:     d.misses.Load(),
+		BytesSaved: d.bytesSaved.Load(),
+	}
+}
+
+// prometheusContentType is the Prometheus text exposition format
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// acceptsPrometheus reports whether the client asked for the text exposition
+// format, as Prometheus scrapers do
+func acceptsPrometheus(r *http.Request) bool {
+	accept := r.Header.Get(echo.HeaderAccept)
+	return strings.Contains(accept, "text/plain") || strings.Contains(accept, "application/openmetrics-text")
+}
+
+// renderPrometheusMetrics renders metrics in the Prometheus text format
+func renderPrometheusMetrics(metrics MetricsResponse) string {
+	var b strings.Builder
+	for _, m := range []struct {
+		name, typ, help string
+		value           int64
+	}{
+		{"workflowstorage_inflight_operations", "gauge", "Storage operations currently being handled.", metrics.Inflight},
+		{"workflowstorage_dedup_hits_total", "counter", "Stores whose content was not written again.", metrics.Dedup.Hits},
+		{"workflowstorage_dedup_misses_total", "counter", "Deduplicated stores whose content had to be written.", metrics.Dedup.Misses},
+		{"workflowstorage_dedup_saved_bytes_total", "counter", "Payload bytes of stores whose content was not written again.", metrics.Dedup.BytesSaved},
+	} {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.typ, m.name, m.value)
+	}
+	return b.String()
+}
+
+// handleMetrics handles GET /v1/api/metrics. Clients accepting text/plain
+// (e.g. Prometheus) get the text exposition format, others JSON.
+func handleMetrics(c echo.Context) error {
+	metrics := MetricsResponse{
+		Dedup:    dedupMetrics.snapshot(),
+		Inflight: inflightOperations.Load(),
+	}
+	if acceptsPrometheus(c.Request()) {
+		return c.Blob(http.StatusOK, prometheusContentType, []byte(renderPrometheusMetrics(metrics)))
+	}
+	return respondJSON(c, http.StatusOK, metrics)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestTrackInflight(t *testing.T) {
+	before := inflightOperations.Load()
+	done := trackInflight()
+	other := trackInflight()
+	if got := inflightOperations.Load() - before; got != 2 {
+		t.Errorf("In flight = %d, want 2", got)
+	}
+	done()
+	other()
+	if got := inflightOperations.Load() - before; got != 0 {
+		t.Errorf("In flight after completion = %d, want 0", got)
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	e := echo.New()
+	scrape := func(accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/v1/api/metrics", nil)
+		if accept != "" {
+			req.Header.Set(echo.HeaderAccept, accept)
+		}
+		rec := httptest.NewRecorder()
+		if err := handleMetrics(e.NewContext(req, rec)); err != nil {
+			t.Fatalf("handleMetrics() error = %v", err)
+		}
+		return rec
+	}
+
+	// A handler still running counts as in flight while the metrics are read
+	done := trackInflight()
+	defer done()
+
+	rec := scrape("")
+	var metrics MetricsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &metrics); err != nil {
+		t.Fatalf("JSON metrics: %v (%s)", err, rec.Body.String())
+	}
+	if metrics.Inflight < 1 {
+		t.Errorf("JSON inflight = %d, want at least 1", metrics.Inflight)
+	}
+
+	rec = scrape("application/openmetrics-text;version=1.0.0;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1")
+	if got := rec.Header().Get(echo.HeaderContentType); got != prometheusContentType {
+		t.Errorf("Content-Type = %q", got)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE workflowstorage_inflight_operations gauge\n",
+		"# TYPE workflowstorage_dedup_hits_total counter\n",
+		"\nworkflowstorage_dedup_saved_bytes_total ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Prometheus metrics miss %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "\nworkflowstorage_inflight_operations 0\n") {
+		t.Errorf("In-flight gauge is 0, want at least 1:\n%s", body)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// ndjsonContentType is the media type of newline-delimited JSON
+const ndjsonContentType = "application/x-ndjson"
+
+// isNDJSON reports whether a content type is newline-delimited JSON
+func isNDJSON(contentType string) bool {
+	return strings.EqualFold(strings.TrimSpace(strings.Split(contentType, ";")[0]), ndjsonContentType)
+}
+
+// acceptsNDJSON reports whether the client asked for an NDJSON stream
+func acceptsNDJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get(echo.HeaderAccept), ndjsonContentType)
+}
+
+// normalizeNDJSON converts stored data to NDJSON. A JSON array is split into
+// one compact record per line; anything else is treated as NDJSON already.
+// Every record must be a JSON object.
+func normalizeNDJSON(data string) (string, error) {
+	trimmed := strings.TrimSpace(data)
+
+	var records []json.RawMessage
+	if strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal([]byte(trimmed), &records); err != nil {
+			return "", fmt.Errorf("invalid JSON array: %w", err)
+		}
+	} else {
+		for _, line := range strings.Split(trimmed, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				records = append(records, json.RawMessage(line))
+			}
+		}
+	}
+
+	var b strings.Builder
+	for i, record := range records {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, record); err != nil {
+			return "", fmt.Errorf("record %d: %w", i+1, err)
+		}
+		if compact.Len() == 0 || compact.Bytes()[0] != '{' {
+			return "", fmt.Errorf("record %d is not a JSON object", i+1)
+		}
+		b.Write(compact.Bytes())
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// openStream opens a stored object for streaming. The body is read as it
+// arrives unless the object is encrypted or compressed, in which case it is
+// decoded in full first. Results still being written are rejected unless the
+// action sets allowPartial. The caller closes the returned output's Body.
+func openStream(c echo.Context, action *semantic.SemanticAction, bucket, key string) (*s3.GetObjectOutput, io.Reader, error) {
+	result, err := storageFor(c).GetObject(c.Request().Context(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		logf(c, "Failed to fetch %s: %v", key, err)
+		if isNotFoundError(err) {
+			return nil, nil, returnActionError(c, action, "data not found", err)
+		}
+		return nil, nil, returnActionError(c, action, "failed to read data", err)
+	}
+	fail := func(err error) (*s3.GetObjectOutput, io.Reader, error) {
+		if cerr := result.Body.Close(); cerr != nil {
+			logf(c, "Failed to close S3 response body: %v", cerr)
+		}
+		return nil, nil, err
+	}
+
+	if isInProgress(result.Metadata) && !boolProperty(action, "allowPartial") {
+		return fail(stillWritingConflict(key))
+	}
+
+	var body io.Reader = result.Body
+	if isEncoded(result.Metadata) {
+		data, err := io.ReadAll(result.Body)
+		if err != nil {
+			return fail(returnActionError(c, action, "failed to read data", err))
+		}
+		plaintext, err := decodePayload(data, result.Metadata)
+		if err != nil {
+			return fail(returnActionError(c, action, "failed to decrypt data", err))
+		}
+		body = bytes.NewReader(plaintext)
+	}
+	return result, body, nil
+}
+
+// streamNDJSON writes a stored NDJSON object to the client record by record,
+// flushing after each line so consumers can process records as they arrive.
+// Encrypted objects are decrypted in full first.
+func streamNDJSON(c echo.Context, action *semantic.SemanticAction, bucket, key string) error {
+	result, body, err := openStream(c, action, bucket, key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := result.Body.Close(); err != nil {
+			logf(c, "Failed to close S3 response body: %v", err)
+		}
+	}()
+
+	if !isNDJSON(aws.ToString(result.ContentType)) {
+		return returnActionError(c, action, fmt.Sprintf("object is %s, not %s", aws.ToString(result.ContentType), ndjsonContentType), nil)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, ndjsonContentType)
+	c.Response().WriteHeader(http.StatusOK)
+
+	reader := bufio.NewReader(body)
+	records := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if line[len(line)-1] != '\n' {
+				line = append(line, '\n')
+			}
+			if _, werr := c.Response().Write(line); werr != nil {
+				logf(c, "Failed to stream %s: %v", key, werr)
+				return nil
+			}
+			c.Response().Flush()
+			records++
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Headers are already sent; the truncated body signals the failure
+			logf(c, "Failed to read %s: %v", key, err)
+			return nil
+		}
+	}
+
+	accessLog.record(c, bucket, key)
+	logf(c, "Streamed %d NDJSON records from %s", records, key)
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestNormalizeNDJSON(t *testing.T) {
+	got, err := normalizeNDJSON(`[{"a": 1}, {"b": [2, 3]}]`)
+	if err != nil {
+		t.Fatalf("normalizeNDJSON() error = %v", err)
+	}
+	if want := "{\"a\":1}\n{\"b\":[2,3]}\n"; got != want {
+		t.Errorf("normalizeNDJSON(array) = %q, want %q", got, want)
+	}
+
+	got, err = normalizeNDJSON("{\"a\": 1}\n\n{\"b\": 2}")
+	if err != nil {
+		t.Fatalf("normalizeNDJSON() error = %v", err)
+	}
+	if want := "{\"a\":1}\n{\"b\":2}\n"; got != want {
+		t.Errorf("normalizeNDJSON(lines) = %q, want %q", got, want)
+	}
+
+	for _, invalid := range []string{`[{"a": 1}, 2]`, `[{"a": 1}`, "{\"a\": 1}\nnot json", `"text"`} {
+		if _, err := normalizeNDJSON(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestSemanticRetrieve_StreamsNDJSON(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(body, accept string, handler func(echo.Context, *semantic.SemanticAction) error) *httptest.ResponseRecorder {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		if accept != "" {
+			req.Header.Set(echo.HeaderAccept, accept)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		if err := handler(c, action); err != nil {
+			t.Fatalf("handler error = %v", err)
+		}
+		return rec
+	}
+
+	run(`{"@type": "CreateAction", "identifier": "events",
+		"object": {"@type": "DigitalDocument", "encodingFormat": "application/x-ndjson",
+			"text": "[{\"event\": \"start\"}, {\"event\": \"stop\"}]"}}`, "", handleSemanticStoreImpl)
+
+	rec := run(`{"@type": "RetrieveAction",
+		"object": {"@type": "DigitalDocument", "identifier": "events", "encodingFormat": "application/x-ndjson"}}`,
+		ndjsonContentType, handleSemanticRetrieveImpl)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if got := rec.Header().Get(echo.HeaderContentType); got != ndjsonContentType {
+		t.Errorf("Expected Content-Type %s, got %q", ndjsonContentType, got)
+	}
+	if want := "{\"event\":\"start\"}\n{\"event\":\"stop\"}\n"; rec.Body.String() != want {
+		t.Errorf("Expected body %q, got %q", want, rec.Body.String())
+	}
+}
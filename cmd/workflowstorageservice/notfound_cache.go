@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// maxNotFoundEntries bounds the negative cache so polling for many distinct
+// keys cannot grow it without limit
+const maxNotFoundEntries = 10000
+
+// notFoundCache remembers keys that recently returned 404 so orchestrators
+// polling for results that do not exist yet are answered without hitting S3.
+// The window is configured by WORKFLOW_STORAGE_NOT_FOUND_TTL (e.g. "5s");
+// caching is disabled when it is unset or zero. A store to the same key
+// removes its entry immediately.
+type notFoundCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+// missingObjects is the service-wide negative cache
+var missingObjects = &notFoundCache{entries: make(map[string]time.Time)}
+
+// notFoundTTL returns the configured negative cache window
+func notFoundTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("WORKFLOW_STORAGE_NOT_FOUND_TTL"))
+	if err != nil || ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+// isMissing reports whether bucket/key is known to be missing
+func (n *notFoundCache) isMissing(bucket, key string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	id := bucket + "/" + key
+	expires, ok := n.entries[id]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expires) {
+		delete(n.entries, id)
+		return false
+	}
+	return true
+}
+
+// markMissing records a 404 for bucket/key for the configured TTL
+func (n *notFoundCache) markMissing(bucket, key string) {
+	ttl := notFoundTTL()
+	if ttl == 0 {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	if len(n.entries) >= maxNotFoundEntries {
+		for id, expires := range n.entries {
+			if now.After(expires) {
+				delete(n.entries, id)
+			}
+		}
+		if len(n.entries) >= maxNotFoundEntries {
+			return
+		}
+	}
+	n.entries[bucket+"/"+key] = now.Add(ttl)
+}
+
+// forget drops the entry for bucket/key after it has been written
+func (n *notFoundCache) forget(bucket, key string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.entries, bucket+"/"+key)
+}
+
+// isNotFoundError reports whether an S3 error means the object does not exist
+func isNotFoundError(err error) bool {
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return true
+	}
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return true
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound":
+			return true
+		}
+	}
+	return false
+}
+
+// isNoSuchBucketError reports whether an S3 error means the bucket itself
+// does not exist, a configuration problem rather than a missing result
+func isNoSuchBucketError(err error) bool {
+	var noSuchBucket *types.NoSuchBucket
+	if errors.As(err, &noSuchBucket) {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchBucket"
+}
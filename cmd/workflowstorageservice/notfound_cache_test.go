@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/labstack/echo/v4"
+)
+
+func TestNotFoundCache(t *testing.T) {
+	cache := &notFoundCache{entries: make(map[string]time.Time)}
+
+	t.Setenv("WORKFLOW_STORAGE_NOT_FOUND_TTL", "")
+	cache.markMissing("bucket", "a")
+	if cache.isMissing("bucket", "a") {
+		t.Error("Negative caching must be disabled without a TTL")
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_NOT_FOUND_TTL", "1m")
+	cache.markMissing("bucket", "a")
+	if !cache.isMissing("bucket", "a") {
+		t.Error("Expected key to be cached as missing")
+	}
+
+	cache.forget("bucket", "a")
+	if cache.isMissing("bucket", "a") {
+		t.Error("Expected store to invalidate the negative cache entry")
+	}
+
+	cache.entries["bucket/b"] = time.Now().Add(-time.Second)
+	if cache.isMissing("bucket", "b") {
+		t.Error("Expired entries must not be reported as missing")
+	}
+}
+
+func TestIsNotFoundError(t *testing.T) {
+	if !isNotFoundError(&types.NoSuchKey{}) {
+		t.Error("NoSuchKey should be a not-found error")
+	}
+	if isNotFoundError(&types.NoSuchBucket{}) {
+		t.Error("NoSuchBucket should not be treated as a missing key")
+	}
+	if !isNoSuchBucketError(&types.NoSuchBucket{}) || isNoSuchBucketError(&types.NoSuchKey{}) {
+		t.Error("Only NoSuchBucket should be a missing-bucket error")
+	}
+}
+
+func TestFetchObject_MissingBucket(t *testing.T) {
+	store, err := newFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("newFileStorage() error = %v", err)
+	}
+	if _, err := store.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("results"),
+		Key:    aws.String("workflow-results/wf-1/other.json"),
+		Body:   strings.NewReader("{}"),
+	}); err != nil {
+		t.Fatalf("PutObject() error = %v", err)
+	}
+
+	_, err = fetchObject(context.Background(), store, "results", "workflow-results/wf-1/missing.json")
+	if got := fetchErrorStatus(err); got != http.StatusNotFound {
+		t.Errorf("Missing key: status = %d, want 404", got)
+	}
+
+	_, err = fetchObject(context.Background(), store, "typo-bucket", "workflow-results/wf-1/missing.json")
+	if got := fetchErrorStatus(err); got != http.StatusBadGateway {
+		t.Errorf("Missing bucket: status = %d, want 502", got)
+	}
+	if msg := fetchErrorMessage(err); !strings.Contains(msg, "storage misconfigured") || !strings.Contains(msg, "typo-bucket") {
+		t.Errorf("Missing bucket: message = %q, want the bucket name", msg)
+	}
+	if missingObjects.isMissing("typo-bucket", "workflow-results/wf-1/missing.json") {
+		t.Error("A missing bucket must not be cached as a missing object")
+	}
+}
+
+func TestSemanticRetrieve_MissingBucket(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("HETZNER_S3_BUCKET", "typo-bucket")
+
+	store, err := newFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("newFileStorage() error = %v", err)
+	}
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "RetrieveAction", "workflowId": "wf-1",
+		"object": {"@type": "DigitalDocument", "identifier": "step-1"}}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+	c.Set(storageContextKey, store)
+
+	var httpErr *echo.HTTPError
+	if err := handleSemanticRetrieveImpl(c, action); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadGateway {
+		t.Errorf("Retrieve from a missing bucket: error = %v, want 502", err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// storedObject is a fully read and decrypted object
+type storedObject struct {
+	data        []byte
+	contentType string
+	etag        string
+	metadata    map[string]string
+}
+
+// fetchError describes why an object could not be fetched. message is the
+// client-facing text; notFound distinguishes 404s from read failures and
+// bucketMissing a misconfigured bucket (502).
+type fetchError struct {
+	message       string
+	notFound      bool
+	bucketMissing bool
+	err           error
+}
+
+func (e *fetchError) Error() string {
+	if e.err == nil {
+		return e.message
+	}
+	return e.message + ": " + e.err.Error()
+}
+
+func (e *fetchError) Unwrap() error {
+	return e.err
+}
+
+// fetchErrorMessage returns the client-facing message for a fetchObject error
+func fetchErrorMessage(err error) string {
+	var fe *fetchError
+	if errors.As(err, &fe) {
+		return fe.message
+	}
+	return err.Error()
+}
+
+// fetchErrorStatus maps a fetchObject error to an HTTP status
+func fetchErrorStatus(err error) int {
+	var fe *fetchError
+	if errors.As(err, &fe) && fe.notFound {
+		return http.StatusNotFound
+	}
+	if errors.As(err, &fe) && fe.bucketMissing {
+		return http.StatusBadGateway
+	}
+	return storageErrorStatus(err)
+}
+
+// returnFetchError reports a failed fetchObject for a semantic action: a
+// missing object as 404 and a missing bucket as 502, other failures through
+// returnActionError
+func returnFetchError(c echo.Context, action *semantic.SemanticAction, err error) error {
+	switch status := fetchErrorStatus(err); status {
+	case http.StatusNotFound, http.StatusBadGateway:
+		return echo.NewHTTPError(status, fetchErrorMessage(err))
+	}
+	return returnActionError(c, action, fetchErrorMessage(err), err)
+}
+
+// classifyStorageError turns an error from GetObject or HeadObject into a
+// fetchError, so clients can tell an absent key (404, give up) from a
+// missing bucket (502) and backend failures (5xx, retry)
+func classifyStorageError(bucket string, err error) *fetchError {
+	switch {
+	case isCredentialError(err):
+		return &fetchError{message: credentialErrorMessage, err: err}
+	case isNoSuchBucketError(err):
+		return &fetchError{message: fmt.Sprintf("storage misconfigured: bucket %q does not exist", bucket), bucketMissing: true, err: err}
+	case isNotFoundError(err):
+		return &fetchError{message: "data not found", notFound: true, err: err}
+	}
+	return &fetchError{message: "failed to fetch data", err: err}
+}
+
+// fetchObject downloads and decrypts an object. Recent 404s are answered from
+// the negative cache, small objects are served from the result cache when
+// their ETag is unchanged, and concurrent fetches of the same object share
+// one download (see coalescedGet).
+func fetchObject(ctx context.Context, store Storage, bucket, key string) (*storedObject, error) {
+	// Answer polling for results that recently 404'd without hitting S3
+	if missingObjects.isMissing(bucket, key) {
+		return nil, &fetchError{message: "data not found", notFound: true}
+	}
+
+	cached, fresh := resultCache.get(bucket, key)
+	if fresh {
+		return cached, nil
+	}
+
+	return coalescedGet(ctx, bucket, key, cached, func(ctx context.Context, limit int64) (*storedObject, error) {
+		return getObject(ctx, store, bucket, key, cached, limit)
+	})
+}
+
+// getObject performs the GetObject behind fetchObject, revalidating cached
+// by ETag. With limit > 0, objects larger than limit are returned together
+// with errNotCoalesced.
+func getObject(ctx context.Context, store Storage, bucket, key string, cached *storedObject, limit int64) (*storedObject, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if cached != nil {
+		input.IfNoneMatch = aws.String(cached.etag)
+	}
+
+	result, err := store.GetObject(ctx, input)
+	if err != nil {
+		if cached != nil && isNotModifiedError(err) {
+			resultCache.touch(bucket, key)
+			return cached, nil
+		}
+		fe := classifyStorageError(bucket, err)
+		if fe.notFound {
+			missingObjects.markMissing(bucket, key)
+		}
+		return nil, fe
+	}
+	defer func() {
+		if err := result.Body.Close(); err != nil {
+			log.Printf("Failed to close S3 response body: %v", err)
+		}
+	}()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, &fetchError{message: "failed to read data", err: err}
+	}
+
+	// Transparently decrypt objects stored with application-layer encryption
+	data, err = decodePayload(data, result.Metadata)
+	if err != nil {
+		return nil, &fetchError{message: "failed to decrypt data", err: err}
+	}
+
+	obj := &storedObject{
+		data:        data,
+		contentType: "application/json",
+		etag:        aws.ToString(result.ETag),
+		metadata:    result.Metadata,
+	}
+	if result.ContentType != nil {
+		obj.contentType = *result.ContentType
+	}
+
+	resultCache.put(bucket, key, obj)
+	if limit > 0 && int64(len(data)) > limit {
+		return obj, errNotCoalesced
+	}
+	return obj, nil
+}
+
+// isNotModifiedError reports whether a conditional GET returned 304
+func isNotModifiedError(err error) bool {
+	var responseErr *awshttp.ResponseError
+	return errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotModified
+}
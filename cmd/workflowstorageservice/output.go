@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errOutputPath rejects an outputFile outside the output base directory
+var errOutputPath = errors.New("outputFile must be a path inside the output directory")
+
+// outputBaseDir returns the directory retrieve may write outputFile results
+// to (WORKFLOW_STORAGE_OUTPUT_BASE_DIR, default /tmp)
+func outputBaseDir() string {
+	if dir := strings.TrimSpace(os.Getenv("WORKFLOW_STORAGE_OUTPUT_BASE_DIR")); dir != "" {
+		return filepath.Clean(dir)
+	}
+	return filepath.Clean(os.TempDir())
+}
+
+// resolveOutputFile maps a caller-supplied outputFile onto base. Relative
+// paths are taken relative to base; absolute paths must already lie inside
+// it. Any ".." segment is rejected outright, as are paths whose existing
+// parent directories or target resolve through symlinks to outside base.
+func resolveOutputFile(base, outputFile string) (string, error) {
+	for _, segment := range strings.Split(filepath.ToSlash(outputFile), "/") {
+		if segment == ".." {
+			return "", errOutputPath
+		}
+	}
+
+	path := outputFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	path = filepath.Clean(path)
+	if !withinDir(base, path) {
+		return "", errOutputPath
+	}
+
+	// Symlinks inside base must not lead back out of it
+	realBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		// base is created on first write; nothing below it can be a symlink yet
+		return path, nil
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return "", errOutputPath
+	}
+	dir := filepath.Dir(path)
+	for {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+	if !withinDir(realBase, realDir) && realDir != realBase {
+		return "", errOutputPath
+	}
+	return path, nil
+}
+
+// writeOutputFile writes data to path and syncs it to disk. It returns the
+// number of bytes written, and an error unless all of data was written and
+// flushed, so a full disk is reported instead of leaving a truncated file
+// behind silently.
+func writeOutputFile(path string, data []byte) (int64, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(file, bytes.NewReader(data))
+	if err == nil && written != int64(len(data)) {
+		err = io.ErrShortWrite
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return written, err
+}
+
+// withinDir reports whether path lies strictly below dir
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
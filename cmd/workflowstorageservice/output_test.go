@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestResolveOutputFile(t *testing.T) {
+	base := t.TempDir()
+
+	for _, tt := range []struct{ outputFile, want string }{
+		{"result.json", filepath.Join(base, "result.json")},
+		{"runs/wf-1/result.json", filepath.Join(base, "runs", "wf-1", "result.json")},
+		{filepath.Join(base, "abs.json"), filepath.Join(base, "abs.json")},
+	} {
+		got, err := resolveOutputFile(base, tt.outputFile)
+		if err != nil || got != tt.want {
+			t.Errorf("resolveOutputFile(%q) = %q, %v, want %q", tt.outputFile, got, err, tt.want)
+		}
+	}
+
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(base, "escape")); err != nil {
+		t.Fatalf("Symlink() error = %v", err)
+	}
+	for _, outputFile := range []string{
+		"/etc/passwd",
+		"../result.json",
+		"runs/../../result.json",
+		filepath.Join(base, "..", "result.json"),
+		base,
+		"escape/result.json",
+	} {
+		if _, err := resolveOutputFile(base, outputFile); !errors.Is(err, errOutputPath) {
+			t.Errorf("resolveOutputFile(%q) error = %v, want errOutputPath", outputFile, err)
+		}
+	}
+}
+
+func TestSemanticRetrieve_OutputFileOutsideBaseDir(t *testing.T) {
+	resetStorageEnv(t)
+	base := t.TempDir()
+	t.Setenv("WORKFLOW_STORAGE_OUTPUT_BASE_DIR", base)
+
+	store := newFakeStorage()
+	store.objects[defaultBucket()+"/workflow-results/wf-1/step-1.json"] = fakeObject{data: []byte(`{"step": 1}`), contentType: "application/json"}
+
+	retrieve := func(outputFile string) (*semantic.SemanticAction, error) {
+		action, err := semantic.ParseSemanticAction([]byte(`{"@type": "RetrieveAction", "workflowId": "wf-1",
+			"object": {"@type": "DigitalDocument", "identifier": "step-1"}, "outputFile": "` + outputFile + `"}`))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return action, handleSemanticRetrieveImpl(c, action)
+	}
+
+	_, err := retrieve("/etc/workflow-result.json")
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("outputFile outside the base directory: error = %v, want 400", err)
+	}
+
+	action, err := retrieve("wf-1/step-1.json")
+	if err != nil {
+		t.Fatalf("handleSemanticRetrieveImpl() error = %v", err)
+	}
+	written := filepath.Join(base, "wf-1", "step-1.json")
+	if data, err := os.ReadFile(written); err != nil || string(data) != `{"step": 1}` {
+		t.Errorf("ReadFile(%s) = %q, %v", written, data, err)
+	}
+	if value, _ := action.Result.Value.(map[string]interface{}); value["contentUrl"] != written {
+		t.Errorf("contentUrl = %v, want %s", value["contentUrl"], written)
+	}
+}
+
+func TestWriteOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.json")
+	written, err := writeOutputFile(path, []byte(`{"ok": true}`))
+	if err != nil || written != 12 {
+		t.Fatalf("writeOutputFile() = %d, %v", written, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != `{"ok": true}` {
+		t.Errorf("File content = %q", data)
+	}
+
+	// A full disk must surface as an error instead of a short file
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is not available")
+	}
+	if _, err := writeOutputFile("/dev/full", []byte("data")); err == nil {
+		t.Error("writeOutputFile(/dev/full) should fail")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultArrayPageSize is used when a paged retrieve omits pageSize
+	defaultArrayPageSize = 100
+	// maxArrayPageSize caps the elements returned by one paged retrieve
+	maxArrayPageSize = 1000
+)
+
+// errNotJSONArray is returned when a paged retrieve targets anything but a JSON array
+var errNotJSONArray = errors.New("stored object is not a JSON array")
+
+// wantsArrayPage reports whether a retrieve asked for a page of a JSON array
+func wantsArrayPage(action *semantic.SemanticAction) bool {
+	_, hasPage := int64Property(action, "page")
+	_, hasPageSize := int64Property(action, "pageSize")
+	return hasPage || hasPageSize
+}
+
+// retrieveArrayPage returns one page of a stored JSON array. page is 1-based.
+// The array is decoded element by element straight from S3, so only the
+// requested slice is held in memory; the remaining elements are only counted.
+func retrieveArrayPage(c echo.Context, action *semantic.SemanticAction, bucket, key, contentURL string, fallback bool) error {
+	page, ok := int64Property(action, "page")
+	if !ok {
+		page = 1
+	}
+	pageSize, ok := int64Property(action, "pageSize")
+	if !ok {
+		pageSize = defaultArrayPageSize
+	}
+	if page < 1 || pageSize < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "page and pageSize must be positive integers")
+	}
+	if pageSize > maxArrayPageSize {
+		pageSize = maxArrayPageSize
+	}
+
+	result, err := storageFor(c).GetObject(c.Request().Context(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		logf(c, "Failed to fetch %s: %v", key, err)
+		if isNotFoundError(err) {
+			return returnActionError(c, action, "data not found", err)
+		}
+		return returnActionError(c, action, "failed to read data", err)
+	}
+	defer func() {
+		if err := result.Body.Close(); err != nil {
+			logf(c, "Failed to close S3 response body: %v", err)
+		}
+	}()
+
+	if isInProgress(result.Metadata) && !boolProperty(action, "allowPartial") {
+		return stillWritingConflict(key)
+	}
+
+	var body io.Reader = result.Body
+	if isEncoded(result.Metadata) {
+		data, err := io.ReadAll(result.Body)
+		if err != nil {
+			return returnActionError(c, action, "failed to read data", err)
+		}
+		plaintext, err := decodePayload(data, result.Metadata)
+		if err != nil {
+			return returnActionError(c, action, "failed to decrypt data", err)
+		}
+		body = bytes.NewReader(plaintext)
+	}
+
+	start := (page - 1) * pageSize
+	items, total, err := sliceJSONArray(body, start, pageSize)
+	if errors.Is(err, errNotJSONArray) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s: %s", errNotJSONArray.Error(), key))
+	}
+	if err != nil {
+		return returnActionError(c, action, "failed to parse JSON array", err)
+	}
+
+	logf(c, "Fetched page %d of %s (%d of %d items)", page, key, len(items), total)
+
+	value := map[string]interface{}{
+		"contentUrl":      contentURL,
+		"page":            page,
+		"pageSize":        pageSize,
+		"numberOfItems":   total,
+		"totalPages":      (total + pageSize - 1) / pageSize,
+		"itemListElement": items,
+	}
+	reportServingBucket(value, bucket, fallback)
+	action.Result = &semantic.SemanticResult{
+		Type:  "ItemList",
+		Value: value,
+	}
+
+	if isInProgress(result.Metadata) {
+		markPartial(action.Result)
+	}
+	accessLog.record(c, bucket, key)
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// sliceJSONArray decodes a JSON array from r and returns count elements
+// starting at start together with the total number of elements
+func sliceJSONArray(r io.Reader, start, count int64) ([]json.RawMessage, int64, error) {
+	dec := json.NewDecoder(r)
+
+	token, err := dec.Token()
+	if err != nil {
+		return nil, 0, errNotJSONArray
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, 0, errNotJSONArray
+	}
+
+	items := make([]json.RawMessage, 0)
+	var total int64
+	for dec.More() {
+		var element json.RawMessage
+		if err := dec.Decode(&element); err != nil {
+			return nil, 0, err
+		}
+		if total >= start && total < start+count {
+			items = append(items, element)
+		}
+		total++
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSliceJSONArray(t *testing.T) {
+	items, total, err := sliceJSONArray(strings.NewReader(`[1, {"a": 2}, "three", [4], null]`), 1, 2)
+	if err != nil {
+		t.Fatalf("sliceJSONArray() error = %v", err)
+	}
+	if total != 5 {
+		t.Errorf("Expected total 5, got %d", total)
+	}
+	if len(items) != 2 || string(items[0]) != `{"a": 2}` || string(items[1]) != `"three"` {
+		t.Errorf("Unexpected slice %q", items)
+	}
+
+	items, total, err = sliceJSONArray(strings.NewReader(`[1, 2]`), 10, 5)
+	if err != nil || total != 2 || len(items) != 0 {
+		t.Errorf("Expected empty page past the end, got %q (total %d, err %v)", items, total, err)
+	}
+
+	for _, invalid := range []string{`{"a": 1}`, `"text"`, ``} {
+		if _, _, err := sliceJSONArray(strings.NewReader(invalid), 0, 1); !errors.Is(err, errNotJSONArray) {
+			t.Errorf("sliceJSONArray(%q) error = %v, want errNotJSONArray", invalid, err)
+		}
+	}
+}
+
+func TestSemanticRetrieve_ArrayPage(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+	store.objects["px-semantic/workflow-results/wf-1/rows.json"] = fakeObject{
+		data:        []byte(`[{"n": 1}, {"n": 2}, {"n": 3}, {"n": 4}, {"n": 5}]`),
+		contentType: "application/json",
+	}
+	store.objects["px-semantic/workflow-results/wf-1/object.json"] = fakeObject{
+		data:        []byte(`{"n": 1}`),
+		contentType: "application/json",
+	}
+
+	run := func(body string) (*httptest.ResponseRecorder, error) {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		return rec, handleSemanticRetrieveImpl(c, action)
+	}
+
+	rec, err := run(`{"@type": "RetrieveAction", "page": 2, "pageSize": 2,
+		"object": {"@type": "DigitalDocument", "identifier": "rows"}}`)
+	if err != nil {
+		t.Fatalf("handleSemanticRetrieveImpl() error = %v", err)
+	}
+
+	var response struct {
+		Result struct {
+			Value struct {
+				NumberOfItems   int               `json:"numberOfItems"`
+				TotalPages      int               `json:"totalPages"`
+				ItemListElement []json.RawMessage `json:"itemListElement"`
+			} `json:"value"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	value := response.Result.Value
+	if value.NumberOfItems != 5 || value.TotalPages != 3 {
+		t.Errorf("Expected 5 items in 3 pages, got %d in %d", value.NumberOfItems, value.TotalPages)
+	}
+	if len(value.ItemListElement) != 2 || string(value.ItemListElement[0]) != `{"n":3}` {
+		t.Errorf("Unexpected page contents %q", value.ItemListElement)
+	}
+
+	_, err = run(`{"@type": "RetrieveAction", "page": 1,
+		"object": {"@type": "DigitalDocument", "identifier": "object"}}`)
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a non-array object, got %v", err)
+	}
+}
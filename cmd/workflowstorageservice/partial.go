@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+// metadataInProgress marks results whose producer is still writing. It is set
+// by a store with "inProgress": true and cleared by the next store without it.
+const metadataInProgress = "in-progress"
+
+// isInProgress reports whether object metadata carries the in-progress marker
+func isInProgress(metadata map[string]string) bool {
+	return metadata[metadataInProgress] == "true"
+}
+
+// stillWritingConflict is the 409 response for retrieving an in-progress
+// result without allowPartial
+func stillWritingConflict(key string) error {
+	return echo.NewHTTPError(http.StatusConflict, "result is still being written (set allowPartial to read it): "+key)
+}
+
+// markPartial flags a retrieve result as a snapshot of a growing object
+func markPartial(result *semantic.SemanticResult) {
+	if result == nil {
+		return
+	}
+	if value, ok := result.Value.(map[string]interface{}); ok {
+		value["partial"] = true
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSemanticRetrieve_AllowPartial(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(body string, handler func(echo.Context, *semantic.SemanticAction) error) (*httptest.ResponseRecorder, error) {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		return rec, handler(c, action)
+	}
+
+	if _, err := run(`{"@type": "CreateAction", "identifier": "log", "inProgress": true,
+		"object": {"@type": "DigitalDocument", "encodingFormat": "text/plain", "text": "line 1\n"}}`, handleSemanticStoreImpl); err != nil {
+		t.Fatalf("Initial store failed: %v", err)
+	}
+
+	retrieve := `{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "identifier": "log"}}`
+	_, err := run(retrieve, handleSemanticRetrieveImpl)
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for an in-progress result without allowPartial, got %v", err)
+	}
+
+	partialRetrieve := `{"@type": "RetrieveAction", "allowPartial": true, "object": {"@type": "DigitalDocument", "identifier": "log"}}`
+	rec, err := run(partialRetrieve, handleSemanticRetrieveImpl)
+	if err != nil {
+		t.Fatalf("handleSemanticRetrieveImpl() error = %v", err)
+	}
+	var response struct {
+		Result struct {
+			Output string                 `json:"output"`
+			Value  map[string]interface{} `json:"value"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Result.Output != "line 1\n" || response.Result.Value["partial"] != true {
+		t.Errorf("Expected partial snapshot, got %+v", response.Result)
+	}
+
+	// The final store clears the marker
+	if _, err := run(`{"@type": "CreateAction", "identifier": "log",
+		"object": {"@type": "DigitalDocument", "encodingFormat": "text/plain", "text": "line 1\nline 2\n"}}`, handleSemanticStoreImpl); err != nil {
+		t.Fatalf("Final store failed: %v", err)
+	}
+	if _, err := run(retrieve, handleSemanticRetrieveImpl); err != nil {
+		t.Errorf("Expected finished result to be retrievable, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestEvaluatePreconditions(t *testing.T) {
+	store := newFakeStorage()
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	store.objects["bucket/key"] = fakeObject{data: []byte("data"), contentType: "text/plain", modified: modified}
+	etag := `"` + sha256Hex([]byte("data")) + `"`
+
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name    string
+		method  string
+		key     string
+		headers map[string]string
+		want    int
+	}{
+		{"no headers", http.MethodGet, "key", nil, 0},
+		{"if-match etag", http.MethodPut, "key", map[string]string{"If-Match": etag}, 0},
+		{"if-match list", http.MethodPut, "key", map[string]string{"If-Match": `"other", ` + etag}, 0},
+		{"if-match stale", http.MethodPut, "key", map[string]string{"If-Match": `"other"`}, http.StatusPreconditionFailed},
+		{"if-match wildcard exists", http.MethodPut, "key", map[string]string{"If-Match": "*"}, 0},
+		{"if-match wildcard missing", http.MethodPut, "missing", map[string]string{"If-Match": "*"}, http.StatusPreconditionFailed},
+		{"if-none-match wildcard create", http.MethodPost, "missing", map[string]string{"If-None-Match": "*"}, 0},
+		{"if-none-match wildcard exists", http.MethodPost, "key", map[string]string{"If-None-Match": "*"}, http.StatusPreconditionFailed},
+		{"if-none-match read", http.MethodGet, "key", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"if-none-match weak read", http.MethodGet, "key", map[string]string{"If-None-Match": "W/" + etag}, http.StatusNotModified},
+		{"if-modified-since unchanged", http.MethodGet, "key", map[string]string{"If-Modified-Since": after}, http.StatusNotModified},
+		{"if-modified-since changed", http.MethodGet, "key", map[string]string{"If-Modified-Since": before}, 0},
+		{"if-modified-since ignored on write", http.MethodPut, "key", map[string]string{"If-Modified-Since": after}, 0},
+		{"if-unmodified-since changed", http.MethodDelete, "key", map[string]string{"If-Unmodified-Since": before}, http.StatusPreconditionFailed},
+		{"if-unmodified-since unchanged", http.MethodDelete, "key", map[string]string{"If-Unmodified-Since": after}, 0},
+		{"if-match wins over if-unmodified-since", http.MethodPut, "key", map[string]string{"If-Match": etag, "If-Unmodified-Since": before}, 0},
+		{"invalid date ignored", http.MethodGet, "key", map[string]string{"If-Modified-Since": "yesterday"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			got, err := evaluatePreconditions(context.Background(), req, store, "bucket", tt.key)
+			if err != nil {
+				t.Fatalf("evaluatePreconditions() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("evaluatePreconditions() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSemanticStore_IfNoneMatchCreatesOnce(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	create := func(text string) error {
+		action, err := semantic.ParseSemanticAction([]byte(`{"@type": "CreateAction", "identifier": "wf",
+			"object": {"@type": "DigitalDocument", "encodingFormat": "text/plain", "text": "` + text + `"}}`))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("If-None-Match", "*")
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return handleSemanticStoreImpl(c, action)
+	}
+
+	if err := create("first"); err != nil {
+		t.Fatalf("First create failed: %v", err)
+	}
+	err := create("second")
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected 412 for an existing object, got %v", err)
+	}
+
+	for _, obj := range store.objects {
+		if string(obj.data) != "first" {
+			t.Errorf("Stored data = %q, want the first write", obj.data)
+		}
+	}
+}
+
+func TestGetWorkflowREST_NotModified(t *testing.T) {
+	resetStorageEnv(t)
+	registerActions()
+
+	e := echo.New()
+	store := newFakeStorage()
+	bucket := defaultBucket()
+	key := resultKey("wf-1", "my-workflow", "")
+	store.objects[bucket+"/"+key] = fakeObject{data: []byte(`{"steps":[]}`), contentType: "application/json", modified: time.Now()}
+	etag := `"` + sha256Hex([]byte(`{"steps":[]}`)) + `"`
+
+	get := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/api/workflows/my-workflow", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("my-workflow")
+		c.Set(storageContextKey, store)
+		if err := getWorkflowREST(c); err != nil {
+			t.Fatalf("getWorkflowREST() error = %v", err)
+		}
+		return rec
+	}
+
+	if rec := get(map[string]string{"If-None-Match": etag}); rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match current ETag: status = %d, want 304", rec.Code)
+	}
+	if rec := get(map[string]string{"If-Match": `"stale"`}); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("If-Match stale ETag: status = %d, want 412", rec.Code)
+	}
+	rec := get(map[string]string{"If-None-Match": `"stale"`})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "steps") {
+		t.Errorf("If-None-Match stale ETag: status = %d, body %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"eve.evalgo.org/semantic"
+)
+
+// previousContent reads the object a store with returnPrevious is about to
+// overwrite, as the "previous" value of the store response. Its text is
+// bounded like inline retrieves (see maxInlineBytes); larger objects return a
+// preview marked truncated. A missing object yields nil.
+func previousContent(ctx context.Context, store Storage, action *semantic.SemanticAction, bucket, key string) (map[string]interface{}, error) {
+	obj, err := fetchObject(ctx, store, bucket, key)
+	if err != nil {
+		if fetchErrorStatus(err) == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	previous := map[string]interface{}{
+		"encodingFormat": obj.contentType,
+		"contentSize":    int64(len(obj.data)),
+	}
+	if obj.etag != "" {
+		previous["etag"] = obj.etag
+	}
+	text := obj.data
+	if limit := maxInlineBytes(action); int64(len(text)) > limit {
+		text = previewBytes(text, limit)
+		previous["truncated"] = true
+		previous["previewSize"] = int64(len(text))
+	}
+	previous["text"] = string(text)
+	return previous, nil
+}
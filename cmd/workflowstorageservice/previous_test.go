@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"workflowstorageservice.evalgo.org/actions"
+)
+
+func TestStore_ReturnPrevious(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_MAX_INLINE_BYTES", "")
+	t.Setenv("WORKFLOW_STORAGE_MAX_RETRIEVE_INLINE", "")
+
+	e := echo.New()
+	store := newFakeStorage()
+	storeText := func(b *actions.Builder) map[string]interface{} {
+		t.Helper()
+		action, err := b.Action()
+		if err != nil {
+			t.Fatalf("Action() error = %v", err)
+		}
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		if err := handleSemanticStoreImpl(c, action); err != nil {
+			t.Fatalf("Store error = %v", err)
+		}
+		return action.Result.Value.(map[string]interface{})
+	}
+	result := func(text string) *actions.Builder {
+		return actions.NewStoreAction().WithWorkflowID("wf-1").WithIdentifier("config").WithText(text).WithProperty("returnPrevious", true)
+	}
+
+	// Nothing is overwritten by the first store
+	value := storeText(result(`{"version": 1}`))
+	if previous, ok := value["previous"].(map[string]interface{}); !ok || previous != nil {
+		t.Errorf("First store previous = %#v, want nil", value["previous"])
+	}
+
+	value = storeText(result(`{"version": 2}`))
+	previous, _ := value["previous"].(map[string]interface{})
+	if previous["text"] != `{"version": 1}` || previous["contentSize"] != int64(14) || previous["encodingFormat"] != "application/json" || previous["truncated"] != nil {
+		t.Errorf("Overwrite previous = %v", previous)
+	}
+
+	// Large previous content is returned as a bounded preview
+	storeText(result(`"` + strings.Repeat("x", 100) + `"`))
+	value = storeText(result(`{"version": 4}`).WithProperty("maxInlineBytes", 10))
+	previous, _ = value["previous"].(map[string]interface{})
+	if previous["text"] != `"xxxxxxxxx` || previous["truncated"] != true || previous["previewSize"] != int64(10) || previous["contentSize"] != int64(102) {
+		t.Errorf("Truncated previous = %v", previous)
+	}
+
+	// Without returnPrevious the response is unchanged
+	value = storeText(actions.NewStoreAction().WithWorkflowID("wf-1").WithIdentifier("config").WithText(`{"version": 5}`))
+	if _, ok := value["previous"]; ok {
+		t.Errorf("Store without returnPrevious = %v", value)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// mutatingActionTypes lists the action types that change stored data; all
+// others only read
+var mutatingActionTypes = map[string]bool{
+	"UploadAction":         true,
+	"CreateAction":         true,
+	"StoreAction":          true,
+	"UpdateAction":         true,
+	"DeleteAction":         true,
+	"TouchAction":          true,
+	"CopyAction":           true,
+	"BundleStoreAction":    true,
+	"ArchiveAction":        true,
+	"LockAction":           true,
+	"UnlockAction":         true,
+	"UpdateMetadataAction": true,
+}
+
+// readOnlyMode reports whether WORKFLOW_STORAGE_READ_ONLY is set, e.g. for a
+// read-only mirror deployment
+func readOnlyMode() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("WORKFLOW_STORAGE_READ_ONLY"))
+	return enabled
+}
+
+// checkWritable rejects mutating action types with 403 Forbidden while the
+// service runs read-only
+func checkWritable(actionType string) error {
+	if readOnlyMode() && mutatingActionTypes[actionType] {
+		return echo.NewHTTPError(http.StatusForbidden, actionType+" is disabled: the service is read-only")
+	}
+	return nil
+}
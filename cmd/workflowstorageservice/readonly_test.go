@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestReadOnlyMode_RejectsWrites(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_READ_ONLY", "true")
+	registerActions()
+
+	e := echo.New()
+	store := newFakeStorage()
+	store.objects[defaultBucket()+"/workflow-results/default/wf-1.json"] = fakeObject{data: []byte(`{"steps": 1}`), contentType: "application/json"}
+
+	call := func(method, target, body string, handler echo.HandlerFunc, id string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if id != "" {
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+		}
+		c.Set(storageContextKey, store)
+		return rec, handler(c)
+	}
+	assertForbidden := func(name string, rec *httptest.ResponseRecorder, err error) {
+		t.Helper()
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			if httpErr.Code != http.StatusForbidden {
+				t.Errorf("%s: expected 403, got %d", name, httpErr.Code)
+			}
+		} else if err != nil || rec.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %v (status %d)", name, err, rec.Code)
+		}
+	}
+
+	rec, err := call(http.MethodPost, "/v1/api/semantic/action", `{"@type": "CreateAction", "identifier": "new",
+		"object": {"@type": "DigitalDocument", "text": "{}"}}`, handleSemanticAction, "")
+	assertForbidden("semantic CreateAction", rec, err)
+	rec, err = call(http.MethodDelete, "/v1/api/workflows/wf-1", "", deleteWorkflowREST, "wf-1")
+	assertForbidden("REST delete", rec, err)
+	rec, err = call(http.MethodPost, "/v1/api/store", `{"workflowId": "wf-1", "actionId": "new", "data": "{}"}`, handleStore, "")
+	assertForbidden("legacy store", rec, err)
+
+	if len(store.objects) != 1 {
+		t.Errorf("Read-only mode changed storage: %v", keysOf(store.objects))
+	}
+
+	// Reads keep working
+	rec, err = call(http.MethodGet, "/v1/api/workflows/wf-1", "", getWorkflowREST, "wf-1")
+	if err != nil || rec.Code != http.StatusOK {
+		t.Errorf("REST retrieve in read-only mode: %v (status %d: %s)", err, rec.Code, rec.Body.String())
+	}
+}
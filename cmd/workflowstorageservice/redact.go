@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// redactedPlaceholder replaces every redacted value
+const redactedPlaceholder = "[REDACTED]"
+
+// parseRedactPath parses a JSON path of the supported subset: "$", then
+// .name or [index] steps, with * or [*] matching every key or element, e.g.
+// "$.credentials", "$.steps[*].env.*" or "$.secrets[0]".
+func parseRedactPath(path string) ([]string, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(path), "$")
+	if !ok {
+		return nil, fmt.Errorf("redaction path %q must start with $", path)
+	}
+
+	var segments []string
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return nil, fmt.Errorf("redaction path %q has an empty name", path)
+			}
+			segments = append(segments, name)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("redaction path %q has an unclosed [", path)
+			}
+			index := rest[1:end]
+			if _, err := strconv.Atoi(index); err != nil && index != "*" {
+				return nil, fmt.Errorf("redaction path %q has an invalid index %q", path, index)
+			}
+			segments = append(segments, index)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("redaction path %q is not a supported JSON path", path)
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("redaction path %q would redact the whole document", path)
+	}
+	return segments, nil
+}
+
+// parseRedactPaths parses WORKFLOW_STORAGE_REDACT_PATHS, a comma-separated
+// list of JSON paths. Invalid paths are returned as errors so they can be
+// reported once at startup.
+func parseRedactPaths(spec string) ([][]string, []error) {
+	var paths [][]string
+	var invalid []error
+	for _, path := range strings.Split(spec, ",") {
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+		segments, err := parseRedactPath(path)
+		if err != nil {
+			invalid = append(invalid, err)
+			continue
+		}
+		paths = append(paths, segments)
+	}
+	return paths, invalid
+}
+
+// redactPaths returns the configured redaction paths
+func redactPaths() [][]string {
+	paths, _ := parseRedactPaths(os.Getenv("WORKFLOW_STORAGE_REDACT_PATHS"))
+	return paths
+}
+
+// redactJSON replaces the values at paths in the JSON document data with
+// redactedPlaceholder. It returns the rewritten document and the concrete
+// paths that were redacted, sorted; data is returned unchanged when nothing
+// matched. Numbers keep their original precision.
+func redactJSON(data string, paths [][]string) (string, []string, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return "", nil, err
+	}
+
+	var redacted []string
+	for _, segments := range paths {
+		document = redactValue(document, segments, "$", &redacted)
+	}
+	if len(redacted) == 0 {
+		return data, nil, nil
+	}
+	sort.Strings(redacted)
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return "", nil, err
+	}
+	return strings.TrimSuffix(out.String(), "\n"), redacted, nil
+}
+
+// redactValue walks segments below node and replaces the values they reach,
+// recording each replaced location (as a concrete path below at) in redacted
+func redactValue(node interface{}, segments []string, at string, redacted *[]string) interface{} {
+	if len(segments) == 0 {
+		*redacted = append(*redacted, at)
+		return redactedPlaceholder
+	}
+	segment, rest := segments[0], segments[1:]
+
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if segment == "*" || segment == key {
+				value[key] = redactValue(child, rest, at+"."+key, redacted)
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			if segment == "*" || segment == strconv.Itoa(i) {
+				value[i] = redactValue(child, rest, fmt.Sprintf("%s[%d]", at, i), redacted)
+			}
+		}
+	}
+	return node
+}
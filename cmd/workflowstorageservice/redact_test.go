@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseRedactPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"$.credentials", []string{"credentials"}},
+		{"$.steps[*].env.*", []string{"steps", "*", "env", "*"}},
+		{" $.secrets[0] ", []string{"secrets", "0"}},
+	}
+	for _, tt := range tests {
+		got, err := parseRedactPath(tt.path)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRedactPath(%q) = %v, %v, want %v", tt.path, got, err, tt.want)
+		}
+	}
+
+	for _, path := range []string{"credentials", "$", "$..x", "$.a[", "$.a[x]"} {
+		if _, err := parseRedactPath(path); err == nil {
+			t.Errorf("parseRedactPath(%q) should fail", path)
+		}
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	paths, invalid := parseRedactPaths("$.credentials,$.steps[*].env.TOKEN,bogus")
+	if len(invalid) != 1 {
+		t.Errorf("parseRedactPaths() invalid = %v, want 1 entry", invalid)
+	}
+
+	data := `{"name": "deploy", "credentials": {"user": "ci", "password": "hunter2"}, "big": 12345678901234567890,
+		"steps": [{"env": {"TOKEN": "abc", "MODE": "fast"}}, {"run": "make"}, {"env": {"TOKEN": "def"}}]}`
+	out, redacted, err := redactJSON(data, paths)
+	if err != nil {
+		t.Fatalf("redactJSON() error = %v", err)
+	}
+	want := []string{"$.credentials", "$.steps[0].env.TOKEN", "$.steps[2].env.TOKEN"}
+	if !reflect.DeepEqual(redacted, want) {
+		t.Errorf("redactJSON() paths = %v, want %v", redacted, want)
+	}
+	for _, secret := range []string{"hunter2", "abc", "def"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Redacted document still contains %q: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "12345678901234567890") || !strings.Contains(out, `"MODE":"fast"`) {
+		t.Errorf("Redaction changed unrelated values: %s", out)
+	}
+
+	// Documents without matches are returned byte for byte
+	clean := `{"name": "deploy"}`
+	if out, redacted, _ := redactJSON(clean, paths); out != clean || len(redacted) != 0 {
+		t.Errorf("redactJSON() of a clean document = %q, %v", out, redacted)
+	}
+}
+
+func TestSemanticStore_Redact(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_REDACT_PATHS", "$.secrets")
+
+	store := newFakeStorage()
+	body := `{"@type": "CreateAction", "identifier": "def-1", "redact": true,
+		"object": {"@type": "DigitalDocument", "text": "{\"steps\": 2, \"secrets\": {\"apiKey\": \"s3cr3t\"}}"}}`
+	action, err := semantic.ParseSemanticAction([]byte(body))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), rec)
+	c.Set(storageContextKey, store)
+	if err := handleSemanticStoreImpl(c, action); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	object := store.objects[defaultBucket()+"/workflow-results/default/def-1.json"]
+	if strings.Contains(string(object.data), "s3cr3t") || !strings.Contains(string(object.data), redactedPlaceholder) {
+		t.Errorf("Stored data = %s", object.data)
+	}
+	if object.metadata[metadataChecksumSHA256] != sha256Hex(object.data) {
+		t.Error("Checksum must describe the redacted payload")
+	}
+	redacted, _ := action.Result.Value.(map[string]interface{})["redactedPaths"].([]string)
+	if !reflect.DeepEqual(redacted, []string{"$.secrets"}) {
+		t.Errorf("Response does not list the redacted path: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+// actionHandler handles one semantic action type
+type actionHandler func(echo.Context, interface{}) error
+
+// actionRegistry maps action types to their handlers within one namespace.
+// semantic.MustRegister keeps a single process-wide registry, so two EVE
+// services embedded in the same binary would collide on common action types
+// such as CreateAction; a scoped registry keeps this service's handlers
+// separate from everyone else's.
+type actionRegistry struct {
+	namespace string
+
+	mu       sync.RWMutex
+	handlers map[string]actionHandler
+}
+
+// serviceActions is the registry handleSemanticAction dispatches through
+var serviceActions = newActionRegistry("workflowstorageservice")
+
+func newActionRegistry(namespace string) *actionRegistry {
+	return &actionRegistry{
+		namespace: namespace,
+		handlers:  make(map[string]actionHandler),
+	}
+}
+
+// register adds a handler for actionType. Registering a type twice in the
+// same namespace is an error.
+func (r *actionRegistry) register(actionType string, handler actionHandler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.handlers[actionType]; exists {
+		return fmt.Errorf("action type %s is already registered in %s", actionType, r.namespace)
+	}
+	r.handlers[actionType] = handler
+	return nil
+}
+
+// mustRegister is register for startup code, panicking on duplicates
+func (r *actionRegistry) mustRegister(actionType string, handler actionHandler) {
+	if err := r.register(actionType, handler); err != nil {
+		panic(err)
+	}
+}
+
+// lookup returns the handler registered for actionType
+func (r *actionRegistry) lookup(actionType string) (actionHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handler, ok := r.handlers[actionType]
+	return handler, ok
+}
+
+// handle dispatches action to the handler registered for its type
+func (r *actionRegistry) handle(c echo.Context, action *semantic.SemanticAction) error {
+	handler, ok := r.lookup(action.Type)
+	if !ok {
+		return returnActionError(c, action, unsupportedActionMessage(action.Type), nil)
+	}
+	return handler(c, action)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestActionRegistry_Scoped(t *testing.T) {
+	ours := newActionRegistry("ours")
+	theirs := newActionRegistry("theirs")
+
+	called := ""
+	handler := func(name string) actionHandler {
+		return func(c echo.Context, action interface{}) error {
+			called = name
+			return nil
+		}
+	}
+
+	if err := ours.register("CreateAction", handler("ours")); err != nil {
+		t.Fatalf("register() error = %v", err)
+	}
+	if err := theirs.register("CreateAction", handler("theirs")); err != nil {
+		t.Errorf("Registering the same type in another namespace failed: %v", err)
+	}
+	if err := ours.register("CreateAction", handler("again")); err == nil {
+		t.Error("Expected a duplicate registration to fail")
+	}
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+	if err := ours.handle(c, &semantic.SemanticAction{Type: "CreateAction"}); err != nil {
+		t.Fatalf("handle() error = %v", err)
+	}
+	if called != "ours" {
+		t.Errorf("handle() dispatched to %q, want ours", called)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+// requestID returns the X-Request-ID assigned by the RequestID middleware,
+// which echoes an incoming ID or generates a new one
+func requestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
+
+// logf logs a message prefixed with the request ID so it can be correlated
+// with the X-Request-ID header returned to the client
+func logf(c echo.Context, format string, args ...interface{}) {
+	if id := requestID(c); id != "" {
+		format = "[" + id + "] " + format
+	}
+	log.Printf(format, args...)
+}
+
+// returnActionError reports a failed semantic action, including the request
+// ID in the error message.
+//
+// Expired or revoked S3 credentials are reported as 503 Service Unavailable
+// instead, whatever the operation, and trigger a credentials reload.
+// Operations cut short by the request deadline are reported as 504.
+func returnActionError(c echo.Context, action *semantic.SemanticAction, message string, err error) error {
+	if err != nil && isCredentialError(err) {
+		logf(c, "%s: %v", message, err)
+		return credentialUnavailable(c)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		logf(c, "%s: %v", message, err)
+		return deadlineExceeded()
+	}
+	if id := requestID(c); id != "" {
+		message = fmt.Sprintf("%s (requestId: %s)", message, id)
+	}
+	return semantic.ReturnActionError(c, action, message, err)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+// responseNaming is the field-naming convention of a JSON response
+type responseNaming int
+
+const (
+	// namingDefault keeps each endpoint's native field names
+	namingDefault responseNaming = iota
+	// namingJSONLD emits application/ld+json with a guaranteed @context
+	namingJSONLD
+	// namingSnakeCase emits flat JSON with snake_case keys and no JSON-LD
+	// keywords (@type becomes type, @id becomes id, @context is dropped)
+	namingSnakeCase
+)
+
+// responseNamingFor selects the naming convention from the naming query
+// parameter ("jsonld" or "snake_case"), falling back to the Accept header:
+// application/ld+json selects JSON-LD and application/json;naming=snake_case
+// selects snake_case.
+func responseNamingFor(r *http.Request) responseNaming {
+	switch strings.ToLower(r.URL.Query().Get("naming")) {
+	case "jsonld", "json-ld":
+		return namingJSONLD
+	case "snake_case", "snake":
+		return namingSnakeCase
+	}
+
+	if acceptsJSONLD(r) {
+		return namingJSONLD
+	}
+	for _, accepted := range strings.Split(r.Header.Get(echo.HeaderAccept), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && strings.EqualFold(params["naming"], "snake_case") {
+			return namingSnakeCase
+		}
+	}
+	return namingDefault
+}
+
+// respondJSON writes v using the envelope version and naming convention
+// requested by the client. All JSON success responses go through here so
+// clients can rely on a single convention across the semantic, REST and
+// legacy endpoints. Envelope v2 implies JSON-LD naming unless another naming
+// is requested.
+func respondJSON(c echo.Context, status int, v interface{}) error {
+	naming := responseNamingFor(c.Request())
+	version := responseVersionFor(c.Request())
+	if version == versionJSONLD && naming == namingDefault {
+		naming = namingJSONLD
+	}
+	if naming == namingDefault && version == versionNative {
+		return c.JSON(status, v)
+	}
+
+	body, err := encodeResponse(v, naming, version)
+	if err != nil {
+		return err
+	}
+
+	contentType := echo.MIMEApplicationJSON
+	if naming == namingJSONLD {
+		contentType = "application/ld+json"
+	}
+	return c.Blob(status, contentType, body)
+}
+
+// encodeResponse marshals v, reshapes it for the envelope version and
+// rewrites its field names for naming
+func encodeResponse(v interface{}, naming responseNaming, version responseVersion) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+	document = applyEnvelope(document, version)
+
+	switch naming {
+	case namingJSONLD:
+		if object, ok := document.(map[string]interface{}); ok {
+			if ctx, ok := object["@context"]; !ok || ctx == "" {
+				object["@context"] = jsonLDContext
+			}
+		}
+	case namingSnakeCase:
+		document = snakeCaseKeys(document)
+	}
+
+	return json.Marshal(document)
+}
+
+// snakeCaseKeys recursively renames object keys to snake_case and strips
+// JSON-LD keywords
+func snakeCaseKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if key == "@context" {
+				continue
+			}
+			out[snakeCase(strings.TrimPrefix(key, "@"))] = snakeCaseKeys(item)
+		}
+		return out
+	case []interface{}:
+		for i, item := range v {
+			v[i] = snakeCaseKeys(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// snakeCase converts a camelCase name to snake_case, keeping acronyms
+// together (contentUrl -> content_url, requestID -> request_id)
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1])
+			if prevLower || nextLower {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"contentUrl":     "content_url",
+		"encodingFormat": "encoding_format",
+		"requestID":      "request_id",
+		"numberOfItems":  "number_of_items",
+		"data":           "data",
+		"s3Endpoint":     "s3_endpoint",
+	}
+	for in, want := range tests {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestResponseNamingFor(t *testing.T) {
+	tests := []struct {
+		target string
+		accept string
+		want   responseNaming
+	}{
+		{"/", "", namingDefault},
+		{"/", "application/json", namingDefault},
+		{"/", "application/ld+json", namingJSONLD},
+		{"/", "application/json; naming=snake_case", namingSnakeCase},
+		{"/?naming=snake_case", "application/ld+json", namingSnakeCase},
+		{"/?naming=jsonld", "", namingJSONLD},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.accept != "" {
+			req.Header.Set(echo.HeaderAccept, tt.accept)
+		}
+		if got := responseNamingFor(req); got != tt.want {
+			t.Errorf("responseNamingFor(%s, Accept %q) = %v, want %v", tt.target, tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestRespondJSON_SnakeCase(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/store?naming=snake_case", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	response := StoreResponse{
+		Type:           "DataDownload",
+		ID:             "#step-1-result",
+		ContentURL:     "s3://px-semantic/workflow-results/wf-1/step-1.json",
+		EncodingFormat: "application/json",
+		ContentSize:    2,
+	}
+	if err := respondJSON(c, http.StatusOK, response); err != nil {
+		t.Fatalf("respondJSON() error = %v", err)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	for _, key := range []string{"type", "id", "content_url", "encoding_format", "content_size"} {
+		if _, ok := body[key]; !ok {
+			t.Errorf("Expected key %q in %v", key, body)
+		}
+	}
+	if _, ok := body["@type"]; ok {
+		t.Errorf("Expected JSON-LD keywords to be stripped, got %v", body)
+	}
+}
+
+func TestStoreResponse_PotentialActionRetrieves(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	body := []byte(`{"workflowId": "wf-1", "actionId": "step-1", "data": "{\"ok\": true}"}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/store", bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(storageContextKey, store)
+	if err := handleStore(c); err != nil {
+		t.Fatalf("handleStore() error = %v", err)
+	}
+
+	var response struct {
+		ContentURL      string          `json:"contentUrl"`
+		PotentialAction json.RawMessage `json:"potentialAction"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	// POSTing the embedded action back must return the stored data
+	action, err := semantic.ParseSemanticAction(response.PotentialAction)
+	if err != nil {
+		t.Fatalf("potentialAction is not a semantic action: %v (%s)", err, response.PotentialAction)
+	}
+	if action.Type != "RetrieveAction" || action.Object == nil || action.Object.ContentUrl != response.ContentURL {
+		t.Fatalf("Unexpected potentialAction %s", response.PotentialAction)
+	}
+	rec = httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), rec)
+	c.Set(storageContextKey, store)
+	if err := handleSemanticRetrieveImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticRetrieveImpl() error = %v", err)
+	}
+	if action.Result == nil || action.Result.Output != `{"ok": true}` {
+		t.Errorf("Retrieve via potentialAction returned %s", rec.Body.String())
+	}
+}
+
+func TestStoreAndFetch_ReportETag(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+	want := `"` + sha256Hex([]byte(`{"ok": true}`)) + `"`
+
+	body := []byte(`{"workflowId": "wf-1", "actionId": "step-1", "data": "{\"ok\": true}"}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/store", bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(storageContextKey, store)
+	if err := handleStore(c); err != nil {
+		t.Fatalf("handleStore() error = %v", err)
+	}
+	var stored StoreResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &stored); err != nil || stored.ETag != want {
+		t.Errorf("Store etag = %q, %v, want %s", stored.ETag, err, want)
+	}
+
+	rec = httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/v1/api/fetch/workflow-results/wf-1/step-1.json", nil), rec)
+	c.SetParamNames("key")
+	c.SetParamValues("workflow-results/wf-1/step-1.json")
+	c.Set(storageContextKey, store)
+	if err := handleFetch(c); err != nil {
+		t.Fatalf("handleFetch() error = %v", err)
+	}
+	var fetched FetchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &fetched); err != nil || fetched.ETag != want || rec.Header().Get("ETag") != want {
+		t.Errorf("Fetch etag = %q (header %q), %v, want %s", fetched.ETag, rec.Header().Get("ETag"), err, want)
+	}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "RetrieveAction", "workflowId": "wf-1",
+		"object": {"@type": "DigitalDocument", "identifier": "step-1"}}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	c = e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+	c.Set(storageContextKey, store)
+	if err := handleSemanticRetrieveImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticRetrieveImpl() error = %v", err)
+	}
+	if value, _ := action.Result.Value.(map[string]interface{}); value["etag"] != want {
+		t.Errorf("Retrieve etag = %v, want %s", value["etag"], want)
+	}
+}
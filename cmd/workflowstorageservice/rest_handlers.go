@@ -3,9 +3,11 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 )
@@ -28,6 +30,9 @@ func registerRESTEndpoints(apiGroup *echo.Group, apiKeyMiddleware echo.Middlewar
 	// POST /v1/api/workflows - Store workflow
 	apiGroup.POST("/workflows", storeWorkflowREST, apiKeyMiddleware)
 
+	// GET /v1/api/workflows - List workflows
+	apiGroup.GET("/workflows", listWorkflowsREST, apiKeyMiddleware)
+
 	// GET /v1/api/workflows/:id - Retrieve workflow
 	apiGroup.GET("/workflows/:id", getWorkflowREST, apiKeyMiddleware)
 
@@ -36,6 +41,10 @@ func registerRESTEndpoints(apiGroup *echo.Group, apiKeyMiddleware echo.Middlewar
 
 	// DELETE /v1/api/workflows/:id - Delete workflow
 	apiGroup.DELETE("/workflows/:id", deleteWorkflowREST, apiKeyMiddleware)
+
+	// OPTIONS - preflight responses; browsers send them without credentials
+	apiGroup.OPTIONS("/workflows", handleWorkflowOptions)
+	apiGroup.OPTIONS("/workflows/:id", handleWorkflowOptions)
 }
 
 // storeWorkflowREST handles REST POST /v1/api/workflows
@@ -79,6 +88,39 @@ func storeWorkflowREST(c echo.Context) error {
 	return callSemanticHandler(c, action)
 }
 
+// listWorkflowsREST handles REST GET /v1/api/workflows
+func listWorkflowsREST(c echo.Context) error {
+	// Convert to JSON-LD ListAction
+	action := map[string]interface{}{
+		"@context": "https://schema.org",
+		"@type":    "ListAction",
+	}
+
+	if workflowID := c.QueryParam("workflowId"); workflowID != "" {
+		action["workflowId"] = workflowID
+	}
+	if token := c.QueryParam("continuationToken"); token != "" {
+		action["continuationToken"] = token
+	}
+	if maxKeys := c.QueryParam("maxKeys"); maxKeys != "" {
+		n, err := strconv.Atoi(maxKeys)
+		if err != nil || n <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "maxKeys must be a positive integer"})
+		}
+		action["maxKeys"] = n
+	}
+	if c.QueryParam("countAll") == "true" {
+		action["countAll"] = true
+	}
+	for _, bound := range []string{"modifiedAfter", "modifiedBefore"} {
+		if value := c.QueryParam(bound); value != "" {
+			action[bound] = value
+		}
+	}
+
+	return callSemanticHandler(c, action)
+}
+
 // getWorkflowREST handles REST GET /v1/api/workflows/:id
 func getWorkflowREST(c echo.Context) error {
 	id := c.Param("id")
@@ -86,14 +128,26 @@ func getWorkflowREST(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "id is required"})
 	}
 
-	// Get bucket from environment or use default
-	bucket := c.QueryParam("bucket")
-	if bucket == "" {
-		bucket = "px-semantic"
+	route, err := restResultLocation(c, id)
+	if err != nil {
+		logf(c, "Failed to route %s: %v", id, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to resolve storage location"})
 	}
+	bucket, key := route.Bucket, route.Key
+	s3URL := fmt.Sprintf("s3://%s/%s", bucket, key)
 
-	// Construct S3 URL
-	s3URL := fmt.Sprintf("s3://%s/workflow-results/default/%s.json", bucket, id)
+	// Conditional GET: 304 for If-None-Match / If-Modified-Since, 412 for If-Match / If-Unmodified-Since
+	status, err := evaluatePreconditions(c.Request().Context(), c.Request(), storageFor(c), bucket, key)
+	if err != nil {
+		logf(c, "Failed to check preconditions for %s: %v", key, err)
+		return c.JSON(storageErrorStatus(err), map[string]string{"error": "failed to check preconditions"})
+	}
+	switch status {
+	case http.StatusNotModified:
+		return c.NoContent(http.StatusNotModified)
+	case http.StatusPreconditionFailed:
+		return c.JSON(http.StatusPreconditionFailed, map[string]string{"error": "precondition failed"})
+	}
 
 	// Convert to JSON-LD RetrieveAction
 	action := map[string]interface{}{
@@ -159,14 +213,13 @@ func deleteWorkflowREST(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "id is required"})
 	}
 
-	// Get bucket from environment or use default
-	bucket := c.QueryParam("bucket")
-	if bucket == "" {
-		bucket = "px-semantic"
+	route, err := restResultLocation(c, id)
+	if err != nil {
+		logf(c, "Failed to route %s: %v", id, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to resolve storage location"})
 	}
-
-	// Construct S3 URL
-	s3URL := fmt.Sprintf("s3://%s/workflow-results/default/%s.json", bucket, id)
+	bucket, key := route.Bucket, route.Key
+	s3URL := fmt.Sprintf("s3://%s/%s", bucket, key)
 
 	// Convert to JSON-LD DeleteAction
 	action := map[string]interface{}{
@@ -182,25 +235,129 @@ func deleteWorkflowREST(c echo.Context) error {
 	return callSemanticHandler(c, action)
 }
 
+// restResultLocation routes a workflow addressed by a REST call the same way
+// the store side did: the X-Workflow-ID header selects the workflow,
+// ?format the encoding format and ?type the capability.
+func restResultLocation(c echo.Context, id string) (Route, error) {
+	return routeResult(RouteRequest{
+		WorkflowID: workflowIDFor(c, nil),
+		Identifier: id,
+		Type:       c.QueryParam("type"),
+		Format:     c.QueryParam("format"),
+		Tenant:     tenantFor(c),
+	})
+}
+
 // callSemanticHandler converts action to JSON and calls the semantic action handler
 func callSemanticHandler(c echo.Context, action map[string]interface{}) error {
+	// ?type= routes the call to the bucket mapped to that capability
+	if typ := c.QueryParam("type"); typ != "" {
+		action["type"] = typ
+	}
+
 	// Marshal action to JSON
 	actionJSON, err := json.Marshal(action)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to marshal action: %v", err)})
 	}
 
-	// Create new request with JSON-LD body
-	newReq := c.Request().Clone(c.Request().Context())
-	newReq.Body = io.NopCloser(bytes.NewReader(actionJSON))
-	newReq.Header.Set("Content-Type", "application/json")
-
-	// Create new context with modified request
-	newCtx := c.Echo().NewContext(newReq, c.Response())
+	// Create new context with the JSON-LD body
+	newCtx := derivedContext(c, actionJSON)
 	newCtx.SetPath(c.Path())
 	newCtx.SetParamNames(c.ParamNames()...)
 	newCtx.SetParamValues(c.ParamValues()...)
 
+	if c.QueryParam("echo") == "true" {
+		return echoSemanticCall(c, newCtx, action)
+	}
+
 	// Call the existing semantic action handler
 	return handleSemanticAction(newCtx)
 }
+
+// derivedContextKeys are the echo context values a derived context inherits
+var derivedContextKeys = []string{storageContextKey, tenantContextKey, timingsContextKey}
+
+// derivedContext returns a context that dispatches the JSON-LD action body
+// through the semantic handler on behalf of c (REST calls, batch entries).
+// It inherits the request context and with it the deadline, the request
+// ID, the injected storage, the tenant and the timings of c, so the action
+// runs with the same scope and limits as the request that produced it.
+func derivedContext(c echo.Context, body []byte) echo.Context {
+	req := c.Request().Clone(c.Request().Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	// The response, which carries the generated ID, may be replaced (see
+	// bufferedSemanticCall), so the ID travels on the request
+	if id := requestID(c); id != "" {
+		req.Header.Set(echo.HeaderXRequestID, id)
+	}
+
+	derived := c.Echo().NewContext(req, c.Response())
+	for _, key := range derivedContextKeys {
+		if value := c.Get(key); value != nil {
+			derived.Set(key, value)
+		}
+	}
+	return derived
+}
+
+// echoSemanticCall runs the semantic handler against a buffered response and
+// returns the synthesized action alongside its result, so clients can see
+// which semantic action their REST call produced (?echo=true)
+func echoSemanticCall(c, newCtx echo.Context, action map[string]interface{}) error {
+	status, result, err := bufferedSemanticCall(c, newCtx)
+	if err != nil {
+		return err
+	}
+
+	return respondJSON(c, status, map[string]interface{}{
+		"action": action,
+		"result": result,
+	})
+}
+
+// bufferedSemanticCall dispatches newCtx through handleSemanticAction with the
+// response captured in memory. It returns the status and the response body
+// (raw JSON when valid). HTTP errors are reported as an {"error": ...} result;
+// other errors are returned.
+func bufferedSemanticCall(c, newCtx echo.Context) (int, interface{}, error) {
+	buffer := &bufferedResponseWriter{header: make(http.Header)}
+	newCtx.SetResponse(echo.NewResponse(buffer, c.Echo()))
+
+	if err := handleSemanticAction(newCtx); err != nil {
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) {
+			return 0, nil, err
+		}
+		return httpErr.Code, map[string]interface{}{"error": httpErr.Message}, nil
+	}
+
+	if body := buffer.body.Bytes(); json.Valid(body) {
+		return newCtx.Response().Status, json.RawMessage(body), nil
+	}
+	return newCtx.Response().Status, buffer.body.String(), nil
+}
+
+// bufferedResponseWriter collects a handler's response in memory
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+// Flush is a no-op; the body is only sent once the handler finishes
+func (w *bufferedResponseWriter) Flush() {}
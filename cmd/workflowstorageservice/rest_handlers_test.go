@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRESTEcho_ReturnsSynthesizedAction(t *testing.T) {
+	resetStorageEnv(t)
+	registerActions()
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	call := func(method, target, body string, handler echo.HandlerFunc, id string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if id != "" {
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+		}
+		c.Set(storageContextKey, store)
+		if err := handler(c); err != nil {
+			t.Fatalf("%s %s error = %v", method, target, err)
+		}
+		var response map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response %q: %v", rec.Body.String(), err)
+		}
+		return rec, response
+	}
+
+	rec, response := call(http.MethodPost, "/v1/api/workflows?echo=true", `{"id": "wf-echo", "definition": {"steps": 1}}`, storeWorkflowREST, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	action, ok := response["action"].(map[string]interface{})
+	if !ok || action["@type"] != "CreateAction" || action["identifier"] != "wf-echo" {
+		t.Errorf("Expected synthesized CreateAction, got %v", response["action"])
+	}
+	result, ok := response["result"].(map[string]interface{})
+	if !ok || result["actionStatus"] != "CompletedActionStatus" {
+		t.Errorf("Expected completed action result, got %v", response["result"])
+	}
+
+	// Without echo the semantic response is returned unchanged
+	_, response = call(http.MethodGet, "/v1/api/workflows/wf-echo", "", getWorkflowREST, "wf-echo")
+	if _, ok := response["action"]; ok {
+		t.Errorf("Expected plain semantic response without echo, got %v", response)
+	}
+	if response["@type"] != "RetrieveAction" {
+		t.Errorf("Expected RetrieveAction response, got %v", response["@type"])
+	}
+}
+
+func TestDerivedContext_InheritsRequestScope(t *testing.T) {
+	e := echo.New()
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/batch", nil).WithContext(ctx)
+	c := e.NewContext(req, httptest.NewRecorder())
+	c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+	store := newFakeStorage()
+	timings := &actionTimings{start: time.Now()}
+	c.Set(storageContextKey, store)
+	c.Set(tenantContextKey, "acme")
+	c.Set(timingsContextKey, timings)
+
+	derived := derivedContext(c, []byte(`{"@type": "RetrieveAction"}`))
+	// Dispatching through bufferedSemanticCall replaces the response
+	derived.SetResponse(echo.NewResponse(&bufferedResponseWriter{header: make(http.Header)}, e))
+
+	if got := requestID(derived); got != "req-1" {
+		t.Errorf("requestID() = %q, want req-1", got)
+	}
+	if got, ok := derived.Request().Context().Deadline(); !ok || !got.Equal(deadline) {
+		t.Errorf("Deadline() = %v, %v, want %v", got, ok, deadline)
+	}
+	if derived.Get(storageContextKey) != store || tenantFor(derived) != "acme" || timingsFor(derived) != timings {
+		t.Errorf("Derived context lost storage, tenant or timings")
+	}
+	if body, _ := io.ReadAll(derived.Request().Body); string(body) != `{"@type": "RetrieveAction"}` {
+		t.Errorf("Body = %q", body)
+	}
+}
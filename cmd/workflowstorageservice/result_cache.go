@@ -0,0 +1,134 @@
+package main
+
+import (
+	"container/list"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultResultCacheTTL is how long a cached object is served without
+// revalidating its ETag against S3
+const defaultResultCacheTTL = 5 * time.Second
+
+// lruResultCache keeps recently retrieved object bodies in memory, bounded by
+// total bytes (WORKFLOW_STORAGE_CACHE_BYTES, disabled when unset). Entries are
+// served directly for WORKFLOW_STORAGE_CACHE_TTL and afterwards revalidated
+// with a conditional GET (If-None-Match on the stored ETag). Objects larger
+// than an eighth of the capacity or above the inline threshold are not cached.
+type lruResultCache struct {
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+	bytes int64
+}
+
+type resultCacheEntry struct {
+	id       string
+	object   *storedObject
+	cachedAt time.Time
+}
+
+// resultCache is the service-wide positive result cache
+var resultCache = newLRUResultCache()
+
+func newLRUResultCache() *lruResultCache {
+	return &lruResultCache{
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// resultCacheCapacity returns WORKFLOW_STORAGE_CACHE_BYTES, or 0 when disabled
+func resultCacheCapacity() int64 {
+	capacity, err := strconv.ParseInt(os.Getenv("WORKFLOW_STORAGE_CACHE_BYTES"), 10, 64)
+	if err != nil || capacity < 0 {
+		return 0
+	}
+	return capacity
+}
+
+// resultCacheTTL returns WORKFLOW_STORAGE_CACHE_TTL or the default
+func resultCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("WORKFLOW_STORAGE_CACHE_TTL"))
+	if err != nil || ttl < 0 {
+		return defaultResultCacheTTL
+	}
+	return ttl
+}
+
+// get returns the cached object for bucket/key and whether it is still fresh.
+// A stale entry is returned so the caller can revalidate its ETag.
+func (r *lruResultCache) get(bucket, key string) (*storedObject, bool) {
+	if resultCacheCapacity() == 0 {
+		return nil, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	element, ok := r.items[bucket+"/"+key]
+	if !ok {
+		return nil, false
+	}
+	r.order.MoveToFront(element)
+
+	entry := element.Value.(*resultCacheEntry)
+	return entry.object, time.Since(entry.cachedAt) < resultCacheTTL()
+}
+
+// touch marks an entry as freshly validated
+func (r *lruResultCache) touch(bucket, key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if element, ok := r.items[bucket+"/"+key]; ok {
+		element.Value.(*resultCacheEntry).cachedAt = time.Now()
+	}
+}
+
+// put caches obj if caching is enabled and the object is small enough,
+// evicting least recently used entries to stay within capacity
+func (r *lruResultCache) put(bucket, key string, obj *storedObject) {
+	capacity := resultCacheCapacity()
+	size := int64(len(obj.data))
+	if capacity == 0 || obj.etag == "" || size > capacity/8 || size > maxInlineBytes(nil) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := bucket + "/" + key
+	r.removeLocked(id)
+
+	element := r.order.PushFront(&resultCacheEntry{id: id, object: obj, cachedAt: time.Now()})
+	r.items[id] = element
+	r.bytes += size
+
+	for r.bytes > capacity {
+		oldest := r.order.Back()
+		if oldest == nil {
+			break
+		}
+		r.removeLocked(oldest.Value.(*resultCacheEntry).id)
+	}
+}
+
+// forget drops bucket/key, e.g. after it has been overwritten
+func (r *lruResultCache) forget(bucket, key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removeLocked(bucket + "/" + key)
+}
+
+func (r *lruResultCache) removeLocked(id string) {
+	element, ok := r.items[id]
+	if !ok {
+		return
+	}
+	r.order.Remove(element)
+	delete(r.items, id)
+	r.bytes -= int64(len(element.Value.(*resultCacheEntry).object.data))
+}
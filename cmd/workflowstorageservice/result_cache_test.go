@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestResultCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_CACHE_BYTES", "80")
+	cache := newLRUResultCache()
+
+	object := func(size int) *storedObject {
+		return &storedObject{data: make([]byte, size), etag: `"etag"`}
+	}
+
+	cache.put("bucket", "a", object(10))
+	cache.put("bucket", "b", object(10))
+	cache.get("bucket", "a") // a is now most recently used
+	for _, key := range []string{"c", "d", "e", "f", "g", "h"} {
+		cache.put("bucket", key, object(10))
+	}
+	cache.put("bucket", "i", object(10))
+
+	if cached, _ := cache.get("bucket", "b"); cached != nil {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if cached, _ := cache.get("bucket", "a"); cached == nil {
+		t.Error("Expected recently used entry to stay cached")
+	}
+	if cache.bytes > 80 {
+		t.Errorf("Cache exceeds capacity: %d bytes", cache.bytes)
+	}
+
+	cache.put("bucket", "large", object(11))
+	if cached, _ := cache.get("bucket", "large"); cached != nil {
+		t.Error("Objects larger than an eighth of the capacity must not be cached")
+	}
+}
+
+func TestFetchObject_ServesFreshEntriesFromCache(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_CACHE_BYTES", "1048576")
+	t.Setenv("WORKFLOW_STORAGE_CACHE_TTL", "1m")
+
+	store := newFakeStorage()
+	store.objects["bucket/workflow-results/wf/cached.json"] = fakeObject{
+		data:        []byte(`{"cached": true}`),
+		contentType: "application/json",
+	}
+	defer resultCache.forget("bucket", "workflow-results/wf/cached.json")
+
+	for i := 0; i < 3; i++ {
+		obj, err := fetchObject(context.Background(), store, "bucket", "workflow-results/wf/cached.json")
+		if err != nil {
+			t.Fatalf("fetchObject() error = %v", err)
+		}
+		if string(obj.data) != `{"cached": true}` {
+			t.Errorf("Unexpected data %q", obj.data)
+		}
+	}
+
+	if store.gets != 1 {
+		t.Errorf("Expected a single GetObject call, got %d", store.gets)
+	}
+}
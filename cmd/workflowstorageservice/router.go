@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+// RouteRequest describes a workflow result whose location is resolved
+type RouteRequest struct {
+	WorkflowID string
+	Identifier string
+	// Type is the capability the request targets ("data", "document-storage", ...)
+	Type string
+	// Format is the encoding format of the result
+	Format string
+	// Properties are the remaining action properties, for routers that need them
+	Properties map[string]interface{}
+	// Tenant confines the result to a tenant's namespace (see apiKeyAuth)
+	Tenant string
+}
+
+// Route is the bucket and key of a workflow result
+type Route struct {
+	Bucket string
+	Key    string
+}
+
+// Router maps workflow results to storage locations. Every handler resolves
+// result keys through the configured router, so a router alone decides the
+// layout; ListPrefix must return the common prefix of every key Route
+// produces for a workflow (or for all workflows when workflowID is empty),
+// or errWorkflowsNotListable when the layout has no such prefix.
+type Router interface {
+	Route(req RouteRequest) (Route, error)
+	ListPrefix(workflowID, typ string) (Route, error)
+}
+
+// errWorkflowsNotListable is returned for layouts whose keys do not start
+// with the workflow ID below a common prefix, e.g. sharded keys. Handlers
+// answer it with 400 rather than listing a prefix that misses results.
+var errWorkflowsNotListable = errors.New("the configured key layout does not group results by workflow ID")
+
+// defaultRouter is the built-in layout: the bucket mapped to the type (see
+// WORKFLOW_STORAGE_BUCKET_MAP) and the key from resultKey, below the
+// mapping's prefix
+type defaultRouter struct{}
+
+func (defaultRouter) Route(req RouteRequest) (Route, error) {
+	if flatKeysEnabled() {
+		if err := checkFlatWorkflowID(req.WorkflowID); err != nil {
+			return Route{}, err
+		}
+	}
+	target := storageTargetForType(req.Type)
+	return Route{
+		Bucket: target.Bucket,
+		Key:    target.objectKey(resultKey(req.WorkflowID, req.Identifier, req.Format)),
+	}, nil
+}
+
+func (defaultRouter) ListPrefix(workflowID, typ string) (Route, error) {
+	if shardKeysEnabled() {
+		// Sharded keys start with the shard, not with workflow-results/
+		return Route{}, errWorkflowsNotListable
+	}
+	target := storageTargetForType(typ)
+	prefix := resultsKeyPrefix + "/"
+	if workflowID != "" {
+		prefix = fmt.Sprintf("%s/%s/", resultsKeyPrefix, workflowID)
+		if flatKeysEnabled() {
+			if err := checkFlatWorkflowID(workflowID); err != nil {
+				return Route{}, err
+			}
+			prefix = fmt.Sprintf("%s/%s%s", resultsKeyPrefix, workflowID, keySeparator())
+		}
+	}
+	return Route{Bucket: target.Bucket, Key: target.objectKey(prefix)}, nil
+}
+
+// templateRouter builds keys from WORKFLOW_STORAGE_KEY_TEMPLATE, e.g.
+// "{type}/{workflowId}/{identifier}{ext}". Placeholders: {workflowId},
+// {identifier}, {type}, {folder} and {ext} (see typeFolder) and {shard}
+// (see keyShard). Buckets are still chosen by WORKFLOW_STORAGE_BUCKET_MAP.
+type templateRouter struct {
+	template string
+}
+
+// errInvalidKeyTemplate is returned for templates that cannot address a result
+var errInvalidKeyTemplate = errors.New("WORKFLOW_STORAGE_KEY_TEMPLATE must contain {identifier}")
+
+func (r templateRouter) Route(req RouteRequest) (Route, error) {
+	folder, ext := typeFolder(req.Format)
+	key := strings.NewReplacer(
+		"{workflowId}", req.WorkflowID,
+		"{identifier}", req.Identifier,
+		"{type}", templateType(req.Type),
+		"{folder}", folder,
+		"{ext}", ext,
+		"{shard}", keyShard(req.WorkflowID, req.Identifier),
+	).Replace(r.template)
+
+	target := storageTargetForType(req.Type)
+	return Route{Bucket: target.Bucket, Key: target.objectKey(key)}, nil
+}
+
+// ListPrefix renders the template up to the first placeholder that depends
+// on the individual result. With {workflowId} in that part, listing all
+// workflows stops in front of it; without it, as in
+// "{shard}/{workflowId}/...", a single workflow cannot be listed.
+func (r templateRouter) ListPrefix(workflowID, typ string) (Route, error) {
+	prefix := r.template
+	for _, placeholder := range []string{"{identifier}", "{folder}", "{ext}", "{shard}"} {
+		if i := strings.Index(prefix, placeholder); i >= 0 {
+			prefix = prefix[:i]
+		}
+	}
+	if workflowID != "" && !strings.Contains(prefix, "{workflowId}") {
+		return Route{}, errWorkflowsNotListable
+	}
+	if workflowID == "" {
+		if i := strings.Index(prefix, "{workflowId}"); i >= 0 {
+			prefix = prefix[:i]
+		}
+	}
+	prefix = strings.NewReplacer("{workflowId}", workflowID, "{type}", templateType(typ)).Replace(prefix)
+
+	target := storageTargetForType(typ)
+	return Route{Bucket: target.Bucket, Key: target.objectKey(prefix)}, nil
+}
+
+// templateType is the {type} value: the capability without its -storage
+// suffix, "default" when none is given
+func templateType(typ string) string {
+	name := strings.TrimSuffix(capabilityName(typ), "-storage")
+	if name == "" {
+		return "default"
+	}
+	return name
+}
+
+// currentRouter returns the router selected by WORKFLOW_STORAGE_ROUTER:
+// "default" (or unset) or "template"
+func currentRouter() (Router, error) {
+	switch name := os.Getenv("WORKFLOW_STORAGE_ROUTER"); name {
+	case "", "default":
+		return defaultRouter{}, nil
+	case "template":
+		template := keyTemplate()
+		if !strings.Contains(template, "{identifier}") {
+			return nil, errInvalidKeyTemplate
+		}
+		return templateRouter{template: strings.TrimPrefix(template, "/")}, nil
+	default:
+		return nil, fmt.Errorf("unknown WORKFLOW_STORAGE_ROUTER %q (supported: default, template)", name)
+	}
+}
+
+// routerName returns the configured router name for /v1/api/config
+func routerName() string {
+	if name := os.Getenv("WORKFLOW_STORAGE_ROUTER"); name != "" {
+		return name
+	}
+	return "default"
+}
+
+// keyTemplate returns the key template when the template router is selected
+func keyTemplate() string {
+	if routerName() != "template" {
+		return ""
+	}
+	return os.Getenv("WORKFLOW_STORAGE_KEY_TEMPLATE")
+}
+
+// routerFor returns the configured router, with workflow IDs and identifiers
+// canonicalized (see WORKFLOW_STORAGE_KEY_NORMALIZATION) and confined to
+// tenant's namespace when tenant is set
+func routerFor(tenant string) (Router, error) {
+	router, err := currentRouter()
+	if err != nil {
+		return nil, err
+	}
+	if normalization := currentKeyNormalization(); normalization.enabled() {
+		router = normalizingRouter{Router: router, normalization: normalization}
+	}
+	env, err := environmentName()
+	if err != nil {
+		return nil, err
+	}
+	if env != "" {
+		router = environmentRouter{Router: router, env: env}
+	}
+	if tenant == "" {
+		return router, nil
+	}
+	return tenantRouter{Router: router, tenant: tenant}, nil
+}
+
+// routeResult resolves the location of a workflow result with the
+// configured router
+func routeResult(req RouteRequest) (Route, error) {
+	router, err := routerFor(req.Tenant)
+	if err != nil {
+		return Route{}, err
+	}
+	return router.Route(req)
+}
+
+// routeAction resolves the location of the result identified by identifier
+// for a semantic action: workflow from workflowIDFor, type and properties
+// from the action
+func routeAction(c echo.Context, action *semantic.SemanticAction, identifier, format string) (Route, error) {
+	req := RouteRequest{
+		WorkflowID: workflowIDFor(c, action),
+		Identifier: identifier,
+		Format:     format,
+		Type:       stringProperty(action, "type"),
+		Tenant:     tenantFor(c),
+	}
+	if action != nil {
+		req.Properties = action.Properties
+	}
+	return routeResult(req)
+}
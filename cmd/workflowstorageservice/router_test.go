@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestDefaultRouter_MatchesResultKey(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_TYPE_FOLDERS", "true")
+	t.Setenv("WORKFLOW_STORAGE_BUCKET_MAP", "data=large-blobs/team-a")
+
+	route, err := routeResult(RouteRequest{WorkflowID: "wf", Identifier: "step", Type: "data", Format: "text/csv"})
+	if err != nil {
+		t.Fatalf("routeResult() error = %v", err)
+	}
+	if route.Bucket != "large-blobs" || route.Key != "team-a/"+resultKey("wf", "step", "text/csv") {
+		t.Errorf("routeResult() = %+v", route)
+	}
+
+	list, err := defaultRouter{}.ListPrefix("wf", "")
+	if err != nil {
+		t.Fatalf("ListPrefix() error = %v", err)
+	}
+	if list.Bucket != defaultBucket() || list.Key != "workflow-results/wf/" {
+		t.Errorf("ListPrefix() = %+v", list)
+	}
+}
+
+func TestTemplateRouter(t *testing.T) {
+	resetStorageEnv(t)
+	router := templateRouter{template: "{type}/{workflowId}/{folder}/{identifier}{ext}"}
+
+	route, err := router.Route(RouteRequest{WorkflowID: "wf", Identifier: "step", Type: "document-storage", Format: "text/csv"})
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if route.Key != "document/wf/csv/step.csv" {
+		t.Errorf("Route() key = %q", route.Key)
+	}
+
+	tests := []struct {
+		workflowID string
+		want       string
+	}{
+		{"wf", "default/wf/"},
+		{"", "default/"},
+	}
+	for _, tt := range tests {
+		list, err := router.ListPrefix(tt.workflowID, "")
+		if err != nil {
+			t.Fatalf("ListPrefix() error = %v", err)
+		}
+		if list.Key != tt.want {
+			t.Errorf("ListPrefix(%q) = %q, want %q", tt.workflowID, list.Key, tt.want)
+		}
+	}
+}
+
+func TestRouter_ListPrefixNotListable(t *testing.T) {
+	resetStorageEnv(t)
+
+	sharded := templateRouter{template: "{shard}/{workflowId}/{identifier}{ext}"}
+	if _, err := sharded.ListPrefix("wf", ""); !errors.Is(err, errWorkflowsNotListable) {
+		t.Errorf("ListPrefix() with {shard} first: error = %v, want errWorkflowsNotListable", err)
+	}
+	unscoped := templateRouter{template: "results/{identifier}{ext}"}
+	if _, err := unscoped.ListPrefix("wf", ""); !errors.Is(err, errWorkflowsNotListable) {
+		t.Errorf("ListPrefix() without {workflowId}: error = %v, want errWorkflowsNotListable", err)
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_SHARD_KEYS", "true")
+	if _, err := (defaultRouter{}).ListPrefix("wf", ""); !errors.Is(err, errWorkflowsNotListable) {
+		t.Errorf("ListPrefix() with sharded keys: error = %v, want errWorkflowsNotListable", err)
+	}
+}
+
+func TestCurrentRouter_Config(t *testing.T) {
+	tests := []struct {
+		router   string
+		template string
+		wantErr  bool
+	}{
+		{"", "", false},
+		{"default", "", false},
+		{"template", "{workflowId}/{identifier}.json", false},
+		{"template", "{workflowId}/fixed.json", true},
+		{"hash", "", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("WORKFLOW_STORAGE_ROUTER", tt.router)
+		t.Setenv("WORKFLOW_STORAGE_KEY_TEMPLATE", tt.template)
+		if _, err := currentRouter(); (err != nil) != tt.wantErr {
+			t.Errorf("currentRouter(%q, %q) error = %v, wantErr %v", tt.router, tt.template, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTemplateRouter_StoreRetrieveList(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_ROUTER", "template")
+	t.Setenv("WORKFLOW_STORAGE_KEY_TEMPLATE", "runs/{workflowId}/{identifier}{ext}")
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(body string, handler func(echo.Context, *semantic.SemanticAction) error) *httptest.ResponseRecorder {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		if err := handler(c, action); err != nil {
+			t.Fatalf("%s failed: %v", body, err)
+		}
+		return rec
+	}
+
+	run(`{"@type": "CreateAction", "identifier": "step-1",
+		"object": {"@type": "DigitalDocument", "encodingFormat": "text/plain", "text": "hello"}}`, handleSemanticStoreImpl)
+	if _, ok := store.objects[defaultBucket()+"/runs/wf-1/step-1.txt"]; !ok {
+		t.Fatalf("Object not stored at the templated key, have %v", keysOf(store.objects))
+	}
+
+	rec := run(`{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "identifier": "step-1", "encodingFormat": "text/plain"}}`, handleSemanticRetrieveImpl)
+	if !strings.Contains(rec.Body.String(), "hello") {
+		t.Errorf("Retrieve returned %s", rec.Body.String())
+	}
+
+	rec = run(`{"@type": "ListAction", "workflowId": "wf-1"}`, handleSemanticListImpl)
+	if !strings.Contains(rec.Body.String(), "runs/wf-1/step-1.txt") {
+		t.Errorf("List did not return the templated key: %s", rec.Body.String())
+	}
+}
@@ -2,14 +2,15 @@ package main
 
 import (
 	"bytes"
-	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"eve.evalgo.org/semantic"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -17,34 +18,119 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// supportedActionTypes lists every action type registered at startup, in
+// registration order
+var supportedActionTypes []string
+
+// registerAction registers a handler with the service's action registry and
+// records the action type so it can be advertised to clients
+func registerAction(actionType string, handler actionHandler) {
+	serviceActions.mustRegister(actionType, handler)
+	supportedActionTypes = append(supportedActionTypes, actionType)
+}
+
+// registerActionsOnce guards registerActions; the registry rejects duplicates
+var registerActionsOnce sync.Once
+
+// registerActions registers every action handler with the service's action
+// registry (see serviceActions). This allows the service to handle semantic
+// actions without modifying switch statements.
+func registerActions() {
+	registerActionsOnce.Do(func() {
+		registerAction("UploadAction", handleSemanticStore)
+		registerAction("CreateAction", handleSemanticStore)
+		registerAction("StoreAction", handleSemanticStore)
+		registerAction("DownloadAction", handleSemanticRetrieve)
+		registerAction("RetrieveAction", handleSemanticRetrieve)
+		registerAction("FetchAction", handleSemanticRetrieve)
+		registerAction("UpdateAction", handleSemanticStore)
+		registerAction("DeleteAction", handleSemanticDelete)
+		registerAction("BatchRetrieveAction", handleSemanticBatchRetrieve)
+		registerAction("ChecksumAction", handleSemanticChecksum)
+		registerAction("TouchAction", handleSemanticTouch)
+		registerAction("ListAction", handleSemanticList)
+		registerAction("ListWorkflowsAction", handleSemanticListWorkflows)
+		registerAction("CopyAction", handleSemanticCopy)
+		registerAction("BundleStoreAction", handleSemanticBundleStore)
+		registerAction("BundleRetrieveAction", handleSemanticBundleRetrieve)
+		registerAction("DescribeAction", handleSemanticDescribe)
+		registerAction("ValidateAction", handleSemanticValidate)
+		registerAction("LockAction", handleSemanticLock)
+		registerAction("UnlockAction", handleSemanticUnlock)
+		registerAction("ArchiveAction", handleSemanticArchive)
+		registerAction("UpdateMetadataAction", handleSemanticUpdateMetadata)
+
+		// Deployment-specific names for the actions above
+		registerActionAliases()
+	})
+}
+
+// isSupportedActionType reports whether a handler is registered for actionType
+func isSupportedActionType(actionType string) bool {
+	for _, supported := range supportedActionTypes {
+		if supported == actionType {
+			return true
+		}
+	}
+	return false
+}
+
+// unsupportedActionMessage describes an unknown action type together with the
+// action types the service does accept
+func unsupportedActionMessage(actionType string) string {
+	return fmt.Sprintf("unsupported action type: %s (supported: %s)", actionType, strings.Join(supportedActionTypes, ", "))
+}
+
 func handleSemanticAction(c echo.Context) error {
-	// Parse semantic action
-	buf := new(bytes.Buffer)
-	if _, err := buf.ReadFrom(c.Request().Body); err != nil {
-		return semantic.ReturnActionError(c, nil, "Failed to read request body", err)
+	defer trackInflight()()
+	start := time.Now()
+
+	// Parse semantic action, bounded in size and nesting (see limits.go)
+	bodyBytes, err := readActionBody(c)
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		return returnActionError(c, nil, "Failed to read request body", err)
 	}
-	bodyBytes := buf.Bytes()
 
 	action, err := semantic.ParseSemanticAction(bodyBytes)
 	if err != nil {
-		return semantic.ReturnActionError(c, nil, "Failed to parse semantic action", err)
+		return returnActionError(c, nil, "Failed to parse semantic action", err)
 	}
+	// includeTimings reports where the action's time went on its result
+	var timings *actionTimings
+	if boolProperty(action, "includeTimings") {
+		timings = &actionTimings{start: start, parse: time.Since(start)}
+		c.Set(timingsContextKey, timings)
+	}
+	validateStart := time.Now()
 
-	// Dispatch to registered handler using the ActionRegistry
+	if !isSupportedActionType(action.Type) {
+		return returnActionError(c, action, unsupportedActionMessage(action.Type), nil)
+	}
+	// Read-only deployments reject writes here, for REST calls and batches too
+	if err := checkWritable(action.Type); err != nil {
+		return err
+	}
+	// Reads may be routed to an allowed replica endpoint
+	if err := selectEndpoint(c, action); err != nil {
+		return err
+	}
+	if timings != nil {
+		timings.validate = time.Since(validateStart)
+	}
+
+	// Dispatch to registered handler using the service-scoped registry
 	// No switch statement needed - handlers are registered at startup
-	return semantic.Handle(c, action)
+	return serviceActions.handle(c, action)
 }
 
 func handleSemanticStoreImpl(c echo.Context, action *semantic.SemanticAction) error {
-	// Extract workflow context from properties or headers
-	workflowID := c.Request().Header.Get("X-Workflow-ID")
-	if workflowID == "" {
-		workflowID = "default"
-	}
-
 	// Get data to store
 	if action.Object == nil {
-		return semantic.ReturnActionError(c, action, "object is required", nil)
+		return returnActionError(c, action, "object is required", nil)
 	}
 
 	var data string
@@ -52,115 +138,468 @@ func handleSemanticStoreImpl(c echo.Context, action *semantic.SemanticAction) er
 
 	if action.Object.Text != "" {
 		data = action.Object.Text
+	} else if encoded := stringProperty(action, "contentBase64"); encoded != "" {
+		// Binary payloads such as tar archives are sent base64 encoded
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return returnActionError(c, action, fmt.Sprintf("invalid contentBase64: %v", err), nil)
+		}
+		data = string(decoded)
 	} else if action.Object.ContentUrl != "" {
 		// TODO: Fetch from URL
-		return semantic.ReturnActionError(c, action, "fetching from contentUrl not yet implemented", nil)
+		return returnActionError(c, action, "fetching from contentUrl not yet implemented", nil)
 	}
 
 	format = action.Object.EncodingFormat
 	if format == "" {
 		format = "application/json"
 	}
+	if err := validateEncodingFormat(c, format); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 
-	if data == "" {
-		return semantic.ReturnActionError(c, action, "no data to store", nil)
+	// The original filename of an upload is kept for downloads
+	filename := stringProperty(action, "filename")
+	if filename != "" {
+		if err := validateFilename(filename); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 	}
 
-	// Store the data
-	bucket := os.Getenv("HETZNER_S3_BUCKET")
-	if bucket == "" {
-		bucket = "px-semantic"
+	// Each content type may have its own size limit
+	if err := checkObjectSize(format, len(data)); err != nil {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
 	}
 
-	key := fmt.Sprintf("workflow-results/%s/%s.json", workflowID, action.Identifier)
+	// retainUntil protects the result from changes until the given time
+	var retainUntil time.Time
+	if value := stringProperty(action, "retainUntil"); value != "" {
+		var err error
+		if retainUntil, err = parseRetainUntil(value); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
 
-	// Upload to S3
+	// Empty results are rejected unless the caller explicitly records them
+	if data == "" && !boolProperty(action, "allowEmpty") {
+		return returnActionError(c, action, "no data to store (set allowEmpty to store an empty object)", nil)
+	}
+
+	// Arrays of records are stored one JSON object per line
+	if isNDJSON(format) && data != "" {
+		normalized, err := normalizeNDJSON(data)
+		if err != nil {
+			return returnActionError(c, action, fmt.Sprintf("invalid NDJSON data: %v", err), nil)
+		}
+		data = normalized
+	}
+
+	// validateJson rejects malformed JSON before anything is uploaded
+	if boolProperty(action, "validateJson") && data != "" {
+		if folder, _ := typeFolder(format); folder != "json" {
+			return returnActionError(c, action, fmt.Sprintf("validateJson requires JSON data, not %s", format), nil)
+		}
+		if err := validateJSONStream(strings.NewReader(data)); err != nil {
+			return returnActionError(c, action, fmt.Sprintf("invalid JSON data: %v", err), nil)
+		}
+	}
+
+	// Configured secret paths are redacted on request before anything is persisted
+	redact := boolProperty(action, "redact")
+	var redacted []string
+	if redact {
+		paths := redactPaths()
+		if len(paths) == 0 {
+			return returnActionError(c, action, "redact requested but WORKFLOW_STORAGE_REDACT_PATHS is not configured", nil)
+		}
+		if folder, _ := typeFolder(format); folder != "json" {
+			return returnActionError(c, action, fmt.Sprintf("redact requires JSON data, not %s", format), nil)
+		}
+		var err error
+		data, redacted, err = redactJSON(data, paths)
+		if err != nil {
+			return returnActionError(c, action, fmt.Sprintf("invalid JSON data: %v", err), nil)
+		}
+	}
+
+	// Tar archives are stored as-is, with an index of their files
+	var tarIndex []tarEntry
+	if isTarFormat(format) {
+		entries, err := indexTar(strings.NewReader(data))
+		if err != nil {
+			return returnActionError(c, action, fmt.Sprintf("invalid tar archive: %v", err), nil)
+		}
+		tarIndex = entries
+	}
+
+	// Resolve bucket and key with the configured router from the workflow
+	// (properties or X-Workflow-ID header), identifier, format and type
+	route, err := routeAction(c, action, action.Identifier, format)
+	if err != nil {
+		return returnActionError(c, action, "Failed to resolve storage location", err)
+	}
+	bucket, key := route.Bucket, route.Key
+
+	// Serialize writes to the same object within this instance
+	unlock := objectLocks.Lock(bucket, key)
+	defer unlock()
+
+	// A producer that is still writing marks the result as in progress
+	inProgress := boolProperty(action, "inProgress")
+
+	// compress selects gzip or zstd; unknown algorithms store uncompressed
+	algorithm, unsupported := requestedCompression(action)
+	if unsupported != "" {
+		logf(c, "Ignoring unsupported compress %q (supported: %s), storing uncompressed", unsupported, compressionAlgorithms())
+	}
 	dataBytes := []byte(data)
-	_, err := s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
+	body, compression, err := compressPayload(algorithm, dataBytes)
+	if err != nil {
+		return returnActionError(c, action, "Failed to compress data", err)
+	}
+
+	// HTTP preconditions (If-Match, If-None-Match: *, ...) for compare-and-swap and create-if-absent;
+	// a failed precondition wins over skipIfUnchanged
+	if status, err := evaluatePreconditions(c.Request().Context(), c.Request(), storageFor(c), bucket, key); err != nil {
+		return returnActionError(c, action, "Failed to check existing object", err)
+	} else if status != 0 {
+		return preconditionError(http.StatusPreconditionFailed, key)
+	}
+
+	// Idempotent re-runs can skip writing identical content (and minting a new
+	// ETag); setting a retention period always needs a write
+	if boolProperty(action, "skipIfUnchanged") && !inProgress && retainUntil.IsZero() {
+		unchanged, err := storedUnchanged(c.Request().Context(), storageFor(c), bucket, key, []byte(data), format, boolProperty(action, "encrypt"), compression, boolProperty(action, "immutable"))
+		if err != nil {
+			return returnActionError(c, action, "Failed to check existing object", err)
+		}
+		if !unchanged {
+			dedupMetrics.recordMiss()
+		} else {
+			dedupMetrics.recordHit(int64(len(data)))
+			logf(c, "Skipped storing unchanged workflow result: %s", key)
+
+			action.Result = &semantic.SemanticResult{
+				Type:   "DigitalDocument",
+				Format: format,
+				Value: map[string]interface{}{
+					"contentUrl":     fmt.Sprintf("s3://%s/%s", bucket, key),
+					"encodingFormat": format,
+					"contentSize":    int64(len(data)),
+					"notModified":    true,
+				},
+			}
+
+			semantic.SetSuccessOnAction(action)
+			return respondAction(c, action)
+		}
+	}
+
+	// Updates and overwrites of immutable objects are rejected
+	if err := checkMutable(c.Request().Context(), c, storageFor(c), bucket, key); err != nil {
+		if errors.Is(err, errImmutable) {
+			return immutableConflict(key, err)
+		}
+		return returnActionError(c, action, "Failed to check existing object", err)
+	}
+	if err := checkLock(c.Request().Context(), c, storageFor(c), bucket, key, stringProperty(action, "lockOwner")); err != nil {
+		if errors.Is(err, errLocked) {
+			return lockedResponse(key, err)
+		}
+		return returnActionError(c, action, "Failed to check lock", err)
+	}
+
+	// returnPrevious hands back the content being overwritten, e.g. for rollback
+	returnPrevious := boolProperty(action, "returnPrevious")
+	var previous map[string]interface{}
+	if returnPrevious {
+		if previous, err = previousContent(c.Request().Context(), storageFor(c), action, bucket, key); err != nil {
+			return returnActionError(c, action, "Failed to read previous content", err)
+		}
+	}
+
+	// Optionally encrypt the (compressed) payload before it leaves the service
+	var metadata map[string]string
+	encrypt := boolProperty(action, "encrypt")
+	if encrypt {
+		body, metadata, err = encryptPayload(body)
+		if err != nil {
+			return returnActionError(c, action, "Failed to encrypt data", err)
+		}
+	}
+	metadata = withChecksum(metadata, dataBytes)
+	if compression != "" {
+		metadata[metadataCompression] = compression
+	}
+	immutable := boolProperty(action, "immutable")
+	if immutable {
+		metadata[metadataImmutable] = "true"
+	}
+	if !retainUntil.IsZero() {
+		metadata[metadataRetainUntil] = retainUntil.Format(time.RFC3339)
+	}
+	if inProgress {
+		metadata[metadataInProgress] = "true"
+	}
+	if isTarFormat(format) {
+		metadata = withTarIndex(metadata, tarIndex)
+	}
+	if currentKeyNormalization().enabled() {
+		metadata[metadataIdentifier] = canonicalIdentifier(action.Identifier)
+	}
+	if filename != "" {
+		metadata = withFilename(metadata, filename)
+	}
+
+	// With versioning every store gets its own key; key then receives a
+	// copy of it as the latest version. keepVersions prunes older ones.
+	keep, err := keepVersions(action)
+	if err != nil {
+		return err
+	}
+	uploadKey := key
+	var version string
+	if versioningEnabled() || keep > 0 {
+		if version, err = newVersion(c.Request().Context(), storageFor(c), bucket, key); err != nil {
+			return returnActionError(c, action, "Failed to pick a version", err)
+		}
+		uploadKey = versionedKey(key, version)
+	}
+
+	// Upload to S3
+	put, err := storageFor(c).PutObject(c.Request().Context(), &s3.PutObjectInput{
 		Bucket:      aws.String(bucket),
-		Key:         aws.String(key),
-		Body:        bytes.NewReader(dataBytes),
+		Key:         aws.String(uploadKey),
+		Body:        bytes.NewReader(body),
 		ContentType: aws.String(format),
+		Metadata:    metadata,
 	})
 	if err != nil {
-		log.Printf("Failed to upload to S3: %v", err)
-		return semantic.ReturnActionError(c, action, "Failed to store data", err)
+		logf(c, "Failed to upload to S3: %v", err)
+		return returnActionError(c, action, "Failed to store data", err)
+	}
+	missingObjects.forget(bucket, uploadKey)
+	resultCache.forget(bucket, uploadKey)
+	if version != "" {
+		if err := promoteVersion(c.Request().Context(), storageFor(c), bucket, key, uploadKey); err != nil {
+			logf(c, "Failed to promote %s to latest: %v", uploadKey, err)
+			return returnActionError(c, action, "Failed to update the latest version", err)
+		}
+	}
+	versionCount, pruned := -1, 0
+	if keep > 0 {
+		// The new version is stored either way, so pruning failures are only logged
+		if versionCount, pruned, err = pruneVersions(c.Request().Context(), c, storageFor(c), bucket, key, keep); err != nil {
+			logf(c, "Failed to prune versions of %s: %v", key, err)
+			versionCount = -1
+		}
 	}
 
-	log.Printf("Stored workflow result via semantic action: %s (size: %d bytes)", key, len(dataBytes))
+	logf(c, "Stored workflow result via semantic action: %s (size: %d bytes, stored: %d bytes, encrypted: %t)", uploadKey, len(dataBytes), len(body), encrypt)
 
 	// Use semantic Result structure
+	value := map[string]interface{}{
+		"contentUrl":     fmt.Sprintf("s3://%s/%s", bucket, uploadKey),
+		"encodingFormat": format,
+		"contentSize":    int64(len(dataBytes)),
+		"encrypted":      encrypt,
+		"immutable":      immutable,
+		"inProgress":     inProgress,
+	}
+	if etag := aws.ToString(put.ETag); etag != "" {
+		value["etag"] = etag
+	}
+	if compression != "" {
+		value["compression"] = compression
+		value["storedSize"] = int64(len(body))
+	}
+	if identifier, ok := metadata[metadataIdentifier]; ok {
+		value["identifier"] = identifier
+	}
+	if filename != "" {
+		value["filename"] = filename
+	}
+	if !retainUntil.IsZero() {
+		value["retainUntil"] = retainUntil.Format(time.RFC3339)
+	}
+	if redact {
+		value["redactedPaths"] = append([]string{}, redacted...)
+	}
+	if returnPrevious {
+		value["previous"] = previous
+	}
+	if version != "" {
+		value["version"] = version
+		value["latestUrl"] = fmt.Sprintf("s3://%s/%s", bucket, key)
+	}
+	if versionCount >= 0 {
+		value["versionCount"] = versionCount
+		value["prunedVersions"] = pruned
+		// Older versions that pruning had to keep (immutable, retained or
+		// failed to delete) are why versionCount can exceed keepVersions
+		value["retainedVersions"] = max(int64(versionCount)-keep, 0)
+	}
 	action.Result = &semantic.SemanticResult{
 		Type:   "DigitalDocument",
 		Format: format,
-		Value: map[string]interface{}{
-			"contentUrl":     fmt.Sprintf("s3://%s/%s", bucket, key),
-			"encodingFormat": format,
-			"contentSize":    int64(len(dataBytes)),
-		},
+		Value:  value,
 	}
 
 	semantic.SetSuccessOnAction(action)
-	return c.JSON(http.StatusOK, action)
+	return respondActionStatus(c, storeSuccessStatus(), action)
 }
 
 func handleSemanticRetrieveImpl(c echo.Context, action *semantic.SemanticAction) error {
 	// Extract s3:// URL from object
 	if action.Object == nil {
-		return semantic.ReturnActionError(c, action, "object is required", nil)
+		return returnActionError(c, action, "object is required", nil)
 	}
 
+	// Resolve bucket and key from the s3:// URL, or route them from the
+	// identifier the same way the store side did
 	contentURL := action.Object.ContentUrl
+	var bucket, key string
 	if contentURL == "" {
-		return semantic.ReturnActionError(c, action, "object.contentUrl is required (resource s3:// location)", nil)
+		identifier := action.Object.Identifier
+		if identifier == "" {
+			identifier = action.Identifier
+		}
+		if identifier == "" {
+			return returnActionError(c, action, "object.contentUrl or object.identifier is required", nil)
+		}
+		route, err := routeAction(c, action, identifier, action.Object.EncodingFormat)
+		if err != nil {
+			return returnActionError(c, action, "Failed to resolve storage location", err)
+		}
+		bucket, key = route.Bucket, route.Key
+		// version selects an earlier write of a versioned result
+		version, err := versionRequested(action)
+		if err != nil {
+			return err
+		}
+		if version != "" {
+			key = versionedKey(key, version)
+		}
+		contentURL = fmt.Sprintf("s3://%s/%s", bucket, key)
+	} else {
+		if stringProperty(action, "version") != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "version requires object.identifier")
+		}
+		var err error
+		bucket, key, err = parseContentURL(contentURL)
+		if err != nil {
+			return returnActionError(c, action, err.Error(), nil)
+		}
+		if err := checkTenantScope(c, key); err != nil {
+			return err
+		}
 	}
 
-	// Parse s3:// URL
-	// Format: s3://bucket/workflow-results/workflowId/actionId.json
-	if len(contentURL) < 6 || contentURL[:5] != "s3://" {
-		return semantic.ReturnActionError(c, action, "only s3:// URLs supported", nil)
+	// Objects not yet migrated are read from the fallback buckets, whatever
+	// the retrieve mode
+	servedBy, err := servingBucket(c.Request().Context(), storageFor(c), bucket, key)
+	if err != nil {
+		logf(c, "Failed to fetch %s: %v", key, err)
+		return returnFetchError(c, action, err)
+	}
+	fallback := servedBy != bucket
+	if fallback {
+		logf(c, "Served %s from fallback bucket %s", key, servedBy)
+		bucket, contentURL = servedBy, fmt.Sprintf("s3://%s/%s", servedBy, key)
 	}
 
-	// Remove s3://bucket/ prefix to get key
-	parts := strings.Split(contentURL[5:], "/")
-	if len(parts) < 2 {
-		return semantic.ReturnActionError(c, action, "invalid s3 URL format", nil)
+	// metadataOnly describes the object without downloading its body
+	if boolProperty(action, "metadataOnly") {
+		return retrieveMetadataOnly(c, action, bucket, key, contentURL, fallback)
 	}
 
-	key := strings.Join(parts[1:], "/")
+	// Browser dashboards can consume records as Server-Sent Events
+	if acceptsEventStream(c.Request()) {
+		return streamEvents(c, action, bucket, key)
+	}
 
-	// Fetch data from S3 directly
-	bucket := os.Getenv("HETZNER_S3_BUCKET")
-	if bucket == "" {
-		bucket = "px-semantic"
+	// NDJSON results are streamed record by record on request
+	if acceptsNDJSON(c.Request()) {
+		return streamNDJSON(c, action, bucket, key)
 	}
 
-	// Download from S3
-	result, err := s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
-	if err != nil {
-		log.Printf("Failed to fetch from S3: %v", err)
-		return semantic.ReturnActionError(c, action, "data not found", err)
+	// Tar archives can be listed, or a single member streamed out of them
+	if name := stringProperty(action, "tarEntry"); name != "" {
+		return streamTarEntry(c, action, bucket, key, name)
+	}
+	if boolProperty(action, "listEntries") {
+		return listTarEntries(c, action, bucket, key, contentURL, fallback)
+	}
+
+	// Large JSON arrays can be paged server-side
+	if wantsArrayPage(action) {
+		return retrieveArrayPage(c, action, bucket, key, contentURL, fallback)
+	}
+
+	// Tailing a growing result must not be answered from the result cache
+	allowPartial := boolProperty(action, "allowPartial")
+	if allowPartial {
+		resultCache.forget(bucket, key)
 	}
-	defer func() {
-		if err := result.Body.Close(); err != nil {
-			log.Printf("Failed to close S3 response body: %v", err)
+
+	// forceContentType corrects mislabeled objects (e.g. stored with the
+	// application/json default) at read time
+	forceContentType := stringProperty(action, "forceContentType")
+	if forceContentType != "" {
+		if err := parseEncodingFormat(forceContentType); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "forceContentType: "+err.Error())
 		}
-	}()
+	}
 
-	data, err := io.ReadAll(result.Body)
+	// inlineCompress returns inline data compressed and base64 encoded
+	inlineCompress, err := inlineCompression(action)
 	if err != nil {
-		return semantic.ReturnActionError(c, action, "failed to read data", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	contentType := "application/json"
-	if result.ContentType != nil {
-		contentType = *result.ContentType
+	obj, err := fetchObject(c.Request().Context(), storageFor(c), bucket, key)
+	if err != nil {
+		logf(c, "Failed to fetch %s: %v", key, err)
+		return returnFetchError(c, action, err)
+	}
+	data, contentType := obj.data, obj.contentType
+	if forceContentType != "" {
+		debugf(c, "Overriding stored Content-Type %s of %s with %s", contentType, key, forceContentType)
+		contentType = forceContentType
 	}
 
-	log.Printf("Fetched workflow result via semantic action: %s (size: %d bytes)", key, len(data))
+	partial := isInProgress(obj.metadata)
+	if partial && !allowPartial {
+		return stillWritingConflict(key)
+	}
+
+	// Optional CSV <-> JSON conversion, driven by the Accept header
+	if boolProperty(action, "convert") {
+		if target := conversionTarget(c.Request().Header.Get(echo.HeaderAccept), contentType); target != "" {
+			converted, err := convertData(data, target)
+			if err != nil {
+				return returnActionError(c, action, "failed to convert data", err)
+			}
+			data, contentType = converted, target
+		}
+	}
+
+	// Optional server-side re-encoding, e.g. stored gzip returned plain
+	if target := stringProperty(action, "transcodeTo"); target != "" {
+		transcoded, transcodedType, err := transcodeData(data, contentType, target)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		data, contentType = transcoded, transcodedType
+	}
+
+	logf(c, "Fetched workflow result via semantic action: %s (size: %d bytes)", key, len(data))
+
+	// Small results can be returned as a self-contained data: URI
+	wantDataURI := wantsDataURI(action)
+	if limit := maxDataURIBytes(); wantDataURI && int64(len(data)) > limit {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("object is too large for a data: URI (%d bytes, max %d); use contentUrl instead", len(data), limit))
+	}
 
 	// Check if result should be written to file
 	var outputFile string
@@ -169,7 +608,7 @@ func handleSemanticRetrieveImpl(c echo.Context, action *semantic.SemanticAction)
 	if action.Properties != nil {
 		if of, ok := action.Properties["outputFile"].(string); ok {
 			outputFile = of
-			log.Printf("DEBUG: Found outputFile in Properties: %s", outputFile)
+			debugf(c, "Found outputFile in Properties: %s", outputFile)
 		}
 	}
 
@@ -181,25 +620,45 @@ func handleSemanticRetrieveImpl(c echo.Context, action *semantic.SemanticAction)
 		}
 	}
 
-	// Write to file if outputFile is specified or outputType is "file"
-	if outputFile != "" || outputType == "file" {
+	// Pick the result shape: data: URI, file (outputFile or outputType
+	// "file"), preview of an oversized result, or inline
+	if wantDataURI {
+		action.Result = &semantic.SemanticResult{
+			Type:   "DigitalDocument",
+			Format: contentType,
+			Value: map[string]interface{}{
+				"contentUrl":     dataURI(data, contentType),
+				"sourceUrl":      contentURL,
+				"encodingFormat": contentType,
+				"contentSize":    int64(len(data)),
+			},
+		}
+	} else if outputFile != "" || outputType == "file" {
 		// If no outputFile specified but outputType is "file", generate a default path
 		if outputFile == "" {
-			outputFile = fmt.Sprintf("/tmp/%s-result.dat", action.Identifier)
+			outputFile = fmt.Sprintf("%s-result.dat", action.Identifier)
+		}
+		resolved, err := resolveOutputFile(outputBaseDir(), outputFile)
+		if err != nil {
+			logf(c, "Rejected outputFile %q: %v", outputFile, err)
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
+		outputFile = resolved
 
 		// Ensure parent directory exists
 		dir := filepath.Dir(outputFile)
 		if err := os.MkdirAll(dir, 0755); err != nil {
-			return semantic.ReturnActionError(c, action, "Failed to create output directory", err)
+			return returnActionError(c, action, "Failed to create output directory", err)
 		}
 
-		// Write result to file
-		if err := os.WriteFile(outputFile, data, 0644); err != nil {
-			return semantic.ReturnActionError(c, action, "Failed to write result to file", err)
+		// Write result to file, reporting what actually reached the disk
+		written, err := writeOutputFile(outputFile, data)
+		if err != nil {
+			logf(c, "Failed to write %s (%d of %d bytes written): %v", outputFile, written, len(data), err)
+			return returnActionError(c, action, "Failed to write result to file", err)
 		}
 
-		log.Printf("Wrote workflow result to file: %s", outputFile)
+		logf(c, "Wrote workflow result to file: %s (%d bytes)", outputFile, written)
 
 		// Use semantic Result structure for file output
 		action.Result = &semantic.SemanticResult{
@@ -208,7 +667,53 @@ func handleSemanticRetrieveImpl(c echo.Context, action *semantic.SemanticAction)
 			Value: map[string]interface{}{
 				"contentUrl":     outputFile,
 				"encodingFormat": contentType,
-				"contentSize":    int64(len(data)),
+				"contentSize":    written,
+			},
+		}
+	} else if limit := maxInlineBytes(action); int64(len(data)) > limit {
+		// Oversized results return a preview plus a link instead of the full payload
+		preview := previewBytes(data, limit)
+		value := map[string]interface{}{
+			"contentSize":    int64(len(data)),
+			"contentUrl":     contentURL,
+			"truncated":      true,
+			"previewSize":    int64(len(preview)),
+			"maxInlineBytes": limit,
+		}
+
+		// Presigned URLs would expose ciphertext or compressed bytes
+		if !isEncoded(obj.metadata) {
+			downloadURL, err := presignGetURL(c.Request().Context(), storageFor(c), bucket, key)
+			if err != nil {
+				logf(c, "Failed to presign %s: %v", key, err)
+			} else {
+				value["downloadUrl"] = downloadURL
+				value["downloadUrlExpiresIn"] = int64(presignedURLExpiry.Seconds())
+			}
+		}
+
+		action.Result = &semantic.SemanticResult{
+			Type:   "Dataset",
+			Format: contentType,
+			Output: string(preview),
+			Value:  value,
+		}
+	} else if inlineCompress != "" {
+		// Compressed inline result; outputCompression and outputEncoding
+		// tell the client how to restore the data
+		output, compressedSize, err := compressInline(inlineCompress, data)
+		if err != nil {
+			return returnActionError(c, action, "Failed to compress data", err)
+		}
+		action.Result = &semantic.SemanticResult{
+			Type:   "Dataset",
+			Format: contentType,
+			Output: output,
+			Value: map[string]interface{}{
+				"contentSize":       int64(len(data)),
+				"compressedSize":    int64(compressedSize),
+				"outputCompression": inlineCompress,
+				"outputEncoding":    "base64",
 			},
 		}
 	} else {
@@ -223,8 +728,132 @@ func handleSemanticRetrieveImpl(c echo.Context, action *semantic.SemanticAction)
 		}
 	}
 
+	if partial {
+		markPartial(action.Result)
+	}
+	if value, ok := action.Result.Value.(map[string]interface{}); ok {
+		if filename := filenameFromMetadata(obj.metadata); filename != "" {
+			value["filename"] = filename
+		}
+		if expires := setExpiryHeaders(c, obj.metadata); expires != "" {
+			value["expires"] = expires
+		}
+		if obj.etag != "" {
+			value["etag"] = obj.etag
+		}
+		reportServingBucket(value, bucket, fallback)
+	}
+	accessLog.record(c, bucket, key)
+
 	semantic.SetSuccessOnAction(action)
-	return c.JSON(http.StatusOK, action)
+	return respondAction(c, action)
+}
+
+// jsonLDContext is the default @context of semantic responses
+const jsonLDContext = "https://schema.org"
+
+// respondAction writes a completed action in the naming convention the
+// client asked for (see responseNamingFor). Clients sending
+// Accept: application/ld+json receive that media type and a guaranteed
+// @context so JSON-LD processors can consume the response directly.
+func respondAction(c echo.Context, action *semantic.SemanticAction) error {
+	return respondActionStatus(c, http.StatusOK, action)
+}
+
+// respondActionStatus is respondAction with a success status other than 200
+func respondActionStatus(c echo.Context, status int, action *semantic.SemanticAction) error {
+	addTimings(c, action)
+	if err := respondJSON(c, status, action); err != nil {
+		return returnActionError(c, action, "Failed to encode response", err)
+	}
+	return nil
+}
+
+// acceptsJSONLD reports whether the client asked for application/ld+json
+func acceptsJSONLD(r *http.Request) bool {
+	return strings.Contains(r.Header.Get(echo.HeaderAccept), "application/ld+json")
+}
+
+// workflowIDFor returns the workflow an action belongs to, taken from the
+// workflowId property or the X-Workflow-ID header, defaulting to "default"
+func workflowIDFor(c echo.Context, action *semantic.SemanticAction) string {
+	if action != nil && action.Properties != nil {
+		if workflowID, ok := action.Properties["workflowId"].(string); ok && workflowID != "" {
+			return workflowID
+		}
+	}
+	if workflowID := c.Request().Header.Get("X-Workflow-ID"); workflowID != "" {
+		return workflowID
+	}
+	return "default"
+}
+
+// parseContentURL splits an s3://bucket/key URL like parseS3URL and rejects
+// buckets that are not among configuredBuckets, so a contentUrl can never
+// reach a bucket the service does not manage
+func parseContentURL(contentURL string) (string, string, error) {
+	bucket, key, err := parseS3URL(contentURL)
+	if err != nil {
+		return "", "", err
+	}
+	if !isConfiguredBucket(bucket) {
+		return "", "", fmt.Errorf("bucket %q is not managed by this service", bucket)
+	}
+	return bucket, key, nil
+}
+
+// boolProperty reads a boolean flag from the action's additional properties
+func boolProperty(action *semantic.SemanticAction, name string) bool {
+	if action == nil || action.Properties == nil {
+		return false
+	}
+	value, ok := action.Properties[name].(bool)
+	return ok && value
+}
+
+// stringProperty reads a string from the action's additional properties
+func stringProperty(action *semantic.SemanticAction, name string) string {
+	if action == nil || action.Properties == nil {
+		return ""
+	}
+	value, _ := action.Properties[name].(string)
+	return value
+}
+
+// int64Property reads a numeric property from the action's additional
+// properties. JSON numbers decode as float64, so fractional values are truncated.
+func int64Property(action *semantic.SemanticAction, name string) (int64, bool) {
+	if action == nil || action.Properties == nil {
+		return 0, false
+	}
+	switch value := action.Properties[name].(type) {
+	case float64:
+		return int64(value), true
+	case int:
+		return int64(value), true
+	case int64:
+		return value, true
+	}
+	return 0, false
+}
+
+// stringListProperty reads a list of strings from the action's additional
+// properties, skipping non-string entries
+func stringListProperty(action *semantic.SemanticAction, name string) []string {
+	if action == nil || action.Properties == nil {
+		return nil
+	}
+	raw, ok := action.Properties[name].([]interface{})
+	if !ok {
+		return nil
+	}
+	values := make([]string, 0, len(raw))
+	for _, item := range raw {
+		if value, ok := item.(string); ok && value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
 }
 
 // handleSemanticStore wraps the implementation to match ActionHandler signature
@@ -244,3 +873,12 @@ func handleSemanticRetrieve(c echo.Context, actionInterface interface{}) error {
 	}
 	return handleSemanticRetrieveImpl(c, action)
 }
+
+// handleSemanticBatchRetrieve wraps the implementation to match ActionHandler signature
+func handleSemanticBatchRetrieve(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticBatchRetrieveImpl(c, action)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxSemanticBatchActions caps the number of actions in one batch request
+const maxSemanticBatchActions = 100
+
+// handleSemanticBatch handles POST /v1/api/semantic/batch. The body is a JSON
+// array of JSON-LD actions, each dispatched through handleSemanticAction in
+// order. The response lists one entry per action with its HTTP status and
+// result or error. With ?stopOnError=true, processing stops at the first
+// failed action and the remaining actions are reported as skipped.
+//
+// Actions are not transactional: earlier writes are kept when a later action
+// fails.
+func handleSemanticBatch(c echo.Context) error {
+	// Each action is checked again when dispatched; the batch as a whole is
+	// bounded by the same limits
+	body, err := readLimitedBody(c)
+	if err == nil {
+		err = checkJSONDepth(body)
+	}
+	var limitErr *payloadLimitError
+	if errors.As(err, &limitErr) {
+		return c.JSON(limitErr.status, map[string]string{"error": limitErr.message})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "failed to read request body"})
+	}
+
+	var actions []json.RawMessage
+	if err := json.Unmarshal(body, &actions); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "body must be a JSON array of semantic actions"})
+	}
+	if len(actions) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "at least one action is required"})
+	}
+	if len(actions) > maxSemanticBatchActions {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "too many actions (max " + strconv.Itoa(maxSemanticBatchActions) + ")"})
+	}
+
+	stopOnError := c.QueryParam("stopOnError") == "true"
+
+	results := make([]map[string]interface{}, 0, len(actions))
+	succeeded, failed := 0, 0
+	stopped := false
+	for i, raw := range actions {
+		entry := map[string]interface{}{"index": i}
+		if stopped {
+			entry["skipped"] = true
+			results = append(results, entry)
+			continue
+		}
+
+		actionCtx := derivedContext(c, raw)
+		status, result, err := bufferedSemanticCall(c, actionCtx)
+		if err != nil {
+			status, result = http.StatusInternalServerError, map[string]interface{}{"error": err.Error()}
+		}
+		entry["status"] = status
+
+		if status >= http.StatusBadRequest {
+			failed++
+			entry["error"] = result
+			stopped = stopOnError
+		} else {
+			succeeded++
+			entry["result"] = result
+		}
+		results = append(results, entry)
+	}
+
+	logf(c, "Processed semantic batch: %d succeeded, %d failed, %d skipped", succeeded, failed, len(actions)-succeeded-failed)
+
+	return respondJSON(c, http.StatusOK, map[string]interface{}{
+		"results":   results,
+		"succeeded": succeeded,
+		"failed":    failed,
+		"skipped":   len(actions) - succeeded - failed,
+	})
+}
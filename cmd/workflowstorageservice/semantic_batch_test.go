@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestSemanticBatch(t *testing.T) {
+	resetStorageEnv(t)
+	registerActions()
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	batch := `[
+		{"@type": "CreateAction", "identifier": "a", "object": {"@type": "DigitalDocument", "text": "{\"a\": 1}"}},
+		{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "identifier": "missing"}},
+		{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "identifier": "a"}}
+	]`
+
+	run := func(target string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(batch))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		if err := handleSemanticBatch(c); err != nil {
+			t.Fatalf("handleSemanticBatch() error = %v", err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return response
+	}
+
+	response := run("/v1/api/semantic/batch")
+	if response["succeeded"] != float64(2) || response["failed"] != float64(1) || response["skipped"] != float64(0) {
+		t.Errorf("Unexpected counts: %v", response)
+	}
+	results := response["results"].([]interface{})
+	if _, ok := results[1].(map[string]interface{})["error"]; !ok {
+		t.Errorf("Expected the missing retrieve to report an error, got %v", results[1])
+	}
+	if _, ok := results[2].(map[string]interface{})["result"]; !ok {
+		t.Errorf("Expected the last retrieve to succeed, got %v", results[2])
+	}
+
+	response = run("/v1/api/semantic/batch?stopOnError=true")
+	if response["succeeded"] != float64(1) || response["failed"] != float64(1) || response["skipped"] != float64(1) {
+		t.Errorf("Unexpected counts with stopOnError: %v", response)
+	}
+}
+
+func TestSemanticBatch_KeepsRequestID(t *testing.T) {
+	resetStorageEnv(t)
+	registerActions()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/batch",
+		strings.NewReader(`[{"@type": "LaunchRocketAction"}]`))
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	// Set by the RequestID middleware on the batch response
+	c.Response().Header().Set(echo.HeaderXRequestID, "req-batch")
+	c.Set(storageContextKey, newFakeStorage())
+	if err := handleSemanticBatch(c); err != nil {
+		t.Fatalf("handleSemanticBatch() error = %v", err)
+	}
+	if !strings.Contains(rec.Body.String(), "req-batch") {
+		t.Errorf("Batch error does not carry the request ID: %s", rec.Body.String())
+	}
+}
+
+func TestSemanticBatch_RejectsNonArray(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/batch", strings.NewReader(`{"@type": "CreateAction"}`))
+	rec := httptest.NewRecorder()
+	if err := handleSemanticBatch(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handleSemanticBatch() error = %v", err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/labstack/echo/v4"
+)
+
+// eventStreamContentType is the media type of Server-Sent Events
+const eventStreamContentType = "text/event-stream"
+
+// acceptsEventStream reports whether the client asked for Server-Sent Events
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get(echo.HeaderAccept), eventStreamContentType)
+}
+
+// ndjsonRecords returns a reader of the non-empty lines of an NDJSON body
+func ndjsonRecords(body io.Reader) func() ([]byte, error) {
+	reader := bufio.NewReader(body)
+	return func() ([]byte, error) {
+		for {
+			line, err := reader.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				return line, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// arrayRecords returns a reader of the elements of a JSON array body. The
+// opening bracket is read up front, so a result that is not an array is
+// rejected before the stream starts.
+func arrayRecords(body io.Reader) (func() ([]byte, error), error) {
+	dec := json.NewDecoder(body)
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("not a JSON array")
+	}
+	return func() ([]byte, error) {
+		if !dec.More() {
+			// A truncated array fails here rather than ending the stream early
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		var record json.RawMessage
+		if err := dec.Decode(&record); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}, nil
+}
+
+// writeEvent writes one Server-Sent Event and flushes it to the client.
+// data must be a single line, e.g. compact JSON.
+func writeEvent(w *echo.Response, event, id string, data []byte) error {
+	var b bytes.Buffer
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", event, data)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
+
+// streamEvents writes the records of a stored NDJSON object or JSON array as
+// Server-Sent Events, one "record" event per record with its 1-based index as
+// id, followed by an "end" event with the record count. A read failure after
+// the stream started is reported as an "error" event. Streaming stops when
+// the client disconnects.
+func streamEvents(c echo.Context, action *semantic.SemanticAction, bucket, key string) error {
+	result, body, err := openStream(c, action, bucket, key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := result.Body.Close(); err != nil {
+			logf(c, "Failed to close S3 response body: %v", err)
+		}
+	}()
+
+	contentType := aws.ToString(result.ContentType)
+	var next func() ([]byte, error)
+	switch folder, _ := typeFolder(contentType); folder {
+	case "ndjson":
+		next = ndjsonRecords(body)
+	case "json":
+		if next, err = arrayRecords(body); err != nil {
+			return returnActionError(c, action, fmt.Sprintf("event streams need NDJSON or a JSON array: %v", err), nil)
+		}
+	default:
+		return returnActionError(c, action, fmt.Sprintf("object is %s; event streams need NDJSON or a JSON array", contentType), nil)
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, eventStreamContentType)
+	header.Set(echo.HeaderCacheControl, "no-cache")
+	// Keep reverse proxies such as nginx from buffering the stream
+	header.Set("X-Accel-Buffering", "no")
+	c.Response().WriteHeader(http.StatusOK)
+
+	ctx := c.Request().Context()
+	records := 0
+	for {
+		if ctx.Err() != nil {
+			logf(c, "Client disconnected after %d events from %s", records, key)
+			return nil
+		}
+		record, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var compact bytes.Buffer
+		if err == nil {
+			err = json.Compact(&compact, record)
+		}
+		if err != nil {
+			// Headers are already sent; the error event marks the stream incomplete
+			logf(c, "Failed to read %s after %d records: %v", key, records, err)
+			if werr := writeEvent(c.Response(), "error", "", []byte(`{"error":"failed to read data"}`)); werr != nil {
+				logf(c, "Failed to stream %s: %v", key, werr)
+			}
+			return nil
+		}
+		records++
+		if err := writeEvent(c.Response(), "record", strconv.Itoa(records), compact.Bytes()); err != nil {
+			logf(c, "Failed to stream %s: %v", key, err)
+			return nil
+		}
+	}
+	if err := writeEvent(c.Response(), "end", "", []byte(fmt.Sprintf(`{"records":%d}`, records))); err != nil {
+		logf(c, "Failed to stream %s: %v", key, err)
+		return nil
+	}
+
+	accessLog.record(c, bucket, key)
+	logf(c, "Streamed %d events from %s", records, key)
+	return nil
+}
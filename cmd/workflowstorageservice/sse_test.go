@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"workflowstorageservice.evalgo.org/actions"
+)
+
+func TestSemanticRetrieve_StreamsEvents(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+	store.objects["px-semantic/workflow-results/wf-1/rows.json"] = fakeObject{
+		data:        []byte("{\"a\": 1}\n\n{\"b\": [2, 3]}\n"),
+		contentType: ndjsonContentType,
+	}
+	store.objects["px-semantic/workflow-results/wf-1/array.json"] = fakeObject{
+		data:        []byte(`[{"a": 1}, "two", 3]`),
+		contentType: "application/json",
+	}
+	store.objects["px-semantic/workflow-results/wf-1/object.json"] = fakeObject{
+		data:        []byte(`{"not": "an array"}`),
+		contentType: "application/json",
+	}
+	store.objects["px-semantic/workflow-results/wf-1/truncated.json"] = fakeObject{
+		data:        []byte(`[{"a": 1}, {"b"`),
+		contentType: "application/json",
+	}
+
+	stream := func(ctx context.Context, identifier string) (*httptest.ResponseRecorder, error) {
+		t.Helper()
+		action, err := actions.NewRetrieveAction().WithWorkflowID("wf-1").WithObjectIdentifier(identifier).Action()
+		if err != nil {
+			t.Fatalf("Action() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil).WithContext(ctx)
+		req.Header.Set(echo.HeaderAccept, eventStreamContentType)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		return rec, handleSemanticRetrieveImpl(c, action)
+	}
+
+	for identifier, want := range map[string]string{
+		"rows": "id: 1\nevent: record\ndata: {\"a\":1}\n\n" +
+			"id: 2\nevent: record\ndata: {\"b\":[2,3]}\n\n" +
+			"event: end\ndata: {\"records\":2}\n\n",
+		"array": "id: 1\nevent: record\ndata: {\"a\":1}\n\n" +
+			"id: 2\nevent: record\ndata: \"two\"\n\n" +
+			"id: 3\nevent: record\ndata: 3\n\n" +
+			"event: end\ndata: {\"records\":3}\n\n",
+		"truncated": "id: 1\nevent: record\ndata: {\"a\":1}\n\n" +
+			"event: error\ndata: {\"error\":\"failed to read data\"}\n\n",
+	} {
+		rec, err := stream(context.Background(), identifier)
+		if err != nil {
+			t.Fatalf("%s: stream error = %v", identifier, err)
+		}
+		if got := rec.Header().Get(echo.HeaderContentType); got != eventStreamContentType {
+			t.Errorf("%s: Content-Type = %q", identifier, got)
+		}
+		if !rec.Flushed {
+			t.Errorf("%s: events were not flushed", identifier)
+		}
+		if rec.Body.String() != want {
+			t.Errorf("%s: body = %q, want %q", identifier, rec.Body.String(), want)
+		}
+	}
+
+	// Only arrays and NDJSON can be streamed
+	if rec, err := stream(context.Background(), "object"); err == nil && rec.Code == http.StatusOK {
+		t.Error("Streaming a JSON object should fail")
+	}
+
+	// A disconnected client stops the stream before any record is sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec, err := stream(ctx, "rows")
+	if err != nil || strings.Contains(rec.Body.String(), "event:") {
+		t.Errorf("Stream to a disconnected client = %v, %q", err, rec.Body.String())
+	}
+}
@@ -3,34 +3,114 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/labstack/echo/v4"
 )
 
-var s3Client *s3.Client
+// s3Region is the region used to sign S3 requests unless the AWS default
+// configuration names one
+const s3Region = "fsn1"
+
+var (
+	s3Client       *s3.Client
+	s3Endpoint     string
+	s3AccessKey    string
+	storageRegion  = s3Region
+	usePathStyle   = true
+	storageBackend = "s3"
+	// defaultStorage is the backend used when no Storage is injected
+	defaultStorage Storage
+)
+
+// storageContextKey is the echo context key under which a Storage
+// implementation can be injected, e.g. a fake in tests
+const storageContextKey = "storage"
+
+// Storage is the subset of the S3 API used by the handlers. *s3.Client
+// satisfies it; tests inject fakes via the echo context.
+type Storage interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// storageFor returns the Storage injected into the echo context, falling back
+// to the client of a selected endpoint (see selectEndpoint) and then the
+// configured backend. Calls are timed for actions sent with includeTimings.
+func storageFor(c echo.Context) Storage {
+	store := defaultStorage
+	if routed, ok := c.Get(endpointContextKey).(Storage); ok && routed != nil {
+		store = routed
+	}
+	if injected, ok := c.Get(storageContextKey).(Storage); ok && injected != nil {
+		store = injected
+	}
+	if timings := timingsFor(c); timings != nil {
+		store = timedStorage{Storage: store, timings: timings}
+	}
+	if contentStoreEnabled() {
+		return contentStore{store}
+	}
+	return store
+}
+
+// initStorage creates the package-level storage backend from the environment.
+// WORKFLOW_STORAGE_BACKEND=fs stores objects under WORKFLOW_STORAGE_FS_DIR
+// and needs no S3 credentials; anything else uses S3.
+func initStorage() {
+	if os.Getenv("WORKFLOW_STORAGE_BACKEND") == "fs" {
+		initFileStorage()
+		return
+	}
 
-func init() {
 	// Initialize S3 client
-	accessKey := os.Getenv("HETZNER_S3_ACCESS_KEY")
-	secretKey := os.Getenv("HETZNER_S3_SECRET_KEY")
 	endpoint := os.Getenv("HETZNER_S3_URL")
+	if !explicitS3Credentials() {
+		initDefaultChainStorage(endpoint)
+		return
+	}
+
+	creds, err := loadS3Credentials(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed to load S3 credentials: %v", err)
+	}
 
-	if accessKey == "" || secretKey == "" || endpoint == "" {
-		log.Fatal("Missing S3 credentials: HETZNER_S3_ACCESS_KEY, HETZNER_S3_SECRET_KEY, HETZNER_S3_URL")
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" || endpoint == "" {
+		log.Fatal("Missing S3 credentials: HETZNER_S3_ACCESS_KEY, HETZNER_S3_SECRET_KEY (or HETZNER_S3_CREDENTIALS_FILE), HETZNER_S3_URL")
 	}
+	if err := checkEndpointSchemes(endpoint); err != nil {
+		log.Fatal(err)
+	}
+
+	s3Endpoint = endpoint
+	usePathStyle = pathStyleFor(endpoint)
+	s3AccessKey = creds.AccessKeyID
+	s3CredentialSource = creds.Source
+
+	// Credentials are cached and re-read when S3 reports them expired (see reloadCredentials)
+	s3Credentials = aws.NewCredentialsCache(aws.CredentialsProviderFunc(loadS3Credentials))
 
 	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
-		config.WithRegion("fsn1"),
+		config.WithCredentialsProvider(s3Credentials),
+		config.WithRegion(s3Region),
+		config.WithHTTPClient(s3HTTPClient()),
 	)
 	if err != nil {
 		log.Fatalf("Failed to load S3 config: %v", err)
@@ -38,18 +118,142 @@ func init() {
 
 	s3Client = s3.NewFromConfig(cfg, func(o *s3.Options) {
 		o.BaseEndpoint = aws.String(endpoint)
-		o.UsePathStyle = true
+		o.UsePathStyle = usePathStyle
 	})
 
+	defaultStorage = s3Client
+
 	log.Println("S3 client initialized successfully")
 }
 
+// initDefaultChainStorage creates the S3 client from the AWS default
+// credential chain (environment, shared credentials file, web identity, ECS
+// task role, EC2 instance profile). It is used when no HETZNER_S3_*
+// credentials are set, e.g. on AWS with IAM roles. HETZNER_S3_URL is optional
+// here; without it the AWS endpoint of the configured region is used.
+func initDefaultChainStorage(endpoint string) {
+	if err := checkEndpointSchemes(endpoint); err != nil {
+		log.Fatal(err)
+	}
+	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithHTTPClient(s3HTTPClient()))
+	if err != nil {
+		log.Fatalf("Failed to load AWS default config: %v", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = s3Region
+	}
+
+	// Let credential errors reload role credentials like explicit ones
+	if cache, ok := cfg.Credentials.(*aws.CredentialsCache); ok {
+		s3Credentials = cache
+	}
+
+	usePathStyle = pathStyleFor(endpoint)
+	s3Client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.UsePathStyle = usePathStyle
+	})
+
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+	}
+	s3Endpoint = endpoint
+	storageRegion = cfg.Region
+	s3CredentialSource = "aws-default-chain"
+	defaultStorage = s3Client
+
+	log.Println("S3 client initialized with the AWS default credential chain")
+}
+
+// pathStyleFor decides whether requests to endpoint use path-style
+// (https://host/bucket/key) or virtual-hosted (https://bucket.host/key)
+// addressing. WORKFLOW_STORAGE_S3_ADDRESSING=path or virtual forces a style;
+// auto (the default) infers it from the endpoint.
+func pathStyleFor(endpoint string) bool {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("WORKFLOW_STORAGE_S3_ADDRESSING"))); mode {
+	case "path":
+		return true
+	case "virtual":
+		return false
+	case "", "auto":
+	default:
+		log.Printf("Unknown WORKFLOW_STORAGE_S3_ADDRESSING %q, inferring the addressing style", mode)
+	}
+	return pathStyleEndpoint(endpoint)
+}
+
+// pathStyleEndpoint infers the addressing style of endpoint: AWS endpoints
+// (including the default one used without an endpoint) are virtual-hosted,
+// while IP addresses, localhost and other S3-compatible providers such as
+// MinIO or Hetzner use path-style, which needs no per-bucket DNS.
+func pathStyleEndpoint(endpoint string) bool {
+	if endpoint == "" {
+		return false
+	}
+	host := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		host = u.Hostname()
+	} else if h, _, err := net.SplitHostPort(endpoint); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	switch {
+	case host == "localhost" || strings.HasSuffix(host, ".localhost"):
+		return true
+	case net.ParseIP(host) != nil:
+		return true
+	case host == "amazonaws.com" || strings.HasSuffix(host, ".amazonaws.com"):
+		return false
+	}
+	return true
+}
+
+// initFileStorage selects the local filesystem backend
+func initFileStorage() {
+	dir := os.Getenv("WORKFLOW_STORAGE_FS_DIR")
+	if dir == "" {
+		dir = "./data"
+	}
+
+	store, err := newFileStorage(dir)
+	if err != nil {
+		log.Fatalf("Failed to initialize filesystem storage in %s: %v", dir, err)
+	}
+	// Buckets are just directories, so create them rather than failing validation
+	for _, bucket := range configuredBuckets() {
+		if err := os.MkdirAll(filepath.Join(store.root, bucket), 0o755); err != nil {
+			log.Fatalf("Failed to create bucket directory in %s: %v", store.root, err)
+		}
+	}
+
+	storageBackend = "fs"
+	s3Endpoint = "file://" + filepath.ToSlash(store.root)
+	defaultStorage = store
+
+	log.Printf("Filesystem storage initialized in %s", store.root)
+}
+
+// defaultBucket returns the configured S3 bucket (HETZNER_S3_BUCKET)
+func defaultBucket() string {
+	bucket := os.Getenv("HETZNER_S3_BUCKET")
+	if bucket == "" {
+		bucket = "px-semantic"
+	}
+	return bucket
+}
+
 // StoreRequest represents a request to store data
 type StoreRequest struct {
 	WorkflowID string `json:"workflowId"`
 	ActionID   string `json:"actionId"`
 	Data       string `json:"data"`
-	Format     string `json:"format,omitempty"` // application/json, text/plain, etc.
+	Format     string `json:"format,omitempty"`     // application/json, text/plain, etc.
+	Encrypt    bool   `json:"encrypt,omitempty"`    // apply application-layer AES-GCM encryption
+	AllowEmpty bool   `json:"allowEmpty,omitempty"` // permit storing a zero-byte object
+	Filename   string `json:"filename,omitempty"`   // original filename, returned on fetch
 }
 
 // StoreResponse returns the reference to stored data
@@ -59,6 +263,39 @@ type StoreResponse struct {
 	ContentURL     string `json:"contentUrl"`
 	EncodingFormat string `json:"encodingFormat"`
 	ContentSize    int64  `json:"contentSize"`
+	// ETag of the stored object, for conditional requests (If-Match, ...)
+	ETag string `json:"etag,omitempty"`
+	// PotentialAction retrieves the stored result when POSTed to
+	// /v1/api/semantic/action
+	PotentialAction *RetrieveActionTemplate `json:"potentialAction,omitempty"`
+}
+
+// RetrieveActionTemplate is a ready-to-use JSON-LD RetrieveAction
+type RetrieveActionTemplate struct {
+	Context string               `json:"@context"`
+	Type    string               `json:"@type"`
+	Object  RetrieveActionObject `json:"object"`
+}
+
+// RetrieveActionObject is the object of a RetrieveActionTemplate
+type RetrieveActionObject struct {
+	Type           string `json:"@type"`
+	ContentURL     string `json:"contentUrl"`
+	EncodingFormat string `json:"encodingFormat"`
+}
+
+// retrieveActionFor returns the RetrieveAction that fetches the object at
+// contentURL, so clients can follow the store response without building it
+func retrieveActionFor(contentURL, format string) *RetrieveActionTemplate {
+	return &RetrieveActionTemplate{
+		Context: jsonLDContext,
+		Type:    "RetrieveAction",
+		Object: RetrieveActionObject{
+			Type:           "DigitalDocument",
+			ContentURL:     contentURL,
+			EncodingFormat: format,
+		},
+	}
 }
 
 // FetchResponse returns the fetched data
@@ -66,100 +303,216 @@ type FetchResponse struct {
 	Data           string `json:"data"`
 	EncodingFormat string `json:"encodingFormat"`
 	ContentSize    int64  `json:"contentSize"`
+	Filename       string `json:"filename,omitempty"`
+	Expires        string `json:"expires,omitempty"`
+	ETag           string `json:"etag,omitempty"`
 }
 
 func handleStore(c echo.Context) error {
+	defer trackInflight()()
+
+	if readOnlyMode() {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "store is disabled: the service is read-only"})
+	}
+
 	var req StoreRequest
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
 	}
 
-	if req.WorkflowID == "" || req.ActionID == "" || req.Data == "" {
+	if req.WorkflowID == "" || req.ActionID == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "workflowId, actionId, and data are required"})
 	}
+	if req.Data == "" && !req.AllowEmpty {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "workflowId, actionId, and data are required (set allowEmpty to store an empty object)"})
+	}
 
 	if req.Format == "" {
 		req.Format = "application/json"
 	}
+	if err := validateEncodingFormat(c, req.Format); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if req.Filename != "" {
+		if err := validateFilename(req.Filename); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	if err := checkObjectSize(req.Format, len(req.Data)); err != nil {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+	}
 
-	// Generate S3 key: workflow-results/{workflowId}/{actionId}.json
-	bucket := os.Getenv("HETZNER_S3_BUCKET")
-	if bucket == "" {
-		bucket = "px-semantic"
+	if isNDJSON(req.Format) && req.Data != "" {
+		normalized, err := normalizeNDJSON(req.Data)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid NDJSON data: %v", err)})
+		}
+		req.Data = normalized
+	}
+
+	// Resolve bucket and key with the configured router, e.g.
+	// workflow-results/{workflowId}/{actionId}.json (see resultKey)
+	route, err := routeResult(RouteRequest{WorkflowID: req.WorkflowID, Identifier: req.ActionID, Format: req.Format, Tenant: tenantFor(c)})
+	if err != nil {
+		logf(c, "Failed to route %s/%s: %v", req.WorkflowID, req.ActionID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to store data"})
 	}
+	bucket, key := route.Bucket, route.Key
 
-	key := fmt.Sprintf("workflow-results/%s/%s.json", req.WorkflowID, req.ActionID)
+	// Serialize writes to the same object within this instance
+	unlock := objectLocks.Lock(bucket, key)
+	defer unlock()
+
+	if err := checkMutable(c.Request().Context(), c, storageFor(c), bucket, key); err != nil {
+		if errors.Is(err, errImmutable) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		logf(c, "Failed to check %s: %v", key, err)
+		return c.JSON(storageErrorStatus(err), map[string]string{"error": "failed to store data"})
+	}
+	// The legacy endpoint has no lock owner, so any active lock rejects it
+	if err := checkLock(c.Request().Context(), c, storageFor(c), bucket, key, ""); err != nil {
+		if errors.Is(err, errLocked) {
+			return c.JSON(http.StatusLocked, map[string]string{"error": err.Error()})
+		}
+		logf(c, "Failed to check lock on %s: %v", key, err)
+		return c.JSON(storageErrorStatus(err), map[string]string{"error": "failed to store data"})
+	}
 
-	// Upload to S3
 	dataBytes := []byte(req.Data)
-	_, err := s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
+	body := dataBytes
+	var metadata map[string]string
+	if req.Encrypt {
+		var err error
+		body, metadata, err = encryptPayload(dataBytes)
+		if err != nil {
+			logf(c, "Failed to encrypt data: %v", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to encrypt data: %v", err)})
+		}
+	}
+	metadata = withChecksum(metadata, dataBytes)
+	if req.Filename != "" {
+		metadata = withFilename(metadata, req.Filename)
+	}
+
+	// Upload to S3
+	put, err := storageFor(c).PutObject(c.Request().Context(), &s3.PutObjectInput{
 		Bucket:      aws.String(bucket),
 		Key:         aws.String(key),
-		Body:        bytes.NewReader(dataBytes),
+		Body:        bytes.NewReader(body),
 		ContentType: aws.String(req.Format),
+		Metadata:    metadata,
 	})
 	if err != nil {
-		log.Printf("Failed to upload to S3: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to store data"})
+		logf(c, "Failed to upload to S3: %v", err)
+		return c.JSON(storageErrorStatus(err), map[string]string{"error": "failed to store data"})
 	}
+	missingObjects.forget(bucket, key)
+	resultCache.forget(bucket, key)
 
-	log.Printf("Stored workflow result: %s (size: %d bytes)", key, len(dataBytes))
+	logf(c, "Stored workflow result: %s (size: %d bytes)", key, len(dataBytes))
 
 	// Return semantic reference
+	contentURL := fmt.Sprintf("s3://%s/%s", bucket, key)
 	response := StoreResponse{
-		Type:           "DataDownload",
-		ID:             fmt.Sprintf("#%s-result", req.ActionID),
-		ContentURL:     fmt.Sprintf("s3://%s/%s", bucket, key),
-		EncodingFormat: req.Format,
-		ContentSize:    int64(len(dataBytes)),
+		Type:            "DataDownload",
+		ID:              fmt.Sprintf("#%s-result", req.ActionID),
+		ContentURL:      contentURL,
+		EncodingFormat:  req.Format,
+		ContentSize:     int64(len(dataBytes)),
+		ETag:            aws.ToString(put.ETag),
+		PotentialAction: retrieveActionFor(contentURL, req.Format),
 	}
 
-	return c.JSON(http.StatusOK, response)
+	return respondJSON(c, http.StatusOK, response)
 }
 
 func handleFetch(c echo.Context) error {
+	defer trackInflight()()
+
 	key := c.Param("key")
 	if key == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "key is required"})
 	}
+	if err := checkTenantScope(c, key); err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "object is outside the tenant scope"})
+	}
 
-	bucket := os.Getenv("HETZNER_S3_BUCKET")
-	if bucket == "" {
-		bucket = "px-semantic"
+	bucket := defaultBucket()
+
+	obj, err := fetchObject(c.Request().Context(), storageFor(c), bucket, key)
+	if err != nil {
+		logf(c, "Failed to fetch %s: %v", key, err)
+		return c.JSON(fetchErrorStatus(err), map[string]string{"error": fetchErrorMessage(err)})
 	}
+	data, contentType := obj.data, obj.contentType
 
-	// Download from S3
-	result, err := s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+	response := FetchResponse{
+		Data:           string(data),
+		EncodingFormat: contentType,
+		ContentSize:    int64(len(data)),
+		Filename:       filenameFromMetadata(obj.metadata),
+		Expires:        setExpiryHeaders(c, obj.metadata),
+		ETag:           obj.etag,
+	}
+	if obj.etag != "" {
+		c.Response().Header().Set("ETag", obj.etag)
+	}
+
+	logf(c, "Fetched workflow result: %s (size: %d bytes)", key, len(data))
+	accessLog.record(c, bucket, key)
+
+	return respondJSON(c, http.StatusOK, response)
+}
+
+// handleFetchHead answers HEAD requests on the legacy fetch route with the
+// object's headers and no body. The headers describe the stored object, so
+// Content-Length is the ciphertext size for encrypted results.
+func handleFetchHead(c echo.Context) error {
+	defer trackInflight()()
+
+	key := c.Param("key")
+	if key == "" {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if err := checkTenantScope(c, key); err != nil {
+		return c.NoContent(http.StatusForbidden)
+	}
+
+	bucket := defaultBucket()
+
+	result, err := storageFor(c).HeadObject(c.Request().Context(), &s3.HeadObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		log.Printf("Failed to fetch from S3: %v", err)
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "data not found"})
-	}
-	defer func() {
-		if err := result.Body.Close(); err != nil {
-			log.Printf("Failed to close S3 response body: %v", err)
+		// HEAD responses have no body, so the status alone tells an absent
+		// key (404) from a backend failure worth retrying (5xx)
+		status := fetchErrorStatus(classifyStorageError(bucket, err))
+		if status != http.StatusNotFound {
+			logf(c, "Failed to head %s: %v", key, err)
 		}
-	}()
-
-	data, err := io.ReadAll(result.Body)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to read data"})
+		return c.NoContent(status)
 	}
 
-	contentType := "application/json"
+	header := c.Response().Header()
+	if result.ContentLength != nil {
+		header.Set(echo.HeaderContentLength, strconv.FormatInt(*result.ContentLength, 10))
+	}
 	if result.ContentType != nil {
-		contentType = *result.ContentType
+		header.Set(echo.HeaderContentType, *result.ContentType)
 	}
-
-	response := FetchResponse{
-		Data:           string(data),
-		EncodingFormat: contentType,
-		ContentSize:    int64(len(data)),
+	if result.ETag != nil {
+		header.Set("ETag", *result.ETag)
 	}
+	if result.LastModified != nil {
+		header.Set(echo.HeaderLastModified, result.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if filename := filenameFromMetadata(result.Metadata); filename != "" {
+		header.Set(echo.HeaderContentDisposition, contentDisposition(filename))
+	}
+	setExpiryHeaders(c, result.Metadata)
+	setAccessHeaders(c, storageFor(c), bucket, key)
 
-	log.Printf("Fetched workflow result: %s (size: %d bytes)", key, len(data))
-
-	return c.JSON(http.StatusOK, response)
+	return c.NoContent(http.StatusOK)
 }
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// fakeObject is an object held by fakeStorage
+type fakeObject struct {
+	data        []byte
+	contentType string
+	metadata    map[string]string
+	modified    time.Time
+}
+
+// fakeStorage is an in-memory Storage used to exercise the handlers without S3
+type fakeStorage struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	gets    int
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{objects: make(map[string]fakeObject)}
+}
+
+// storageEnv lists the settings that change where results are stored and
+// how stores and lists behave; resetStorageEnv clears them
+var storageEnv = []string{
+	"HETZNER_S3_BUCKET",
+	"WORKFLOW_STORAGE_BUCKET_MAP",
+	"WORKFLOW_STORAGE_FALLBACK_BUCKETS",
+	"WORKFLOW_STORAGE_ROUTER",
+	"WORKFLOW_STORAGE_KEY_TEMPLATE",
+	"WORKFLOW_STORAGE_SHARD_KEYS",
+	"WORKFLOW_STORAGE_TYPE_FOLDERS",
+	"WORKFLOW_STORAGE_FLAT_KEYS",
+	"WORKFLOW_STORAGE_KEY_SEPARATOR",
+	"WORKFLOW_STORAGE_KEY_NORMALIZATION",
+	"WORKFLOW_STORAGE_ENV_PREFIX",
+	"WORKFLOW_STORAGE_TENANT_KEYS",
+	"WORKFLOW_STORAGE_DEDUPLICATE",
+	"WORKFLOW_STORAGE_VERSIONING",
+	"WORKFLOW_STORAGE_KEEP_VERSIONS",
+	"WORKFLOW_STORAGE_READ_ONLY",
+	"WORKFLOW_STORAGE_LIST_MAX_KEYS",
+	"WORKFLOW_STORAGE_LIST_PAGE_SIZE",
+}
+
+// resetStorageEnv runs the test with the default key layout and store
+// behaviour, whatever the environment of the test process. Tests set what
+// they need afterwards; new layout settings belong in storageEnv.
+func resetStorageEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range storageEnv {
+		t.Setenv(name, "")
+	}
+}
+
+func (f *fakeStorage) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)] = fakeObject{
+		data:        data,
+		contentType: aws.ToString(params.ContentType),
+		metadata:    params.Metadata,
+		modified:    time.Now(),
+	}
+	return &s3.PutObjectOutput{ETag: aws.String(`"` + sha256Hex(data) + `"`)}, nil
+}
+
+func (f *fakeStorage) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	f.gets++
+	f.mu.Unlock()
+
+	obj, ok := f.get(params.Bucket, params.Key)
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(obj.data)),
+		ContentType:   aws.String(obj.contentType),
+		ContentLength: aws.Int64(int64(len(obj.data))),
+		ETag:          aws.String(`"` + sha256Hex(obj.data) + `"`),
+		LastModified:  aws.Time(obj.modified),
+		Metadata:      obj.metadata,
+	}, nil
+}
+
+func (f *fakeStorage) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	obj, ok := f.get(params.Bucket, params.Key)
+	if !ok {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadObjectOutput{
+		ContentType:   aws.String(obj.contentType),
+		ContentLength: aws.Int64(int64(len(obj.data))),
+		ETag:          aws.String(`"` + sha256Hex(obj.data) + `"`),
+		LastModified:  aws.Time(obj.modified),
+		Metadata:      obj.metadata,
+	}, nil
+}
+
+func (f *fakeStorage) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if aws.ToString(params.Bucket) == "" {
+		return nil, errors.New("bucket is required")
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (f *fakeStorage) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	source := aws.ToString(params.CopySource)
+	if unescaped, err := url.PathUnescape(source); err == nil {
+		source = unescaped
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[source]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	if params.MetadataDirective == types.MetadataDirectiveReplace {
+		obj.metadata = params.Metadata
+		obj.contentType = aws.ToString(params.ContentType)
+	}
+	f.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)] = obj
+	return &s3.CopyObjectOutput{
+		CopyObjectResult: &types.CopyObjectResult{LastModified: aws.Time(time.Now())},
+	}, nil
+}
+
+// ListObjectsV2 pages through keys in lexical order; the continuation token
+// is the last key or common prefix of the previous page. With a Delimiter,
+// keys below the prefix that contain it are rolled up into CommonPrefixes.
+func (f *fakeStorage) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucketPrefix := aws.ToString(params.Bucket) + "/"
+	prefix, delimiter, token := aws.ToString(params.Prefix), aws.ToString(params.Delimiter), aws.ToString(params.ContinuationToken)
+	if startAfter := aws.ToString(params.StartAfter); startAfter > token {
+		token = startAfter
+	}
+	var keys []string
+	for id := range f.objects {
+		key := strings.TrimPrefix(id, bucketPrefix)
+		if key == id || !strings.HasPrefix(key, prefix) || key <= token {
+			continue
+		}
+		if delimiter != "" && strings.HasSuffix(token, delimiter) && strings.HasPrefix(key, token) {
+			// Still inside the common prefix that ended the previous page
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Roll keys up into common prefixes, keeping lexical order
+	var entries []string
+	common := make(map[string]bool)
+	for _, key := range keys {
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				key = key[:len(prefix)+i+len(delimiter)]
+				if common[key] {
+					continue
+				}
+				common[key] = true
+			}
+		}
+		entries = append(entries, key)
+	}
+
+	maxKeys := int(aws.ToInt32(params.MaxKeys))
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(false)}
+	if len(entries) > maxKeys {
+		entries = entries[:maxKeys]
+		output.IsTruncated = aws.Bool(true)
+		output.NextContinuationToken = aws.String(entries[len(entries)-1])
+	}
+	for _, key := range entries {
+		if common[key] {
+			output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(key)})
+			continue
+		}
+		output.Contents = append(output.Contents, types.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(f.objects[bucketPrefix+key].data))),
+			LastModified: aws.Time(f.objects[bucketPrefix+key].modified),
+		})
+	}
+	return output, nil
+}
+
+func (f *fakeStorage) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeStorage) get(bucket, key *string) (fakeObject, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[aws.ToString(bucket)+"/"+aws.ToString(key)]
+	return obj, ok
+}
+
+func TestPathStyleFor(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_S3_ADDRESSING", "")
+	tests := []struct {
+		endpoint string
+		want     bool
+	}{
+		{"", false},
+		{"https://s3.eu-central-1.amazonaws.com", false},
+		{"https://s3.amazonaws.com", false},
+		{"https://fsn1.your-objectstorage.com", true},
+		{"http://localhost:9000", true},
+		{"http://127.0.0.1:9000", true},
+		{"http://[::1]:9000", true},
+		{"minio:9000", true},
+	}
+	for _, tt := range tests {
+		if got := pathStyleFor(tt.endpoint); got != tt.want {
+			t.Errorf("pathStyleFor(%q) = %v, want %v", tt.endpoint, got, tt.want)
+		}
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_S3_ADDRESSING", "path")
+	if !pathStyleFor("https://s3.eu-central-1.amazonaws.com") {
+		t.Error("WORKFLOW_STORAGE_S3_ADDRESSING=path must force path-style")
+	}
+	t.Setenv("WORKFLOW_STORAGE_S3_ADDRESSING", "virtual")
+	if pathStyleFor("http://localhost:9000") {
+		t.Error("WORKFLOW_STORAGE_S3_ADDRESSING=virtual must force virtual-hosted")
+	}
+}
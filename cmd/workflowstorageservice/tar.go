@@ -0,0 +1,281 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// metadataTarEntries records the number of regular files in a tar archive
+	metadataTarEntries = "tar-entries"
+	// metadataTarIndex records the archive's files and sizes, URL-encoded as
+	// name=size pairs. It is omitted when it would not fit maxTarIndexBytes.
+	metadataTarIndex = "tar-index"
+	// maxTarIndexBytes keeps the index well below the 2 KB S3 metadata limit
+	maxTarIndexBytes = 1024
+)
+
+// tarEntry is one regular file of a stored tar archive
+type tarEntry struct {
+	Name string
+	Size int64
+}
+
+// isTarFormat reports whether a content type is a (possibly gzipped) tar
+// archive: application/x-tar, application/x-gtar or application/tar+gzip
+func isTarFormat(contentType string) bool {
+	switch strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0])) {
+	case "application/x-tar", "application/x-gtar", "application/tar+gzip":
+		return true
+	}
+	return false
+}
+
+// newTarReader reads a tar archive from r, transparently decompressing it
+// when it starts with the gzip magic bytes
+func newTarReader(r io.Reader) (*tar.Reader, error) {
+	buffered := bufio.NewReader(r)
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return tar.NewReader(gz), nil
+	}
+	return tar.NewReader(buffered), nil
+}
+
+// indexTar lists the regular files of an archive, failing on anything that
+// is not a readable tar archive
+func indexTar(r io.Reader) ([]tarEntry, error) {
+	archive, err := newTarReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return tarFiles(archive)
+}
+
+// tarFiles reads archive to the end and returns its regular files
+func tarFiles(archive *tar.Reader) ([]tarEntry, error) {
+	var entries []tarEntry
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg {
+			entries = append(entries, tarEntry{Name: header.Name, Size: header.Size})
+		}
+	}
+}
+
+// withTarIndex records the entry count and, when small enough, the index of
+// entries in the object metadata
+func withTarIndex(metadata map[string]string, entries []tarEntry) map[string]string {
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata[metadataTarEntries] = strconv.Itoa(len(entries))
+
+	index := url.Values{}
+	for _, entry := range entries {
+		index.Set(entry.Name, strconv.FormatInt(entry.Size, 10))
+	}
+	if encoded := index.Encode(); len(encoded) <= maxTarIndexBytes {
+		metadata[metadataTarIndex] = encoded
+	}
+	return metadata
+}
+
+// tarIndexFromMetadata returns the entries recorded at store time, sorted by
+// name. ok is false when the archive has no complete index in its metadata.
+func tarIndexFromMetadata(metadata map[string]string) ([]tarEntry, bool) {
+	count, err := strconv.Atoi(metadata[metadataTarEntries])
+	if err != nil {
+		return nil, false
+	}
+	index, err := url.ParseQuery(metadata[metadataTarIndex])
+	if err != nil || len(index) != count {
+		return nil, false
+	}
+
+	entries := make([]tarEntry, 0, len(index))
+	for name := range index {
+		size, _ := strconv.ParseInt(index.Get(name), 10, 64)
+		entries = append(entries, tarEntry{Name: name, Size: size})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, true
+}
+
+// openTarObject opens a stored tar archive for reading. Encrypted archives
+// are decrypted in full first. The caller closes the returned body.
+func openTarObject(c echo.Context, action *semantic.SemanticAction, bucket, key string) (*tar.Reader, io.Closer, error) {
+	result, err := storageFor(c).GetObject(c.Request().Context(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		logf(c, "Failed to fetch %s: %v", key, err)
+		if isNotFoundError(err) {
+			return nil, nil, returnActionError(c, action, "data not found", err)
+		}
+		return nil, nil, returnActionError(c, action, "failed to read data", err)
+	}
+
+	fail := func(failure error) (*tar.Reader, io.Closer, error) {
+		if err := result.Body.Close(); err != nil {
+			logf(c, "Failed to close S3 response body: %v", err)
+		}
+		return nil, nil, failure
+	}
+
+	if isInProgress(result.Metadata) && !boolProperty(action, "allowPartial") {
+		return fail(stillWritingConflict(key))
+	}
+	if !isTarFormat(aws.ToString(result.ContentType)) {
+		return fail(returnActionError(c, action, fmt.Sprintf("object is %s, not a tar archive", aws.ToString(result.ContentType)), nil))
+	}
+
+	var body io.Reader = result.Body
+	if isEncoded(result.Metadata) {
+		data, err := io.ReadAll(result.Body)
+		if err != nil {
+			return fail(returnActionError(c, action, "failed to read data", err))
+		}
+		plaintext, err := decodePayload(data, result.Metadata)
+		if err != nil {
+			return fail(returnActionError(c, action, "failed to decrypt data", err))
+		}
+		body = bytes.NewReader(plaintext)
+	}
+
+	archive, err := newTarReader(body)
+	if err != nil {
+		return fail(returnActionError(c, action, "failed to read tar archive", err))
+	}
+	return archive, result.Body, nil
+}
+
+// streamTarEntry writes the named member of a stored tar archive to the
+// client. The archive is read sequentially up to the member, so neither the
+// archive nor the member is held in memory (except for encrypted archives).
+func streamTarEntry(c echo.Context, action *semantic.SemanticAction, bucket, key, name string) error {
+	archive, body, err := openTarObject(c, action, bucket, key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := body.Close(); err != nil {
+			logf(c, "Failed to close S3 response body: %v", err)
+		}
+	}()
+
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("entry %q not found in %s", name, key))
+		}
+		if err != nil {
+			return returnActionError(c, action, "failed to read tar archive", err)
+		}
+		if header.Typeflag != tar.TypeReg || header.Name != name {
+			continue
+		}
+
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = echo.MIMEOctetStream
+		}
+		response := c.Response()
+		response.Header().Set(echo.HeaderContentType, contentType)
+		response.Header().Set(echo.HeaderContentLength, strconv.FormatInt(header.Size, 10))
+		response.WriteHeader(http.StatusOK)
+
+		if _, err := io.Copy(response, archive); err != nil {
+			// Headers are already sent; the truncated body signals the failure
+			logf(c, "Failed to stream %s from %s: %v", name, key, err)
+			return nil
+		}
+
+		accessLog.record(c, bucket, key)
+		logf(c, "Streamed tar entry %s from %s (size: %d bytes)", name, key, header.Size)
+		return nil
+	}
+}
+
+// listTarEntries answers a retrieve with listEntries set: the archive's
+// files and sizes, read from the index recorded at store time or, for
+// archives without one, by scanning the archive
+func listTarEntries(c echo.Context, action *semantic.SemanticAction, bucket, key, contentURL string, fallback bool) error {
+	head, err := storageFor(c).HeadObject(c.Request().Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		logf(c, "Failed to stat %s: %v", key, err)
+		if isNotFoundError(err) {
+			return returnActionError(c, action, "data not found", err)
+		}
+		return returnActionError(c, action, "failed to read data", err)
+	}
+
+	entries, ok := tarIndexFromMetadata(head.Metadata)
+	if !ok {
+		archive, body, err := openTarObject(c, action, bucket, key)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := body.Close(); err != nil {
+				logf(c, "Failed to close S3 response body: %v", err)
+			}
+		}()
+
+		if entries, err = tarFiles(archive); err != nil {
+			return returnActionError(c, action, "failed to read tar archive", err)
+		}
+	}
+
+	items := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		items = append(items, map[string]interface{}{
+			"name":        entry.Name,
+			"contentSize": entry.Size,
+		})
+	}
+
+	value := map[string]interface{}{
+		"contentUrl":      contentURL,
+		"numberOfItems":   len(items),
+		"itemListElement": items,
+	}
+	reportServingBucket(value, bucket, fallback)
+	action.Result = &semantic.SemanticResult{
+		Type:  "ItemList",
+		Value: value,
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+// buildTar returns a tar archive of files, gzipped when compress is set
+func buildTar(t *testing.T, compress bool, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var out io.Writer = &buf
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		out = gz
+	}
+	tw := tar.NewWriter(out)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("WriteHeader() error = %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestTarIndexMetadata(t *testing.T) {
+	entries := []tarEntry{{Name: "b/data.csv", Size: 7}, {Name: "a.json", Size: 2}}
+	got, ok := tarIndexFromMetadata(withTarIndex(nil, entries))
+	if !ok || len(got) != 2 || got[0] != entries[1] || got[1] != entries[0] {
+		t.Errorf("tarIndexFromMetadata() = %v, %t", got, ok)
+	}
+
+	// Indexes that do not fit the metadata budget are recomputed by scanning
+	var many []tarEntry
+	for i := 0; i < 200; i++ {
+		many = append(many, tarEntry{Name: "entries/with/a/long/path/file-" + string(rune('a'+i%26)) + string(rune('a'+i/26)), Size: 1})
+	}
+	metadata := withTarIndex(nil, many)
+	if _, ok := metadata[metadataTarIndex]; ok {
+		t.Error("Expected an oversized index to be omitted")
+	}
+	if _, ok := tarIndexFromMetadata(metadata); ok {
+		t.Error("Expected an omitted index to be reported as incomplete")
+	}
+}
+
+func TestSemanticTar_StoreListAndExtract(t *testing.T) {
+	resetStorageEnv(t)
+
+	for _, compress := range []bool{false, true} {
+		e := echo.New()
+		store := newFakeStorage()
+		archive := buildTar(t, compress, map[string]string{"report.json": `{"ok": true}`, "data/rows.csv": "a,b\n1,2\n"})
+
+		run := func(body map[string]interface{}, handler func(echo.Context, *semantic.SemanticAction) error) (*httptest.ResponseRecorder, error) {
+			raw, _ := json.Marshal(body)
+			action, err := semantic.ParseSemanticAction(raw)
+			if err != nil {
+				t.Fatalf("ParseSemanticAction() error = %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+			req.Header.Set("X-Workflow-ID", "wf-1")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set(storageContextKey, store)
+			return rec, handler(c, action)
+		}
+
+		if _, err := run(map[string]interface{}{
+			"@type":         "CreateAction",
+			"identifier":    "bundle",
+			"contentBase64": base64.StdEncoding.EncodeToString(archive),
+			"object":        map[string]interface{}{"@type": "DigitalDocument", "encodingFormat": "application/x-tar"},
+		}, handleSemanticStoreImpl); err != nil {
+			t.Fatalf("Store failed: %v", err)
+		}
+		stored := store.objects[defaultBucket()+"/workflow-results/wf-1/bundle.json"]
+		if !bytes.Equal(stored.data, archive) {
+			t.Fatalf("Archive not stored as-is (compress %t)", compress)
+		}
+		if stored.metadata[metadataTarEntries] != "2" {
+			t.Errorf("Expected 2 indexed entries, got metadata %v", stored.metadata)
+		}
+
+		retrieve := func(properties map[string]interface{}) (*httptest.ResponseRecorder, error) {
+			body := map[string]interface{}{
+				"@type":  "RetrieveAction",
+				"object": map[string]interface{}{"@type": "DigitalDocument", "identifier": "bundle"},
+			}
+			for name, value := range properties {
+				body[name] = value
+			}
+			return run(body, handleSemanticRetrieveImpl)
+		}
+
+		rec, err := retrieve(map[string]interface{}{"tarEntry": "data/rows.csv"})
+		if err != nil {
+			t.Fatalf("Extract failed: %v", err)
+		}
+		if rec.Body.String() != "a,b\n1,2\n" {
+			t.Errorf("Extracted entry = %q (compress %t)", rec.Body.String(), compress)
+		}
+
+		rec, err = retrieve(map[string]interface{}{"listEntries": true})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		var response struct {
+			Result struct {
+				Value struct {
+					NumberOfItems int `json:"numberOfItems"`
+				} `json:"value"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if response.Result.Value.NumberOfItems != 2 {
+			t.Errorf("Listed %d entries, want 2: %s", response.Result.Value.NumberOfItems, rec.Body.String())
+		}
+
+		_, err = retrieve(map[string]interface{}{"tarEntry": "missing.txt"})
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != http.StatusNotFound {
+			t.Errorf("Missing entry error = %v, want 404", err)
+		}
+	}
+}
+
+func TestSemanticTar_RejectsInvalidArchive(t *testing.T) {
+	e := echo.New()
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "CreateAction", "identifier": "broken",
+		"object": {"@type": "DigitalDocument", "encodingFormat": "application/x-tar", "text": "not a tar archive at all"}}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	store := newFakeStorage()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), rec)
+	c.Set(storageContextKey, store)
+	_ = handleSemanticStoreImpl(c, action)
+	if len(store.objects) != 0 {
+		t.Errorf("Expected an invalid archive not to be stored, have %v", keysOf(store.objects))
+	}
+}
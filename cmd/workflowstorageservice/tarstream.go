@@ -0,0 +1,154 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// acceptsTar reports whether the client asked for a tar export
+func acceptsTar(r *http.Request) bool {
+	return strings.Contains(r.Header.Get(echo.HeaderAccept), "application/x-tar")
+}
+
+// streamTar writes objects into a single uncompressed tar
+// download, e.g. for piping into tar -x. Objects are prefetched like a ZIP
+// export (see startZipPrefetch) and written in the given order, each with
+// its size and modification time. Entries are named names[i], or like ZIP
+// entries after the original filename or the key's last segment when names
+// is nil, made unique with a numeric suffix. Objects that cannot be fetched
+// are skipped and listed in errors.json at the end of the archive.
+func streamTar(c echo.Context, filename string, contentURLs []string, objects []Route, names []string) error {
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "application/x-tar")
+	response.Header().Set(echo.HeaderContentDisposition, contentDisposition(filename))
+	response.WriteHeader(http.StatusOK)
+
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+	prefetch := startZipPrefetch(ctx, storageFor(c), objects, zipConcurrency())
+
+	tw := tar.NewWriter(response)
+	used := make(map[string]bool)
+	var failures []zipExportError
+	for i, object := range objects {
+		obj := prefetch.next(i)
+		if obj.message != "" {
+			prefetch.release()
+			failures = append(failures, zipExportError{ContentURL: contentURLs[i], Error: obj.message})
+			continue
+		}
+		if names != nil {
+			obj.name = names[i]
+		}
+		err := writeTarEntry(tw, used, object.Key, obj)
+		prefetch.release()
+		if err != nil {
+			// Headers are already sent; the truncated archive signals the failure
+			logf(c, "Failed to stream %s into tar export: %v", object.Key, err)
+			cancel()
+			go prefetch.discard(i + 1)
+			return nil
+		}
+		accessLog.record(c, object.Bucket, object.Key)
+		response.Flush()
+	}
+
+	if len(failures) > 0 {
+		data, err := json.Marshal(failures)
+		if err == nil {
+			err = writeTarFile(tw, zipErrorsEntry, time.Now(), data)
+		}
+		if err != nil {
+			logf(c, "Failed to write %s: %v", zipErrorsEntry, err)
+			return nil
+		}
+	}
+	if err := tw.Close(); err != nil {
+		logf(c, "Failed to close tar export: %v", err)
+	}
+
+	logf(c, "Streamed %d workflow results as a tar export (%d failed)", len(objects)-len(failures), len(failures))
+	return nil
+}
+
+// writeTarEntry copies a fetched object into the archive and closes its
+// body. The header announces the object's size, so a body that ends early
+// fails the entry. An error means the archive can no longer be written.
+func writeTarEntry(tw *tar.Writer, used map[string]bool, key string, obj zipObject) error {
+	defer func() {
+		if err := obj.body.Close(); err != nil {
+			log.Printf("Failed to close S3 response body of %s: %v", key, err)
+		}
+	}()
+
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     uniqueZipName(used, obj.name),
+		Size:     obj.size,
+		Mode:     0o644,
+		ModTime:  obj.modified,
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, obj.body)
+	return err
+}
+
+// writeTarFile adds a regular file with the given content to the archive
+func writeTarFile(tw *tar.Writer, name string, modified time.Time, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0o644,
+		ModTime:  modified,
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// tarExportKeys lists the keys below prefix for a tar export, skipping
+// internal keys, versions and objects outside modified. It fails with 400 when more
+// than limit objects match, since a partial archive would look complete to
+// tar -x.
+func tarExportKeys(ctx context.Context, store Storage, bucket, prefix string, modified modifiedRange, limit int64) ([]string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(maxListPageSize),
+	}
+	var keys []string
+	for {
+		page, err := store.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if internalKey(key) || isVersionKey(key) || !modified.contains(obj.LastModified) {
+				continue
+			}
+			if int64(len(keys)) >= limit {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("more than %d objects match; narrow the selection with workflowId, type or modifiedAfter", limit))
+			}
+			keys = append(keys, key)
+		}
+		if !aws.ToBool(page.IsTruncated) || page.NextContinuationToken == nil {
+			return keys, nil
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+}
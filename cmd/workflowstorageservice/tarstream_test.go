@@ -0,0 +1,129 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+// readTar returns the files of a tar archive by name, failing on a truncated
+// or malformed archive
+func readTar(t *testing.T, data []byte) (map[string]string, map[string]*tar.Header) {
+	t.Helper()
+	files := make(map[string]string)
+	headers := make(map[string]*tar.Header)
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, headers
+		}
+		if err != nil {
+			t.Fatalf("Invalid tar response: %v", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("Read %s: %v", header.Name, err)
+		}
+		files[header.Name] = string(content)
+		headers[header.Name] = header
+	}
+}
+
+func TestSemanticList_TarExport(t *testing.T) {
+	resetStorageEnv(t)
+
+	modified := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := newFakeStorage()
+	store.objects[defaultBucket()+"/workflow-results/wf-1/step-1.json"] = fakeObject{data: []byte(`{"step": 1}`), modified: modified}
+	store.objects[defaultBucket()+"/workflow-results/wf-1/csv/report.csv"] = fakeObject{data: []byte("a,b\n"), contentType: "text/csv", modified: modified}
+	store.objects[defaultBucket()+"/workflow-results/wf-2/step-1.json"] = fakeObject{data: []byte(`{}`), modified: modified}
+
+	list := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set(echo.HeaderAccept, "application/x-tar")
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		if err := handleSemanticListImpl(c, action); err != nil {
+			var httpErr *echo.HTTPError
+			if errors.As(err, &httpErr) {
+				rec.Code = httpErr.Code
+				return rec
+			}
+			t.Fatalf("handleSemanticListImpl() error = %v", err)
+		}
+		return rec
+	}
+
+	rec := list(`{"@type": "ListAction", "workflowId": "wf-1"}`)
+	if got := rec.Header().Get(echo.HeaderContentType); got != "application/x-tar" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := rec.Header().Get(echo.HeaderContentDisposition); !strings.Contains(got, "export.tar") {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	files, headers := readTar(t, rec.Body.Bytes())
+	if len(files) != 2 || files["step-1.json"] != `{"step": 1}` || files["csv/report.csv"] != "a,b\n" {
+		t.Errorf("Tar entries = %v", files)
+	}
+	if header := headers["csv/report.csv"]; header == nil || header.Size != 4 || !header.ModTime.Equal(modified) || header.Typeflag != tar.TypeReg {
+		t.Errorf("Header of csv/report.csv = %+v", header)
+	}
+
+	// A selection above the list limit is refused before anything is streamed
+	t.Setenv("WORKFLOW_STORAGE_LIST_MAX_KEYS", "2")
+	if rec := list(`{"@type": "ListAction"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Oversized tar export: status %d, want 400", rec.Code)
+	}
+}
+
+func TestBatchRetrieve_TarExport(t *testing.T) {
+	resetStorageEnv(t)
+
+	store := newFakeStorage()
+	store.objects[defaultBucket()+"/workflow-results/wf-1/step-1.json"] = fakeObject{data: []byte(`{"step": 1}`)}
+	store.objects[defaultBucket()+"/workflow-results/wf-1/report.json"] = fakeObject{
+		data:     []byte("a,b\n"),
+		metadata: withFilename(nil, "Q3 report.csv"),
+	}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "BatchRetrieveAction", "workflowId": "wf-1",
+		"identifiers": ["step-1", "report", "missing"], "filename": "selected.tar"}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	req.Header.Set(echo.HeaderAccept, "application/x-tar")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set(storageContextKey, store)
+	if err := handleSemanticBatchRetrieveImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticBatchRetrieveImpl() error = %v", err)
+	}
+
+	if got := rec.Header().Get(echo.HeaderContentDisposition); !strings.Contains(got, "selected.tar") {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	files, _ := readTar(t, rec.Body.Bytes())
+	if files["step-1.json"] != `{"step": 1}` || files["Q3 report.csv"] != "a,b\n" {
+		t.Errorf("Tar entries = %v", files)
+	}
+	if !strings.Contains(files[zipErrorsEntry], "workflow-results/wf-1/missing.json") {
+		t.Errorf("errors.json = %q, want the missing object", files[zipErrorsEntry])
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	evehttp "eve.evalgo.org/http"
+	"github.com/labstack/echo/v4"
+)
+
+// tenantContextKey is the echo context key holding the caller's tenant
+const tenantContextKey = "tenant"
+
+// tenantKeysPrefix is the top-level prefix of every tenant's namespace
+const tenantKeysPrefix = "tenants"
+
+// parseTenantKeys parses WORKFLOW_STORAGE_TENANT_KEYS, a comma-separated list
+// of apiKey=tenant entries, e.g. "k3y-a=acme,k3y-b=globex". Tenant names are
+// used as a key segment and may only contain letters, digits, '-', '_' and
+// '.'. Malformed entries are returned separately, with every character of
+// the key masked, so they can be reported once at startup.
+func parseTenantKeys(spec string) (map[string]string, []string) {
+	tenants := make(map[string]string)
+	var malformed []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		apiKey, tenant, ok := strings.Cut(entry, "=")
+		apiKey, tenant = strings.TrimSpace(apiKey), strings.TrimSpace(tenant)
+		if !ok || apiKey == "" || !validTenantName(tenant) {
+			malformed = append(malformed, strings.Repeat("*", len(apiKey))+"="+tenant)
+			continue
+		}
+		tenants[apiKey] = tenant
+	}
+	return tenants, malformed
+}
+
+// validTenantName reports whether tenant is usable as a single key segment
+func validTenantName(tenant string) bool {
+	if tenant == "" || tenant == "." || tenant == ".." {
+		return false
+	}
+	for _, r := range tenant {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// tenantKeys returns the configured API key to tenant mapping
+func tenantKeys() map[string]string {
+	tenants, _ := parseTenantKeys(os.Getenv("WORKFLOW_STORAGE_TENANT_KEYS"))
+	return tenants
+}
+
+// tenantNames returns the configured tenants, sorted, for /v1/api/config
+func tenantNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, tenant := range tenantKeys() {
+		if !seen[tenant] {
+			seen[tenant] = true
+			names = append(names, tenant)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apiKeyAuth returns the API key middleware of the protected routes. Without
+// WORKFLOW_STORAGE_TENANT_KEYS it is the EVE single-key check on apiKey.
+// With tenants configured, X-API-Key must be one of the tenant keys and the
+// tenant is recorded on the context, where routing and key checks pick it up.
+func apiKeyAuth(apiKey string) echo.MiddlewareFunc {
+	tenants := tenantKeys()
+	if len(tenants) == 0 {
+		return evehttp.APIKeyMiddleware(apiKey)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tenant, ok := lookupTenant(tenants, c.Request().Header.Get("X-API-Key"))
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid or missing API key")
+			}
+			c.Set(tenantContextKey, tenant)
+			return next(c)
+		}
+	}
+}
+
+// adminAuth returns the middleware of the operator routes (/v1/api/config,
+// /v1/api/metrics). A valid X-Admin-Override always passes. Otherwise the
+// request needs the global API key: without tenants that is the EVE check
+// of apiKey; with tenants X-API-Key must match WORKFLOW_STORAGE_API_KEY, and
+// tenant keys are refused with 403, since the configuration lists every
+// tenant.
+func adminAuth(apiKey string) echo.MiddlewareFunc {
+	if len(tenantKeys()) == 0 {
+		globalAuth := evehttp.APIKeyMiddleware(apiKey)
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			checked := globalAuth(next)
+			return func(c echo.Context) error {
+				if hasAdminOverride(c) {
+					return next(c)
+				}
+				return checked(c)
+			}
+		}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if hasAdminOverride(c) {
+				return next(c)
+			}
+			provided := c.Request().Header.Get("X-API-Key")
+			if apiKey != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) == 1 {
+				return next(c)
+			}
+			if _, ok := lookupTenant(tenantKeys(), provided); ok {
+				return echo.NewHTTPError(http.StatusForbidden, "tenant API keys cannot access operator endpoints")
+			}
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid or missing API key")
+		}
+	}
+}
+
+// lookupTenant finds the tenant of apiKey, comparing in constant time
+func lookupTenant(tenants map[string]string, apiKey string) (string, bool) {
+	if apiKey == "" {
+		return "", false
+	}
+	for key, tenant := range tenants {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			return tenant, true
+		}
+	}
+	return "", false
+}
+
+// tenantFor returns the tenant of the request, or "" when tenancy is off
+func tenantFor(c echo.Context) string {
+	tenant, _ := c.Get(tenantContextKey).(string)
+	return tenant
+}
+
+// tenantKeyPrefix is the namespace all keys of tenant live under
+func tenantKeyPrefix(tenant string) string {
+	return tenantKeysPrefix + "/" + tenant + "/"
+}
+
+// scopeToTenant places a key built outside the router (e.g. bundle keys) in
+// the caller's tenant namespace
+func scopeToTenant(c echo.Context, key string) string {
+	if tenant := tenantFor(c); tenant != "" {
+		return tenantKeyPrefix(tenant) + key
+	}
+	return key
+}
+
+// tenantRouter confines another router to a tenant's namespace by prefixing
+// every key it produces with tenants/{tenant}/
+type tenantRouter struct {
+	Router
+	tenant string
+}
+
+func (r tenantRouter) Route(req RouteRequest) (Route, error) {
+	route, err := r.Router.Route(req)
+	if err != nil {
+		return Route{}, err
+	}
+	route.Key = tenantKeyPrefix(r.tenant) + route.Key
+	return route, nil
+}
+
+func (r tenantRouter) ListPrefix(workflowID, typ string) (Route, error) {
+	route, err := r.Router.ListPrefix(workflowID, typ)
+	if err != nil {
+		return Route{}, err
+	}
+	route.Key = tenantKeyPrefix(r.tenant) + route.Key
+	return route, nil
+}
+
+// checkTenantScope rejects explicit keys (contentUrl, targetUrl, legacy
+// fetch keys) outside the caller's tenant namespace with 403 Forbidden, so a
+// guessed s3:// URL cannot reach another tenant's objects. Requests without
+// a tenant are not restricted.
+func checkTenantScope(c echo.Context, key string) error {
+	tenant := tenantFor(c)
+	if tenant == "" {
+		return nil
+	}
+	if strings.HasPrefix(key, tenantKeyPrefix(tenant)) && !hasDotSegment(key) {
+		return nil
+	}
+	return echo.NewHTTPError(http.StatusForbidden, "object is outside the tenant scope")
+}
+
+// hasDotSegment reports whether key contains a "." or ".." segment
+func hasDotSegment(key string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
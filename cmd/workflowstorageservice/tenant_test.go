@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseTenantKeys(t *testing.T) {
+	tenants, malformed := parseTenantKeys("key-a=acme, key-b = globex ,key-c=../x,=nobody,key-d")
+	if len(tenants) != 2 || tenants["key-a"] != "acme" || tenants["key-b"] != "globex" {
+		t.Errorf("parseTenantKeys() tenants = %v", tenants)
+	}
+	if len(malformed) != 3 {
+		t.Errorf("parseTenantKeys() malformed = %v, want 3 entries", malformed)
+	}
+	if len(malformed) > 0 && malformed[0] != "*****=../x" {
+		t.Errorf("parseTenantKeys() malformed[0] = %q, want the key fully masked", malformed[0])
+	}
+	for _, entry := range malformed {
+		if strings.Contains(entry, "key-") {
+			t.Errorf("Malformed entry %q exposes the API key", entry)
+		}
+	}
+}
+
+func TestAPIKeyAuth_Tenants(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_TENANT_KEYS", "key-a=acme")
+
+	e := echo.New()
+	handler := apiKeyAuth("ignored")(func(c echo.Context) error {
+		return c.String(http.StatusOK, tenantFor(c))
+	})
+
+	tests := []struct {
+		apiKey     string
+		wantStatus int
+		wantTenant string
+	}{
+		{"key-a", http.StatusOK, "acme"},
+		{"ignored", http.StatusUnauthorized, ""},
+		{"", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", tt.apiKey)
+		rec := httptest.NewRecorder()
+		err := handler(e.NewContext(req, rec))
+
+		status := rec.Code
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			status = httpErr.Code
+		}
+		if status != tt.wantStatus {
+			t.Errorf("apiKeyAuth(%q) status = %d, want %d", tt.apiKey, status, tt.wantStatus)
+		}
+		if tt.wantTenant != "" && rec.Body.String() != tt.wantTenant {
+			t.Errorf("apiKeyAuth(%q) tenant = %q, want %q", tt.apiKey, rec.Body.String(), tt.wantTenant)
+		}
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_TENANT_KEYS", "key-a=acme")
+	t.Setenv("WORKFLOW_STORAGE_ADMIN_KEY", "admin-secret")
+
+	e := echo.New()
+	handler := adminAuth("global-key")(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		override   string
+		wantStatus int
+	}{
+		{"global key", "global-key", "", http.StatusOK},
+		{"admin override", "", "admin-secret", http.StatusOK},
+		{"tenant key", "key-a", "", http.StatusForbidden},
+		{"wrong override", "key-a", "guess", http.StatusForbidden},
+		{"no key", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v1/api/config", nil)
+		req.Header.Set("X-API-Key", tt.apiKey)
+		req.Header.Set(adminOverrideHeader, tt.override)
+		rec := httptest.NewRecorder()
+		err := handler(e.NewContext(req, rec))
+
+		status := rec.Code
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			status = httpErr.Code
+		}
+		if status != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.wantStatus)
+		}
+	}
+
+	// Without a global key only the admin override gets through
+	handler = adminAuth("")(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/v1/api/config", nil)
+	err := handler(e.NewContext(req, httptest.NewRecorder()))
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusUnauthorized {
+		t.Errorf("Empty global key: error = %v, want 401", err)
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	run := func(tenant, body string, handler func(echo.Context, *semantic.SemanticAction) error) (*httptest.ResponseRecorder, error) {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		c.Set(tenantContextKey, tenant)
+		return rec, handler(c, action)
+	}
+
+	if _, err := run("acme", `{"@type": "CreateAction", "identifier": "step-1",
+		"object": {"@type": "DigitalDocument", "text": "{\"secret\": true}"}}`, handleSemanticStoreImpl); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	const key = "tenants/acme/workflow-results/wf-1/step-1.json"
+	if _, ok := store.objects[defaultBucket()+"/"+key]; !ok {
+		t.Fatalf("Object not stored in the tenant namespace, have %v", keysOf(store.objects))
+	}
+
+	// The owner can read it back by identifier and by contentUrl
+	rec, err := run("acme", `{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "identifier": "step-1"}}`, handleSemanticRetrieveImpl)
+	if err != nil || !strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("Owner retrieve = %v, %s", err, rec.Body.String())
+	}
+
+	// Another tenant neither resolves the identifier to it nor reaches it by URL
+	rec, _ = run("globex", `{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "identifier": "step-1"}}`, handleSemanticRetrieveImpl)
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("Other tenant read the object by identifier: %s", rec.Body.String())
+	}
+	for _, url := range []string{
+		"s3://px-semantic/" + key,
+		"s3://px-semantic/tenants/globex/../acme/workflow-results/wf-1/step-1.json",
+	} {
+		_, err = run("globex", `{"@type": "RetrieveAction", "object": {"@type": "DigitalDocument", "contentUrl": "`+url+`"}}`, handleSemanticRetrieveImpl)
+		var httpErr *echo.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != http.StatusForbidden {
+			t.Errorf("Retrieve of %s by another tenant error = %v, want 403", url, err)
+		}
+	}
+
+	// Listing stays within the tenant namespace
+	rec, err = run("globex", `{"@type": "ListAction"}`, handleSemanticListImpl)
+	if err != nil || strings.Contains(rec.Body.String(), "acme") {
+		t.Errorf("Other tenant list = %v, %s", err, rec.Body.String())
+	}
+}
+
+func TestSemanticBatch_KeepsTenant(t *testing.T) {
+	resetStorageEnv(t)
+	registerActions()
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	batch := `[{"@type": "CreateAction", "identifier": "a", "object": {"@type": "DigitalDocument", "text": "{\"a\": 1}"}}]`
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/batch", strings.NewReader(batch))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := e.NewContext(req, httptest.NewRecorder())
+	c.Set(storageContextKey, store)
+	c.Set(tenantContextKey, "acme")
+	if err := handleSemanticBatch(c); err != nil {
+		t.Fatalf("handleSemanticBatch() error = %v", err)
+	}
+
+	if _, ok := store.objects[defaultBucket()+"/tenants/acme/workflow-results/default/a.json"]; !ok {
+		t.Errorf("Batch store escaped the tenant namespace, have %v", keysOf(store.objects))
+	}
+}
+
+func TestRESTStore_KeepsTenant(t *testing.T) {
+	resetStorageEnv(t)
+	registerActions()
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/workflows", strings.NewReader(`{"id": "wf-rest", "definition": {"steps": 1}}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := e.NewContext(req, httptest.NewRecorder())
+	c.Set(storageContextKey, store)
+	c.Set(tenantContextKey, "acme")
+	if err := storeWorkflowREST(c); err != nil {
+		t.Fatalf("storeWorkflowREST() error = %v", err)
+	}
+
+	for id := range store.objects {
+		if !strings.HasPrefix(id, defaultBucket()+"/tenants/acme/") {
+			t.Errorf("REST store escaped the tenant namespace: %s", id)
+		}
+	}
+	if len(store.objects) == 0 {
+		t.Error("Expected the REST store to write an object")
+	}
+}
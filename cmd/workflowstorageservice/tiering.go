@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultArchivePrefix is where ArchiveAction moves objects without a
+	// targetPrefix
+	defaultArchivePrefix = "archive/"
+
+	// defaultArchiveBatchSize bounds the objects one ArchiveAction moves
+	// without maxObjects
+	defaultArchiveBatchSize = 1000
+)
+
+// archiveTargetPrefix validates the targetPrefix property and returns it
+// with a trailing slash
+func archiveTargetPrefix(action *semantic.SemanticAction) (string, error) {
+	prefix := stringProperty(action, "targetPrefix")
+	if prefix == "" {
+		return defaultArchivePrefix, nil
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if strings.HasPrefix(prefix, "/") || hasDotSegment(strings.TrimSuffix(prefix, "/")) {
+		return "", fmt.Errorf("invalid targetPrefix %q", prefix)
+	}
+	return prefix, nil
+}
+
+// handleSemanticArchiveImpl moves the results of a workflow that are older
+// than olderThanSeconds below targetPrefix (default archive/) in the same
+// bucket, using a server-side copy followed by a delete. Keys keep their
+// path below the prefix, e.g. workflow-results/wf-1/step-1.json becomes
+// archive/workflow-results/wf-1/step-1.json, and metadata is copied as is.
+//
+// The action is a maintenance operation and requires the admin override
+// header. At most maxObjects objects (default 1000, capped at the list limit)
+// are moved per call; hasMore tells the caller to run it again. Moved objects
+// leave the workflow prefix, so repeated runs pick up where the last one
+// stopped and a run after completion moves nothing.
+func handleSemanticArchiveImpl(c echo.Context, action *semantic.SemanticAction) error {
+	if !hasAdminOverride(c) {
+		return echo.NewHTTPError(http.StatusForbidden, "ArchiveAction requires "+adminOverrideHeader)
+	}
+
+	// Unlike other actions there is no "default" workflow fallback
+	workflowID := stringProperty(action, "workflowId")
+	if workflowID == "" {
+		return returnActionError(c, action, "workflowId is required", nil)
+	}
+	olderThan, ok := int64Property(action, "olderThanSeconds")
+	if !ok || olderThan < 0 {
+		return returnActionError(c, action, "olderThanSeconds is required", nil)
+	}
+	targetPrefix, err := archiveTargetPrefix(action)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	batchSize := int64(defaultArchiveBatchSize)
+	if maxObjects, ok := int64Property(action, "maxObjects"); ok && maxObjects > 0 {
+		batchSize = maxObjects
+	}
+	batchSize = min(batchSize, maxListKeys())
+
+	router, err := routerFor(tenantFor(c))
+	if err != nil {
+		return returnActionError(c, action, "Failed to resolve storage location", err)
+	}
+	listRoute, err := router.ListPrefix(workflowID, stringProperty(action, "type"))
+	if errors.Is(err, errWorkflowsNotListable) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return returnActionError(c, action, "Failed to resolve storage location", err)
+	}
+	bucket, prefix := listRoute.Bucket, listRoute.Key
+	scopedTarget := scopeToTenant(c, targetPrefix)
+	owner := stringProperty(action, "lockOwner")
+
+	store := storageFor(c)
+	ctx := c.Request().Context()
+	cutoff := time.Now().Add(-time.Duration(olderThan) * time.Second)
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(maxListPageSize),
+	}
+	var moved, skipped int64
+	failures := make([]map[string]interface{}, 0)
+	hasMore := false
+	for {
+		page, err := store.ListObjectsV2(ctx, input)
+		if err != nil {
+			logf(c, "Failed to list %s: %v", prefix, err)
+			return returnActionError(c, action, "Failed to list objects", err)
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			// A target prefix inside the workflow prefix must not be archived again
+			if strings.HasPrefix(key, scopedTarget) || obj.LastModified == nil || !obj.LastModified.Before(cutoff) {
+				skipped++
+				continue
+			}
+			if moved+int64(len(failures)) >= batchSize {
+				hasMore = true
+				break
+			}
+
+			targetKey := scopeToTenant(c, targetPrefix+unscopedKey(c, key))
+			if err := moveObject(ctx, store, bucket, key, targetKey, owner); err != nil {
+				logf(c, "Failed to archive %s: %v", key, err)
+				message := "failed to move object"
+				if errors.Is(err, errLocked) {
+					message = "object is locked"
+				}
+				failures = append(failures, map[string]interface{}{
+					"contentUrl": fmt.Sprintf("s3://%s/%s", bucket, key),
+					"error":      message,
+				})
+				continue
+			}
+			if err := deleteAccessStats(ctx, store, bucket, key); err != nil {
+				logf(c, "Failed to delete access stats for %s: %v", key, err)
+			}
+			moved++
+		}
+
+		if hasMore || !aws.ToBool(page.IsTruncated) || page.NextContinuationToken == nil {
+			break
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+
+	logf(c, "Archived %d workflow results of %s to %s (%d skipped, %d failed)", moved, workflowID, targetPrefix, skipped, len(failures))
+
+	action.Result = &semantic.SemanticResult{
+		Type: "DigitalDocument",
+		Value: map[string]interface{}{
+			"workflowId":   workflowID,
+			"targetPrefix": targetPrefix,
+			"moved":        moved,
+			"skipped":      skipped,
+			"failed":       len(failures),
+			"errors":       failures,
+			"hasMore":      hasMore,
+		},
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// unscopedKey strips the caller's tenant namespace from key
+func unscopedKey(c echo.Context, key string) string {
+	if tenant := tenantFor(c); tenant != "" {
+		return strings.TrimPrefix(key, tenantKeyPrefix(tenant))
+	}
+	return key
+}
+
+// moveObject copies bucket/key to targetKey server-side, then deletes the
+// source. If the delete fails the copy is left in place; rerunning the move
+// overwrites it with the same content. A source with an active advisory lock
+// held by someone other than owner is not moved; the admin override that
+// authorizes ArchiveAction does not break locks.
+func moveObject(ctx context.Context, store Storage, bucket, key, targetKey, owner string) error {
+	unlockSource := objectLocks.Lock(bucket, key)
+	defer unlockSource()
+	unlockTarget := objectLocks.Lock(bucket, targetKey)
+	defer unlockTarget()
+
+	lock, err := activeLock(ctx, store, bucket, key)
+	if err != nil {
+		return err
+	}
+	if lock != nil && lock.owner != owner {
+		return lock
+	}
+
+	if _, err := store.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(targetKey),
+		CopySource: aws.String(copySource(bucket, key)),
+	}); err != nil {
+		return err
+	}
+	missingObjects.forget(bucket, targetKey)
+	resultCache.forget(bucket, targetKey)
+
+	if _, err := store.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return err
+	}
+	resultCache.forget(bucket, key)
+	return nil
+}
+
+// handleSemanticArchive wraps the implementation to match ActionHandler signature
+func handleSemanticArchive(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticArchiveImpl(c, action)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSemanticArchive_MovesOldResults(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_ADMIN_KEY", "admin-secret")
+
+	bucket := defaultBucket()
+	old := time.Now().Add(-48 * time.Hour)
+	store := newFakeStorage()
+	for _, id := range []string{"step-1", "step-2", "step-3"} {
+		store.objects[bucket+"/workflow-results/wf-1/"+id+".json"] = fakeObject{
+			data:        []byte(`{"id": "` + id + `"}`),
+			contentType: "application/json",
+			metadata:    map[string]string{metadataChecksumSHA256: id},
+			modified:    old,
+		}
+	}
+	store.objects[bucket+"/workflow-results/wf-1/fresh.json"] = fakeObject{data: []byte("{}"), modified: time.Now()}
+	store.objects[bucket+"/workflow-results/wf-2/step-1.json"] = fakeObject{data: []byte("{}"), modified: old}
+
+	run := func(body, override string) (*semantic.SemanticAction, error) {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		if override != "" {
+			req.Header.Set(adminOverrideHeader, override)
+		}
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return action, handleSemanticArchiveImpl(c, action)
+	}
+	archive := `{"@type": "ArchiveAction", "workflowId": "wf-1", "olderThanSeconds": 86400, "maxObjects": 2}`
+
+	var httpErr *echo.HTTPError
+	if _, err := run(archive, ""); !errors.As(err, &httpErr) || httpErr.Code != http.StatusForbidden {
+		t.Fatalf("ArchiveAction without admin override: expected 403, got %v", err)
+	}
+
+	// The first batch stops at maxObjects, the second finishes the job
+	action, err := run(archive, "admin-secret")
+	if err != nil {
+		t.Fatalf("handleSemanticArchiveImpl() error = %v", err)
+	}
+	value, _ := action.Result.Value.(map[string]interface{})
+	if value["moved"] != int64(2) || value["hasMore"] != true {
+		t.Errorf("First batch = %v, want 2 moved and hasMore", value)
+	}
+	action, err = run(archive, "admin-secret")
+	if err != nil {
+		t.Fatalf("handleSemanticArchiveImpl() error = %v", err)
+	}
+	value, _ = action.Result.Value.(map[string]interface{})
+	if value["moved"] != int64(1) || value["hasMore"] != false || value["skipped"] != int64(1) {
+		t.Errorf("Second batch = %v, want 1 moved, 1 skipped", value)
+	}
+
+	for _, id := range []string{"step-1", "step-2", "step-3"} {
+		if _, ok := store.objects[bucket+"/workflow-results/wf-1/"+id+".json"]; ok {
+			t.Errorf("%s was not removed from the workflow prefix", id)
+		}
+		archived, ok := store.objects[bucket+"/archive/workflow-results/wf-1/"+id+".json"]
+		if !ok || archived.metadata[metadataChecksumSHA256] != id {
+			t.Errorf("%s was not archived with its metadata", id)
+		}
+	}
+	if _, ok := store.objects[bucket+"/workflow-results/wf-1/fresh.json"]; !ok {
+		t.Error("Recent results must stay in place")
+	}
+	if _, ok := store.objects[bucket+"/workflow-results/wf-2/step-1.json"]; !ok {
+		t.Error("Other workflows must not be archived")
+	}
+
+	// A finished archive run is a no-op
+	action, err = run(archive, "admin-secret")
+	if err != nil {
+		t.Fatalf("handleSemanticArchiveImpl() error = %v", err)
+	}
+	if value, _ := action.Result.Value.(map[string]interface{}); value["moved"] != int64(0) {
+		t.Errorf("Repeated run moved %v objects", value["moved"])
+	}
+}
+
+func TestSemanticArchive_SkipsLockedResults(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_ADMIN_KEY", "admin-secret")
+
+	bucket := defaultBucket()
+	store := newFakeStorage()
+	key := "workflow-results/wf-1/step-1.json"
+	store.objects[bucket+"/"+key] = fakeObject{data: []byte("{}"), modified: time.Now().Add(-48 * time.Hour)}
+	store.objects[bucket+"/"+lockKey(key)] = fakeObject{metadata: map[string]string{
+		metadataLockOwner:     "writer-a",
+		metadataLockExpiresAt: time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	}}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "ArchiveAction", "workflowId": "wf-1", "olderThanSeconds": 86400}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	req.Header.Set(adminOverrideHeader, "admin-secret")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.Set(storageContextKey, store)
+	if err := handleSemanticArchiveImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticArchiveImpl() error = %v", err)
+	}
+
+	value := action.Result.Value.(map[string]interface{})
+	failures, _ := value["errors"].([]map[string]interface{})
+	if value["moved"] != int64(0) || len(failures) != 1 || failures[0]["error"] != "object is locked" {
+		t.Errorf("ArchiveAction of a locked result = %v, want it reported as locked", value)
+	}
+	if _, ok := store.objects[bucket+"/"+key]; !ok {
+		t.Error("A locked result must not be moved")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// timingsContextKey is the echo context key holding the actionTimings of an
+// action sent with includeTimings
+const timingsContextKey = "timings"
+
+// actionTimings collects where the time of one semantic action went. S3
+// time is summed over all storage calls, which may run concurrently (e.g.
+// ZIP exports), so it can exceed the total.
+type actionTimings struct {
+	start    time.Time
+	parse    time.Duration
+	validate time.Duration
+	s3       atomic.Int64
+	s3Calls  atomic.Int64
+}
+
+// timingsFor returns the timings collected for the action of c, or nil when
+// the action did not ask for them
+func timingsFor(c echo.Context) *actionTimings {
+	timings, _ := c.Get(timingsContextKey).(*actionTimings)
+	return timings
+}
+
+// addS3Since records one storage call that started at start
+func (t *actionTimings) addS3Since(start time.Time) {
+	t.s3.Add(int64(time.Since(start)))
+	t.s3Calls.Add(1)
+}
+
+// value returns the timings object reported on the result, in milliseconds
+func (t *actionTimings) value() map[string]interface{} {
+	return map[string]interface{}{
+		"parseMs":    milliseconds(t.parse),
+		"validateMs": milliseconds(t.validate),
+		"s3Ms":       milliseconds(time.Duration(t.s3.Load())),
+		"s3Calls":    t.s3Calls.Load(),
+		"totalMs":    milliseconds(time.Since(t.start)),
+	}
+}
+
+// milliseconds converts d to fractional milliseconds with microsecond precision
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// addTimings reports the collected timings on the result of action as
+// timings. Results whose value is not an object are left unchanged.
+func addTimings(c echo.Context, action *semantic.SemanticAction) {
+	timings := timingsFor(c)
+	if timings == nil || action == nil || action.Result == nil {
+		return
+	}
+	switch value := action.Result.Value.(type) {
+	case nil:
+		action.Result.Value = map[string]interface{}{"timings": timings.value()}
+	case map[string]interface{}:
+		value["timings"] = timings.value()
+	}
+}
+
+// timedStorage measures the calls of the wrapped Storage for includeTimings.
+// Reads are timed until the response arrives, not until its body is read.
+type timedStorage struct {
+	Storage
+	timings *actionTimings
+}
+
+func (s timedStorage) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	defer s.timings.addS3Since(time.Now())
+	return s.Storage.PutObject(ctx, params, optFns...)
+}
+
+func (s timedStorage) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	defer s.timings.addS3Since(time.Now())
+	return s.Storage.GetObject(ctx, params, optFns...)
+}
+
+func (s timedStorage) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	defer s.timings.addS3Since(time.Now())
+	return s.Storage.HeadObject(ctx, params, optFns...)
+}
+
+func (s timedStorage) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	defer s.timings.addS3Since(time.Now())
+	return s.Storage.HeadBucket(ctx, params, optFns...)
+}
+
+func (s timedStorage) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	defer s.timings.addS3Since(time.Now())
+	return s.Storage.CopyObject(ctx, params, optFns...)
+}
+
+func (s timedStorage) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	defer s.timings.addS3Since(time.Now())
+	return s.Storage.ListObjectsV2(ctx, params, optFns...)
+}
+
+func (s timedStorage) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	defer s.timings.addS3Since(time.Now())
+	return s.Storage.DeleteObject(ctx, params, optFns...)
+}
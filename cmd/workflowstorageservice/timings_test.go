@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestSemanticAction_IncludeTimings(t *testing.T) {
+	resetStorageEnv(t)
+	registerActions()
+
+	e := echo.New()
+	store := newFakeStorage()
+	run := func(body string) map[string]interface{} {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", strings.NewReader(body)), rec)
+		c.Set(storageContextKey, store)
+		if err := handleSemanticAction(c); err != nil {
+			t.Fatalf("handleSemanticAction() error = %v", err)
+		}
+		var response struct {
+			Result struct {
+				Value map[string]interface{} `json:"value"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("Response %d: %s (%v)", rec.Code, rec.Body.String(), err)
+		}
+		return response.Result.Value
+	}
+
+	value := run(`{"@type": "CreateAction", "identifier": "timed", "includeTimings": true,
+		"object": {"@type": "DigitalDocument", "text": "{}"}}`)
+	timings, ok := value["timings"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Result without timings: %v", value)
+	}
+	for _, name := range []string{"parseMs", "validateMs", "s3Ms", "totalMs"} {
+		if ms, ok := timings[name].(float64); !ok || ms < 0 {
+			t.Errorf("timings.%s = %v", name, timings[name])
+		}
+	}
+	if calls, _ := timings["s3Calls"].(float64); calls < 1 {
+		t.Errorf("timings.s3Calls = %v, want the store's S3 calls", timings["s3Calls"])
+	}
+	if timings["totalMs"].(float64) < timings["parseMs"].(float64) {
+		t.Errorf("totalMs below parseMs: %v", timings)
+	}
+
+	if value := run(`{"@type": "CreateAction", "identifier": "untimed",
+		"object": {"@type": "DigitalDocument", "text": "{}"}}`); value["timings"] != nil {
+		t.Errorf("Timings reported without includeTimings: %v", value["timings"])
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// tlsVersions maps WORKFLOW_STORAGE_TLS_MIN_VERSION values to TLS versions
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// defaultTLSMinVersion is the minimum TLS version of S3 connections unless
+// WORKFLOW_STORAGE_TLS_MIN_VERSION is set
+const defaultTLSMinVersion = "1.2"
+
+// tlsMinVersionName returns WORKFLOW_STORAGE_TLS_MIN_VERSION, falling back to
+// defaultTLSMinVersion for unset or unsupported values
+func tlsMinVersionName() string {
+	name := strings.TrimSpace(os.Getenv("WORKFLOW_STORAGE_TLS_MIN_VERSION"))
+	if name == "" {
+		return defaultTLSMinVersion
+	}
+	if _, ok := tlsVersions[name]; !ok {
+		supported := make([]string, 0, len(tlsVersions))
+		for version := range tlsVersions {
+			supported = append(supported, version)
+		}
+		sort.Strings(supported)
+		log.Printf("Unknown WORKFLOW_STORAGE_TLS_MIN_VERSION %q (supported: %s), using %s", name, strings.Join(supported, ", "), defaultTLSMinVersion)
+		return defaultTLSMinVersion
+	}
+	return name
+}
+
+// s3HTTPClient returns the HTTP client of the S3 SDK: the SDK default,
+// refusing TLS versions below tlsMinVersionName. Clients of allowed
+// endpoints share it (see endpointClient).
+func s3HTTPClient() *awshttp.BuildableClient {
+	minVersion := tlsVersions[tlsMinVersionName()]
+	return awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.MinVersion = minVersion
+	})
+}
+
+// requireHTTPS reports whether WORKFLOW_STORAGE_REQUIRE_HTTPS is set. Startup
+// then refuses plain http:// S3 endpoints instead of warning about them.
+func requireHTTPS() bool {
+	required, _ := strconv.ParseBool(os.Getenv("WORKFLOW_STORAGE_REQUIRE_HTTPS"))
+	return required
+}
+
+// insecureEndpoints returns the S3 endpoints, the primary one and those in
+// WORKFLOW_STORAGE_ALLOWED_ENDPOINTS, that are not https:// and would send
+// signed requests in cleartext
+func insecureEndpoints(primary string) []string {
+	var allowed []string
+	for _, endpoint := range allowedEndpoints() {
+		allowed = append(allowed, endpoint)
+	}
+	sort.Strings(allowed)
+	endpoints := append([]string{primary}, allowed...)
+	var insecure []string
+	for _, endpoint := range endpoints {
+		if endpoint == "" {
+			continue
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || !strings.EqualFold(u.Scheme, "https") {
+			insecure = append(insecure, endpoint)
+		}
+	}
+	return insecure
+}
+
+// checkEndpointSchemes warns about S3 endpoints that are not https://, or
+// fails when WORKFLOW_STORAGE_REQUIRE_HTTPS is set
+func checkEndpointSchemes(primary string) error {
+	insecure := insecureEndpoints(primary)
+	if len(insecure) == 0 {
+		return nil
+	}
+	if requireHTTPS() {
+		return fmt.Errorf("S3 endpoints must use https:// (WORKFLOW_STORAGE_REQUIRE_HTTPS): %s", strings.Join(insecure, ", "))
+	}
+	log.Printf("Warning: S3 endpoints without https:// send credentials and data in cleartext: %s", strings.Join(insecure, ", "))
+	return nil
+}
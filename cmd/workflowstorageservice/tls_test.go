@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/tls"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestS3HTTPClient_TLSMinVersion(t *testing.T) {
+	for setting, want := range map[string]uint16{
+		"":    tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+		"1.0": tls.VersionTLS12,
+	} {
+		t.Setenv("WORKFLOW_STORAGE_TLS_MIN_VERSION", setting)
+		transport := s3HTTPClient().GetTransport()
+		if transport.TLSClientConfig == nil {
+			t.Fatal("Transport has no TLS configuration")
+		}
+		if got := transport.TLSClientConfig.MinVersion; got != want {
+			t.Errorf("WORKFLOW_STORAGE_TLS_MIN_VERSION=%q: MinVersion = %x, want %x", setting, got, want)
+		}
+	}
+}
+
+func TestCheckEndpointSchemes(t *testing.T) {
+	t.Setenv("WORKFLOW_STORAGE_ALLOWED_ENDPOINTS", "eu=https://fsn1.example.com,local=http://localhost:9000")
+	t.Setenv("WORKFLOW_STORAGE_REQUIRE_HTTPS", "")
+
+	if got, want := insecureEndpoints("http://s3.example.com"), []string{"http://s3.example.com", "http://localhost:9000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("insecureEndpoints() = %v, want %v", got, want)
+	}
+	if got := insecureEndpoints(""); !reflect.DeepEqual(got, []string{"http://localhost:9000"}) {
+		t.Errorf("insecureEndpoints() without a primary endpoint = %v", got)
+	}
+
+	// Plain http endpoints are only a warning by default
+	if err := checkEndpointSchemes("http://s3.example.com"); err != nil {
+		t.Errorf("checkEndpointSchemes() error = %v, want a warning only", err)
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_REQUIRE_HTTPS", "true")
+	err := checkEndpointSchemes("https://s3.example.com")
+	if err == nil || !strings.Contains(err.Error(), "http://localhost:9000") || strings.Contains(err.Error(), "s3.example.com") {
+		t.Errorf("checkEndpointSchemes() with WORKFLOW_STORAGE_REQUIRE_HTTPS error = %v", err)
+	}
+
+	t.Setenv("WORKFLOW_STORAGE_ALLOWED_ENDPOINTS", "")
+	if err := checkEndpointSchemes("https://s3.example.com"); err != nil {
+		t.Errorf("checkEndpointSchemes() with https only error = %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/labstack/echo/v4"
+)
+
+// metadataExpiresAt records an application-level expiry set by TouchAction
+const metadataExpiresAt = "expires-at"
+
+// objectExpiry returns the expires-at time recorded on an object, if any
+func objectExpiry(metadata map[string]string) (time.Time, bool) {
+	expiresAt, err := time.Parse(time.RFC3339, metadata[metadataExpiresAt])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expiresAt.UTC(), true
+}
+
+// setExpiryHeaders announces an object's expiry to HTTP clients: Expires for
+// caches and X-Expires-At with the RFC 3339 timestamp. It returns the
+// timestamp for the JSON response, or "" when the object has no expiry.
+func setExpiryHeaders(c echo.Context, metadata map[string]string) string {
+	expiresAt, ok := objectExpiry(metadata)
+	if !ok {
+		return ""
+	}
+	header := c.Response().Header()
+	header.Set("Expires", expiresAt.Format(http.TimeFormat))
+	header.Set("X-Expires-At", expiresAt.Format(time.RFC3339))
+	return expiresAt.Format(time.RFC3339)
+}
+
+// handleSemanticTouchImpl refreshes an object's LastModified by copying it
+// onto itself with MetadataDirective REPLACE. The body is copied server-side,
+// so large objects are never re-uploaded. An optional ttlSeconds property
+// records a new expires-at timestamp in the object metadata.
+func handleSemanticTouchImpl(c echo.Context, action *semantic.SemanticAction) error {
+	if action.Object == nil || action.Object.ContentUrl == "" {
+		return returnActionError(c, action, "object.contentUrl is required (resource s3:// location)", nil)
+	}
+
+	bucket, key, err := parseContentURL(action.Object.ContentUrl)
+	if err != nil {
+		return returnActionError(c, action, err.Error(), nil)
+	}
+	if err := checkTenantScope(c, key); err != nil {
+		return err
+	}
+
+	store := storageFor(c)
+	ctx := c.Request().Context()
+
+	// Metadata is read and rewritten, so serialize with other writers
+	unlock := objectLocks.Lock(bucket, key)
+	defer unlock()
+
+	head, err := store.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		logf(c, "Failed to stat %s: %v", key, err)
+		return returnActionError(c, action, "data not found", err)
+	}
+
+	// REPLACE drops existing metadata unless it is supplied again
+	metadata := make(map[string]string, len(head.Metadata)+1)
+	for k, v := range head.Metadata {
+		metadata[k] = v
+	}
+	if ttl, ok := int64Property(action, "ttlSeconds"); ok && ttl > 0 {
+		metadata[metadataExpiresAt] = time.Now().UTC().Add(time.Duration(ttl) * time.Second).Format(time.RFC3339)
+	}
+
+	result, err := store.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(copySource(bucket, key)),
+		ContentType:       head.ContentType,
+		Metadata:          metadata,
+		MetadataDirective: types.MetadataDirectiveReplace,
+	})
+	if err != nil {
+		logf(c, "Failed to touch %s: %v", key, err)
+		return returnActionError(c, action, "Failed to touch object", err)
+	}
+	resultCache.forget(bucket, key)
+
+	lastModified := time.Now().UTC()
+	if result.CopyObjectResult != nil && result.CopyObjectResult.LastModified != nil {
+		lastModified = result.CopyObjectResult.LastModified.UTC()
+	}
+
+	logf(c, "Touched workflow result: %s", key)
+
+	value := map[string]interface{}{
+		"contentUrl":   action.Object.ContentUrl,
+		"lastModified": lastModified.Format(time.RFC3339),
+	}
+	if expiresAt, ok := metadata[metadataExpiresAt]; ok {
+		value["expires"] = expiresAt
+	}
+
+	action.Result = &semantic.SemanticResult{
+		Type:  "DigitalDocument",
+		Value: value,
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// copySource builds the URL-encoded bucket/key value for CopyObject
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+// handleSemanticTouch wraps the implementation to match ActionHandler signature
+func handleSemanticTouch(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticTouchImpl(c, action)
+}
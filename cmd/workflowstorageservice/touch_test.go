@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestCopySource(t *testing.T) {
+	got := copySource("bucket", "workflow-results/wf 1/step.json")
+	if got != "bucket/workflow-results/wf%201/step.json" {
+		t.Errorf("Unexpected copy source %q", got)
+	}
+}
+
+func TestSemanticTouch_PreservesMetadataAndSetsExpiry(t *testing.T) {
+	resetStorageEnv(t)
+
+	store := newFakeStorage()
+	store.objects["px-semantic/workflow-results/wf-1/step-1.json"] = fakeObject{
+		data:        []byte("{}"),
+		contentType: "application/json",
+		metadata:    map[string]string{metadataChecksumSHA256: "abc"},
+	}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{
+		"@context": "https://schema.org",
+		"@type": "TouchAction",
+		"ttlSeconds": 3600,
+		"object": {"@type": "DigitalDocument", "contentUrl": "s3://px-semantic/workflow-results/wf-1/step-1.json"}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(storageContextKey, store)
+
+	if err := handleSemanticTouchImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticTouchImpl() error = %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	obj := store.objects["px-semantic/workflow-results/wf-1/step-1.json"]
+	if obj.metadata[metadataChecksumSHA256] != "abc" {
+		t.Error("TouchAction must keep existing metadata")
+	}
+	if obj.metadata[metadataExpiresAt] == "" {
+		t.Error("TouchAction with ttlSeconds must record expires-at")
+	}
+	if obj.contentType != "application/json" {
+		t.Errorf("TouchAction must keep the content type, got %q", obj.contentType)
+	}
+}
+
+func TestSemanticRetrieve_ExpiryHeaders(t *testing.T) {
+	resetStorageEnv(t)
+
+	store := newFakeStorage()
+	store.objects[defaultBucket()+"/workflow-results/wf-1/step-1.json"] = fakeObject{
+		data:        []byte(`{"step": 1}`),
+		contentType: "application/json",
+		metadata:    map[string]string{metadataExpiresAt: "2030-01-02T03:04:05Z"},
+	}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "RetrieveAction", "workflowId": "wf-1",
+		"object": {"@type": "DigitalDocument", "identifier": "step-1"}}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), rec)
+	c.Set(storageContextKey, store)
+	if err := handleSemanticRetrieveImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticRetrieveImpl() error = %v", err)
+	}
+
+	if got := rec.Header().Get("Expires"); got != "Wed, 02 Jan 2030 03:04:05 GMT" {
+		t.Errorf("Expires = %q", got)
+	}
+	if got := rec.Header().Get("X-Expires-At"); got != "2030-01-02T03:04:05Z" {
+		t.Errorf("X-Expires-At = %q", got)
+	}
+	value, _ := action.Result.Value.(map[string]interface{})
+	if value["expires"] != "2030-01-02T03:04:05Z" {
+		t.Errorf("Result value expires = %v", value["expires"])
+	}
+
+	// Objects without an expiry get no headers
+	if _, ok := objectExpiry(map[string]string{}); ok {
+		t.Error("objectExpiry() of an object without expires-at should report false")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// transcoding converts a stored object to another encoding on retrieve.
+// accepts reports whether the stored content type and data can be converted;
+// run returns the converted data and its content type.
+type transcoding struct {
+	accepts func(contentType string, data []byte) bool
+	run     func(data []byte, contentType string) ([]byte, string, error)
+}
+
+// transcodings are the targets of the transcodeTo retrieve property
+var transcodings = map[string]transcoding{
+	// plain: stored gzip -> decompressed bytes
+	"plain": {
+		accepts: func(contentType string, data []byte) bool {
+			return bytes.HasPrefix(data, []byte{0x1f, 0x8b})
+		},
+		run: func(data []byte, contentType string) ([]byte, string, error) {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, "", err
+			}
+			plain, err := io.ReadAll(zr)
+			return plain, "application/octet-stream", err
+		},
+	},
+	// json-pretty: stored JSON -> indented JSON
+	"json-pretty": {
+		accepts: acceptsJSON,
+		run: func(data []byte, contentType string) ([]byte, string, error) {
+			var out bytes.Buffer
+			err := json.Indent(&out, data, "", "  ")
+			return out.Bytes(), contentType, err
+		},
+	},
+	// json-minify: stored JSON -> compact JSON
+	"json-minify": {
+		accepts: acceptsJSON,
+		run: func(data []byte, contentType string) ([]byte, string, error) {
+			var out bytes.Buffer
+			err := json.Compact(&out, data)
+			return out.Bytes(), contentType, err
+		},
+	},
+	// raw: stored base64 text -> decoded bytes
+	"raw": {
+		accepts: func(contentType string, data []byte) bool {
+			_, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+			return isTextualContentType(contentType) && err == nil
+		},
+		run: func(data []byte, contentType string) ([]byte, string, error) {
+			raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+			return raw, "application/octet-stream", err
+		},
+	},
+	// base64: any stored bytes -> base64 text
+	"base64": {
+		accepts: func(string, []byte) bool { return true },
+		run: func(data []byte, contentType string) ([]byte, string, error) {
+			return []byte(base64.StdEncoding.EncodeToString(data)), "text/plain", nil
+		},
+	},
+}
+
+// acceptsJSON reports whether a stored object is a JSON document
+func acceptsJSON(contentType string, data []byte) bool {
+	folder, _ := typeFolder(contentType)
+	return folder == "json" && json.Valid(data)
+}
+
+// transcodeTargets lists the supported transcodeTo values for error messages
+func transcodeTargets() string {
+	targets := make([]string, 0, len(transcodings))
+	for target := range transcodings {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return strings.Join(targets, ", ")
+}
+
+// transcodeData converts data of contentType to target. The error describes
+// an unknown target or a stored object the target does not apply to and is
+// answered with 400.
+func transcodeData(data []byte, contentType, target string) ([]byte, string, error) {
+	transcoding, ok := transcodings[target]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported transcodeTo %q (supported: %s)", target, transcodeTargets())
+	}
+	if !transcoding.accepts(contentType, data) {
+		return nil, "", fmt.Errorf("cannot transcode %s object to %s", contentType, target)
+	}
+	out, outType, err := transcoding.run(data, contentType)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot transcode %s object to %s: %v", contentType, target, err)
+	}
+	return out, outType, nil
+}
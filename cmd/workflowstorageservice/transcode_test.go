@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestTranscodeData(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte("hello"))
+	zw.Close()
+
+	tests := []struct {
+		target, contentType, data string
+		want, wantType            string
+	}{
+		{"plain", "application/gzip", compressed.String(), "hello", "application/octet-stream"},
+		{"json-pretty", "application/json", `{"a":[1,2]}`, "{\n  \"a\": [\n    1,\n    2\n  ]\n}", "application/json"},
+		{"json-minify", "application/ld+json", "{ \"a\" : 1 }", `{"a":1}`, "application/ld+json"},
+		{"raw", "text/plain", "aGVsbG8=\n", "hello", "application/octet-stream"},
+		{"base64", "application/octet-stream", "hello", "aGVsbG8=", "text/plain"},
+	}
+	for _, tt := range tests {
+		got, gotType, err := transcodeData([]byte(tt.data), tt.contentType, tt.target)
+		if err != nil || string(got) != tt.want || gotType != tt.wantType {
+			t.Errorf("transcodeData(%s) = %q, %q, %v, want %q, %q", tt.target, got, gotType, err, tt.want, tt.wantType)
+		}
+	}
+
+	for _, tt := range []struct{ target, contentType, data string }{
+		{"plain", "application/json", `{"a": 1}`},
+		{"json-pretty", "text/csv", "a,b\n"},
+		{"json-pretty", "application/json", "{broken"},
+		{"raw", "text/plain", "not base64!"},
+		{"brotli", "application/json", "{}"},
+	} {
+		if _, _, err := transcodeData([]byte(tt.data), tt.contentType, tt.target); err == nil {
+			t.Errorf("transcodeData(%s) of %s should fail", tt.target, tt.contentType)
+		}
+	}
+}
+
+func TestSemanticRetrieve_TranscodeTo(t *testing.T) {
+	resetStorageEnv(t)
+
+	store := newFakeStorage()
+	store.objects[defaultBucket()+"/workflow-results/wf-1/step-1.json"] = fakeObject{data: []byte(`{"a":1}`), contentType: "application/json"}
+
+	retrieve := func(target string) (*semantic.SemanticAction, error) {
+		action, err := semantic.ParseSemanticAction([]byte(`{"@type": "RetrieveAction", "workflowId": "wf-1", "transcodeTo": "` + target + `",
+			"object": {"@type": "DigitalDocument", "identifier": "step-1"}}`))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return action, handleSemanticRetrieveImpl(c, action)
+	}
+
+	action, err := retrieve("json-pretty")
+	if err != nil {
+		t.Fatalf("handleSemanticRetrieveImpl() error = %v", err)
+	}
+	if action.Result.Output != "{\n  \"a\": 1\n}" {
+		t.Errorf("Output = %q, want indented JSON", action.Result.Output)
+	}
+
+	var httpErr *echo.HTTPError
+	if _, err := retrieve("plain"); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("transcodeTo plain on JSON: error = %v, want 400", err)
+	}
+}
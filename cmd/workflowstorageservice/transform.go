@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// maxCopyTransforms bounds the length of a transform chain
+const maxCopyTransforms = 4
+
+// contentTransform rewrites a stream. run copies src to dst while
+// transforming it; contentType maps the input media type to the output one.
+type contentTransform struct {
+	run         func(dst io.Writer, src io.Reader) error
+	contentType func(in string) string
+}
+
+// copyTransforms are the transforms CopyAction may chain. All of them stream,
+// so memory use does not grow with the object size.
+var copyTransforms = map[string]contentTransform{
+	"gzip": {
+		run: func(dst io.Writer, src io.Reader) error {
+			zw := gzip.NewWriter(dst)
+			if _, err := io.Copy(zw, src); err != nil {
+				return err
+			}
+			return zw.Close()
+		},
+		contentType: func(string) string { return "application/gzip" },
+	},
+	"gunzip": {
+		run: func(dst io.Writer, src io.Reader) error {
+			zr, err := gzip.NewReader(src)
+			if err != nil {
+				return fmt.Errorf("gunzip: %w", err)
+			}
+			_, err = io.Copy(dst, zr)
+			return err
+		},
+		contentType: func(string) string { return "application/octet-stream" },
+	},
+	"base64-encode": {
+		run: func(dst io.Writer, src io.Reader) error {
+			enc := base64.NewEncoder(base64.StdEncoding, dst)
+			if _, err := io.Copy(enc, src); err != nil {
+				return err
+			}
+			return enc.Close()
+		},
+		contentType: func(string) string { return "text/plain" },
+	},
+	"base64-decode": {
+		run: func(dst io.Writer, src io.Reader) error {
+			_, err := io.Copy(dst, base64.NewDecoder(base64.StdEncoding, src))
+			return err
+		},
+		contentType: func(string) string { return "application/octet-stream" },
+	},
+	"json-minify": {
+		run:         minifyJSON,
+		contentType: func(in string) string { return in },
+	},
+}
+
+// transformChain validates names and returns the transforms in order
+func transformChain(names []string) ([]contentTransform, error) {
+	if len(names) > maxCopyTransforms {
+		return nil, fmt.Errorf("too many transforms (max %d)", maxCopyTransforms)
+	}
+	chain := make([]contentTransform, 0, len(names))
+	for _, name := range names {
+		transform, ok := copyTransforms[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown transform %q", name)
+		}
+		chain = append(chain, transform)
+	}
+	return chain, nil
+}
+
+// applyTransforms connects the chain with pipes and returns the reader of the
+// final output together with its content type. Each stage runs in its own
+// goroutine; errors travel downstream through the pipes, and closing the
+// returned reader early unblocks every stage.
+func applyTransforms(src io.Reader, contentType string, chain []contentTransform) (io.ReadCloser, string) {
+	out := io.NopCloser(src)
+	for _, transform := range chain {
+		upstream := out
+		pr, pw := io.Pipe()
+		go func(run func(io.Writer, io.Reader) error) {
+			err := run(pw, upstream)
+			pw.CloseWithError(err)
+			// Unblock the previous stage if this one stopped reading early
+			_ = upstream.Close()
+		}(transform.run)
+		out = pr
+		contentType = transform.contentType(contentType)
+	}
+	return out, contentType
+}
+
+// minifyJSON strips insignificant whitespace from a JSON document while
+// streaming. Input that is not valid JSON is passed through minus whitespace
+// outside of strings.
+func minifyJSON(dst io.Writer, src io.Reader) error {
+	in := bufio.NewReader(src)
+	out := bufio.NewWriter(dst)
+	inString, escaped := false, false
+	for {
+		b, err := in.ReadByte()
+		if err == io.EOF {
+			return out.Flush()
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r':
+			continue
+		}
+		if err := out.WriteByte(b); err != nil {
+			return err
+		}
+	}
+}
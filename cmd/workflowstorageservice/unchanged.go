@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// storedUnchanged reports whether bucket/key already holds data with the same
+// content type, encryption, compression and immutability as the requested write. Content
+// is compared by the plaintext SHA-256 recorded in the object metadata, so
+// encrypted objects and objects stored before checksums were recorded always
+// count as changed.
+func storedUnchanged(ctx context.Context, store Storage, bucket, key string, data []byte, format string, encrypt bool, compression string, immutable bool) (bool, error) {
+	head, err := store.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	checksum := head.Metadata[metadataChecksumSHA256]
+	switch {
+	case checksum == "" || checksum != sha256Hex(data):
+		return false, nil
+	case aws.ToString(head.ContentType) != format:
+		return false, nil
+	case isEncrypted(head.Metadata) != encrypt:
+		return false, nil
+	case head.Metadata[metadataCompression] != compression:
+		return false, nil
+	case isInProgress(head.Metadata):
+		// Finishing an in-progress result needs a write to clear the marker
+		return false, nil
+	case immutable && head.Metadata[metadataImmutable] != "true":
+		// Upgrading an object to immutable needs a write
+		return false, nil
+	}
+	return true, nil
+}
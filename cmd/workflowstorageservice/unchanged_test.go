@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSemanticStore_SkipIfUnchanged(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+	const id = "px-semantic/workflow-results/wf-1/step-1.json"
+
+	run := func(text string) map[string]interface{} {
+		body, _ := json.Marshal(map[string]interface{}{
+			"@type":           "CreateAction",
+			"identifier":      "step-1",
+			"skipIfUnchanged": true,
+			"object":          map[string]interface{}{"@type": "DigitalDocument", "text": text},
+		})
+		action, err := semantic.ParseSemanticAction(body)
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+		req.Header.Set("X-Workflow-ID", "wf-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(storageContextKey, store)
+		if err := handleSemanticStoreImpl(c, action); err != nil {
+			t.Fatalf("handleSemanticStoreImpl() error = %v", err)
+		}
+
+		var response struct {
+			Result struct {
+				Value map[string]interface{} `json:"value"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return response.Result.Value
+	}
+
+	before := dedupMetrics.snapshot()
+
+	if value := run(`{"v": 1}`); value["notModified"] == true {
+		t.Fatal("Expected first store to write")
+	}
+	written := store.objects[id].modified
+
+	if value := run(`{"v": 1}`); value["notModified"] != true {
+		t.Errorf("Expected identical store to be skipped, got %v", value)
+	}
+	if !store.objects[id].modified.Equal(written) {
+		t.Error("Expected the object not to be rewritten")
+	}
+
+	if value := run(`{"v": 2}`); value["notModified"] == true {
+		t.Errorf("Expected changed content to be written, got %v", value)
+	}
+	if string(store.objects[id].data) != `{"v": 2}` {
+		t.Errorf("Expected updated content, got %q", store.objects[id].data)
+	}
+
+	after := dedupMetrics.snapshot()
+	if hits := after.Hits - before.Hits; hits != 1 {
+		t.Errorf("Expected 1 dedup hit, got %d", hits)
+	}
+	if misses := after.Misses - before.Misses; misses != 2 {
+		t.Errorf("Expected 2 dedup misses, got %d", misses)
+	}
+	if saved := after.BytesSaved - before.BytesSaved; saved != int64(len(`{"v": 1}`)) {
+		t.Errorf("Expected %d bytes saved, got %d", len(`{"v": 1}`), saved)
+	}
+}
+
+func TestSemanticStore_SkipIfUnchangedHonoursPreconditions(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+	store.objects["px-semantic/workflow-results/wf-1/step-1.json"] = fakeObject{data: []byte(`{"v": 1}`), contentType: "application/json"}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{
+		"@type": "CreateAction",
+		"identifier": "step-1",
+		"skipIfUnchanged": true,
+		"object": {"@type": "DigitalDocument", "text": "{\"v\": 1}"}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	req.Header.Set("X-Workflow-ID", "wf-1")
+	req.Header.Set("If-None-Match", "*")
+	c := e.NewContext(req, httptest.NewRecorder())
+	c.Set(storageContextKey, store)
+
+	// Create-if-absent must fail even though the content is unchanged
+	var httpErr *echo.HTTPError
+	if err := handleSemanticStoreImpl(c, action); !errors.As(err, &httpErr) || httpErr.Code != http.StatusPreconditionFailed {
+		t.Errorf("handleSemanticStoreImpl() error = %v, want 412", err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+// layoutFormats holds one encoding format per layout folder (see
+// typeFolder), enough to reproduce every key a router can produce
+var layoutFormats = []string{
+	"application/json",
+	"application/x-ndjson",
+	"text/csv",
+	"application/xml",
+	"text/plain",
+	"application/octet-stream",
+}
+
+// parseS3URL splits an s3://bucket/key URL
+func parseS3URL(contentURL string) (string, string, error) {
+	rest, ok := strings.CutPrefix(contentURL, "s3://")
+	if !ok {
+		return "", "", errors.New("only s3:// URLs supported")
+	}
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" || key == "" {
+		return "", "", errors.New("invalid s3 URL format")
+	}
+	return bucket, key, nil
+}
+
+// matchResultKey finds the result that router stores at bucket/key. Routers
+// only map forward, so candidate workflow IDs (one key segment) and
+// identifiers (the segments after it, without extension) are routed for
+// every configured type and layout format until one reproduces the key.
+func matchResultKey(router Router, bucket, key string) (RouteRequest, bool) {
+	types := []string{""}
+	for capability := range bucketMap() {
+		types = append(types, capability)
+	}
+	sort.Strings(types[1:])
+
+	// Key parts start at the beginning and after every "/" or flat key
+	// separator; the workflow ID is one part, the identifier the rest
+	delimiters := []string{"/"}
+	if flatKeysEnabled() {
+		delimiters = append(delimiters, keySeparator())
+	}
+	starts, ends := []int{0}, []int{}
+	for i := 0; i < len(key); i++ {
+		for _, delimiter := range delimiters {
+			if strings.HasPrefix(key[i:], delimiter) {
+				ends = append(ends, i)
+				starts = append(starts, i+len(delimiter))
+				i += len(delimiter) - 1
+				break
+			}
+		}
+	}
+	ends = append(ends, len(key))
+
+	for i := range starts {
+		workflowID := key[starts[i]:ends[i]]
+		for j := i + 1; j < len(starts); j++ {
+			rest := key[starts[j]:]
+			for _, format := range layoutFormats {
+				_, ext := typeFolder(format)
+				identifier := strings.TrimSuffix(rest, ext)
+				if identifier == "" {
+					continue
+				}
+				for _, typ := range types {
+					req := RouteRequest{WorkflowID: workflowID, Identifier: identifier, Type: typ, Format: format}
+					route, err := router.Route(req)
+					if err == nil && route.Bucket == bucket && route.Key == key {
+						return req, true
+					}
+				}
+			}
+		}
+	}
+	return RouteRequest{}, false
+}
+
+// handleSemanticValidateImpl checks whether object.contentUrl points into
+// the service's namespace: a configured bucket and a key the configured
+// router (including tenant, environment and normalization) would produce.
+// A foreign URL is not an error; valid is false and reason explains why.
+func handleSemanticValidateImpl(c echo.Context, action *semantic.SemanticAction) error {
+	if action.Object == nil || action.Object.ContentUrl == "" {
+		return returnActionError(c, action, "object.contentUrl is required (resource s3:// location)", nil)
+	}
+	contentURL := action.Object.ContentUrl
+
+	router, err := routerFor(tenantFor(c))
+	if err != nil {
+		return returnActionError(c, action, "Failed to resolve storage location", err)
+	}
+
+	value := map[string]interface{}{
+		"contentUrl": contentURL,
+		"valid":      false,
+	}
+	bucket, key, err := parseS3URL(contentURL)
+	switch {
+	case err != nil:
+		value["reason"] = err.Error()
+	case !isConfiguredBucket(bucket):
+		value["bucket"] = bucket
+		value["reason"] = "bucket is not managed by this service"
+	case hasDotSegment(key):
+		value["bucket"], value["key"] = bucket, key
+		value["reason"] = "key contains . or .. segments"
+	default:
+		value["bucket"], value["key"] = bucket, key
+		req, ok := matchResultKey(router, bucket, key)
+		if !ok {
+			value["reason"] = "key does not match the configured key layout"
+			break
+		}
+		value["valid"] = true
+		value["workflowId"] = req.WorkflowID
+		value["identifier"] = req.Identifier
+		if req.Type != "" {
+			value["type"] = req.Type
+		}
+	}
+
+	action.Result = &semantic.SemanticResult{
+		Type:  "PropertyValue",
+		Value: value,
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// isConfiguredBucket reports whether bucket is one of configuredBuckets
+func isConfiguredBucket(bucket string) bool {
+	for _, configured := range configuredBuckets() {
+		if configured == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSemanticValidate wraps the implementation to match ActionHandler signature
+func handleSemanticValidate(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticValidateImpl(c, action)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSemanticValidate(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_BUCKET_MAP", "data=large-blobs/team-a")
+
+	store := newFakeStorage()
+	validate := func(contentURL string) map[string]interface{} {
+		t.Helper()
+		action, err := semantic.ParseSemanticAction([]byte(`{"@type": "ValidateAction",
+			"object": {"@type": "DigitalDocument", "contentUrl": "` + contentURL + `"}}`))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		if err := handleSemanticValidateImpl(c, action); err != nil {
+			t.Fatalf("handleSemanticValidateImpl(%s) error = %v", contentURL, err)
+		}
+		return action.Result.Value.(map[string]interface{})
+	}
+
+	value := validate("s3://px-semantic/workflow-results/wf-1/step-1.json")
+	if value["valid"] != true || value["workflowId"] != "wf-1" || value["identifier"] != "step-1" || value["type"] != nil {
+		t.Errorf("Default bucket URL = %v", value)
+	}
+	value = validate("s3://large-blobs/team-a/workflow-results/wf-2/nested/step-2.json")
+	if value["valid"] != true || value["workflowId"] != "wf-2" || value["identifier"] != "nested/step-2" || value["type"] != "data-storage" {
+		t.Errorf("Mapped bucket URL = %v", value)
+	}
+
+	for contentURL, reason := range map[string]string{
+		"https://px-semantic/workflow-results/wf-1/step-1.json": "only s3:// URLs supported",
+		"s3://someone-else/workflow-results/wf-1/step-1.json":   "bucket is not managed by this service",
+		"s3://px-semantic/workflow-results/../secrets.json":     "key contains . or .. segments",
+		"s3://px-semantic/uploads/wf-1/step-1.json":             "key does not match the configured key layout",
+		"s3://large-blobs/workflow-results/wf-1/step-1.json":    "key does not match the configured key layout",
+	} {
+		if value := validate(contentURL); value["valid"] != false || value["reason"] != reason {
+			t.Errorf("%s = %v, want reason %q", contentURL, value, reason)
+		}
+	}
+	if store.gets != 0 || len(store.objects) != 0 {
+		t.Error("Validation should not touch storage")
+	}
+}
+
+func TestSemanticValidate_ShardedAndTenantKeys(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_SHARD_KEYS", "true")
+	t.Setenv("WORKFLOW_STORAGE_TYPE_FOLDERS", "true")
+
+	router, err := routerFor("acme")
+	if err != nil {
+		t.Fatalf("routerFor() error = %v", err)
+	}
+	route, err := router.Route(RouteRequest{WorkflowID: "wf-1", Identifier: "report", Format: "text/csv"})
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+
+	req, ok := matchResultKey(router, route.Bucket, route.Key)
+	if !ok || req.WorkflowID != "wf-1" || req.Identifier != "report" {
+		t.Errorf("matchResultKey(%s) = %+v, %v", route.Key, req, ok)
+	}
+
+	// Another tenant's router does not claim the key
+	other, err := routerFor("globex")
+	if err != nil {
+		t.Fatalf("routerFor() error = %v", err)
+	}
+	if _, ok := matchResultKey(other, route.Bucket, route.Key); ok {
+		t.Errorf("Key %s matched another tenant's layout", route.Key)
+	}
+}
+
+func TestMatchResultKey_FlatKeys(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_TYPE_FOLDERS", "true")
+	t.Setenv("WORKFLOW_STORAGE_FLAT_KEYS", "true")
+
+	router, err := routerFor("")
+	if err != nil {
+		t.Fatalf("routerFor() error = %v", err)
+	}
+	route, err := router.Route(RouteRequest{WorkflowID: "wf-1", Identifier: "report__v2", Format: "text/csv"})
+	if err != nil {
+		t.Fatalf("Route() error = %v", err)
+	}
+	if route.Key != "workflow-results/wf-1__csv__report__v2.csv" {
+		t.Fatalf("Route() key = %s", route.Key)
+	}
+
+	req, ok := matchResultKey(router, route.Bucket, route.Key)
+	if !ok || req.WorkflowID != "wf-1" || req.Identifier != "report__v2" {
+		t.Errorf("matchResultKey(%s) = %+v, %v", route.Key, req, ok)
+	}
+
+	if _, err := router.Route(RouteRequest{WorkflowID: "wf__1", Identifier: "report"}); err == nil {
+		t.Error("Route() accepted a workflow ID containing the separator")
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"eve.evalgo.org/semantic"
 	"github.com/labstack/echo/v4"
+	"workflowstorageservice.evalgo.org/actions"
 )
 
 func TestSemanticActionEndpoint_InvalidJSON(t *testing.T) {
@@ -82,6 +85,73 @@ func TestSemanticActionEndpoint_UnsupportedActionType(t *testing.T) {
 	}
 }
 
+func TestUnsupportedActionMessage_ListsSupportedTypes(t *testing.T) {
+	original := supportedActionTypes
+	defer func() { supportedActionTypes = original }()
+	supportedActionTypes = []string{"CreateAction", "RetrieveAction"}
+
+	msg := unsupportedActionMessage("UnsupportedAction")
+	expected := "unsupported action type: UnsupportedAction (supported: CreateAction, RetrieveAction)"
+	if msg != expected {
+		t.Errorf("Expected %q, got %q", expected, msg)
+	}
+
+	if !isSupportedActionType("CreateAction") {
+		t.Error("CreateAction should be supported")
+	}
+	if isSupportedActionType("UnsupportedAction") {
+		t.Error("UnsupportedAction should not be supported")
+	}
+}
+
+func TestStoreEndpoint_EmptyDataRequiresAllowEmpty(t *testing.T) {
+	e := echo.New()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"workflowId": "wf-1",
+		"actionId":   "step-1",
+		"data":       "",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/store", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if err := handleStore(c); err != nil {
+		t.Fatalf("handleStore() error = %v", err)
+	}
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for empty data without allowEmpty, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestRespondAction_JSONLD(t *testing.T) {
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	req.Header.Set("Accept", "application/ld+json")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	action := &semantic.SemanticAction{Type: "RetrieveAction"}
+	if err := respondAction(c, action); err != nil {
+		t.Fatalf("respondAction() error = %v", err)
+	}
+
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/ld+json" {
+		t.Errorf("Expected Content-Type application/ld+json, got %q", contentType)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response["@context"] != jsonLDContext {
+		t.Errorf("Expected @context %q, got %v", jsonLDContext, response["@context"])
+	}
+}
+
 func TestHealthEndpoint(t *testing.T) {
 	e := echo.New()
 
@@ -110,3 +180,189 @@ func TestHealthEndpoint(t *testing.T) {
 		t.Errorf("Expected status 'ok', got '%v'", response["status"])
 	}
 }
+
+func TestReturnActionError_IncludesRequestID(t *testing.T) {
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	rec := httptest.NewRecorder()
+	rec.Header().Set(echo.HeaderXRequestID, "req-123")
+	c := e.NewContext(req, rec)
+
+	_ = returnActionError(c, &semantic.SemanticAction{Type: "RetrieveAction"}, "data not found", nil)
+
+	if !bytes.Contains(rec.Body.Bytes(), []byte("req-123")) {
+		t.Errorf("Expected error response to contain the request ID, got %s", rec.Body.String())
+	}
+}
+
+func TestSemanticStoreAndRetrieve_WithInjectedStorage(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+
+	storeAction, err := actions.NewStoreAction().
+		WithIdentifier("step-1").
+		WithText(`{"result": 42}`).
+		WithFormat("application/json").
+		Action()
+	if err != nil {
+		t.Fatalf("Action() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	req.Header.Set("X-Workflow-ID", "wf-1")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(storageContextKey, store)
+
+	if err := handleSemanticStoreImpl(c, storeAction); err != nil {
+		t.Fatalf("handleSemanticStoreImpl() error = %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	value, ok := storeAction.Result.Value.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Unexpected store result value %#v", storeAction.Result.Value)
+	}
+	contentURL, _ := value["contentUrl"].(string)
+	if contentURL != "s3://px-semantic/workflow-results/wf-1/step-1.json" {
+		t.Errorf("Unexpected contentUrl %q", contentURL)
+	}
+
+	retrieveAction, err := actions.NewRetrieveAction().
+		WithIdentifier("step-1").
+		WithContentURL(contentURL).
+		Action()
+	if err != nil {
+		t.Fatalf("Action() error = %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.Set(storageContextKey, store)
+
+	if err := handleSemanticRetrieveImpl(c, retrieveAction); err != nil {
+		t.Fatalf("handleSemanticRetrieveImpl() error = %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if retrieveAction.Result.Output != `{"result": 42}` {
+		t.Errorf("Unexpected retrieved output %q", retrieveAction.Result.Output)
+	}
+}
+
+func TestSemanticRetrieve_NotFoundWithInjectedStorage(t *testing.T) {
+	e := echo.New()
+
+	action, err := semantic.ParseSemanticAction([]byte(`{
+		"@context": "https://schema.org",
+		"@type": "RetrieveAction",
+		"object": {"@type": "DigitalDocument", "contentUrl": "s3://px-semantic/workflow-results/wf-1/missing.json"}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(storageContextKey, newFakeStorage())
+
+	if err := handleSemanticRetrieveImpl(c, action); err != nil {
+		return
+	}
+	if rec.Code == http.StatusOK {
+		t.Error("handleSemanticRetrieveImpl() should not return 200 OK for a missing object")
+	}
+}
+
+func TestSemanticRetrieve_ByIdentifier(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+	store.objects["px-semantic/workflow-results/wf-1/step-1.json"] = fakeObject{
+		data:        []byte(`{"ok": true}`),
+		contentType: "application/json",
+	}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{
+		"@context": "https://schema.org",
+		"@type": "RetrieveAction",
+		"object": {"@type": "DigitalDocument", "identifier": "step-1"}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	req.Header.Set("X-Workflow-ID", "wf-1")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set(storageContextKey, store)
+
+	if err := handleSemanticRetrieveImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticRetrieveImpl() error = %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if action.Result.Output != `{"ok": true}` {
+		t.Errorf("Unexpected retrieved output %q", action.Result.Output)
+	}
+}
+
+func TestFetchHead_ReturnsHeadersWithoutBody(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+	store.objects["px-semantic/workflow-results/wf-1/step-1.json"] = fakeObject{
+		data:        []byte(`{"ok": true}`),
+		contentType: "application/json",
+		modified:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	head := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodHead, "/v1/api/fetch/"+key, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("key")
+		c.SetParamValues(key)
+		c.Set(storageContextKey, store)
+		if err := handleFetchHead(c); err != nil {
+			t.Fatalf("handleFetchHead() error = %v", err)
+		}
+		return rec
+	}
+
+	rec := head("workflow-results/wf-1/step-1.json")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got %q", rec.Body.String())
+	}
+	if got := rec.Header().Get(echo.HeaderContentLength); got != "12" {
+		t.Errorf("Expected Content-Length 12, got %q", got)
+	}
+	if got := rec.Header().Get(echo.HeaderContentType); got != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %q", got)
+	}
+	if rec.Header().Get("ETag") == "" {
+		t.Error("Expected ETag header")
+	}
+	if got := rec.Header().Get(echo.HeaderLastModified); got != "Fri, 02 Jan 2026 03:04:05 GMT" {
+		t.Errorf("Unexpected Last-Modified %q", got)
+	}
+
+	if rec := head("workflow-results/wf-1/missing.json"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing object, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// versionLayout formats the versions appended to result keys. It is fixed
+// width, so versions sort lexically in the order they were written.
+const versionLayout = "20060102T150405.000Z"
+
+// maxVersionAttempts bounds the search for an unused version when several
+// stores of a result fall into the same millisecond
+const maxVersionAttempts = 100
+
+// versioningEnabled reports whether WORKFLOW_STORAGE_VERSIONING is set. Stores
+// then keep every write of a result under its own key (see versionedKey) and
+// the result's key holds a copy of the latest version.
+func versioningEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("WORKFLOW_STORAGE_VERSIONING"))
+	return enabled
+}
+
+// keepVersions returns how many versions of a result a store keeps, 0 for
+// all: the keepVersions property, which also versions this store when
+// WORKFLOW_STORAGE_VERSIONING is off, or with versioning enabled
+// WORKFLOW_STORAGE_KEEP_VERSIONS
+func keepVersions(action *semantic.SemanticAction) (int64, error) {
+	if action.Properties != nil && action.Properties["keepVersions"] != nil {
+		keep, ok := int64Property(action, "keepVersions")
+		if !ok || keep < 1 {
+			return 0, echo.NewHTTPError(http.StatusBadRequest, "keepVersions must be a positive number")
+		}
+		return keep, nil
+	}
+	return keepVersionsDefault(), nil
+}
+
+// keepVersionsDefault returns WORKFLOW_STORAGE_KEEP_VERSIONS, the versions
+// versioned stores keep when WORKFLOW_STORAGE_VERSIONING is enabled, 0 for all
+func keepVersionsDefault() int64 {
+	if !versioningEnabled() {
+		return 0
+	}
+	keep, err := strconv.ParseInt(os.Getenv("WORKFLOW_STORAGE_KEEP_VERSIONS"), 10, 64)
+	if err != nil || keep < 0 {
+		return 0
+	}
+	return keep
+}
+
+// versionedKey returns the key of one version of the result stored at key:
+// the version is inserted in front of the extension, e.g.
+// workflow-results/wf-1/config.json becomes
+// workflow-results/wf-1/config-20240101T120000.000Z.json
+func versionedKey(key, version string) string {
+	dir, name := path.Split(key)
+	ext := path.Ext(name)
+	return dir + strings.TrimSuffix(name, ext) + "-" + version + ext
+}
+
+// versionOf returns the version of versioned, a key produced by versionedKey
+// for key, or false when versioned is not a version of key
+func versionOf(key, versioned string) (string, bool) {
+	dir, name := path.Split(key)
+	ext := path.Ext(name)
+	stem := dir + strings.TrimSuffix(name, ext) + "-"
+	if !strings.HasPrefix(versioned, stem) || !strings.HasSuffix(versioned, ext) || len(versioned) < len(stem)+len(ext) {
+		return "", false
+	}
+	version := versioned[len(stem) : len(versioned)-len(ext)]
+	if parseVersion(version) != nil {
+		return "", false
+	}
+	return version, true
+}
+
+// isVersionKey reports whether key looks like a key produced by versionedKey,
+// i.e. its name ends in -{version} before the extension (or at the end).
+// Plain listings skip such keys; versions are listed with versionsOf.
+func isVersionKey(key string) bool {
+	name := path.Base(key)
+	for _, stem := range []string{strings.TrimSuffix(name, path.Ext(name)), name} {
+		if i := len(stem) - len(versionLayout) - 1; i > 0 && stem[i] == '-' && parseVersion(stem[i+1:]) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVersion checks that version is in versionLayout
+func parseVersion(version string) error {
+	t, err := time.Parse(versionLayout, version)
+	if err != nil || t.Format(versionLayout) != version {
+		return fmt.Errorf("invalid version %q (expected e.g. %s)", version, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).Format(versionLayout))
+	}
+	return nil
+}
+
+// newVersion picks the version for a new write of the result at key: the
+// current time, moved forward a millisecond at a time while that version
+// exists. Callers hold the object lock of key, so writes within this
+// instance never pick the same version.
+func newVersion(ctx context.Context, store Storage, bucket, key string) (string, error) {
+	t := time.Now().UTC()
+	for i := 0; i < maxVersionAttempts; i++ {
+		version := t.Format(versionLayout)
+		_, err := store.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(versionedKey(key, version)),
+		})
+		if err != nil {
+			if isNotFoundError(err) {
+				return version, nil
+			}
+			return "", err
+		}
+		t = t.Add(time.Millisecond)
+	}
+	return "", fmt.Errorf("no unused version for %s", key)
+}
+
+// promoteVersion makes the version stored at versioned the latest one by
+// copying it over key server-side, metadata included
+func promoteVersion(ctx context.Context, store Storage, bucket, key, versioned string) error {
+	if _, err := store.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		CopySource: aws.String(copySource(bucket, versioned)),
+	}); err != nil {
+		return err
+	}
+	missingObjects.forget(bucket, key)
+	resultCache.forget(bucket, key)
+	return nil
+}
+
+// versionKeys returns the keys of all versions of the result at key, oldest
+// first
+func versionKeys(ctx context.Context, store Storage, bucket, key string) ([]string, error) {
+	dir, name := path.Split(key)
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(dir + strings.TrimSuffix(name, path.Ext(name)) + "-"),
+		MaxKeys: aws.Int32(maxListPageSize),
+	}
+	var keys []string
+	for {
+		page, err := store.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			if _, ok := versionOf(key, aws.ToString(obj.Key)); ok {
+				keys = append(keys, aws.ToString(obj.Key))
+			}
+		}
+		if !aws.ToBool(page.IsTruncated) || page.NextContinuationToken == nil {
+			return keys, nil
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+}
+
+// pruneVersions deletes the oldest versions of the result at key beyond the
+// keep newest, turning its history into a ring buffer. Immutable and retained
+// versions, and versions that fail to delete, are kept and still count; no
+// newer version is deleted in their place, so the history can outgrow keep.
+// It returns the number of versions left and the number deleted.
+func pruneVersions(ctx context.Context, c echo.Context, store Storage, bucket, key string, keep int64) (int, int, error) {
+	keys, err := versionKeys(ctx, store, bucket, key)
+	if err != nil {
+		return 0, 0, err
+	}
+	pruned := 0
+	for _, versioned := range keys[:max(int64(len(keys))-keep, 0)] {
+		if err := checkMutable(ctx, c, store, bucket, versioned); err != nil {
+			logf(c, "Keeping version %s: %v", versioned, err)
+			continue
+		}
+		if _, err := store.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(versioned),
+		}); err != nil {
+			logf(c, "Failed to prune version %s: %v", versioned, err)
+			continue
+		}
+		resultCache.forget(bucket, versioned)
+		if err := deleteAccessStats(ctx, store, bucket, versioned); err != nil {
+			logf(c, "Failed to delete access stats of %s: %v", versioned, err)
+		}
+		pruned++
+	}
+	return len(keys) - pruned, pruned, nil
+}
+
+// listVersions answers a ListAction with versionsOf: the versions of one
+// result, oldest first, with the latest in latestVersion. The result is
+// routed like a store with the action's workflowId, type and encodingFormat
+// (which decides the key extension). At most maxListKeys versions are
+// returned; truncated reports a longer history.
+func listVersions(c echo.Context, action *semantic.SemanticAction, identifier string) error {
+	route, err := routeAction(c, action, identifier, stringProperty(action, "encodingFormat"))
+	if err != nil {
+		return returnActionError(c, action, "Failed to resolve storage location", err)
+	}
+	bucket, key := route.Bucket, route.Key
+
+	// Every version shares the key up to the version itself
+	dir, name := path.Split(key)
+	prefix := dir + strings.TrimSuffix(name, path.Ext(name)) + "-"
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(maxListPageSize),
+	}
+
+	store := storageFor(c)
+	limit := maxListKeys()
+	items := make([]map[string]interface{}, 0)
+	truncated := false
+	for {
+		page, err := store.ListObjectsV2(c.Request().Context(), input)
+		if err != nil {
+			logf(c, "Failed to list %s: %v", prefix, err)
+			return returnActionError(c, action, "Failed to list objects", err)
+		}
+		for _, obj := range page.Contents {
+			version, ok := versionOf(key, aws.ToString(obj.Key))
+			if !ok {
+				continue
+			}
+			if int64(len(items)) >= limit {
+				truncated = true
+				break
+			}
+			item := map[string]interface{}{
+				"version":     version,
+				"contentUrl":  fmt.Sprintf("s3://%s/%s", bucket, aws.ToString(obj.Key)),
+				"contentSize": aws.ToInt64(obj.Size),
+			}
+			if obj.LastModified != nil {
+				item["lastModified"] = obj.LastModified.UTC().Format(time.RFC3339)
+			}
+			items = append(items, item)
+		}
+		if truncated || !aws.ToBool(page.IsTruncated) || page.NextContinuationToken == nil {
+			break
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+
+	logf(c, "Listed %d versions of %s", len(items), key)
+
+	value := map[string]interface{}{
+		"identifier":      identifier,
+		"contentUrl":      fmt.Sprintf("s3://%s/%s", bucket, key),
+		"numberOfItems":   len(items),
+		"itemListElement": items,
+	}
+	if len(items) > 0 && !truncated {
+		value["latestVersion"] = items[len(items)-1]["version"]
+	}
+	if truncated {
+		value["truncated"] = true
+		value["maxKeys"] = limit
+	}
+
+	action.Result = &semantic.SemanticResult{
+		Type:  "ItemList",
+		Value: value,
+	}
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// versionRequested returns the version property of a retrieve, validated;
+// "" selects the latest version
+func versionRequested(action *semantic.SemanticAction) (string, error) {
+	version := stringProperty(action, "version")
+	if version == "" {
+		return "", nil
+	}
+	if err := parseVersion(version); err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return version, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+	"workflowstorageservice.evalgo.org/actions"
+)
+
+func TestVersionedKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"workflow-results/wf-1/config.json": "workflow-results/wf-1/config-20240101T120000.000Z.json",
+		"wf-1/data/archive.tar":             "wf-1/data/archive-20240101T120000.000Z.tar",
+		"wf-1/config":                       "wf-1/config-20240101T120000.000Z",
+	} {
+		got := versionedKey(key, "20240101T120000.000Z")
+		if got != want {
+			t.Errorf("versionedKey(%q) = %q, want %q", key, got, want)
+		}
+		if version, ok := versionOf(key, got); !ok || version != "20240101T120000.000Z" {
+			t.Errorf("versionOf(%q, %q) = %q, %t", key, got, version, ok)
+		}
+	}
+
+	for _, other := range []string{
+		"workflow-results/wf-1/config.json",
+		"workflow-results/wf-1/config-draft.json",
+		"workflow-results/wf-1/config-20240101T120000.000Z.csv",
+		"workflow-results/wf-1/config-2024-01-01.json",
+	} {
+		if version, ok := versionOf("workflow-results/wf-1/config.json", other); ok {
+			t.Errorf("versionOf(%q) = %q, want no version", other, version)
+		}
+	}
+
+	for key, want := range map[string]bool{
+		"workflow-results/wf-1/config-20240101T120000.000Z.json": true,
+		"wf-1/config-20240101T120000.000Z":                       true,
+		"workflow-results/wf-1/config.json":                      false,
+		"workflow-results/wf-1/config-2024-01-01.json":           false,
+		"workflow-results/wf-1/20240101T120000.000Z.json":        false,
+	} {
+		if got := isVersionKey(key); got != want {
+			t.Errorf("isVersionKey(%q) = %t, want %t", key, got, want)
+		}
+	}
+}
+
+func TestVersionedStoreAndRetrieve(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_VERSIONING", "true")
+
+	e := echo.New()
+	store := newFakeStorage()
+	run := func(b *actions.Builder, handler func(echo.Context, *semantic.SemanticAction) error) (*semantic.SemanticAction, error) {
+		t.Helper()
+		action, err := b.Action()
+		if err != nil {
+			t.Fatalf("Action() error = %v", err)
+		}
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		return action, handler(c, action)
+	}
+	storeText := func(text string) map[string]interface{} {
+		t.Helper()
+		action, err := run(actions.NewStoreAction().WithWorkflowID("wf-1").WithIdentifier("config").WithText(text), handleSemanticStoreImpl)
+		if err != nil {
+			t.Fatalf("Store error = %v", err)
+		}
+		return action.Result.Value.(map[string]interface{})
+	}
+
+	first := storeText(`{"version": 1}`)
+	second := storeText(`{"version": 2}`)
+	v1, _ := first["version"].(string)
+	v2, _ := second["version"].(string)
+	if v1 == "" || v2 <= v1 {
+		t.Fatalf("Versions = %q, %q, want increasing versions", v1, v2)
+	}
+	if second["contentUrl"] != "s3://px-semantic/"+versionedKey("workflow-results/wf-1/config.json", v2) || second["latestUrl"] != "s3://px-semantic/workflow-results/wf-1/config.json" {
+		t.Errorf("Store result = %v", second)
+	}
+	if got := string(store.objects["px-semantic/workflow-results/wf-1/config.json"].data); got != `{"version": 2}` {
+		t.Errorf("Latest = %s", got)
+	}
+
+	retrieve := func() *actions.Builder {
+		return actions.NewRetrieveAction().WithWorkflowID("wf-1").WithObjectIdentifier("config")
+	}
+	action, err := run(retrieve(), handleSemanticRetrieveImpl)
+	if err != nil || action.Result.Output != `{"version": 2}` {
+		t.Errorf("Retrieve latest = %v, %v", action.Result, err)
+	}
+	action, err = run(retrieve().WithProperty("version", v1), handleSemanticRetrieveImpl)
+	if err != nil || action.Result.Output != `{"version": 1}` {
+		t.Errorf("Retrieve version %s = %v, %v", v1, action.Result, err)
+	}
+	var httpErr *echo.HTTPError
+	if _, err := run(retrieve().WithProperty("version", "yesterday"), handleSemanticRetrieveImpl); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("Retrieve with an invalid version error = %v, want 400", err)
+	}
+
+	// Unrelated results sharing the name stem are not versions
+	store.objects["px-semantic/workflow-results/wf-1/config-draft.json"] = fakeObject{data: []byte(`{}`)}
+	action, err = run(actions.NewListAction().WithWorkflowID("wf-1").WithProperty("versionsOf", "config"), handleSemanticListImpl)
+	if err != nil {
+		t.Fatalf("List versions error = %v", err)
+	}
+	value := action.Result.Value.(map[string]interface{})
+	items := value["itemListElement"].([]map[string]interface{})
+	if len(items) != 2 || items[0]["version"] != v1 || items[1]["version"] != v2 || value["latestVersion"] != v2 {
+		t.Errorf("Versions = %v", value)
+	}
+
+	// Plain listings show the latest pointer, not the versions
+	action, err = run(actions.NewListAction().WithWorkflowID("wf-1").WithProperty("countAll", true), handleSemanticListImpl)
+	if err != nil {
+		t.Fatalf("List error = %v", err)
+	}
+	value = action.Result.Value.(map[string]interface{})
+	if value["numberOfItems"] != 2 || value["totalCount"] != 2 {
+		t.Errorf("Plain listing = %v, want config.json and config-draft.json", value)
+	}
+}
+
+func TestVersionedStore_KeepVersions(t *testing.T) {
+	resetStorageEnv(t)
+
+	e := echo.New()
+	store := newFakeStorage()
+	storeText := func(text string, keep interface{}) (map[string]interface{}, error) {
+		t.Helper()
+		action, err := actions.NewStoreAction().WithWorkflowID("wf-1").WithIdentifier("ring").WithText(text).WithProperty("keepVersions", keep).Action()
+		if err != nil {
+			t.Fatalf("Action() error = %v", err)
+		}
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		if err := handleSemanticStoreImpl(c, action); err != nil {
+			return nil, err
+		}
+		return action.Result.Value.(map[string]interface{}), nil
+	}
+	versions := func() []string {
+		t.Helper()
+		keys, err := versionKeys(context.Background(), store, "px-semantic", "workflow-results/wf-1/ring.json")
+		if err != nil {
+			t.Fatalf("versionKeys() error = %v", err)
+		}
+		return keys
+	}
+
+	// keepVersions versions the store even with WORKFLOW_STORAGE_VERSIONING off
+	var last map[string]interface{}
+	for i := 1; i <= 3; i++ {
+		value, err := storeText(fmt.Sprintf(`{"run": %d}`, i), 2)
+		if err != nil {
+			t.Fatalf("Store %d error = %v", i, err)
+		}
+		last = value
+	}
+	if last["versionCount"] != 2 || last["prunedVersions"] != 1 || last["retainedVersions"] != int64(0) || last["version"] == nil {
+		t.Errorf("Store result = %v, want 2 versions left after pruning 1", last)
+	}
+	kept := versions()
+	if len(kept) != 2 || kept[1] != versionedKey("workflow-results/wf-1/ring.json", last["version"].(string)) {
+		t.Errorf("Versions = %v, want the two newest", kept)
+	}
+	if got := string(store.objects["px-semantic/workflow-results/wf-1/ring.json"].data); got != `{"run": 3}` {
+		t.Errorf("Latest = %s", got)
+	}
+
+	// Retained versions are never pruned
+	oldest := store.objects["px-semantic/"+kept[0]]
+	oldest.metadata = map[string]string{metadataImmutable: "true"}
+	store.objects["px-semantic/"+kept[0]] = oldest
+	value, err := storeText(`{"run": 4}`, 1)
+	if err != nil {
+		t.Fatalf("Store error = %v", err)
+	}
+	if value["versionCount"] != 2 || value["prunedVersions"] != 1 || value["retainedVersions"] != int64(1) || versions()[0] != kept[0] {
+		t.Errorf("Store result = %v, versions %v, want the immutable version kept", value, versions())
+	}
+
+	var httpErr *echo.HTTPError
+	if _, err := storeText(`{}`, 0); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("keepVersions 0 error = %v, want 400", err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"eve.evalgo.org/semantic"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+// workflowProbeID is the workflow ID used to check that a layout places the
+// workflow ID directly after the list prefix of all workflows. It has no
+// punctuation, so it is valid with any flat key separator.
+const workflowProbeID = "workflowid"
+
+// workflowsRoot returns the location whose next key segment is the workflow
+// ID, the prefix ListWorkflowsAction enumerates with workflowDelimiter
+func workflowsRoot(router Router, typ string) (Route, error) {
+	root, err := router.ListPrefix("", typ)
+	if err != nil {
+		return Route{}, err
+	}
+	probe, err := router.ListPrefix(workflowProbeID, typ)
+	if err != nil {
+		return Route{}, err
+	}
+	if probe.Bucket != root.Bucket || !strings.HasPrefix(probe.Key, root.Key+workflowProbeID) {
+		return Route{}, errWorkflowsNotListable
+	}
+	return root, nil
+}
+
+// workflowDelimiter returns the delimiter that ends the workflow ID in keys:
+// the flat key separator when the default router builds flat keys, "/"
+// otherwise
+func workflowDelimiter() string {
+	if flatKeysEnabled() && routerName() == "default" {
+		return keySeparator()
+	}
+	return "/"
+}
+
+// handleSemanticListWorkflowsImpl lists the distinct workflow IDs that have
+// stored results, one page at a time, using a delimited listing so each
+// workflow costs one entry however many results it holds. Optional
+// properties: type, maxKeys, continuationToken and countObjects, which
+// counts each listed workflow's results (capped at maxCountAllKeys per
+// workflow, numberOfItemsIsExact is false when the cap is hit).
+func handleSemanticListWorkflowsImpl(c echo.Context, action *semantic.SemanticAction) error {
+	router, err := routerFor(tenantFor(c))
+	if err != nil {
+		return returnActionError(c, action, "Failed to resolve storage location", err)
+	}
+	root, err := workflowsRoot(router, stringProperty(action, "type"))
+	if errors.Is(err, errWorkflowsNotListable) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return returnActionError(c, action, "Failed to resolve storage location", err)
+	}
+	bucket, prefix := root.Bucket, root.Key
+
+	pageSize := listPageSize()
+	if maxKeys, ok := int64Property(action, "maxKeys"); ok && maxKeys > 0 {
+		pageSize = min(maxKeys, maxListKeys())
+	}
+
+	delimiter := workflowDelimiter()
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String(delimiter),
+	}
+	if token, ok := action.Properties["continuationToken"].(string); ok && token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+
+	// Common prefixes are paged like keys, so walk pages until enough
+	// workflows are collected
+	ctx := c.Request().Context()
+	store := storageFor(c)
+	countObjects := boolProperty(action, "countObjects")
+	items := make([]map[string]interface{}, 0, min(pageSize, maxListPageSize))
+	hasMore := false
+	var nextToken *string
+	for int64(len(items)) < pageSize {
+		input.MaxKeys = aws.Int32(int32(min(pageSize-int64(len(items)), maxListPageSize)))
+		page, err := store.ListObjectsV2(ctx, input)
+		if err != nil {
+			logf(c, "Failed to list workflows under %s: %v", prefix, err)
+			return returnActionError(c, action, "Failed to list workflows", err)
+		}
+
+		for _, common := range page.CommonPrefixes {
+			workflowPrefix := aws.ToString(common.Prefix)
+			item := map[string]interface{}{
+				"workflowId": strings.TrimSuffix(strings.TrimPrefix(workflowPrefix, prefix), delimiter),
+				"contentUrl": fmt.Sprintf("s3://%s/%s", bucket, workflowPrefix),
+			}
+			if countObjects {
+				count, exact, err := countKeys(ctx, store, bucket, workflowPrefix)
+				if err != nil {
+					logf(c, "Failed to count %s: %v", workflowPrefix, err)
+					return returnActionError(c, action, "Failed to count objects", err)
+				}
+				item["numberOfItems"] = count
+				item["numberOfItemsIsExact"] = exact
+			}
+			items = append(items, item)
+		}
+
+		hasMore = aws.ToBool(page.IsTruncated) && page.NextContinuationToken != nil
+		nextToken = page.NextContinuationToken
+		if !hasMore {
+			break
+		}
+		input.ContinuationToken = nextToken
+	}
+
+	value := map[string]interface{}{
+		"numberOfItems":   len(items),
+		"itemListElement": items,
+		"hasMore":         hasMore,
+	}
+	if hasMore {
+		value["nextContinuationToken"] = *nextToken
+	}
+
+	logf(c, "Listed %d workflows under %s", len(items), prefix)
+
+	action.Result = &semantic.SemanticResult{
+		Type:  "ItemList",
+		Value: value,
+	}
+
+	semantic.SetSuccessOnAction(action)
+	return respondAction(c, action)
+}
+
+// handleSemanticListWorkflows wraps the implementation to match ActionHandler signature
+func handleSemanticListWorkflows(c echo.Context, actionInterface interface{}) error {
+	action, ok := actionInterface.(*semantic.SemanticAction)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid action type")
+	}
+	return handleSemanticListWorkflowsImpl(c, action)
+}
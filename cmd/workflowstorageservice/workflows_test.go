@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSemanticListWorkflows_PagesWorkflowIDs(t *testing.T) {
+	resetStorageEnv(t)
+
+	bucket := defaultBucket()
+	store := newFakeStorage()
+	for _, key := range []string{"wf-a/step-1.json", "wf-a/step-2.json", "wf-a/step-3.json", "wf-b/step-1.json", "wf-c/step-1.json"} {
+		store.objects[bucket+"/workflow-results/"+key] = fakeObject{data: []byte("{}")}
+	}
+
+	list := func(body string) *semantic.SemanticAction {
+		action, err := semantic.ParseSemanticAction([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseSemanticAction() error = %v", err)
+		}
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+		c.Set(storageContextKey, store)
+		if err := handleSemanticListWorkflowsImpl(c, action); err != nil {
+			t.Fatalf("handleSemanticListWorkflowsImpl() error = %v", err)
+		}
+		return action
+	}
+
+	value := list(`{"@type": "ListWorkflowsAction", "maxKeys": 2, "countObjects": true}`).Result.Value.(map[string]interface{})
+	items := value["itemListElement"].([]map[string]interface{})
+	if len(items) != 2 || items[0]["workflowId"] != "wf-a" || items[1]["workflowId"] != "wf-b" {
+		t.Fatalf("First page = %v, want wf-a and wf-b", items)
+	}
+	if items[0]["numberOfItems"] != 3 || items[0]["numberOfItemsIsExact"] != true {
+		t.Errorf("wf-a numberOfItems = %v, want 3", items[0]["numberOfItems"])
+	}
+	if value["hasMore"] != true {
+		t.Fatalf("hasMore = %v, want true", value["hasMore"])
+	}
+
+	value = list(`{"@type": "ListWorkflowsAction", "maxKeys": 2, "continuationToken": "` + value["nextContinuationToken"].(string) + `"}`).Result.Value.(map[string]interface{})
+	items = value["itemListElement"].([]map[string]interface{})
+	if len(items) != 1 || items[0]["workflowId"] != "wf-c" || value["hasMore"] != false {
+		t.Errorf("Second page = %v (hasMore %v), want only wf-c", items, value["hasMore"])
+	}
+	if _, counted := items[0]["numberOfItems"]; counted {
+		t.Error("numberOfItems should only be reported with countObjects")
+	}
+}
+
+func TestSemanticListWorkflows_RejectsShardedKeys(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_SHARD_KEYS", "true")
+
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "ListWorkflowsAction"}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+	c.Set(storageContextKey, newFakeStorage())
+
+	var httpErr *echo.HTTPError
+	if err := handleSemanticListWorkflowsImpl(c, action); !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("ListWorkflowsAction with sharded keys: error = %v, want 400", err)
+	}
+}
+
+func TestSemanticListWorkflows_FlatKeys(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_FLAT_KEYS", "true")
+
+	bucket := defaultBucket()
+	store := newFakeStorage()
+	for _, key := range []string{"wf-a__step-1.json", "wf-a__step-2.json", "wf-b__report__v2.json"} {
+		store.objects[bucket+"/workflow-results/"+key] = fakeObject{data: []byte("{}")}
+	}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "ListWorkflowsAction", "countObjects": true}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil), httptest.NewRecorder())
+	c.Set(storageContextKey, store)
+	if err := handleSemanticListWorkflowsImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticListWorkflowsImpl() error = %v", err)
+	}
+
+	items := action.Result.Value.(map[string]interface{})["itemListElement"].([]map[string]interface{})
+	if len(items) != 2 || items[0]["workflowId"] != "wf-a" || items[1]["workflowId"] != "wf-b" {
+		t.Fatalf("Workflows = %v, want wf-a and wf-b", items)
+	}
+	if items[0]["numberOfItems"] != 2 || items[1]["numberOfItems"] != 1 {
+		t.Errorf("Counts = %v, %v, want 2 and 1", items[0]["numberOfItems"], items[1]["numberOfItems"])
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// zipErrorsEntry lists the selected objects that could not be exported
+	zipErrorsEntry = "errors.json"
+
+	// defaultZipConcurrency is the number of objects a ZIP export fetches
+	// in parallel when WORKFLOW_STORAGE_ZIP_CONCURRENCY is not set
+	defaultZipConcurrency = 4
+
+	// maxZipConcurrency bounds WORKFLOW_STORAGE_ZIP_CONCURRENCY
+	maxZipConcurrency = 32
+
+	// maxZipBufferBytes is the largest object a ZIP export buffers in memory
+	// while it waits for its turn; larger objects are streamed
+	maxZipBufferBytes = 8 << 20
+)
+
+// acceptsZip reports whether the client asked for a ZIP export
+func acceptsZip(r *http.Request) bool {
+	return strings.Contains(r.Header.Get(echo.HeaderAccept), "application/zip")
+}
+
+// zipCompression selects how ZIP export entries are compressed
+type zipCompression string
+
+const (
+	// zipCompressionAuto stores already-compressed content and deflates the rest
+	zipCompressionAuto    zipCompression = "auto"
+	zipCompressionStore   zipCompression = "store"
+	zipCompressionDeflate zipCompression = "deflate"
+)
+
+// parseZipCompression parses the compression query parameter of a ZIP
+// export; an empty value selects auto
+func parseZipCompression(value string) (zipCompression, error) {
+	switch compression := zipCompression(strings.ToLower(strings.TrimSpace(value))); compression {
+	case "":
+		return zipCompressionAuto, nil
+	case zipCompressionAuto, zipCompressionStore, zipCompressionDeflate:
+		return compression, nil
+	}
+	return "", fmt.Errorf("unsupported compression %q (use auto, store or deflate)", value)
+}
+
+// method returns the archive/zip method for an entry with contentType
+func (z zipCompression) method(contentType string) uint16 {
+	switch {
+	case z == zipCompressionStore:
+		return zip.Store
+	case z == zipCompressionAuto && precompressed(contentType):
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// precompressed reports whether content of contentType is already compressed,
+// so deflating it again would cost CPU without shrinking it
+func precompressed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "image/svg+xml", "image/bmp", "audio/wav", "audio/x-wav":
+		return false
+	case "application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2",
+		"application/x-xz", "application/zstd", "application/x-7z-compressed",
+		"application/vnd.rar", "application/pdf":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "image/") || strings.HasPrefix(mediaType, "video/") ||
+		strings.HasPrefix(mediaType, "audio/")
+}
+
+// zipExportError is one entry of errors.json
+type zipExportError struct {
+	ContentURL string `json:"contentUrl"`
+	Error      string `json:"error"`
+}
+
+// streamBatchZip writes the selected objects into a single ZIP download.
+// Objects are fetched concurrently (see zipConcurrency) while entries are
+// written one at a time in the given order, so the archive layout is
+// deterministic. Entries are named after the original filename or the key's
+// last segment, made unique with a numeric suffix, and compressed as
+// selected by compression. Objects that cannot be fetched are skipped and
+// listed in errors.json at the end of the archive.
+func streamBatchZip(c echo.Context, filename string, compression zipCompression, contentURLs []string, objects []Route) error {
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "application/zip")
+	response.Header().Set(echo.HeaderContentDisposition, contentDisposition(filename))
+	response.WriteHeader(http.StatusOK)
+
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+	prefetch := startZipPrefetch(ctx, storageFor(c), objects, zipConcurrency())
+
+	zw := zip.NewWriter(response)
+	names := make(map[string]bool)
+	var failures []zipExportError
+	for i, object := range objects {
+		obj := prefetch.next(i)
+		if obj.message != "" {
+			prefetch.release()
+			failures = append(failures, zipExportError{ContentURL: contentURLs[i], Error: obj.message})
+			continue
+		}
+		err := writeZipEntry(zw, names, compression, object.Key, obj)
+		prefetch.release()
+		if err != nil {
+			// Headers are already sent; the truncated archive signals the failure
+			logf(c, "Failed to stream %s into ZIP export: %v", object.Key, err)
+			cancel()
+			go prefetch.discard(i + 1)
+			return nil
+		}
+		accessLog.record(c, object.Bucket, object.Key)
+		response.Flush()
+	}
+
+	if len(failures) > 0 {
+		entry, err := zw.Create(zipErrorsEntry)
+		if err == nil {
+			err = json.NewEncoder(entry).Encode(failures)
+		}
+		if err != nil {
+			logf(c, "Failed to write %s: %v", zipErrorsEntry, err)
+			return nil
+		}
+	}
+	if err := zw.Close(); err != nil {
+		logf(c, "Failed to close ZIP export: %v", err)
+	}
+
+	logf(c, "Streamed %d workflow results as a ZIP export (%d failed)", len(objects)-len(failures), len(failures))
+	return nil
+}
+
+// zipConcurrency returns WORKFLOW_STORAGE_ZIP_CONCURRENCY or the default, the
+// number of objects a ZIP export fetches ahead of the entry being written
+func zipConcurrency() int {
+	concurrency, err := strconv.Atoi(os.Getenv("WORKFLOW_STORAGE_ZIP_CONCURRENCY"))
+	if err != nil || concurrency <= 0 {
+		return defaultZipConcurrency
+	}
+	return min(concurrency, maxZipConcurrency)
+}
+
+// zipObject is an object fetched for a ZIP export. Objects up to
+// maxZipBufferBytes are read into memory by the fetching worker; larger ones
+// keep their S3 body open and are streamed when their entry is written.
+// message is set instead when the object could not be fetched.
+type zipObject struct {
+	name        string
+	contentType string
+	modified    time.Time
+	size        int64
+	body        io.ReadCloser
+	message     string
+}
+
+// zipPrefetcher fetches the objects of a ZIP export ahead of the writer. A
+// slot is taken before an object is fetched and given back once its entry is
+// written, so at most cap(slots) objects (and their buffers) are in flight.
+type zipPrefetcher struct {
+	slots   chan struct{}
+	results []chan zipObject
+}
+
+// startZipPrefetch starts fetching objects in order with up to concurrency
+// objects in flight
+func startZipPrefetch(ctx context.Context, store Storage, objects []Route, concurrency int) *zipPrefetcher {
+	p := &zipPrefetcher{
+		slots:   make(chan struct{}, concurrency),
+		results: make([]chan zipObject, len(objects)),
+	}
+	for i := range p.results {
+		p.results[i] = make(chan zipObject, 1)
+	}
+
+	go func() {
+		for i, object := range objects {
+			select {
+			case p.slots <- struct{}{}:
+			case <-ctx.Done():
+				for _, result := range p.results[i:] {
+					result <- zipObject{message: "export cancelled"}
+				}
+				return
+			}
+			go func(i int, object Route) {
+				p.results[i] <- fetchZipObject(ctx, store, object.Bucket, object.Key)
+			}(i, object)
+		}
+	}()
+	return p
+}
+
+// next waits for the object at index i
+func (p *zipPrefetcher) next(i int) zipObject {
+	return <-p.results[i]
+}
+
+// release frees the slot of an object whose entry has been written
+func (p *zipPrefetcher) release() {
+	<-p.slots
+}
+
+// discard closes the objects from index i on after the export was aborted.
+// The context must be cancelled first, which makes the remaining objects
+// arrive as failures instead of waiting for free slots.
+func (p *zipPrefetcher) discard(i int) {
+	for _, result := range p.results[i:] {
+		if obj := <-result; obj.body != nil {
+			obj.body.Close()
+		}
+	}
+}
+
+// fetchZipObject fetches one object for a ZIP export. Failures are reported
+// in message for errors.json.
+func fetchZipObject(ctx context.Context, store Storage, bucket, key string) zipObject {
+	result, err := store.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isCredentialError(err) {
+			return zipObject{message: credentialErrorMessage}
+		}
+		return zipObject{message: "data not found"}
+	}
+
+	obj := zipObject{
+		name:        filenameFromMetadata(result.Metadata),
+		contentType: aws.ToString(result.ContentType),
+		modified:    time.Now(),
+		size:        aws.ToInt64(result.ContentLength),
+		body:        result.Body,
+	}
+	if obj.name == "" {
+		obj.name = path.Base(key)
+	}
+	if result.LastModified != nil {
+		obj.modified = *result.LastModified
+	}
+
+	encoded := isEncoded(result.Metadata)
+	if !encoded && (result.ContentLength == nil || aws.ToInt64(result.ContentLength) > maxZipBufferBytes) {
+		// Streamed by the writer; the open body holds no object buffer
+		return obj
+	}
+
+	// AES-GCM must authenticate the whole ciphertext before releasing
+	// plaintext, compressed objects are decoded whole, and small objects are
+	// buffered so the connection is freed
+	defer func() {
+		if err := result.Body.Close(); err != nil {
+			log.Printf("Failed to close S3 response body: %v", err)
+		}
+	}()
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return zipObject{message: "failed to read data"}
+	}
+	if encoded {
+		if data, err = decodePayload(data, result.Metadata); err != nil {
+			return zipObject{message: "failed to decode data"}
+		}
+	}
+	obj.size = int64(len(data))
+	obj.body = io.NopCloser(bytes.NewReader(data))
+	return obj
+}
+
+// writeZipEntry copies a fetched object into the archive and closes its
+// body. An error means the archive itself can no longer be written.
+func writeZipEntry(zw *zip.Writer, names map[string]bool, compression zipCompression, key string, obj zipObject) error {
+	defer func() {
+		if err := obj.body.Close(); err != nil {
+			log.Printf("Failed to close S3 response body of %s: %v", key, err)
+		}
+	}()
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     uniqueZipName(names, obj.name),
+		Method:   compression.method(obj.contentType),
+		Modified: obj.modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, obj.body)
+	return err
+}
+
+// uniqueZipName returns name, or name with a -2, -3, ... suffix before the
+// extension when an earlier entry already uses it
+func uniqueZipName(names map[string]bool, name string) string {
+	unique := name
+	ext := path.Ext(name)
+	for n := 2; names[unique] || unique == zipErrorsEntry; n++ {
+		unique = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	names[unique] = true
+	return unique
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"eve.evalgo.org/semantic"
+	"github.com/labstack/echo/v4"
+)
+
+func TestUniqueZipName(t *testing.T) {
+	names := make(map[string]bool)
+	for _, tt := range []struct{ name, want string }{
+		{"step-1.json", "step-1.json"},
+		{"step-1.json", "step-1-2.json"},
+		{"step-1.json", "step-1-3.json"},
+		{"README", "README"},
+		{"errors.json", "errors-2.json"},
+	} {
+		if got := uniqueZipName(names, tt.name); got != tt.want {
+			t.Errorf("uniqueZipName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestZipCompression(t *testing.T) {
+	tests := []struct {
+		compression zipCompression
+		contentType string
+		want        uint16
+	}{
+		{zipCompressionAuto, "application/json", zip.Deflate},
+		{zipCompressionAuto, "image/png", zip.Store},
+		{zipCompressionAuto, "application/gzip", zip.Store},
+		{zipCompressionAuto, "image/svg+xml; charset=utf-8", zip.Deflate},
+		{zipCompressionStore, "application/json", zip.Store},
+		{zipCompressionDeflate, "image/png", zip.Deflate},
+	}
+	for _, tt := range tests {
+		if got := tt.compression.method(tt.contentType); got != tt.want {
+			t.Errorf("%s.method(%q) = %d, want %d", tt.compression, tt.contentType, got, tt.want)
+		}
+	}
+
+	if got, err := parseZipCompression(""); err != nil || got != zipCompressionAuto {
+		t.Errorf("parseZipCompression(\"\") = %q, %v, want auto", got, err)
+	}
+	if _, err := parseZipCompression("brotli"); err == nil {
+		t.Error("parseZipCompression(\"brotli\") should fail")
+	}
+}
+
+func TestBatchRetrieve_ZipExport(t *testing.T) {
+	resetStorageEnv(t)
+
+	store := newFakeStorage()
+	store.objects[defaultBucket()+"/workflow-results/wf-1/step-1.json"] = fakeObject{data: []byte(`{"step": 1}`), contentType: "application/json"}
+	store.objects[defaultBucket()+"/workflow-results/wf-1/chart.json"] = fakeObject{data: []byte("\x89PNG"), contentType: "image/png"}
+	store.objects[defaultBucket()+"/workflow-results/wf-1/report.json"] = fakeObject{
+		data:        []byte("a,b\n"),
+		contentType: "text/csv",
+		metadata:    withFilename(nil, "Q3 report.csv"),
+	}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "BatchRetrieveAction", "workflowId": "wf-1",
+		"identifiers": ["step-1", "chart", "report", "missing"], "filename": "selected.zip"}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	req.Header.Set(echo.HeaderAccept, "application/zip")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set(storageContextKey, store)
+	if err := handleSemanticBatchRetrieveImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticBatchRetrieveImpl() error = %v", err)
+	}
+
+	if got := rec.Header().Get(echo.HeaderContentDisposition); !strings.Contains(got, "selected.zip") {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("Invalid ZIP response: %v", err)
+	}
+
+	entries := make(map[string]string)
+	for _, file := range archive.File {
+		if file.Name == "chart.json" && file.Method != zip.Store {
+			t.Errorf("Precompressed entry %s uses method %d, want Store", file.Name, file.Method)
+		}
+		r, err := file.Open()
+		if err != nil {
+			t.Fatalf("Open(%s) error = %v", file.Name, err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		entries[file.Name] = string(data)
+	}
+	if entries["step-1.json"] != `{"step": 1}` || entries["Q3 report.csv"] != "a,b\n" {
+		t.Errorf("ZIP entries = %v", entries)
+	}
+	if !strings.Contains(entries[zipErrorsEntry], "workflow-results/wf-1/missing.json") {
+		t.Errorf("errors.json = %q, want the missing object", entries[zipErrorsEntry])
+	}
+}
+
+func TestBatchRetrieve_ZipExportKeepsOrder(t *testing.T) {
+	resetStorageEnv(t)
+	t.Setenv("WORKFLOW_STORAGE_ZIP_CONCURRENCY", "3")
+
+	store := newFakeStorage()
+	var identifiers []string
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("step-%02d", 20-i)
+		identifiers = append(identifiers, `"`+id+`"`)
+		store.objects[defaultBucket()+"/workflow-results/wf-1/"+id+".json"] = fakeObject{data: []byte(`{"id": "` + id + `"}`), contentType: "application/json"}
+	}
+
+	action, err := semantic.ParseSemanticAction([]byte(`{"@type": "BatchRetrieveAction", "workflowId": "wf-1",
+		"identifiers": [` + strings.Join(identifiers, ", ") + `]}`))
+	if err != nil {
+		t.Fatalf("ParseSemanticAction() error = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/semantic/action", nil)
+	req.Header.Set(echo.HeaderAccept, "application/zip")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set(storageContextKey, store)
+	if err := handleSemanticBatchRetrieveImpl(c, action); err != nil {
+		t.Fatalf("handleSemanticBatchRetrieveImpl() error = %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("Invalid ZIP response: %v", err)
+	}
+	if len(archive.File) != len(identifiers) {
+		t.Fatalf("ZIP has %d entries, want %d", len(archive.File), len(identifiers))
+	}
+	for i, file := range archive.File {
+		if want := strings.Trim(identifiers[i], `"`) + ".json"; file.Name != want {
+			t.Errorf("Entry %d = %s, want %s", i, file.Name, want)
+		}
+	}
+}
+
+func TestZipPrefetch_BoundsObjectsInFlight(t *testing.T) {
+	store := newFakeStorage()
+	var objects []Route
+	for _, key := range []string{"a.json", "b.json", "c.json"} {
+		store.objects["bucket/"+key] = fakeObject{data: []byte("{}")}
+		objects = append(objects, Route{Bucket: "bucket", Key: key})
+	}
+
+	prefetch := startZipPrefetch(context.Background(), store, objects, 2)
+	prefetch.next(0)
+	prefetch.next(1)
+	select {
+	case <-prefetch.results[2]:
+		t.Fatal("Third object fetched while two are still in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	prefetch.release()
+	if obj := prefetch.next(2); obj.message != "" || obj.name != "c.json" {
+		t.Errorf("next(2) = %+v", obj)
+	}
+}
+
+func TestZipConcurrency(t *testing.T) {
+	for value, want := range map[string]int{"": defaultZipConcurrency, "8": 8, "0": defaultZipConcurrency, "1000": maxZipConcurrency, "x": defaultZipConcurrency} {
+		t.Setenv("WORKFLOW_STORAGE_ZIP_CONCURRENCY", value)
+		if got := zipConcurrency(); got != want {
+			t.Errorf("zipConcurrency() with %q = %d, want %d", value, got, want)
+		}
+	}
+}